@@ -111,7 +111,7 @@ func NewKeyedTransactorWithChainID(key *ecdsa.PrivateKey, chainID *big.Int) (*Tr
 		return nil, ErrNoChainID
 	}
 	//types.Signer, common.Address, *types.Transaction
-	eip155Signer := types.NewEIP155Signer(chainID)
+	latestSigner := types.LatestSignerForChainID(chainID)
 	return &TransactOpts{
 		From: keyAddr,
 		Signer: func(signer types.Signer, address common.Address, transaction *types.Transaction) (*types.Transaction, error) {
@@ -119,7 +119,7 @@ func NewKeyedTransactorWithChainID(key *ecdsa.PrivateKey, chainID *big.Int) (*Tr
 				return nil, ErrNotAuthorized
 			}
 			if signer == nil {
-				signer = eip155Signer
+				signer = latestSigner
 			}
 			signature, err := crypto.Sign(signer.Hash(transaction).Bytes(), key)
 			if err != nil {
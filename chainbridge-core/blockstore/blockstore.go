@@ -10,6 +10,7 @@ import (
 	"math/big"
 
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/config"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
@@ -41,6 +42,28 @@ func StoreBlock(db KeyValueWriter, block *big.Int, chainID uint64) error {
 	return nil
 }
 
+// StoreBlockHash stores the last processed block with its hash, for the
+// listener to detect a reorganisation of the blocks it processed.
+func StoreBlockHash(db KeyValueWriter, block *big.Int, hash common.Hash, chainID uint64) error {
+	if err := StoreBlock(db, block, chainID); err != nil {
+		return err
+	}
+	return db.SetByKey([]byte(fmt.Sprintf("chain:%d:blockhash", chainID)), hash.Bytes())
+}
+
+// GetLastStoredBlockHash returns the hash stored with the last processed
+// block, or the zero hash if none was stored.
+func GetLastStoredBlockHash(db KeyValueReader, chainID uint64) (common.Hash, error) {
+	v, err := db.GetByKey([]byte(fmt.Sprintf("chain:%d:blockhash", chainID)))
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return common.Hash{}, nil
+		}
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(v), nil
+}
+
 func GetLastStoredBlock(db KeyValueReader, chainID uint64) (*big.Int, error) {
 	key := bytes.Buffer{}
 	keyS := fmt.Sprintf("chain:%d:block", chainID)
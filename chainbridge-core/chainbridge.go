@@ -2,6 +2,7 @@ package chainbridge_core
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -650,45 +651,73 @@ func initRelayer(engine *pbft.Pbft, stack *node.Node, accountPath, accountPasswo
 	if MsgReleayer != nil {
 		return nil
 	}
+	if engine.GetBlockChain().Config().ChainID == nil {
+		return errors.New("escChainID is nil")
+	}
+	escChainID = engine.GetBlockChain().Config().ChainID.Uint64()
 	cfg, err := config.GetConfig(config.DefaultConfigDir)
 	if err != nil {
 		log.Info("engine.GetBlockChain().Config().BridgeContractAddr", "address", engine.GetBlockChain().Config().BridgeContractAddr)
 		err = createSelfChain(engine, stack)
 		return err
 	}
+	if cfg.Chain(escChainID) == nil {
+		bridgelog.Info("ESC chain not configured, relaying from the local node", "chainid", escChainID)
+		cfg.Chains = append([]config.GeneralChainConfig{*selfChainConfig(engine, stack)}, cfg.Chains...)
+	}
 	db, err := lvldb.NewLvlDB(config.BlockstoreFlagName)
 	if err != nil {
 		return err
 	}
-	escChainID = engine.GetBlockChain().Config().ChainID.Uint64()
-	count := len(cfg.Chains)
-	chains := make([]relayer.RelayedChain, count)
-	for i := 0; i < count; i++ {
-		layer, errMsg := createChain(&cfg.Chains[i], db, engine, accountPath, accountPassword)
+	stores := map[string]blockstore.KeyValueReaderWriter{"": db}
+	chains := make([]relayer.RelayedChain, 0, len(cfg.Chains))
+	for i := range cfg.Chains {
+		chainConfig := &cfg.Chains[i]
+		var layer *evm.EVMChain
+		store, errMsg := openBlockstore(stores, chainConfig.BlockstorePath)
+		if errMsg == nil {
+			layer, errMsg = createChain(chainConfig, store, engine, accountPath, accountPassword)
+		}
 		if errMsg != nil {
-			return errors.New(fmt.Sprintf("evm chain is create error:%s, chainid:%d", errMsg.Error(), cfg.Chains[i].Id))
+			if chainConfig.Id == escChainID {
+				return errors.New(fmt.Sprintf("evm chain is create error:%s, chainid:%d", errMsg.Error(), chainConfig.Id))
+			}
+			// A sister chain misconfigured or unreachable must not stop
+			// the bridge of the ESC chain itself
+			bridgelog.Error("evm chain is create error, not relaying to it", "error", errMsg, "chainid", chainConfig.Id, "name", chainConfig.Name)
+			continue
 		}
-		chains[i] = layer
+		chains = append(chains, layer)
 		if escChainID == layer.ChainID() {
 			engine.GetBlockChain().Config().BridgeContractAddr = layer.GetBridgeContract()
+		} else {
+			bridgelog.Info("relaying arbiter list to sister chain", "chainid", chainConfig.Id, "name", chainConfig.Name, "endpoint", chainConfig.Endpoint)
 		}
 	}
 	MsgReleayer = relayer.NewRelayer(chains, escChainID)
 	return nil
 }
 
+// openBlockstore returns the blockstore at the path, opening it once for all
+// the chains sharing it. An empty path is the default blockstore.
+func openBlockstore(stores map[string]blockstore.KeyValueReaderWriter, path string) (blockstore.KeyValueReaderWriter, error) {
+	if store, ok := stores[path]; ok {
+		return store, nil
+	}
+	db, err := lvldb.NewLvlDB(path)
+	if err != nil {
+		return nil, err
+	}
+	stores[path] = db
+	return db, nil
+}
+
 func createSelfChain(engine *pbft.Pbft, stack *node.Node) error {
 	if engine.GetBlockChain().Config().ChainID == nil {
 		return errors.New("escChainID is nil")
 	}
 	escChainID = engine.GetBlockChain().Config().ChainID.Uint64()
-	rpc := fmt.Sprintf("http://localhost:%d", stack.Config().HTTPPort)
-	generalConfig := config.GeneralChainConfig{
-		Name:     "ESC",
-		Id:       escChainID,
-		Endpoint: rpc,
-	}
-	layer, errMsg := createChain(&generalConfig, nil, engine, "", "")
+	layer, errMsg := createChain(selfChainConfig(engine, stack), nil, engine, "", "")
 	if errMsg != nil {
 		return errors.New(fmt.Sprintf("evm createSelfChain is error:%s, chainid:%d", errMsg.Error(), escChainID))
 	}
@@ -698,6 +727,22 @@ func createSelfChain(engine *pbft.Pbft, stack *node.Node) error {
 	return nil
 }
 
+// selfChainConfig returns the config of the ESC chain served by this node,
+// reached over its HTTP endpoint.
+func selfChainConfig(engine *pbft.Pbft, stack *node.Node) *config.GeneralChainConfig {
+	rpc := fmt.Sprintf("http://localhost:%d", stack.Config().HTTPPort)
+	generalConfig := &config.GeneralChainConfig{
+		Name:     "ESC",
+		Id:       escChainID,
+		Endpoint: rpc,
+	}
+	generalConfig.Opts.Bridge = engine.GetBlockChain().Config().BridgeContractAddr
+	if opts, err := generalConfig.Opts.ParseConfig(); err == nil {
+		generalConfig.Opts = *opts
+	}
+	return generalConfig
+}
+
 func Stop(msg string) {
 	if isRequireArbiter {
 		errChn <- fmt.Errorf(msg)
@@ -714,6 +759,21 @@ func createChain(generalConfig *config.GeneralChainConfig, db blockstore.KeyValu
 	if err != nil {
 		return nil, err
 	}
+	if generalConfig.Id != escChainID {
+		// Sister chains are written by the relayer account of their own
+		if generalConfig.Kp == nil {
+			return nil, errors.New("relayer account is not loaded")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		id, err := ethClient.ChainID(ctx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("query chain id of endpoint %s: %v", generalConfig.Endpoint, err)
+		}
+		if id.Uint64() != generalConfig.Id {
+			return nil, fmt.Errorf("endpoint %s serves chain %d", generalConfig.Endpoint, id)
+		}
+	}
 
 	var evmVoter *voter.EVMVoter
 	if engine.GetBridgeArbiters() != nil {
@@ -142,22 +142,31 @@ func (a *ArbiterManager) Clear() {
 
 func (a *ArbiterManager) HashArbiterList(hashSalt *big.Int) (common.Hash, error) {
 	arbiters := a.GetArbiterList()
-	data := make([]byte, 0)
+	addresses := make([]common.Address, 0, len(arbiters))
 	for _, arbiter := range arbiters {
 		escssaPUb, err := crypto.DecompressPubkey(arbiter)
 		if err != nil {
 			return common.Hash{}, err
 		}
-		addr := crypto.PubkeyToAddress(*escssaPUb)
-		data = append(data, addr.Bytes()...)
+		addresses = append(addresses, crypto.PubkeyToAddress(*escssaPUb))
+	}
+	return HashArbiters(addresses, a.nextTotalCount, hashSalt), nil
+}
+
+// HashArbiters returns the hash the current arbiters sign to set the arbiter
+// list and the total count on the bridge contract.
+func HashArbiters(arbiters []common.Address, totalCount int, hashSalt *big.Int) common.Hash {
+	data := make([]byte, 0)
+	for _, arbiter := range arbiters {
+		data = append(data, arbiter.Bytes()...)
 	}
-	total := new(big.Int).SetUint64(uint64(a.nextTotalCount))
+	total := new(big.Int).SetUint64(uint64(totalCount))
 	totalBytes := common.LeftPadBytes(total.Bytes(), 32)
 	data = append(data, totalBytes...)
 
 	saltBytes := common.LeftPadBytes(hashSalt.Bytes(), 32)
 	data = append(data, saltBytes...)
-	return crypto.Keccak256Hash(data), nil
+	return crypto.Keccak256Hash(data)
 }
 
 func (a *ArbiterManager) AddSignature(pid peer.PID, signature []byte) error {
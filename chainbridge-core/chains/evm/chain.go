@@ -21,7 +21,7 @@ import (
 )
 
 type EventListener interface {
-	ListenToEvents(startBlock *big.Int, chainID uint64, kvrw blockstore.KeyValueWriter, errChn chan<- error) <-chan *relayer.SetArbiterListMsg
+	ListenToEvents(startBlock *big.Int, chainID uint64, kvrw blockstore.KeyValueReaderWriter, stop <-chan struct{}, errChn chan<- error) <-chan *relayer.SetArbiterListMsg
 }
 
 type ProposalVoter interface {
@@ -160,7 +160,7 @@ func (c *EVMChain) PollEvents(sysErr chan<- error, stop <-chan struct{}, eventsC
 		sysErr <- fmt.Errorf("error %w on getting last stored block", err)
 		return
 	}
-	ech := c.listener.ListenToEvents(block, c.chainID, c.kvdb, sysErr)
+	ech := c.listener.ListenToEvents(block, c.chainID, c.kvdb, stop, sysErr)
 	for {
 		select {
 		case newEvent := <-ech:
@@ -8,6 +8,7 @@ import (
 	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"sync"
 	"time"
@@ -70,6 +71,9 @@ func (c *EVMClient) Configurate(generalConfig *config.GeneralChainConfig, accoun
 	kp, err := keystore.KeypairFromAddress(keystore.EthChain, accountPath, []byte(password), generalConfig.Insecure)
 	if err == nil {
 		krp := kp.(*secp256k1.Keypair)
+		if generalConfig.From != "" && common.HexToAddress(generalConfig.From) != krp.CommonAddress() {
+			return fmt.Errorf("keystore account %s is not the configured account %s", krp.Address(), generalConfig.From)
+		}
 		c.config.Kp = krp
 	}
 	rpcClient, err := rpc.DialContext(context.TODO(), generalConfig.Endpoint)
@@ -135,6 +139,15 @@ func (c *EVMClient) CurrentBlock() (*types.Block, error) {
 	return c.Client.BlockByNumber(context.Background(), nil)
 }
 
+// BlockHash returns the hash of the canonical block at the number.
+func (c *EVMClient) BlockHash(number *big.Int) (common.Hash, error) {
+	header, err := c.Client.HeaderByNumber(context.Background(), number)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return header.Hash(), nil
+}
+
 func (c *EVMClient) Engine() engine.ESCEngine {
 	return c.engine
 }
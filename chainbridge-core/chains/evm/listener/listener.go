@@ -3,11 +3,11 @@ package listener
 import (
 	"context"
 	"fmt"
-	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/blockstore"
-	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/bridgelog"
 	"math/big"
 	"time"
 
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/blockstore"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/bridgelog"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/config"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/relayer"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
@@ -16,6 +16,18 @@ import (
 var BlockDelay = big.NewInt(6)
 var BlockRetryInterval = time.Second * 5
 
+// MaxLogRetries is the number of consecutive failed single block queries
+// after which the listener gives up.
+var MaxLogRetries = 60
+
+// maxCheckpoints is the number of processed ranges remembered to find the
+// fork point of a reorganisation.
+const maxCheckpoints = 128
+
+// ReorgRewind is the number of blocks replayed when a reorganisation goes
+// deeper than the remembered ranges, like one happening during downtime.
+var ReorgRewind = big.NewInt(256)
+
 type SetArbitersEvent struct {
 	AddressList  []common.Address
 	AddressCount [32]byte
@@ -24,14 +36,25 @@ type SetArbitersEvent struct {
 
 type ChainClient interface {
 	LatestBlock() (*big.Int, error)
+	BlockHash(number *big.Int) (common.Hash, error)
 	FetchUpdateArbitersLogs(ctx context.Context, contractAddress common.Address, startBlock *big.Int, endBlock *big.Int) ([]*relayer.SetArbiterListMsg, error)
 	CallContract(ctx context.Context, callArgs map[string]interface{}, blockNumber *big.Int) ([]byte, error)
 }
 
+// checkpoint is the last block of a processed range.
+type checkpoint struct {
+	number *big.Int
+	hash   common.Hash
+}
+
 type EVMListener struct {
 	chainReader   ChainClient
 	bridgeAddress common.Address
 	opsConfig     *config.OpsConfig
+
+	batchSize   uint64       // blocks queried at once, shrunk when queries fail
+	failures    int          // consecutive failed queries of a single block
+	checkpoints []checkpoint // processed ranges, oldest first
 }
 
 func NewEVMListener(chainReader ChainClient, opsConfig *config.OpsConfig) *EVMListener {
@@ -40,60 +63,167 @@ func NewEVMListener(chainReader ChainClient, opsConfig *config.OpsConfig) *EVMLi
 	if opsConfig.BlockConfirmations > 0 {
 		BlockDelay = big.NewInt(opsConfig.BlockConfirmations)
 	}
-
+	listener.batchSize = listener.maxBatchSize()
 	return listener
 }
 
+func (l *EVMListener) maxBatchSize() uint64 {
+	if l.opsConfig.MaxBlockRange > 0 {
+		return l.opsConfig.MaxBlockRange
+	}
+	return config.DefaultMaxBlockRange
+}
+
+// ListenToEvents queries the bridge logs from startBlock on, in ranges of up
+// to MaxBlockRange blocks lagging BlockDelay blocks behind the head, until
+// stop is closed. The last block of every range is stored with its hash; a
+// block found replaced later makes the listener replay from the fork point.
 func (l *EVMListener) ListenToEvents(startBlock *big.Int, chainID uint64,
-	kvrw blockstore.KeyValueWriter,
+	kvrw blockstore.KeyValueReaderWriter, stop <-chan struct{},
 	errChn chan<- error) <-chan *relayer.SetArbiterListMsg {
 	ch := make(chan *relayer.SetArbiterListMsg)
+	startBlock = new(big.Int).Set(startBlock)
+	l.loadCheckpoint(kvrw, startBlock, chainID)
 	go func() {
 		for {
 			select {
+			case <-stop:
+				bridgelog.Info("Listener stopped", "chainId", chainID, "block", startBlock.String())
+				return
 			default:
-				head, err := l.chainReader.LatestBlock()
-				if err != nil {
-					time.Sleep(BlockRetryInterval)
-					continue
-				}
-				// Sleep if the difference is less than BlockDelay; (latest - current) < BlockDelay
-				if big.NewInt(0).Sub(head, startBlock).Cmp(BlockDelay) == -1 {
-					time.Sleep(BlockRetryInterval)
-					continue
-				}
-				err = l.fetchUpdateArbitersMsg(startBlock, chainID, ch)
-				if err != nil {
+			}
+			head, err := l.chainReader.LatestBlock()
+			if err != nil {
+				l.sleep(stop)
+				continue
+			}
+			if rewind, err := l.checkReorg(); err != nil {
+				bridgelog.Warn("Failed to check the processed blocks", "chainId", chainID, "err", err)
+				l.sleep(stop)
+				continue
+			} else if rewind != nil && rewind.Cmp(startBlock) < 0 {
+				bridgelog.Warn("Chain reorganisation detected, replaying logs", "chainId", chainID, "from", rewind.String(), "to", startBlock.String())
+				startBlock.Set(rewind)
+			}
+			// Sleep if the difference is less than BlockDelay; (latest - current) < BlockDelay
+			safeHead := new(big.Int).Sub(head, BlockDelay)
+			if safeHead.Cmp(startBlock) < 0 {
+				l.sleep(stop)
+				continue
+			}
+			endBlock := new(big.Int).Add(startBlock, new(big.Int).SetUint64(l.batchSize-1))
+			if endBlock.Cmp(safeHead) > 0 {
+				endBlock = safeHead
+			}
+			hash, err := l.chainReader.BlockHash(endBlock)
+			if err != nil {
+				l.sleep(stop)
+				continue
+			}
+			logs, err := l.chainReader.FetchUpdateArbitersLogs(context.Background(), l.bridgeAddress, startBlock, endBlock)
+			if err != nil {
+				if l.batchSize > 1 {
+					l.batchSize /= 2
+					bridgelog.Warn("Failed to query logs, shrinking the range", "chainId", chainID, "from", startBlock.String(), "to", endBlock.String(), "batch", l.batchSize, "err", err)
+				} else if l.failures++; l.failures >= MaxLogRetries {
 					errChn <- err
 					return
+				} else {
+					bridgelog.Warn("Failed to query logs, retrying", "chainId", chainID, "block", startBlock.String(), "failures", l.failures, "err", err)
 				}
-
-				if startBlock.Int64()%20 == 0 {
-					// Logging process every 20 bocks to exclude spam
-					bridgelog.Info("Queried block for deposit events", "block", startBlock.String(), "chainId", chainID)
+				l.sleep(stop)
+				continue
+			}
+			l.failures = 0
+			for _, eventLog := range logs {
+				select {
+				case ch <- eventLog:
+					bridgelog.Info(fmt.Sprintf("Resolved message %+v in blocks %s-%s", eventLog, startBlock.String(), endBlock.String()))
+				case <-stop:
+					bridgelog.Info("Listener stopped", "chainId", chainID, "block", startBlock.String())
+					return
 				}
-				//Write to block store. Not a critical operation, no need to retry
-				err = blockstore.StoreBlock(kvrw, startBlock, chainID)
-				if err != nil {
-					bridgelog.Error("Failed to write latest block to blockstore", "block", startBlock.String())
+			}
+			bridgelog.Info("Queried blocks for deposit events", "from", startBlock.String(), "to", endBlock.String(), "chainId", chainID)
+
+			l.addCheckpoint(endBlock, hash)
+			//Write to block store. Not a critical operation, no need to retry
+			err = blockstore.StoreBlockHash(kvrw, endBlock, hash, chainID)
+			if err != nil {
+				bridgelog.Error("Failed to write latest block to blockstore", "block", endBlock.String())
+			}
+			// Grow the range back after the queries succeed again
+			if max := l.maxBatchSize(); l.batchSize < max {
+				l.batchSize *= 2
+				if l.batchSize > max {
+					l.batchSize = max
 				}
-				// Goto next block
-				startBlock.Add(startBlock, big.NewInt(1))
 			}
+			// Goto next range
+			startBlock.Add(endBlock, big.NewInt(1))
 		}
 	}()
 	return ch
 }
 
-func (l *EVMListener) fetchUpdateArbitersMsg(startBlock *big.Int, chainID uint64, msg chan *relayer.SetArbiterListMsg) error {
-	bridgelog.Info("FetchUpdateArbitersLogs", "startBlock", startBlock.Uint64(), "chainID", chainID)
-	logs, err := l.chainReader.FetchUpdateArbitersLogs(context.Background(), l.bridgeAddress, startBlock, startBlock)
+func (l *EVMListener) sleep(stop <-chan struct{}) {
+	select {
+	case <-time.After(BlockRetryInterval):
+	case <-stop:
+	}
+}
+
+// loadCheckpoint remembers the block stored before a restart, if the listener
+// continues from it.
+func (l *EVMListener) loadCheckpoint(kvr blockstore.KeyValueReader, startBlock *big.Int, chainID uint64) {
+	number, err := blockstore.GetLastStoredBlock(kvr, chainID)
+	if err != nil || number.Sign() == 0 || number.Cmp(startBlock) > 0 {
+		return
+	}
+	hash, err := blockstore.GetLastStoredBlockHash(kvr, chainID)
+	if err != nil || hash == (common.Hash{}) {
+		return
+	}
+	l.addCheckpoint(number, hash)
+}
+
+func (l *EVMListener) addCheckpoint(number *big.Int, hash common.Hash) {
+	l.checkpoints = append(l.checkpoints, checkpoint{number: new(big.Int).Set(number), hash: hash})
+	if len(l.checkpoints) > maxCheckpoints {
+		l.checkpoints = l.checkpoints[len(l.checkpoints)-maxCheckpoints:]
+	}
+}
+
+// checkReorg verifies that the last processed block is still canonical. If
+// it is not, it returns the block to replay from: the one after the newest
+// checkpoint still canonical, or ReorgRewind blocks before the replaced one.
+func (l *EVMListener) checkReorg() (*big.Int, error) {
+	if len(l.checkpoints) == 0 {
+		return nil, nil
+	}
+	last := l.checkpoints[len(l.checkpoints)-1]
+	hash, err := l.chainReader.BlockHash(last.number)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if hash == last.hash {
+		return nil, nil
+	}
+	for i := len(l.checkpoints) - 2; i >= 0; i-- {
+		cp := l.checkpoints[i]
+		hash, err := l.chainReader.BlockHash(cp.number)
+		if err != nil {
+			return nil, err
+		}
+		if hash == cp.hash {
+			l.checkpoints = l.checkpoints[:i+1]
+			return new(big.Int).Add(cp.number, big.NewInt(1)), nil
+		}
 	}
-	for _, eventLog := range logs {
-		msg <- eventLog
-		bridgelog.Info(fmt.Sprintf("Resolved message %+v in block %s", eventLog, startBlock.String()))
+	l.checkpoints = l.checkpoints[:0]
+	rewind := new(big.Int).Sub(last.number, ReorgRewind)
+	if rewind.Sign() < 0 {
+		rewind.SetInt64(0)
 	}
-	return nil
+	return rewind, nil
 }
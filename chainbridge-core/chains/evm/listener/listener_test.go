@@ -0,0 +1,189 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/blockstore"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/config"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/relayer"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// testChain serves one arbiter update log per block, its count being the
+// block number plus the fork offset of the block.
+type testChain struct {
+	lock     sync.Mutex
+	head     int64
+	forkFrom int64 // blocks from this one on belong to the fork
+	fork     int64
+	maxRange int64 // ranges wider than this fail
+	failures int   // next queries failing whatever their range
+	queries  int
+}
+
+func (c *testChain) LatestBlock() (*big.Int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return big.NewInt(c.head), nil
+}
+
+func (c *testChain) BlockHash(number *big.Int) (common.Hash, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return common.BigToHash(big.NewInt(c.count(number.Int64()))), nil
+}
+
+func (c *testChain) count(number int64) int64 {
+	if c.forkFrom > 0 && number >= c.forkFrom {
+		return number + c.fork
+	}
+	return number
+}
+
+func (c *testChain) FetchUpdateArbitersLogs(ctx context.Context, contractAddress common.Address, startBlock *big.Int, endBlock *big.Int) ([]*relayer.SetArbiterListMsg, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.queries++
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("connection refused")
+	}
+	if endBlock.Int64()-startBlock.Int64()+1 > c.maxRange {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	var logs []*relayer.SetArbiterListMsg
+	for n := startBlock.Int64(); n <= endBlock.Int64(); n++ {
+		logs = append(logs, &relayer.SetArbiterListMsg{AddressCount: big.NewInt(c.count(n))})
+	}
+	return logs, nil
+}
+
+func (c *testChain) CallContract(ctx context.Context, callArgs map[string]interface{}, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+type testStore struct {
+	lock sync.Mutex
+	kv   map[string][]byte
+}
+
+func (s *testStore) GetByKey(key []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if v, ok := s.kv[string(key)]; ok {
+		return v, nil
+	}
+	return nil, leveldb.ErrNotFound
+}
+
+func (s *testStore) SetByKey(key []byte, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.kv[string(key)] = common.CopyBytes(value)
+	return nil
+}
+
+func receive(t *testing.T, ch <-chan *relayer.SetArbiterListMsg, n int) []int64 {
+	counts := make([]int64, 0, n)
+	for len(counts) < n {
+		select {
+		case msg := <-ch:
+			counts = append(counts, msg.AddressCount.Int64())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout after %d of %d logs", len(counts), n)
+		}
+	}
+	return counts
+}
+
+func TestListenerBatchesAndReorg(t *testing.T) {
+	BlockRetryInterval = 10 * time.Millisecond
+	chain := &testChain{head: 104, maxRange: 16}
+	store := &testStore{kv: make(map[string][]byte)}
+	l := NewEVMListener(chain, &config.OpsConfig{BlockConfirmations: 4, MaxBlockRange: 64})
+
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	ch := l.ListenToEvents(big.NewInt(1), 1, store, stop, errs)
+
+	// Blocks up to head - delay are queried in ranges the chain accepts
+	counts := receive(t, ch, 100)
+	for i, count := range counts {
+		if count != int64(i+1) {
+			t.Fatalf("log %d: have count %d, want %d", i, count, i+1)
+		}
+	}
+	for i := 0; ; i++ {
+		number, _ := blockstore.GetLastStoredBlock(store, 1)
+		if number.Int64() == 100 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("stored block mismatch: have %d, want 100", number)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Replacing processed blocks replays them from the fork point
+	chain.lock.Lock()
+	chain.forkFrom, chain.fork, chain.head = 90, 1000, 110
+	chain.lock.Unlock()
+
+	var replayed []int64
+	for len(replayed) == 0 || replayed[len(replayed)-1] != 1106 {
+		replayed = append(replayed, receive(t, ch, 1)...)
+	}
+	if first := replayed[0]; first < 80 || first > 1090 {
+		t.Fatalf("replay started at %d", first)
+	}
+	for i := 1; i < len(replayed); i++ {
+		if replayed[i] != replayed[i-1]+1 && !(replayed[i-1] == 89 && replayed[i] == 1090) {
+			t.Fatalf("replayed logs not contiguous: %v", replayed)
+		}
+	}
+	close(stop)
+	select {
+	case err := <-errs:
+		t.Fatalf("listener failed: %v", err)
+	default:
+	}
+}
+
+func TestListenerTransientFailures(t *testing.T) {
+	BlockRetryInterval = 10 * time.Millisecond
+	MaxLogRetries = 5
+	chain := &testChain{head: 14, maxRange: 16, failures: 4}
+	store := &testStore{kv: make(map[string][]byte)}
+	l := NewEVMListener(chain, &config.OpsConfig{BlockConfirmations: 4, MaxBlockRange: 1})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	errs := make(chan error, 1)
+	ch := l.ListenToEvents(big.NewInt(1), 1, store, stop, errs)
+
+	// Failures below the retry limit are waited out
+	counts := receive(t, ch, 10)
+	if counts[0] != 1 || counts[9] != 10 {
+		t.Fatalf("logs mismatch: %v", counts)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("listener failed on transient errors: %v", err)
+	default:
+	}
+	// Persistent failures are reported
+	chain.lock.Lock()
+	chain.failures, chain.head = 1000, 20
+	chain.lock.Unlock()
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("persistent failure not reported")
+	}
+}
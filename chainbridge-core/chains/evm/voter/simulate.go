@@ -0,0 +1,183 @@
+// Copyright 2021 ChainSafe Systems
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package voter
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/accounts"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/accounts/abi"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/chains/evm/aribiters"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge_abi"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
+)
+
+// ArbiterListSimulation reports what the bridge contract would do with an
+// arbiter list update, found by executing the update against a copy of the
+// chain state instead of sending it.
+type ArbiterListSimulation struct {
+	Bridge          common.Address   `json:"bridge"`
+	Block           uint64           `json:"block"`           // head block the update is executed on
+	From            common.Address   `json:"from"`            // sender of the update
+	CurrentArbiters []common.Address `json:"currentArbiters"` // arbiters on the contract
+	CurrentTotal    uint64           `json:"currentTotal"`    // total count on the contract
+	HashSalt        *hexutil.Big     `json:"hashSalt"`
+
+	Arbiters []common.Address `json:"arbiters"` // proposed arbiters
+	Total    int              `json:"total"`    // proposed total count
+	Added    []common.Address `json:"added"`
+	Removed  []common.Address `json:"removed"`
+
+	Hash            common.Hash      `json:"hash"`            // hash the current arbiters sign
+	Signers         []common.Address `json:"signers"`         // current arbiters whose signature is valid
+	SignatureErrors []string         `json:"signatureErrors"` // signatures not counted and why
+	Required        int              `json:"required"`        // signatures the relayer waits for
+
+	Input    hexutil.Bytes  `json:"input"`
+	Gas      hexutil.Uint64 `json:"gas"`             // gas limit the relayer would send with
+	Return   hexutil.Bytes  `json:"return"`          // data returned by the contract
+	Reverted bool           `json:"reverted"`        // whether the contract rejects the update
+	Error    string         `json:"error,omitempty"` // revert reason or execution error
+}
+
+// SimulateSetArbiterList checks the signatures of an arbiter list update
+// against the arbiters on the bridge contract, then executes the update as
+// sent by from against the latest state, without sending a transaction.
+func (w *EVMVoter) SimulateSetArbiterList(arbiters []common.Address, totalCount int, signatures [][]byte,
+	bridgeAddress string, from common.Address) (*ArbiterListSimulation, error) {
+	if !w.IsDeployedBridgeContract(bridgeAddress) {
+		return nil, fmt.Errorf("no bridge contract deployed at %s", bridgeAddress)
+	}
+	head, err := w.client.LatestBlock()
+	if err != nil {
+		return nil, err
+	}
+	current, err := w.GetArbiterList(bridgeAddress)
+	if err != nil {
+		return nil, err
+	}
+	currentTotal, err := w.GetTotalCount(bridgeAddress)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := w.GetHashSalt(bridgeAddress)
+	if err != nil {
+		return nil, err
+	}
+	res := &ArbiterListSimulation{
+		Bridge:          common.HexToAddress(bridgeAddress),
+		Block:           head.Uint64(),
+		From:            from,
+		CurrentArbiters: current,
+		CurrentTotal:    currentTotal,
+		HashSalt:        (*hexutil.Big)(salt),
+		Arbiters:        arbiters,
+		Total:           totalCount,
+		Added:           diffAddresses(arbiters, current),
+		Removed:         diffAddresses(current, arbiters),
+		Hash:            aribiters.HashArbiters(arbiters, totalCount, salt),
+		Signers:         []common.Address{},
+		SignatureErrors: []string{},
+	}
+	// The first list is set without signatures
+	if len(current) > 0 {
+		res.Required = int(currentTotal)*2/3 + 1
+	}
+	res.checkSignatures(signatures)
+
+	a, err := chainbridge_abi.GetSetArbitersABI()
+	if err != nil {
+		return nil, err
+	}
+	count := big.NewInt(int64(totalCount))
+	input, err := a.Pack("setArbiterList", arbiters, &count, signatures)
+	if err != nil {
+		return nil, err
+	}
+	res.Input = input
+
+	msg := ethereum.CallMsg{From: from, To: &res.Bridge, Data: input}
+	out, err := w.client.CallContract(context.TODO(), toCallArg(msg), head)
+	if err != nil {
+		// Errors answered by the node are the contract failing, others
+		// leave the outcome unknown
+		if _, ok := err.(rpc.Error); !ok {
+			return nil, err
+		}
+		res.Reverted = true
+		res.Error = revertReason(err)
+		return res, nil
+	}
+	res.Return = out
+	gas, err := w.client.EstimateGasLimit(context.TODO(), msg)
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+	res.Gas = hexutil.Uint64(gas)
+	return res, nil
+}
+
+// checkSignatures counts the distinct current arbiters having signed the hash.
+func (res *ArbiterListSimulation) checkSignatures(signatures [][]byte) {
+	seen := make(map[common.Address]bool)
+	for i, sig := range signatures {
+		pub, err := crypto.SigToPub(accounts.TextHash(res.Hash.Bytes()), sig)
+		if err != nil {
+			res.SignatureErrors = append(res.SignatureErrors, fmt.Sprintf("signature %d: %v", i, err))
+			continue
+		}
+		signer := crypto.PubkeyToAddress(*pub)
+		switch {
+		case !containsAddress(res.CurrentArbiters, signer):
+			res.SignatureErrors = append(res.SignatureErrors, fmt.Sprintf("signature %d: signer %s is not a current arbiter", i, signer.String()))
+		case seen[signer]:
+			res.SignatureErrors = append(res.SignatureErrors, fmt.Sprintf("signature %d: signer %s signed twice", i, signer.String()))
+		default:
+			seen[signer] = true
+			res.Signers = append(res.Signers, signer)
+		}
+	}
+}
+
+// revertReason returns the reason the contract reverted with, if the node
+// reports one, or the error otherwise.
+func revertReason(err error) string {
+	if de, ok := err.(rpc.DataError); ok {
+		if data, ok := de.ErrorData().(string); ok {
+			if ret, err := hexutil.Decode(data); err == nil {
+				if reason, err := abi.UnpackRevert(ret); err == nil {
+					return "execution reverted: " + reason
+				}
+			}
+		}
+	}
+	return err.Error()
+}
+
+func containsAddress(list []common.Address, addr common.Address) bool {
+	for _, item := range list {
+		if item == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// diffAddresses returns the addresses of a missing from b.
+func diffAddresses(a, b []common.Address) []common.Address {
+	diff := make([]common.Address, 0)
+	for _, addr := range a {
+		if !containsAddress(b, addr) {
+			diff = append(diff, addr)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,55 @@
+package voter
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/accounts"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/chains/evm/aribiters"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+)
+
+func TestSimulationSignatures(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	current := make([]common.Address, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		current[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	outsider, _ := crypto.GenerateKey()
+	proposed := []common.Address{current[1], {0x01}}
+
+	res := &ArbiterListSimulation{
+		CurrentArbiters: current,
+		Hash:            aribiters.HashArbiters(proposed, 4, big.NewInt(7)),
+		Added:           diffAddresses(proposed, current),
+		Removed:         diffAddresses(current, proposed),
+	}
+	sign := func(key *ecdsa.PrivateKey, hash common.Hash) []byte {
+		sig, err := crypto.Sign(accounts.TextHash(hash.Bytes()), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	other := aribiters.HashArbiters(proposed, 5, big.NewInt(7))
+	res.checkSignatures([][]byte{
+		sign(keys[0], res.Hash),
+		sign(keys[0], res.Hash), // twice
+		sign(outsider, res.Hash),
+		sign(keys[1], other), // other total count
+		{0x01},
+		sign(keys[2], res.Hash),
+	})
+	if len(res.Signers) != 2 || res.Signers[0] != current[0] || res.Signers[1] != current[2] {
+		t.Fatalf("signers mismatch: have %v", res.Signers)
+	}
+	if len(res.SignatureErrors) != 4 {
+		t.Fatalf("signature errors mismatch: have %v", res.SignatureErrors)
+	}
+	if len(res.Added) != 1 || res.Added[0] != (common.Address{0x01}) || len(res.Removed) != 2 {
+		t.Fatalf("list change mismatch: added %v, removed %v", res.Added, res.Removed)
+	}
+}
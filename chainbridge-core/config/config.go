@@ -65,11 +65,17 @@ func NewConfig() *BridgeConfig {
 }
 
 func (c *BridgeConfig) validateAndParse() error {
-	for _, chain := range c.Chains {
+	ids := make(map[uint64]bool)
+	for i := range c.Chains {
+		chain := &c.Chains[i]
 		err := chain.Validate()
 		if err != nil {
 			return err
 		}
+		if ids[chain.Id] {
+			return fmt.Errorf("duplicate chain id %d", chain.Id)
+		}
+		ids[chain.Id] = true
 		ops, err := chain.Opts.ParseConfig()
 		if err != nil {
 			return err
@@ -79,6 +85,17 @@ func (c *BridgeConfig) validateAndParse() error {
 	return nil
 }
 
+// Chain returns the config of the chain with the id, or nil if the chain is
+// not configured.
+func (c *BridgeConfig) Chain(id uint64) *GeneralChainConfig {
+	for i := range c.Chains {
+		if c.Chains[i].Id == id {
+			return &c.Chains[i]
+		}
+	}
+	return nil
+}
+
 func GetConfig(path string) (*BridgeConfig, error) {
 	var fig = NewConfig()
 	if path == "" {
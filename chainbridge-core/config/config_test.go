@@ -0,0 +1,56 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir, data string) string {
+	path := filepath.Join(dir, "chain_bridge.json")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetConfigChains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chainbridge-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, `{"chains": [
+		{"name": "ESC", "id": 20, "endpoint": "http://localhost:20636", "opts": {"bridge": "0x01"}},
+		{"name": "EID", "id": 22, "endpoint": "https://api.elastos.io/eid", "from": "0x02",
+			"keystorePath": "./eid.key", "blockstorePath": "./eid", "opts": {"bridge": "0x03", "gasLimit": 100000, "blockConfirmations": 3}}
+	]}`)
+	cfg, err := GetConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	esc, eid := cfg.Chain(20), cfg.Chain(22)
+	if esc == nil || eid == nil || cfg.Chain(21) != nil {
+		t.Fatalf("chain lookup mismatch: %+v", cfg.Chains)
+	}
+	// Unset options get their defaults
+	if esc.Opts.GasLimit != DefaultGasLimit || esc.Opts.MaxGasPrice != DefaultGasPrice || esc.Opts.MaxBlockRange != DefaultMaxBlockRange {
+		t.Fatalf("default options not applied: %+v", esc.Opts)
+	}
+	if eid.Opts.GasLimit != 100000 || eid.Opts.BlockConfirmations != 3 || eid.Opts.GasMultiplier != DefaultGasMultiplier {
+		t.Fatalf("options mismatch: %+v", eid.Opts)
+	}
+	if eid.From != "0x02" || eid.KeystorePath != "./eid.key" || eid.BlockstorePath != "./eid" {
+		t.Fatalf("chain config mismatch: %+v", eid)
+	}
+
+	path = writeConfig(t, dir, `{"chains": [
+		{"name": "ESC", "id": 20, "endpoint": "http://localhost:20636", "opts": {"bridge": "0x01"}},
+		{"name": "EID", "id": 20, "endpoint": "https://api.elastos.io/eid", "opts": {"bridge": "0x03"}}
+	]}`)
+	if _, err := GetConfig(path); err == nil {
+		t.Fatalf("duplicate chain id accepted")
+	}
+}
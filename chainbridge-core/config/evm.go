@@ -11,6 +11,7 @@ const DefaultGasLimit = 7000000
 const DefaultGasPrice = 20000000000
 const DefaultGasMultiplier = 1.1
 const DefaultBlockConfirmations = 10
+const DefaultMaxBlockRange = 1000
 
 type OpsConfig struct {
 	Bridge             string  `mapstructure:"bridge"`
@@ -19,6 +20,7 @@ type OpsConfig struct {
 	GasLimit           uint64  `mapstructure:"gasLimit"`
 	StartBlock         uint64  `mapstructure:"startBlock"`
 	BlockConfirmations int64   `mapstructure:"blockConfirmations"`
+	MaxBlockRange      uint64  `mapstructure:"maxBlockRange"` // most blocks queried for logs at once
 }
 
 func (c *OpsConfig) Validate() error {
@@ -61,6 +63,12 @@ func (c *OpsConfig) ParseConfig() (*OpsConfig, error) {
 		config.BlockConfirmations = DefaultBlockConfirmations
 	}
 
+	if c.MaxBlockRange != 0 {
+		config.MaxBlockRange = c.MaxBlockRange
+	} else {
+		config.MaxBlockRange = DefaultMaxBlockRange
+	}
+
 	config.StartBlock = c.StartBlock
 
 	return config, nil
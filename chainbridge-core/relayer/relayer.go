@@ -86,7 +86,11 @@ func (r *Relayer) UpdateArbiters(arbiters [][]byte, totalCount int,
 	return nil
 }
 
+// SetArbiterList writes the arbiters to the chain, or to every chain if
+// chainID is 0. A chain failing does not keep the others from being written;
+// the first error is returned.
 func (r *Relayer) SetArbiterList(arbiters []common.Address, total int, chainID uint64) error {
+	var firstErr error
 	for _, c := range r.relayedChains {
 		if c.ChainID() != chainID && chainID != 0 {
 			continue
@@ -94,10 +98,12 @@ func (r *Relayer) SetArbiterList(arbiters []common.Address, total int, chainID u
 		err := c.WriteArbiters(arbiters, [][]byte{}, total)
 		if err != nil {
 			log.Error("write arbiter error", "error", err, "chainID", c.ChainID())
-			return err
+			if firstErr == nil {
+				firstErr = fmt.Errorf("chain %d: %w", c.ChainID(), err)
+			}
 		}
 	}
-	return nil
+	return firstErr
 }
 
 func (r *Relayer) GetArbiters(chainID uint64) []common.Address {
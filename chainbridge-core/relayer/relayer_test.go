@@ -0,0 +1,60 @@
+package relayer
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+)
+
+type testChain struct {
+	id       uint64
+	err      error
+	arbiters []common.Address
+}
+
+func (c *testChain) ChainID() uint64 { return c.id }
+
+func (c *testChain) WriteArbiters(arbiters []common.Address, signatures [][]byte, totalCount int) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.arbiters = arbiters
+	return nil
+}
+
+func (c *testChain) GetArbiters() []common.Address { return c.arbiters }
+func (c *testChain) GetSignatures() ([][crypto.SignatureLength]byte, error) {
+	return nil, nil
+}
+func (c *testChain) GetTotalCount() (uint64, error)                                    { return 0, nil }
+func (c *testChain) GetESCState() (uint8, error)                                       { return 0, nil }
+func (c *testChain) SetESCState(state uint8) error                                     { return nil }
+func (c *testChain) GetHashSalt() (*big.Int, error)                                    { return big.NewInt(0), nil }
+func (c *testChain) SetManualArbiters([]common.Address, int) error                     { return nil }
+func (c *testChain) GetBridgeContract() string                                         { return "" }
+func (c *testChain) PollEvents(chan<- error, <-chan struct{}, chan *SetArbiterListMsg) {}
+
+func TestSetArbiterListSisterChains(t *testing.T) {
+	esc := &testChain{id: 20}
+	failing := &testChain{id: 21, err: errors.New("endpoint unreachable")}
+	eid := &testChain{id: 22}
+	r := NewRelayer([]RelayedChain{esc, failing, eid}, esc.id)
+
+	arbiters := []common.Address{{0x01}, {0x02}}
+	if err := r.SetArbiterList(arbiters, 2, 0); err == nil {
+		t.Fatalf("failing chain not reported")
+	}
+	// The chain after the failing one is written all the same
+	if len(esc.arbiters) != 2 || len(eid.arbiters) != 2 {
+		t.Fatalf("arbiters not written to every chain: esc %v, eid %v", esc.arbiters, eid.arbiters)
+	}
+	if err := r.SetArbiterList(arbiters[:1], 1, eid.id); err != nil {
+		t.Fatalf("failed to write one chain: %v", err)
+	}
+	if len(eid.arbiters) != 1 || len(esc.arbiters) != 2 {
+		t.Fatalf("arbiters written to another chain: esc %v, eid %v", esc.arbiters, eid.arbiters)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2015 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of Elastos.ELA.SideChain.ESC.
+//
+// Elastos.ELA.SideChain.ESC is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Elastos.ELA.SideChain.ESC is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Elastos.ELA.SideChain.ESC. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/chains/evm/evmclient"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/chains/evm/voter"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/config"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/cmd/utils"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	bridgeConfigFlag = cli.StringFlag{
+		Name:  "bridgeconfig",
+		Usage: "Chain bridge config file",
+		Value: config.DefaultConfigDir,
+	}
+	bridgeChainFlag = cli.Uint64Flag{
+		Name:  "chain",
+		Usage: "Chain id of the bridge contract (0 = first configured chain)",
+	}
+	bridgeArbitersFlag = cli.StringFlag{
+		Name:  "arbiters",
+		Usage: "Comma separated proposed arbiters, as addresses or compressed public keys",
+	}
+	bridgeTotalFlag = cli.IntFlag{
+		Name:  "total",
+		Usage: "Proposed total arbiter count (0 = number of proposed arbiters)",
+	}
+	bridgeSignaturesFlag = cli.StringFlag{
+		Name:  "signatures",
+		Usage: "Comma separated hex signatures of the current arbiters",
+	}
+	bridgeFromFlag = cli.StringFlag{
+		Name:  "from",
+		Usage: "Sender of the update (default = account configured for the chain)",
+	}
+
+	bridgeCommand = cli.Command{
+		Name:      "bridge",
+		Usage:     "Inspect the chain bridge contracts",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "simulate",
+				Usage:     "Simulate an arbiter list update without sending it",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(bridgeSimulate),
+				Category:  "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					bridgeConfigFlag,
+					bridgeChainFlag,
+					bridgeArbitersFlag,
+					bridgeTotalFlag,
+					bridgeSignaturesFlag,
+					bridgeFromFlag,
+				},
+				Description: `
+    geth bridge simulate --chain 20 --arbiters 0x02ab...,0x03cd... --total 12 --signatures 0x1f...,0x2e...
+
+reads the bridge contract of the chain from the chain bridge config, computes
+the salted hash of the proposed arbiter list and checks the signatures against
+the arbiters currently on the contract. It then executes the setArbiterList
+call against a copy of the latest state of the chain endpoint and estimates
+its gas, printing the outcome as JSON. No transaction is sent.
+
+The arbiters are hashed in the order given; the nodes order the arbiters they
+collect by public key. The command fails if the contract would reject the
+update.`,
+			},
+		},
+	}
+)
+
+func bridgeSimulate(ctx *cli.Context) error {
+	cfg, err := config.GetConfig(ctx.String(bridgeConfigFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to load the bridge config: %v", err)
+	}
+	var chainConfig *config.GeneralChainConfig
+	if id := ctx.Uint64(bridgeChainFlag.Name); id != 0 {
+		chainConfig = cfg.Chain(id)
+	} else if len(cfg.Chains) > 0 {
+		chainConfig = &cfg.Chains[0]
+	}
+	if chainConfig == nil {
+		utils.Fatalf("Chain not configured in the bridge config")
+	}
+	arbiters, err := parseBridgeArbiters(ctx.String(bridgeArbitersFlag.Name))
+	if err != nil {
+		utils.Fatalf("Invalid arbiters: %v", err)
+	}
+	var signatures [][]byte
+	for _, item := range splitBridgeList(ctx.String(bridgeSignaturesFlag.Name)) {
+		sig, err := hexutil.Decode(item)
+		if err != nil {
+			utils.Fatalf("Invalid signature %s: %v", item, err)
+		}
+		signatures = append(signatures, sig)
+	}
+	total := ctx.Int(bridgeTotalFlag.Name)
+	if total == 0 {
+		total = len(arbiters)
+	}
+
+	client := evmclient.NewEVMClient(nil)
+	if client == nil {
+		utils.Fatalf("Failed to create the chain client")
+	}
+	if err := client.Configurate(chainConfig, "", ""); err != nil {
+		utils.Fatalf("Failed to connect to chain %d: %v", chainConfig.Id, err)
+	}
+	var from common.Address
+	switch {
+	case ctx.IsSet(bridgeFromFlag.Name):
+		from = common.HexToAddress(ctx.String(bridgeFromFlag.Name))
+	case chainConfig.From != "":
+		from = common.HexToAddress(chainConfig.From)
+	case chainConfig.Kp != nil:
+		from = chainConfig.Kp.CommonAddress()
+	}
+	res, err := voter.NewVoter(client, nil).SimulateSetArbiterList(arbiters, total, signatures, chainConfig.Opts.Bridge, from)
+	if err != nil {
+		utils.Fatalf("Failed to simulate the update: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(res); err != nil {
+		return err
+	}
+	if res.Reverted {
+		return errors.New("the bridge contract would reject the update")
+	}
+	return nil
+}
+
+// parseBridgeArbiters parses a list of addresses and compressed public keys
+// into addresses, keeping the order.
+func parseBridgeArbiters(list string) ([]common.Address, error) {
+	arbiters := make([]common.Address, 0)
+	for _, item := range splitBridgeList(list) {
+		data, err := hexutil.Decode(item)
+		if err != nil {
+			return nil, err
+		}
+		switch len(data) {
+		case common.AddressLength:
+			arbiters = append(arbiters, common.BytesToAddress(data))
+		default:
+			pub, err := crypto.DecompressPubkey(data)
+			if err != nil {
+				return nil, err
+			}
+			arbiters = append(arbiters, crypto.PubkeyToAddress(*pub))
+		}
+	}
+	return arbiters, nil
+}
+
+func splitBridgeList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			if !strings.HasPrefix(item, "0x") {
+				item = "0x" + item
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -38,6 +38,7 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/console"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/eth"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/eth/downloader"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethclient"
@@ -115,6 +116,7 @@ var (
 		utils.SyncModeFlag,
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
+		utils.SnapshotFlag,
 		utils.LightServeFlag,
 		utils.LightLegacyServFlag,
 		utils.LightIngressFlag,
@@ -130,6 +132,7 @@ var (
 		utils.CacheDatabaseFlag,
 		utils.CacheTrieFlag,
 		utils.CacheGCFlag,
+		utils.CacheSnapshotFlag,
 		utils.CacheNoPrefetchFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -178,6 +181,7 @@ var (
 		utils.PbftKeystorePassWord,
 		utils.PbftIPAddress,
 		utils.PbftDposPort,
+		utils.PbftMessageEnvelope,
 		utils.PbftMinerAddress,
 		utils.DynamicArbiter,
 		utils.FrozenAccount,
@@ -244,6 +248,12 @@ func init() {
 		removedbCommand,
 		dumpCommand,
 		inspectCommand,
+		// See pbftcmd.go:
+		pbftCommand,
+		// See snapshot.go:
+		snapshotCommand,
+		// See bridgecmd.go:
+		bridgeCommand,
 		// See accountcmd.go:
 		accountCommand,
 		walletCommand,
@@ -397,36 +407,44 @@ func calculateGenesisAddress(genesisBlockHash string) (string, error) {
 	return genesisAddress, nil
 }
 
-func startSpv(ctx *cli.Context, stack *node.Node) {
-
-	var SpvDataDir string
+// spvDataDir returns the directory the SPV module stores its data in.
+func spvDataDir(ctx *cli.Context) string {
 	switch {
 	case ctx.GlobalIsSet(utils.DataDirFlag.Name):
-		SpvDataDir = ctx.GlobalString(utils.DataDirFlag.Name)
+		return ctx.GlobalString(utils.DataDirFlag.Name)
 	case ctx.GlobalBool(utils.DeveloperFlag.Name):
-		SpvDataDir = "" // unless explicitly requested, use memory databases
+		return "" // unless explicitly requested, use memory databases
 	case ctx.GlobalBool(utils.TestnetFlag.Name):
-		SpvDataDir = filepath.Join(node.DefaultDataDir(), "testnet")
+		return filepath.Join(node.DefaultDataDir(), "testnet")
 	case ctx.GlobalBool(utils.RinkebyFlag.Name):
-		SpvDataDir = filepath.Join(node.DefaultDataDir(), "rinkeby")
+		return filepath.Join(node.DefaultDataDir(), "rinkeby")
 	case ctx.GlobalBool(utils.GoerliFlag.Name):
-		SpvDataDir = filepath.Join(node.DefaultDataDir(), "goerli")
+		return filepath.Join(node.DefaultDataDir(), "goerli")
 	default:
-		SpvDataDir = node.DefaultDataDir()
+		return node.DefaultDataDir()
 	}
+}
 
-	var spvCfg = &spv.Config{
-		DataDir: SpvDataDir,
-	}
-	// prepare the SPV service config parameters
+// spvActiveNet returns the ELA network the SPV module connects with.
+func spvActiveNet(ctx *cli.Context) string {
 	switch {
 	case ctx.GlobalBool(utils.TestnetFlag.Name):
-		spvCfg.ActiveNet = "t"
-
+		return "t"
 	case ctx.GlobalBool(utils.RinkebyFlag.Name):
-		spvCfg.ActiveNet = "r"
+		return "r"
 	case ctx.GlobalBool(utils.GoerliFlag.Name):
-		spvCfg.ActiveNet = "g"
+		return "g"
+	}
+	return ""
+}
+
+func startSpv(ctx *cli.Context, stack *node.Node) {
+	SpvDataDir := spvDataDir(ctx)
+
+	// prepare the SPV service config parameters
+	var spvCfg = &spv.Config{
+		DataDir:   SpvDataDir,
+		ActiveNet: spvActiveNet(ctx),
 	}
 
 	// prepare to start the SPV module
@@ -528,6 +546,9 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 	//start the SPV service
 	//log.Info(fmt.Sprintf("Starting SPV service with config: %+v \n", *spvCfg))
 	startSpv(ctx, stack)
+	if ethereum != nil {
+		go rechargeLogsLoop(ethereum.BlockChain())
+	}
 	startSmallCrossTx(ctx, stack)
 
 	// Register wallet event handlers to open and auto-derive wallets
@@ -704,23 +725,49 @@ func unlockAccounts(ctx *cli.Context, stack *node.Node) {
 	}
 }
 
+// rechargeLogsLoop tracks the recharges packed into or reorganised out of the
+// canonical chain. The logs removed by a reorganisation are sent before the
+// ones added by it, so they are handled first.
+func rechargeLogsLoop(chain *core.BlockChain) {
+	var (
+		logsCh    = make(chan []*types.Log, 16)
+		rmLogsCh  = make(chan core.RemovedLogsEvent, 16)
+		logsSub   = chain.SubscribeLogsEvent(logsCh)
+		rmLogsSub = chain.SubscribeRemovedLogsEvent(rmLogsCh)
+	)
+	defer logsSub.Unsubscribe()
+	defer rmLogsSub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-rmLogsCh:
+			spv.MarkRechargeLogs(ev.Logs)
+		case logs := <-logsCh:
+		drain:
+			for {
+				select {
+				case ev := <-rmLogsCh:
+					spv.MarkRechargeLogs(ev.Logs)
+				default:
+					break drain
+				}
+			}
+			spv.MarkRechargeLogs(logs)
+		case <-logsSub.Err():
+			return
+		case <-rmLogsSub.Err():
+			return
+		}
+	}
+}
+
 func startSmallCrossTx(ctx *cli.Context, stack *node.Node) {
-	var datadir string
-	switch {
-	case ctx.GlobalIsSet(utils.DataDirFlag.Name):
-		datadir = ctx.GlobalString(utils.DataDirFlag.Name)
-	case ctx.GlobalBool(utils.DeveloperFlag.Name):
-		datadir = "" // unless explicitly requested, use memory databases
-	case ctx.GlobalBool(utils.TestnetFlag.Name):
-		datadir = filepath.Join(node.DefaultDataDir(), "testnet")
-	case ctx.GlobalBool(utils.RinkebyFlag.Name):
-		datadir = filepath.Join(node.DefaultDataDir(), "rinkeby")
-	case ctx.GlobalBool(utils.GoerliFlag.Name):
-		datadir = filepath.Join(node.DefaultDataDir(), "goerli")
-	default:
-		datadir = node.DefaultDataDir()
+	datadir := spvDataDir(ctx)
+	if err := smallcrosstx.SmallCrossTxInit(datadir, stack.EventMux()); err != nil {
+		utils.Fatalf("Failed to open the small cross tx database: %v", err)
 	}
-	smallcrosstx.SmallCrossTxInit(datadir, stack.EventMux())
 
-	withdrawfailedtx.FailedWithrawInit(datadir, stack.EventMux())
+	if err := withdrawfailedtx.FailedWithrawInit(datadir, stack.EventMux()); err != nil {
+		utils.Fatalf("Failed to open the withdraw refund database: %v", err)
+	}
 }
@@ -0,0 +1,251 @@
+// Copyright 2015 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of Elastos.ELA.SideChain.ESC.
+//
+// Elastos.ELA.SideChain.ESC is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Elastos.ELA.SideChain.ESC is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Elastos.ELA.SideChain.ESC. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/cmd/utils"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/pbft"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	pbftFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block of the range",
+	}
+	pbftToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block of the range (0 = current head)",
+	}
+	pbftSpvDirFlag = cli.StringFlag{
+		Name:  "spvdir",
+		Usage: "Data directory of the SPV store holding the ELA arbiters (default = data directory)",
+	}
+
+	pbftCommand = cli.Command{
+		Name:      "pbft",
+		Usage:     "Inspect the PBFT consensus data of the local chain",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "stats",
+				Usage:     "Print the proposed, missed and voted counts of the producers",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(pbftStats),
+				Category:  "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.TestnetFlag,
+					utils.SyncModeFlag,
+					pbftFromFlag,
+					pbftToFlag,
+				},
+				Description: `
+    geth pbft stats --from 1000 --to 2000
+
+walks the confirms sealed into the block headers of the range and prints, for
+every ELA turn, how many blocks each producer proposed, how many of its views
+expired and how many confirms carry its vote.
+
+The producers of turns arbitrated by the main chain are not available offline,
+missed views are only accounted for the genesis producers. Use the
+pbft.getProducerStats RPC of a running node for the complete figures.`,
+			},
+			{
+				Name:      "verify-chain",
+				Usage:     "Verify the confirms sealed into the block headers",
+				ArgsUsage: "[<exportfile>]",
+				Action:    utils.MigrateFlags(pbftVerifyChain),
+				Category:  "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.SyncModeFlag,
+					pbftFromFlag,
+					pbftToFlag,
+					pbftSpvDirFlag,
+				},
+				Description: `
+    geth pbft verify-chain --from 1000 --to 2000
+    geth pbft verify-chain chain.rlp.gz
+
+checks the confirm of every PBFT block of the local chain, or of the chain
+exported into the given file, against the producers of its ELA turn read from
+the local SPV store. It prints one JSON line per block with the arbiters that
+signed the confirm and the reasons the confirm is rejected, if any, and fails
+if any block carries insufficient or invalid signatures.
+
+The node owning the data directories must not be running.`,
+			},
+		},
+	}
+)
+
+func pbftStats(ctx *cli.Context) error {
+	node, _ := makeConfigNode(ctx)
+	defer node.Close()
+
+	chain, chainDb := utils.MakeChain(ctx, node)
+	defer chainDb.Close()
+
+	from, to := ctx.Uint64(pbftFromFlag.Name), ctx.Uint64(pbftToFlag.Name)
+	if to == 0 {
+		to = chain.CurrentHeader().Number.Uint64()
+	}
+	var genesisProducers [][]byte
+	if cfg := chain.Config().Pbft; cfg != nil {
+		for _, producer := range cfg.Producers {
+			genesisProducers = append(genesisProducers, common.Hex2Bytes(producer))
+		}
+	}
+	producersAt := func(elaHeight uint64) [][]byte {
+		if elaHeight == 0 {
+			return genesisProducers
+		}
+		return nil
+	}
+	turns, err := pbft.CollectProducerStats(chain, from, to, producersAt)
+	if err != nil {
+		utils.Fatalf("Failed to collect producer stats: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(turns)
+}
+
+func pbftVerifyChain(ctx *cli.Context) error {
+	if len(ctx.Args()) > 1 {
+		utils.Fatalf("This command accepts at most one argument.")
+	}
+	node, _ := makeConfigNode(ctx)
+	defer node.Close()
+
+	chain, chainDb := utils.MakeChain(ctx, node)
+	defer chainDb.Close()
+
+	dir := ctx.String(pbftSpvDirFlag.Name)
+	if dir == "" {
+		dir = spvDataDir(ctx)
+	}
+	arbiters, err := spv.OpenArbitersStore(&spv.Config{DataDir: dir, ActiveNet: spvActiveNet(ctx)})
+	if err != nil {
+		utils.Fatalf("Failed to open the SPV store: %v", err)
+	}
+	defer arbiters.Close()
+
+	var genesisProducers [][]byte
+	if cfg := chain.Config().Pbft; cfg != nil {
+		for _, producer := range cfg.Producers {
+			genesisProducers = append(genesisProducers, common.Hex2Bytes(producer))
+		}
+	}
+	producersAt := func(elaHeight uint64) ([][]byte, int, error) {
+		if elaHeight == 0 {
+			return genesisProducers, len(genesisProducers), nil
+		}
+		return arbiters.GetProducers(elaHeight)
+	}
+
+	var (
+		encoder = json.NewEncoder(os.Stdout)
+		checked int
+		invalid int
+	)
+	verify := func(header *types.Header) error {
+		if header.Number.Sign() == 0 || !chain.Config().IsPBFTFork(header.Number) {
+			return nil
+		}
+		result := pbft.CheckHeaderConfirm(header, producersAt)
+		checked++
+		if !result.OK() {
+			invalid++
+			log.Warn("Invalid block confirm", "number", result.Number, "hash", result.Hash, "err", result.Errors[0])
+		}
+		return encoder.Encode(result)
+	}
+
+	if len(ctx.Args()) == 1 {
+		err = verifyExportedChain(ctx.Args().First(), verify)
+	} else {
+		from, to := ctx.Uint64(pbftFromFlag.Name), ctx.Uint64(pbftToFlag.Name)
+		if to == 0 {
+			to = chain.CurrentHeader().Number.Uint64()
+		}
+		for number := from; number <= to && err == nil; number++ {
+			header := chain.GetHeaderByNumber(number)
+			if header == nil {
+				utils.Fatalf("Header #%d not found", number)
+			}
+			err = verify(header)
+		}
+	}
+	if err != nil {
+		utils.Fatalf("Chain verification failed: %v", err)
+	}
+	log.Info("Verified block confirms", "blocks", checked, "invalid", invalid)
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d blocks carry an invalid confirm", invalid, checked)
+	}
+	return nil
+}
+
+// verifyExportedChain streams the blocks of a file written by geth export.
+func verifyExportedChain(fn string, verify func(*types.Header) error) error {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return err
+		}
+	}
+	stream := rlp.NewStream(reader, 0)
+	for n := 0; ; n++ {
+		var b types.Block
+		if err := stream.Decode(&b); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("at block %d: %v", n, err)
+		}
+		if err := verify(b.Header()); err != nil {
+			return err
+		}
+	}
+}
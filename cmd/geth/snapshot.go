@@ -0,0 +1,116 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of Elastos.ELA.SideChain.ESC.
+//
+// Elastos.ELA.SideChain.ESC is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Elastos.ELA.SideChain.ESC is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Elastos.ELA.SideChain.ESC. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/cmd/utils"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state/pruner"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	snapshotCommand = cli.Command{
+		Name:        "snapshot",
+		Usage:       "A set of commands based on the snapshot",
+		ArgsUsage:   "",
+		Category:    "BLOCKCHAIN COMMANDS",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Prune stale state data based on the target state root",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(pruneState),
+				Category:  "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.CacheDatabaseFlag,
+					utils.TestnetFlag,
+					utils.BloomFilterSizeFlag,
+				},
+				Description: `
+    geth snapshot prune-state <state-root>
+
+will prune historical state data with the help of a bloom filter. All the trie
+nodes and contract codes not belonging to the specified state root (and the
+genesis state) will be deleted from the database. The state root must be the
+one of a canonical block among the 128 most recent ones. If no state root is
+given, the state of the block HEAD-128 is retained, or HEAD-127 if the former
+is not persisted. The database is compacted after the deletion.
+
+The node must be stopped while pruning. On the next startup it rewinds its head
+to the retained state and reprocesses the blocks above it.
+
+The pruning is resumable: once the bloom filter of the live state is written to
+the data directory, an interrupted pruning is finished on the next invocation
+of this command or on the next node startup.`,
+			},
+		},
+	}
+)
+
+func pruneState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	// Finish any previously interrupted pruning before starting a new one
+	if err := pruner.RecoverPruning(stack.ResolvePath(""), chaindb); err != nil {
+		log.Error("Failed to recover interrupted pruning", "err", err)
+		return err
+	}
+	if ctx.NArg() > 1 {
+		log.Error("Too many arguments given")
+		return errors.New("too many arguments")
+	}
+	var targetRoot common.Hash
+	if ctx.NArg() == 1 {
+		root, err := parseRoot(ctx.Args()[0])
+		if err != nil {
+			log.Error("Failed to resolve state root", "err", err)
+			return err
+		}
+		targetRoot = root
+	}
+	pruner, err := pruner.NewPruner(chaindb, stack.ResolvePath(""), ctx.GlobalUint64(utils.BloomFilterSizeFlag.Name))
+	if err != nil {
+		log.Error("Failed to create state pruner", "err", err)
+		return err
+	}
+	if err = pruner.Prune(targetRoot); err != nil {
+		log.Error("Failed to prune state", "err", err)
+		return err
+	}
+	return nil
+}
+
+// parseRoot parses a hex encoded state root.
+func parseRoot(input string) (common.Hash, error) {
+	var h common.Hash
+	if err := h.UnmarshalText([]byte(input)); err != nil {
+		return h, err
+	}
+	return h, nil
+}
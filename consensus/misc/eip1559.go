@@ -0,0 +1,90 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package misc
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/math"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+)
+
+// VerifyEip1559Header verifies the base fee of a header against its parent.
+// Headers before the fork must not carry a base fee at all. The gas limit is
+// deliberately left alone: ESC keeps its gas limit policy across the fork and
+// the gas target is simply half of the parent's limit.
+func VerifyEip1559Header(config *params.ChainConfig, parent, header *types.Header) error {
+	if !config.IsEIP1559(header.Number) {
+		if header.BaseFee != nil {
+			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
+		}
+		return nil
+	}
+	if header.BaseFee == nil {
+		return fmt.Errorf("header is missing baseFee")
+	}
+	if expected := CalcBaseFee(config, parent); header.BaseFee.Cmp(expected) != 0 {
+		return fmt.Errorf("invalid baseFee: have %s, want %s, parentBaseFee %s, parentGasUsed %d",
+			header.BaseFee, expected, parent.BaseFee, parent.GasUsed)
+	}
+	return nil
+}
+
+// CalcBaseFee calculates the base fee of the header following parent. The
+// first block of the fork starts at InitialBaseFee, the result never drops
+// below the chain's configured MinBaseFee.
+func CalcBaseFee(config *params.ChainConfig, parent *types.Header) *big.Int {
+	if !config.IsEIP1559(parent.Number) || parent.BaseFee == nil {
+		return applyMinBaseFee(config, new(big.Int).SetUint64(params.InitialBaseFee))
+	}
+	var (
+		parentGasTarget          = parent.GasLimit / params.ElasticityMultiplier
+		parentGasTargetBig       = new(big.Int).SetUint64(parentGasTarget)
+		baseFeeChangeDenominator = new(big.Int).SetUint64(params.BaseFeeChangeDenominator)
+	)
+	// If the parent used exactly its target, the base fee remains unchanged.
+	if parent.GasUsed == parentGasTarget || parentGasTarget == 0 {
+		return applyMinBaseFee(config, new(big.Int).Set(parent.BaseFee))
+	}
+	if parent.GasUsed > parentGasTarget {
+		// The parent used more gas than its target, the base fee increases.
+		gasUsedDelta := new(big.Int).SetUint64(parent.GasUsed - parentGasTarget)
+		x := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+		y := x.Div(x, parentGasTargetBig)
+		baseFeeDelta := math.BigMax(x.Div(y, baseFeeChangeDenominator), common.Big1)
+
+		return applyMinBaseFee(config, x.Add(parent.BaseFee, baseFeeDelta))
+	}
+	// The parent used less gas than its target, the base fee decreases.
+	gasUsedDelta := new(big.Int).SetUint64(parentGasTarget - parent.GasUsed)
+	x := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+	y := x.Div(x, parentGasTargetBig)
+	baseFeeDelta := x.Div(y, baseFeeChangeDenominator)
+
+	return applyMinBaseFee(config, math.BigMax(x.Sub(parent.BaseFee, baseFeeDelta), new(big.Int)))
+}
+
+// applyMinBaseFee raises baseFee to the configured floor if it is below it.
+func applyMinBaseFee(config *params.ChainConfig, baseFee *big.Int) *big.Int {
+	if config.MinBaseFee != nil && baseFee.Cmp(config.MinBaseFee) < 0 {
+		return new(big.Int).Set(config.MinBaseFee)
+	}
+	return baseFee
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package misc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+)
+
+// eip1559Config returns a chain config with the fee market active from block 5.
+func eip1559Config() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.LondonBlock = big.NewInt(5)
+	config.EIP1559Block = big.NewInt(5)
+	return &config
+}
+
+// Tests that the base fee follows the gas usage of the parent block.
+func TestCalcBaseFee(t *testing.T) {
+	tests := []struct {
+		parentBaseFee   int64
+		parentGasLimit  uint64
+		parentGasUsed   uint64
+		expectedBaseFee int64
+	}{
+		{params.InitialBaseFee, 20000000, 10000000, params.InitialBaseFee}, // usage == target
+		{params.InitialBaseFee, 20000000, 9000000, 987500000},              // usage below target
+		{params.InitialBaseFee, 20000000, 11000000, 1012500000},            // usage above target
+		{params.InitialBaseFee, 20000000, 0, 875000000},                    // empty block
+		{1, 20000000, 20000000, 2},                                         // minimum increase of one wei
+	}
+	for i, test := range tests {
+		parent := &types.Header{
+			Number:   big.NewInt(32),
+			GasLimit: test.parentGasLimit,
+			GasUsed:  test.parentGasUsed,
+			BaseFee:  big.NewInt(test.parentBaseFee),
+		}
+		if have, want := CalcBaseFee(eip1559Config(), parent), big.NewInt(test.expectedBaseFee); have.Cmp(want) != 0 {
+			t.Errorf("test %d: base fee mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+// Tests that the configured minimum base fee is never undercut.
+func TestCalcBaseFeeFloor(t *testing.T) {
+	config := eip1559Config()
+	config.MinBaseFee = big.NewInt(params.InitialBaseFee / 2)
+
+	parent := &types.Header{
+		Number:   big.NewInt(32),
+		GasLimit: 20000000,
+		BaseFee:  big.NewInt(params.InitialBaseFee),
+	}
+	for i := 0; i < 20; i++ {
+		parent.BaseFee = CalcBaseFee(config, parent)
+	}
+	if parent.BaseFee.Cmp(config.MinBaseFee) != 0 {
+		t.Errorf("base fee mismatch: have %v, want %v", parent.BaseFee, config.MinBaseFee)
+	}
+}
+
+// Tests that headers carry a base fee exactly from the fork block on.
+func TestVerifyEip1559Header(t *testing.T) {
+	config := eip1559Config()
+
+	parent := &types.Header{Number: big.NewInt(3), GasLimit: 20000000}
+	if err := VerifyEip1559Header(config, parent, &types.Header{Number: big.NewInt(4)}); err != nil {
+		t.Errorf("pre-fork header without base fee rejected: %v", err)
+	}
+	if err := VerifyEip1559Header(config, parent, &types.Header{Number: big.NewInt(4), BaseFee: big.NewInt(1)}); err == nil {
+		t.Errorf("pre-fork header with base fee accepted")
+	}
+	parent.Number = big.NewInt(4)
+	if err := VerifyEip1559Header(config, parent, &types.Header{Number: big.NewInt(5)}); err == nil {
+		t.Errorf("fork header without base fee accepted")
+	}
+	if err := VerifyEip1559Header(config, parent, &types.Header{Number: big.NewInt(5), BaseFee: big.NewInt(params.InitialBaseFee)}); err != nil {
+		t.Errorf("fork header with initial base fee rejected: %v", err)
+	}
+	if err := VerifyEip1559Header(config, parent, &types.Header{Number: big.NewInt(5), BaseFee: big.NewInt(params.InitialBaseFee + 1)}); err == nil {
+		t.Errorf("fork header with wrong base fee accepted")
+	}
+}
@@ -6,9 +6,14 @@
 package pbft
 
 import (
+	"fmt"
+	"sync/atomic"
+
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
+
+	"github.com/elastos/Elastos.ELA/core/types/payload"
 )
 
 // API is a user facing RPC API to allow controlling the signer and voting
@@ -44,6 +49,124 @@ func (a *API) GetAllPeersInfo() []peerInfo {
 	return result
 }
 
+// ProposalInfo describes the proposal being voted on.
+type ProposalInfo struct {
+	Hash       string `json:"hash"`
+	BlockHash  string `json:"blockHash"`
+	Sponsor    string `json:"sponsor"`
+	ViewOffset uint32 `json:"viewOffset"`
+}
+
+// ProducerVote is the vote of one current producer on the processing
+// proposal, one of "accept", "reject" or "none".
+type ProducerVote struct {
+	Producer string `json:"producer"`
+	Vote     string `json:"vote"`
+}
+
+// ConsensusStatus is a snapshot of the local consensus state.
+type ConsensusStatus struct {
+	Producer              bool           `json:"producer"`
+	OnDuty                bool           `json:"onDuty"`
+	Running               bool           `json:"running"`
+	ViewOffset            uint32         `json:"viewOffset"`
+	DutyIndex             uint32         `json:"dutyIndex"`
+	ViewStartTime         int64          `json:"viewStartTime"`
+	ChangeViewTime        int64          `json:"changeViewTime"`
+	ProcessingProposal    *ProposalInfo  `json:"processingProposal"`
+	Votes                 []ProducerVote `json:"votes"`
+	ResetViewRequests     []string       `json:"resetViewRequests"`
+	FinishedHeight        uint64         `json:"finishedHeight"`
+	FinishedBlockSealHash string         `json:"finishedBlockSealHash"`
+	Sealing               bool           `json:"sealing"`
+	SealOver              bool           `json:"sealOver"`
+	Recovered             bool           `json:"recovered"`
+	Recovering            bool           `json:"recovering"`
+}
+
+// GetConsensusStatus returns the view, the processing proposal with the
+// votes collected per producer and the seal state of the local node.
+func (a *API) GetConsensusStatus() *ConsensusStatus {
+	p := a.pbft
+	view := p.dispatcher.GetConsensusView()
+	status := &ConsensusStatus{
+		Producer:              p.IsProducer(),
+		OnDuty:                p.IsOnduty(),
+		Running:               view.IsRunning(),
+		ViewOffset:            view.GetViewOffset(),
+		DutyIndex:             view.GetDutyIndex(),
+		ViewStartTime:         view.GetViewStartTime().Unix(),
+		ChangeViewTime:        view.GetChangeViewTime().Unix(),
+		ResetViewRequests:     p.dispatcher.GetResetViewRequests(),
+		FinishedHeight:        p.dispatcher.GetFinishedHeight(),
+		FinishedBlockSealHash: p.dispatcher.GetFinishedBlockSealHash().String(),
+		Sealing:               atomic.LoadInt32(&p.isSealing) == 1,
+		SealOver:              p.isSealOver,
+		Recovered:             p.isRecoved,
+		Recovering:            p.recoverStarted,
+	}
+	if proposal := p.dispatcher.GetProcessingProposal(); proposal != nil {
+		status.ProcessingProposal = &ProposalInfo{
+			Hash:       proposal.Hash().String(),
+			BlockHash:  proposal.BlockHash.String(),
+			Sponsor:    common.Bytes2Hex(proposal.Sponsor),
+			ViewOffset: proposal.ViewOffset,
+		}
+	}
+	status.Votes = producerVotes(view.GetProducers(), p.dispatcher.GetAcceptVotes(), p.dispatcher.GetRejectedVotes())
+	return status
+}
+
+func producerVotes(producers [][]byte, accepts, rejects []payload.DPOSProposalVote) []ProducerVote {
+	votes := make(map[string]string, len(accepts)+len(rejects))
+	for _, v := range rejects {
+		votes[common.Bytes2Hex(v.Signer)] = "reject"
+	}
+	for _, v := range accepts {
+		votes[common.Bytes2Hex(v.Signer)] = "accept"
+	}
+	result := make([]ProducerVote, 0, len(producers))
+	for _, producer := range producers {
+		pbk := common.Bytes2Hex(producer)
+		vote, ok := votes[pbk]
+		if !ok {
+			vote = "none"
+		}
+		result = append(result, ProducerVote{Producer: pbk, Vote: vote})
+	}
+	return result
+}
+
+// maxProducerStatsRange is the maximum number of blocks GetProducerStats
+// walks in one call.
+const maxProducerStatsRange = 100000
+
+// GetProducerStats returns the proposed, missed and voted counts of every
+// producer per ELA turn over the blocks [from, to]. A zero to stands for
+// the current head.
+func (a *API) GetProducerStats(from, to uint64) ([]*TurnStats, error) {
+	if to == 0 {
+		to = a.chain.CurrentHeader().Number.Uint64()
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid range [%d, %d]", from, to)
+	}
+	if to-from >= maxProducerStatsRange {
+		return nil, fmt.Errorf("range [%d, %d] exceeds %d blocks", from, to, maxProducerStatsRange)
+	}
+	return CollectProducerStats(a.chain, from, to, a.pbft.TurnProducers)
+}
+
+// GetPeerScores returns the misbehavior scores and the dropped messages of
+// the producers connected to.
+func (a *API) GetPeerScores() []dpos.PeerScore {
+	scores := a.pbft.PeerScores()
+	if scores == nil {
+		return nil
+	}
+	return scores.Scores()
+}
+
 func (a *API) Dispatcher() *dpos.Dispatcher {
 	return a.pbft.dispatcher
 }
@@ -0,0 +1,26 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbft
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducerVotes(t *testing.T) {
+	producers := [][]byte{{0x01}, {0x02}, {0x03}}
+	accepts := []payload.DPOSProposalVote{{Signer: []byte{0x03}, Accept: true}}
+	rejects := []payload.DPOSProposalVote{{Signer: []byte{0x01}}, {Signer: []byte{0x04}}}
+
+	votes := producerVotes(producers, accepts, rejects)
+	assert.Equal(t, []ProducerVote{
+		{Producer: "01", Vote: "reject"},
+		{Producer: "02", Vote: "none"},
+		{Producer: "03", Vote: "accept"},
+	}, votes)
+}
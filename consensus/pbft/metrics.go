@@ -0,0 +1,35 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+// Contains the metrics collected by the pbft engine.
+
+package pbft
+
+import (
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/metrics"
+)
+
+var (
+	proposalLatencyTimer = metrics.NewRegisteredTimer("pbft/proposal/latency", nil)
+	proposalRejectMeter  = metrics.NewRegisteredMeter("pbft/proposal/rejected", nil)
+	proposalUnconfMeter  = metrics.NewRegisteredMeter("pbft/proposal/unconfirmed", nil)
+
+	viewChangeMeter  = metrics.NewRegisteredMeter("pbft/view/change", nil)
+	viewResetMeter   = metrics.NewRegisteredMeter("pbft/view/reset", nil)
+	viewOffsetGauge  = metrics.NewRegisteredGauge("pbft/view/offset", nil)
+	recoverMeter     = metrics.NewRegisteredMeter("pbft/recover/start", nil)
+	recoverDoneMeter = metrics.NewRegisteredMeter("pbft/recover/done", nil)
+)
+
+// voteCounter returns the counter of the accept or reject votes received
+// from a producer.
+func voteCounter(signer []byte, accept bool) metrics.Counter {
+	kind := "reject"
+	if accept {
+		kind = "accept"
+	}
+	return metrics.GetOrRegisterCounter("pbft/votes/"+kind+"/"+common.Bytes2Hex(signer), nil)
+}
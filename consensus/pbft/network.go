@@ -53,6 +53,7 @@ func (p *Pbft) StartProposal(block *types.Block) (*payload.DPOSProposal, error)
 	if err, _, _ := p.dispatcher.ProcessProposal(id, proposal); err != nil {
 		log.Error("ProcessProposal error", "err", err)
 	}
+	p.proposalTime = time.Now()
 
 	m := &msg.Proposal{
 		Proposal: *proposal,
@@ -452,6 +453,11 @@ func (p *Pbft) OnProposalReceived(id peer.PID, proposal *payload.DPOSProposal) {
 	if err != nil {
 		log.Error("Process Proposal error", "err", err)
 		if isSendReject {
+			// Only a badly signed proposal proves misbehavior, the others
+			// may be rejected by a lagging view of the producers.
+			if dpos.CheckProposal(proposal) != nil {
+				p.network.Penalize(id, dpos.PenaltyInvalidProposal, err)
+			}
 			voteMsg = p.dispatcher.RejectProposal(proposal, p.account)
 		} else if !handled {
 			pubKey := common.Bytes2Hex(id[:])
@@ -474,6 +480,10 @@ func (p *Pbft) OnProposalReceived(id peer.PID, proposal *payload.DPOSProposal) {
 		voteMsg = p.dispatcher.RejectProposal(proposal, p.account)
 	} else {
 		voteMsg = p.dispatcher.AcceptProposal(proposal, p.account)
+		p.proposalTime = time.Now()
+	}
+	if voteMsg != nil && voteMsg.Command == msg.CmdRejectVote {
+		proposalRejectMeter.Mark(1)
 	}
 
 	if handled {
@@ -493,6 +503,10 @@ func (p *Pbft) OnVoteAccepted(id peer.PID, vote *payload.DPOSProposalVote) {
 	if !p.dispatcher.GetConsensusView().IsRunning() {
 		return
 	}
+	if err := dpos.CheckVote(vote); err != nil {
+		p.network.Penalize(id, dpos.PenaltyInvalidVote, err)
+		return
+	}
 	if vote.Accept == true {
 		dpos.Info("OnVoteAccepted:", "hash:", vote.Hash().String())
 	}
@@ -522,10 +536,13 @@ func (p *Pbft) OnVoteAccepted(id peer.PID, vote *payload.DPOSProposalVote) {
 			log.Warn("Has Confirm proposal")
 			return
 		}
-		_, _, err := p.dispatcher.ProcessVote(vote)
+		succeed, _, err := p.dispatcher.ProcessVote(vote)
 		if err != nil {
 			log.Error("ProcessVote error", "err", err)
 		}
+		if succeed {
+			voteCounter(vote.Signer, vote.Accept).Inc(1)
+		}
 	}
 }
 
@@ -581,6 +598,7 @@ func (p *Pbft) recoverAbnormalState() bool {
 			return false
 		}
 		p.recoverStarted = true
+		recoverMeter.Mark(1)
 		p.RequestAbnormalRecovering()
 		startTime := time.Now()
 		go func() {
@@ -644,6 +662,7 @@ func (p *Pbft) DoRecover() {
 	})
 	medianTime := medianOf(startTimes)
 	p.dispatcher.RecoverAbnormal(status, medianTime)
+	recoverDoneMeter.Mark(1)
 	p.notHandledProposal = make(map[string]struct{})
 }
 
@@ -679,6 +698,7 @@ func (p *Pbft) OnResponseResetViewReceived(msg *msg.ResetView) {
 		// do reset
 		header := p.chain.CurrentHeader()
 		p.dispatcher.ResetConsensus(header.Number.Uint64())
+		viewResetMeter.Mark(1)
 		log.Info("[reset consensu] start mine")
 		p.StartMine()
 		log.Info("[end reset consensus]", "p.dispatcher.GetResetViewReqCount()", p.dispatcher.GetResetViewReqCount(), "p.dispatcher.GetConsensusView().GetViewOffset()", p.dispatcher.GetConsensusView().GetViewOffset())
@@ -803,10 +823,13 @@ func (p *Pbft) limitMap(m map[common.Hash]struct{}, limit int) {
 }
 
 func (p *Pbft) OnSmallCroTxReceived(id peer.PID, msg *dmsg.SmallCroTx) {
-	list := p.GetCurrentProducers()
-	total := p.dispatcher.GetConsensusView().GetTotalProducersCount()
-	height := p.chain.CurrentBlock().GetHeight()
-	smallcrosstx.OnReceivedSmallCroTxFromDirectNet(list, total, msg.GetSignature(), msg.GetRawTx(), height)
+	block := p.chain.CurrentBlock()
+	list, total, err := p.turnProducers(block.Nonce())
+	if err != nil {
+		log.Error("OnSmallCroTxReceived", "elaHeight", block.Nonce(), "error", err)
+		return
+	}
+	smallcrosstx.OnReceivedSmallCroTxFromDirectNet(list, total, block.Nonce(), msg.GetSignature(), msg.GetRawTx(), block.NumberU64())
 }
 
 func (p *Pbft) OnFailedWithdrawTxReceived(id peer.PID, msg *dmsg.FailedWithdrawTx) {
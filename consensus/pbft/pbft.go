@@ -19,6 +19,7 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/crypto"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/misc"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
@@ -125,6 +126,9 @@ type Pbft struct {
 	isSealOver     bool
 	isRecovering   bool
 	isSealing      int32
+	proposalTime   time.Time
+
+	producersAt ProducersFunc // source of the turn producers replacing the SPV module, if set
 }
 
 func New(chainConfig *params.ChainConfig, dataDir string) *Pbft {
@@ -187,6 +191,10 @@ func New(chainConfig *params.ChainConfig, dataDir string) *Pbft {
 
 	if account != nil {
 		accpubkey = account.PublicKeyBytes()
+		envelope, err := dpos.ParseEnvelopeMode(cfg.MessageEnvelope)
+		if err != nil {
+			dpos.Warn("Invalid message envelope mode, sending bare messages:", err.Error())
+		}
 		network, err := dpos.NewNetwork(&dpos.NetworkConfig{
 			IPAddress:         cfg.IPAddress,
 			Magic:             cfg.Magic,
@@ -198,8 +206,10 @@ func New(chainConfig *params.ChainConfig, dataDir string) *Pbft {
 			DataPath:          dposPath,
 			PublicKey:         accpubkey,
 			GetCurrentHeight:  pbft.GetMainChainHeight,
+			ProducerIsOnDuty:  pbft.producerIsOnDuty,
 			DPoSV2StartHeight: cfg.DPoSV2StartHeight,
 			NodeVersion:       cfg.NodeVersion,
+			Envelope:          envelope,
 			AnnounceAddr: func() {
 				events.Notify(dpos.ETAnnounceAddr, nil)
 			},
@@ -220,6 +230,12 @@ func (p *Pbft) GetMainChainHeight(pid peer.PID) uint64 {
 	return spv.GetSpvHeight()
 }
 
+// producerIsOnDuty returns whether the peer is the producer on duty of the
+// current view.
+func (p *Pbft) producerIsOnDuty(pid peer.PID) bool {
+	return p.dispatcher != nil && p.dispatcher.GetConsensusView().ProducerIsOnDuty(pid[:])
+}
+
 func (p *Pbft) subscribeEvent() {
 	events.Subscribe(func(e *events.Event) {
 		switch e.Type {
@@ -389,6 +405,10 @@ func (p *Pbft) verifyHeader(chain consensus.ChainReader, header *types.Header, p
 	if parent.Time+p.period > header.Time {
 		return ErrInvalidTimestamp
 	}
+	// Verify the base fee, the gas limit policy is unchanged by EIP-1559
+	if err := misc.VerifyEip1559Header(chain.Config(), parent, header); err != nil {
+		return err
+	}
 
 	if number > 0 {
 		if header.Difficulty == nil || (header.Difficulty.Cmp(diffInTurn) != 0) {
@@ -620,6 +640,10 @@ func (p *Pbft) onConfirm(confirm *payload.Confirm) error {
 		log.Error("Received confirm", "proposal", confirm.Proposal.Hash().String(), "err:", err)
 		return err
 	}
+	if !p.proposalTime.IsZero() {
+		proposalLatencyTimer.UpdateSince(p.proposalTime)
+		p.proposalTime = time.Time{}
+	}
 	duty := p.IsOnDuty()
 	if p.isSealOver && duty {
 		return errors.New("seal block is over, can't confirm")
@@ -644,6 +668,7 @@ func (p *Pbft) onConfirm(confirm *payload.Confirm) error {
 
 func (p *Pbft) onUnConfirm(unconfirm *payload.Confirm) error {
 	log.Info("--------[onUnConfirm]------", "proposal:", unconfirm.Proposal.Hash())
+	proposalUnconfMeter.Mark(1)
 	if p.isSealOver {
 		return errors.New("seal block is over, can't unconfirm")
 	}
@@ -708,7 +733,7 @@ func DBlockSealHash(block dpos.DBlock) (hash ecom.Uint256, err error) {
 }
 
 func encodeSigHeader(w io.Writer, header *types.Header) {
-	err := rlp.Encode(w, []interface{}{
+	enc := []interface{}{
 		header.ParentHash,
 		header.UncleHash,
 		header.Coinbase,
@@ -724,8 +749,11 @@ func encodeSigHeader(w io.Writer, header *types.Header) {
 		//header.Extra[:len(header.Extra)-crypto.SignatureLength], // Yes, this will panic if extra is too short
 		header.MixDigest,
 		header.Nonce,
-	})
-	if err != nil {
+	}
+	if header.BaseFee != nil {
+		enc = append(enc, header.BaseFee)
+	}
+	if err := rlp.Encode(w, enc); err != nil {
 		panic("can't encode: " + err.Error())
 	}
 }
@@ -736,6 +764,15 @@ func (p *Pbft) AddDirectLinkPeer(pid peer.PID, addr string) {
 	}
 }
 
+// PeerScores returns the misbehavior scores of the producers, or nil if not
+// connected to the producers.
+func (p *Pbft) PeerScores() *dpos.PeerScores {
+	if p.network != nil {
+		return p.network.PeerScores()
+	}
+	return nil
+}
+
 func (p *Pbft) GetActivePeersCount() int {
 	if p.network != nil {
 		return len(p.network.GetActivePeers())
@@ -830,6 +867,15 @@ func (p *Pbft) verifyConfirm(confirm *payload.Confirm, elaHeight uint64) error {
 	minSignCount := 0
 	if elaHeight == 0 {
 		minSignCount = p.dispatcher.GetConsensusView().GetCRMajorityCount()
+	} else if p.producersAt != nil {
+		producers, count, err := p.producersAt(elaHeight)
+		if err != nil {
+			return err
+		}
+		if err := checkConfirmSigners(confirm, producers); err != nil {
+			return err
+		}
+		minSignCount = p.dispatcher.GetConsensusView().GetMajorityCountByTotalSigners(count)
 	} else {
 		_, count, err := spv.GetProducers(elaHeight)
 		if err != nil {
@@ -875,6 +921,10 @@ func (p *Pbft) CleanFinalConfirmedBlock(height uint64) {
 }
 
 func (p *Pbft) OnViewChanged(isOnDuty bool, force bool) {
+	viewOffsetGauge.Update(int64(p.dispatcher.GetConsensusView().GetViewOffset()))
+	if !force {
+		viewChangeMeter.Mark(1)
+	}
 	if isOnDuty && p.OnDuty != nil {
 		p.OnDuty()
 	}
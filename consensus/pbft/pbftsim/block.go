@@ -0,0 +1,54 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbftsim
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+
+	elacom "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// Block is the minimal block proposed and confirmed by simulated producers.
+// Confirm is empty while the block is being voted on and carries the
+// serialized payload.Confirm once sealed, like the header extra of a real
+// PBFT block.
+type Block struct {
+	Height     uint64
+	ParentHash elacom.Uint256
+	Time       uint64
+	Sponsor    []byte
+	Confirm    []byte
+}
+
+// Hash returns the seal hash of the block, which is what proposals refer to.
+// The confirm is not part of it.
+func (b *Block) Hash() elacom.Uint256 {
+	data, _ := rlp.EncodeToBytes([]interface{}{b.Height, b.ParentHash, b.Time, b.Sponsor})
+	return elacom.Uint256(sha256.Sum256(data))
+}
+
+// GetConfirm decodes the confirm sealed into the block.
+func (b *Block) GetConfirm() (*payload.Confirm, error) {
+	confirm := &payload.Confirm{}
+	if err := confirm.Deserialize(bytes.NewReader(b.Confirm)); err != nil {
+		return nil, err
+	}
+	return confirm, nil
+}
+
+func (b *Block) withConfirm(confirm *payload.Confirm) (*Block, error) {
+	buf := new(bytes.Buffer)
+	if err := confirm.Serialize(buf); err != nil {
+		return nil, err
+	}
+	cpy := *b
+	cpy.Confirm = buf.Bytes()
+	return &cpy, nil
+}
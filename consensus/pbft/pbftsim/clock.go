@@ -0,0 +1,115 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbftsim
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/dpos/dtime"
+)
+
+// event is a callback scheduled to run at a given virtual time. Events with
+// the same deadline run in the order they were scheduled.
+type event struct {
+	at  time.Time
+	seq uint64
+	fn  func()
+}
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
+
+// Clock is a discrete event scheduler driving the simulation. Virtual time
+// only moves forward when Run is called, so a simulation with the same seed
+// always replays the same interleaving of messages and timers.
+type Clock struct {
+	now   time.Time
+	seq   uint64
+	queue eventQueue
+}
+
+// NewClock creates a virtual clock starting at the given time.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current virtual time.
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+// AfterFunc schedules fn to run once the virtual time has advanced by d.
+func (c *Clock) AfterFunc(d time.Duration, fn func()) {
+	if d < 0 {
+		d = 0
+	}
+	c.seq++
+	heap.Push(&c.queue, &event{at: c.now.Add(d), seq: c.seq, fn: fn})
+}
+
+// Step runs the next pending event, advancing the virtual time to its
+// deadline. It reports false if no event was scheduled before the limit.
+func (c *Clock) Step(limit time.Time) bool {
+	if len(c.queue) == 0 || c.queue[0].at.After(limit) {
+		return false
+	}
+	e := heap.Pop(&c.queue).(*event)
+	if e.at.After(c.now) {
+		c.now = e.at
+	}
+	e.fn()
+	return true
+}
+
+// Run processes all events scheduled within the next d of virtual time.
+func (c *Clock) Run(d time.Duration) {
+	limit := c.now.Add(d)
+	for c.Step(limit) {
+	}
+	c.now = limit
+}
+
+// nodeTime is the median time source handed to a node's dispatcher. It reads
+// the shared virtual clock shifted by the node's own skew.
+type nodeTime struct {
+	clock *Clock
+	skew  time.Duration
+}
+
+// Ensure nodeTime implement dtime.MedianTimeSource interface.
+var _ dtime.MedianTimeSource = (*nodeTime)(nil)
+
+func (t *nodeTime) AdjustedTime() time.Time {
+	return t.clock.Now().Add(t.skew)
+}
+
+func (t *nodeTime) AddTimeSample(id string, timeVal time.Time) {}
+
+func (t *nodeTime) Offset() time.Duration {
+	return t.skew
+}
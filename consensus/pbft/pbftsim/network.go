@@ -0,0 +1,243 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbftsim
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
+	dmsg "github.com/elastos/Elastos.ELA.SideChain.ESC/dpos/msg"
+
+	"github.com/elastos/Elastos.ELA/dpos/p2p"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/msg"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	elap2p "github.com/elastos/Elastos.ELA/p2p"
+)
+
+var errUnknownPeer = errors.New("unknown peer")
+
+// Filter decides whether a message travelling from one node to another is
+// dropped. It is consulted in addition to the random drop rate.
+type Filter func(from, to int, m elap2p.Message) bool
+
+// NetworkStats counts the traffic seen by the simulated network.
+type NetworkStats struct {
+	Sent      int
+	Dropped   int
+	Delivered int
+}
+
+// Network is an in-memory replacement of the DPoS p2p network. Messages are
+// serialized on send and decoded on delivery, so every node works on its own
+// copy exactly as it would over TCP.
+type Network struct {
+	clock *Clock
+	rand  *rand.Rand
+	nodes []*Node
+
+	latency  time.Duration
+	jitter   time.Duration
+	dropRate float64
+	filter   Filter
+	groups   map[int]int // node index -> partition group, empty if connected
+
+	stats NetworkStats
+}
+
+func newNetwork(clock *Clock, seed int64, latency, jitter time.Duration, dropRate float64) *Network {
+	return &Network{
+		clock:    clock,
+		rand:     rand.New(rand.NewSource(seed)),
+		latency:  latency,
+		jitter:   jitter,
+		dropRate: dropRate,
+		groups:   make(map[int]int),
+	}
+}
+
+// SetLatency changes the base delay and the random jitter added to every
+// delivered message.
+func (n *Network) SetLatency(latency, jitter time.Duration) {
+	n.latency, n.jitter = latency, jitter
+}
+
+// SetDropRate sets the probability in [0, 1] of a message being lost.
+func (n *Network) SetDropRate(rate float64) {
+	n.dropRate = rate
+}
+
+// SetFilter installs a custom drop rule, nil removes it.
+func (n *Network) SetFilter(filter Filter) {
+	n.filter = filter
+}
+
+// Partition splits the network into the given groups of node indexes. Nodes
+// in different groups can't reach each other, nodes not listed in any group
+// are isolated.
+func (n *Network) Partition(groups ...[]int) {
+	n.groups = make(map[int]int)
+	for i := range n.nodes {
+		n.groups[i] = -1 - i
+	}
+	for g, group := range groups {
+		for _, index := range group {
+			n.groups[index] = g
+		}
+	}
+}
+
+// Heal removes all partitions.
+func (n *Network) Heal() {
+	n.groups = make(map[int]int)
+}
+
+// Stats returns the traffic counters.
+func (n *Network) Stats() NetworkStats {
+	return n.stats
+}
+
+func (n *Network) connected(from, to int) bool {
+	if !n.nodes[from].online || !n.nodes[to].online {
+		return false
+	}
+	if len(n.groups) == 0 {
+		return true
+	}
+	return n.groups[from] == n.groups[to]
+}
+
+func (n *Network) indexOf(id peer.PID) int {
+	for i, node := range n.nodes {
+		if node.pid.Equal(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *Network) send(from, to int, m elap2p.Message) {
+	n.stats.Sent++
+	if !n.connected(from, to) || n.rand.Float64() < n.dropRate ||
+		(n.filter != nil && n.filter(from, to, m)) {
+		n.stats.Dropped++
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := m.Serialize(buf); err != nil {
+		dpos.Error("[pbftsim] serialize message error", m.CMD(), err)
+		n.stats.Dropped++
+		return
+	}
+	cmd := m.CMD()
+	delay := n.latency
+	if n.jitter > 0 {
+		delay += time.Duration(n.rand.Int63n(int64(n.jitter)))
+	}
+	n.clock.AfterFunc(delay, func() {
+		if !n.connected(from, to) {
+			n.stats.Dropped++
+			return
+		}
+		message, err := createMessage(cmd)
+		if err == nil {
+			err = message.Deserialize(buf)
+		}
+		if err != nil {
+			dpos.Error("[pbftsim] decode message error", cmd, err)
+			n.stats.Dropped++
+			return
+		}
+		n.stats.Delivered++
+		n.nodes[to].handleMessage(n.nodes[from].pid, message)
+	})
+}
+
+func createMessage(cmd string) (message elap2p.Message, err error) {
+	switch cmd {
+	case elap2p.CmdBlock:
+		message = dmsg.NewBlockMsg([]byte{})
+	case msg.CmdAcceptVote:
+		message = &msg.Vote{Command: msg.CmdAcceptVote}
+	case msg.CmdReceivedProposal:
+		message = &msg.Proposal{}
+	case msg.CmdRejectVote:
+		message = &msg.Vote{Command: msg.CmdRejectVote}
+	case msg.CmdGetBlock:
+		message = &msg.GetBlock{}
+	case msg.CmdGetBlocks:
+		message = &msg.GetBlocks{}
+	case msg.CmdRequestConsensus:
+		message = &dmsg.RequestConsensus{}
+	case msg.CmdResponseConsensus:
+		message = &dmsg.ResponseConsensus{}
+	case msg.CmdRequestProposal:
+		message = &msg.RequestProposal{}
+	case msg.CmdResetConsensusView:
+		message = &msg.ResetView{}
+	default:
+		return nil, errors.New("unsupported message, CMD " + cmd)
+	}
+	return message, nil
+}
+
+// simPeer is the p2p.Peer reported by GetActivePeers.
+type simPeer struct {
+	pid peer.PID
+}
+
+func (p *simPeer) PID() peer.PID { return p.pid }
+
+func (p *simPeer) ToPeer() *peer.Peer { return nil }
+
+// endpoint is the view of the network owned by one node.
+type endpoint struct {
+	net   *Network
+	index int
+}
+
+// Ensure endpoint implement dpos.DPOSNetwork interface.
+var _ dpos.DPOSNetwork = (*endpoint)(nil)
+
+func (e *endpoint) Start() {
+	e.net.nodes[e.index].online = true
+}
+
+func (e *endpoint) Stop() error {
+	e.net.nodes[e.index].online = false
+	return nil
+}
+
+func (e *endpoint) SendMessageToPeer(id peer.PID, m elap2p.Message) error {
+	to := e.net.indexOf(id)
+	if to < 0 {
+		return errUnknownPeer
+	}
+	e.net.send(e.index, to, m)
+	return nil
+}
+
+func (e *endpoint) BroadcastMessage(m elap2p.Message) {
+	for to := range e.net.nodes {
+		if to != e.index {
+			e.net.send(e.index, to, m)
+		}
+	}
+}
+
+func (e *endpoint) UpdatePeers(peers []peer.PID) {}
+
+func (e *endpoint) GetActivePeers() []p2p.Peer {
+	peers := make([]p2p.Peer, 0, len(e.net.nodes))
+	for to, node := range e.net.nodes {
+		if to != e.index && e.net.connected(e.index, to) {
+			peers = append(peers, &simPeer{pid: node.pid})
+		}
+	}
+	return peers
+}
@@ -0,0 +1,788 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbftsim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
+	dmsg "github.com/elastos/Elastos.ELA.SideChain.ESC/dpos/msg"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+
+	elacom "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	daccount "github.com/elastos/Elastos.ELA/dpos/account"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/msg"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	elap2p "github.com/elastos/Elastos.ELA/p2p"
+)
+
+const (
+	// changeViewInterval mirrors the change view loop of the pbft engine.
+	changeViewInterval = time.Second
+
+	// recoverTimeout and recoverInterval mirror recoverAbnormalState.
+	recoverTimeout  = 3 * time.Second
+	recoverInterval = 100 * time.Millisecond
+)
+
+var (
+	errSealOver          = errors.New("seal block is over, can't confirm")
+	errNotConfirmCurrent = errors.New("is not confirm current proposal")
+)
+
+type pendingProposal struct {
+	id       peer.PID
+	proposal *payload.DPOSProposal
+}
+
+// Node is a simulated block producer. It owns a real dpos.Dispatcher and
+// reacts to network messages and timers the same way the pbft engine does
+// in consensus/pbft/network.go, with the block chain reduced to a list of
+// confirmed blocks.
+type Node struct {
+	index      int
+	sim        *Simulator
+	account    daccount.Account
+	pid        peer.PID
+	network    *endpoint
+	timeSource *nodeTime
+	dispatcher *dpos.Dispatcher
+	online     bool
+	epoch      uint64 // bumped on stop to discard the timers of a crashed node
+
+	chain              []*Block
+	blocks             map[elacom.Uint256]*Block
+	futureBlocks       map[uint64]*Block
+	confirms           map[elacom.Uint256]*payload.Confirm
+	pendingProposals   map[elacom.Uint256]*pendingProposal
+	requestedProposals map[elacom.Uint256]struct{}
+	notHandledProposal map[string]struct{}
+	syncTarget         uint64
+
+	enableViewLoop bool
+	sealing        *Block
+	sealConfirm    *payload.Confirm
+	isSealOver     bool
+
+	isRecoved      bool
+	isRecovering   bool
+	recoverStarted bool
+	statusMap      map[uint32]map[string]*dmsg.ConsensusStatus
+}
+
+func newNode(sim *Simulator, index int, account daccount.Account, genesis *Block) *Node {
+	n := &Node{
+		index:      index,
+		sim:        sim,
+		account:    account,
+		network:    &endpoint{net: sim.network, index: index},
+		timeSource: &nodeTime{clock: sim.clock},
+		chain:      []*Block{genesis},
+	}
+	copy(n.pid[:], account.PublicKeyBytes())
+	n.reset()
+	return n
+}
+
+// reset drops all in-memory consensus state, as a process restart would.
+// Only the confirmed chain survives.
+func (n *Node) reset() {
+	n.dispatcher = dpos.NewDispatcher(n.sim.producers, n.onConfirm, n.onUnConfirm,
+		n.sim.config.ViewInterval, n.account.PublicKeyBytes(), n.timeSource, n, 0)
+	n.blocks = make(map[elacom.Uint256]*Block)
+	n.futureBlocks = make(map[uint64]*Block)
+	n.confirms = make(map[elacom.Uint256]*payload.Confirm)
+	n.pendingProposals = make(map[elacom.Uint256]*pendingProposal)
+	n.requestedProposals = make(map[elacom.Uint256]struct{})
+	n.notHandledProposal = make(map[string]struct{})
+	n.statusMap = make(map[uint32]map[string]*dmsg.ConsensusStatus)
+	n.syncTarget = 0
+	n.enableViewLoop = false
+	n.sealing, n.sealConfirm, n.isSealOver = nil, nil, false
+	n.isRecoved, n.isRecovering, n.recoverStarted = false, false, false
+	if head := n.Head(); head.Height > 0 {
+		hash := head.Hash()
+		n.dispatcher.FinishedProposal(head.Height, hash, head.Time)
+	}
+}
+
+// Index returns the position of the node in the producer list.
+func (n *Node) Index() int { return n.index }
+
+// PublicKey returns the producer public key of the node.
+func (n *Node) PublicKey() []byte { return n.account.PublicKeyBytes() }
+
+// Online reports whether the node is running.
+func (n *Node) Online() bool { return n.online }
+
+// Head returns the last confirmed block of the node.
+func (n *Node) Head() *Block { return n.chain[len(n.chain)-1] }
+
+// Height returns the height of the last confirmed block of the node.
+func (n *Node) Height() uint64 { return n.Head().Height }
+
+// BlockByHeight returns the confirmed block at the given height, or nil.
+func (n *Node) BlockByHeight(height uint64) *Block {
+	if height >= uint64(len(n.chain)) {
+		return nil
+	}
+	return n.chain[height]
+}
+
+// Dispatcher exposes the consensus dispatcher of the node.
+func (n *Node) Dispatcher() *dpos.Dispatcher { return n.dispatcher }
+
+// ViewOffset returns the current view offset of the node.
+func (n *Node) ViewOffset() uint32 {
+	return n.dispatcher.GetConsensusView().GetViewOffset()
+}
+
+// IsOnDuty reports whether the node believes it is the current proposer.
+func (n *Node) IsOnDuty() bool { return n.dispatcher.ProducerIsOnDuty() }
+
+// SetClockSkew shifts the local clock of the node relative to the virtual
+// clock of the simulation.
+func (n *Node) SetClockSkew(skew time.Duration) { n.timeSource.skew = skew }
+
+// Start brings the node online. A node that was stopped restarts with a
+// fresh consensus state and recovers it from its peers.
+func (n *Node) Start() {
+	if n.online {
+		return
+	}
+	n.network.Start()
+	n.reset()
+	n.Recover()
+}
+
+// Stop crashes the node: it leaves the network and all its timers are
+// discarded.
+func (n *Node) Stop() {
+	n.network.Stop()
+	n.epoch++
+}
+
+// Recover waits for enough active peers and then requests the consensus
+// status from them, like Pbft.Recover.
+func (n *Node) Recover() {
+	if n.isRecovering {
+		return
+	}
+	n.isRecovering = true
+	var try func()
+	try = func() {
+		if n.dispatcher.GetConsensusView().HasProducerMajorityCount(len(n.network.GetActivePeers())) {
+			n.isRecovering = false
+			n.recoverAbnormalState()
+			return
+		}
+		n.after(time.Second, try)
+	}
+	try()
+}
+
+// RequestAbnormalRecovering broadcasts a consensus status request.
+func (n *Node) RequestAbnormalRecovering() {
+	height := n.Height()
+	dpos.Info("[RequestAbnormalRecovering]", "node", n.index, "height", height)
+	n.broadcast(&dmsg.RequestConsensus{Height: height})
+}
+
+func (n *Node) now() time.Time {
+	return n.timeSource.AdjustedTime()
+}
+
+// after schedules fn on the virtual clock unless the node is stopped before.
+func (n *Node) after(d time.Duration, fn func()) {
+	epoch := n.epoch
+	n.sim.clock.AfterFunc(d, func() {
+		if n.online && n.epoch == epoch {
+			fn()
+		}
+	})
+}
+
+func (n *Node) broadcast(m elap2p.Message) {
+	if n.online {
+		n.network.BroadcastMessage(m)
+	}
+}
+
+func (n *Node) send(id peer.PID, m elap2p.Message) {
+	if n.online {
+		n.network.SendMessageToPeer(id, m)
+	}
+}
+
+func (n *Node) handleMessage(id peer.PID, m elap2p.Message) {
+	if !n.online {
+		return
+	}
+	switch m := m.(type) {
+	case *dmsg.BlockMsg:
+		n.onBlock(id, m)
+	case *msg.Proposal:
+		n.onProposalReceived(id, &m.Proposal)
+	case *msg.Vote:
+		n.onVoteAccepted(id, &m.Vote)
+	case *msg.GetBlock:
+		n.onGetBlock(id, m.BlockHash)
+	case *msg.GetBlocks:
+		n.onGetBlocks(id, uint64(m.StartBlockHeight), uint64(m.EndBlockHeight))
+	case *msg.RequestProposal:
+		n.onRequestProposal(id)
+	case *dmsg.RequestConsensus:
+		n.onRequestConsensus(id, m.Height)
+	case *dmsg.ResponseConsensus:
+		n.onResponseConsensus(id, &m.Consensus)
+	case *msg.ResetView:
+		n.onResponseResetViewReceived(m)
+	}
+}
+
+// prepare mirrors Pbft.Prepare followed by Pbft.Seal, run by the miner on
+// every new head.
+func (n *Node) prepare() {
+	if !n.isRecoved {
+		return
+	}
+	head := n.Head()
+	if head.Height+1 <= n.dispatcher.GetFinishedHeight() {
+		return
+	}
+	view := n.dispatcher.GetConsensusView()
+	if view.IsRunning() && n.enableViewLoop {
+		return
+	}
+	n.start(head.Time)
+	headerTime := head.Time + n.sim.config.BlockPeriod
+	if now := uint64(n.now().Unix()); headerTime < now {
+		headerTime = now
+		n.dispatcher.ResetView(now)
+	}
+	if !n.dispatcher.ProducerIsOnDuty() {
+		return
+	}
+	n.seal(&Block{
+		Height:     head.Height + 1,
+		ParentHash: head.Hash(),
+		Time:       headerTime,
+		Sponsor:    n.account.PublicKeyBytes(),
+	})
+}
+
+func (n *Node) start(headerTime uint64) {
+	view := n.dispatcher.GetConsensusView()
+	if !n.enableViewLoop {
+		n.enableViewLoop = true
+		view.SetChangViewTime(headerTime)
+		view.UpdateDutyIndex(n.Height())
+		n.changeViewLoop()
+	} else {
+		n.dispatcher.ResetView(headerTime)
+	}
+	view.SetRunning()
+}
+
+func (n *Node) changeViewLoop() {
+	n.after(changeViewInterval, func() {
+		n.onChangeView()
+		n.changeViewLoop()
+	})
+}
+
+func (n *Node) seal(block *Block) {
+	hash := block.Hash()
+	data, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		dpos.Error("[pbftsim] encode block error", err)
+		return
+	}
+	n.blocks[hash] = block
+	n.broadcast(dmsg.NewBlockMsg(data))
+
+	proposal, err := dpos.StartProposal(n.account, hash, n.ViewOffset())
+	if err != nil {
+		return
+	}
+	if err, _, _ := n.dispatcher.ProcessProposal(n.pid, proposal); err != nil {
+		dpos.Error("ProcessProposal error", "err", err)
+	}
+	n.broadcast(&msg.Proposal{Proposal: *proposal})
+
+	n.isSealOver = false
+	n.sealing, n.sealConfirm = block, nil
+	if voteMsg := n.dispatcher.AcceptProposal(proposal, n.account); voteMsg != nil {
+		vote := voteMsg.Vote
+		n.after(0, func() { n.onVoteAccepted(n.pid, &vote) })
+		n.broadcast(voteMsg)
+	}
+
+	// The sealer waits until the header time and then for the rest of the
+	// view before giving up on the proposal.
+	deadline := time.Unix(int64(block.Time), 0)
+	if changeViewTime := n.dispatcher.GetConsensusView().GetChangeViewTime(); changeViewTime.After(deadline) {
+		deadline = changeViewTime
+	}
+	n.after(deadline.Sub(n.now()), func() {
+		if n.sealing == block && n.sealConfirm == nil {
+			dpos.Warn("seal time out stop mine", "node", n.index, "height", block.Height)
+			n.sealing, n.isSealOver = nil, true
+		}
+	})
+}
+
+func (n *Node) finishSeal(block *Block) {
+	if n.sealing != block || n.sealConfirm == nil {
+		return
+	}
+	confirm := n.sealConfirm
+	n.sealing, n.sealConfirm, n.isSealOver = nil, nil, true
+	if block.Height != n.Height()+1 {
+		return
+	}
+	final, err := block.withConfirm(confirm)
+	if err != nil {
+		dpos.Error("confirm serialize error", "error", err)
+		return
+	}
+	data, err := rlp.EncodeToBytes(final)
+	if err != nil {
+		dpos.Error("[pbftsim] encode block error", err)
+		return
+	}
+	n.insertBlock(final)
+	n.broadcast(dmsg.NewBlockMsg(data))
+}
+
+// onConfirm is invoked by the dispatcher while it holds its vote lock, so
+// sealing is finished from a separate event.
+func (n *Node) onConfirm(confirm *payload.Confirm) error {
+	n.confirms[confirm.Proposal.BlockHash] = confirm
+	duty := n.dispatcher.ProducerIsOnDuty()
+	if n.isSealOver && duty {
+		return errSealOver
+	}
+	if duty {
+		curProposal := n.dispatcher.GetProcessingProposal()
+		if curProposal == nil || !curProposal.BlockHash.IsEqual(confirm.Proposal.BlockHash) {
+			return errNotConfirmCurrent
+		}
+		if block := n.sealing; block != nil && n.sealConfirm == nil {
+			n.sealConfirm = confirm
+			n.after(time.Unix(int64(block.Time), 0).Sub(n.now()), func() { n.finishSeal(block) })
+		}
+	}
+	return nil
+}
+
+func (n *Node) onUnConfirm(unconfirm *payload.Confirm) error {
+	if n.isSealOver {
+		return errors.New("seal block is over, can't unconfirm")
+	}
+	if n.dispatcher.ProducerIsOnDuty() && n.sealing != nil {
+		n.sealing, n.isSealOver = nil, true
+	}
+	return nil
+}
+
+func (n *Node) insertBlock(block *Block) {
+	n.chain = append(n.chain, block)
+	n.sim.onCommit(n, block)
+	n.dispatcher.FinishedProposal(block.Height, block.Hash(), block.Time)
+
+	for hash, b := range n.blocks {
+		if b.Height <= block.Height {
+			delete(n.blocks, hash)
+		}
+	}
+	for height := range n.futureBlocks {
+		if height <= block.Height {
+			delete(n.futureBlocks, height)
+		}
+	}
+	if n.sealing != nil && n.sealing.Height <= block.Height {
+		n.sealing, n.sealConfirm, n.isSealOver = nil, nil, true
+	}
+	if next, ok := n.futureBlocks[block.Height+1]; ok {
+		n.onConfirmedBlock(peer.PID{}, next)
+		return
+	}
+	n.after(0, n.prepare)
+}
+
+func (n *Node) verifyBlock(parent, block *Block) error {
+	if !block.ParentHash.IsEqual(parent.Hash()) {
+		return errors.New("unknown ancestor")
+	}
+	confirm, err := block.GetConfirm()
+	if err != nil {
+		return err
+	}
+	if !confirm.Proposal.BlockHash.IsEqual(block.Hash()) {
+		return errors.New("confirm is not for this block")
+	}
+	if !bytes.Equal(confirm.Proposal.Sponsor, block.Sponsor) {
+		return errors.New("confirm sponsor is not block sponsor")
+	}
+	return dpos.CheckConfirm(confirm, n.dispatcher.GetConsensusView().GetMajorityCount()+1)
+}
+
+func (n *Node) onBlock(id peer.PID, m *dmsg.BlockMsg) {
+	block := new(Block)
+	if err := rlp.DecodeBytes(m.GetData(), block); err != nil {
+		dpos.Error("[pbftsim] decode block error", err)
+		return
+	}
+	if len(block.Confirm) > 0 {
+		n.onConfirmedBlock(id, block)
+		return
+	}
+	if block.Height <= n.Height() || block.Height <= n.dispatcher.GetFinishedHeight() {
+		return
+	}
+	hash := block.Hash()
+	n.blocks[hash] = block
+	if p, ok := n.pendingProposals[hash]; ok {
+		delete(n.pendingProposals, hash)
+		n.onProposalReceived(p.id, p.proposal)
+	}
+}
+
+// onConfirmedBlock mirrors Pbft.OnBlockReceived: the block is held back
+// until its header time and then inserted on top of the local chain.
+func (n *Node) onConfirmedBlock(id peer.PID, block *Block) {
+	head := n.Head()
+	if block.Height <= head.Height {
+		return
+	}
+	if block.Height > head.Height+1 {
+		n.futureBlocks[block.Height] = block
+		n.requestBlocks(id, head.Height+1, block.Height-1)
+		return
+	}
+	if delay := time.Unix(int64(block.Time), 0).Sub(n.now()); delay > 0 {
+		n.after(delay, func() { n.onConfirmedBlock(id, block) })
+		return
+	}
+	if err := n.verifyBlock(head, block); err != nil {
+		dpos.Warn("verify block error", "node", n.index, "height", block.Height, "error", err)
+		return
+	}
+	n.insertBlock(block)
+}
+
+func (n *Node) requestBlocks(id peer.PID, from, to uint64) {
+	if to <= n.syncTarget {
+		return
+	}
+	n.syncTarget = to
+	n.send(id, &msg.GetBlocks{StartBlockHeight: uint32(from), EndBlockHeight: uint32(to)})
+}
+
+func (n *Node) onGetBlocks(id peer.PID, from, to uint64) {
+	for height := from; height <= to; height++ {
+		block := n.BlockByHeight(height)
+		if block == nil {
+			return
+		}
+		n.sendBlock(id, block)
+	}
+}
+
+func (n *Node) onGetBlock(id peer.PID, hash elacom.Uint256) {
+	if block, ok := n.blocks[hash]; ok {
+		n.sendBlock(id, block)
+		return
+	}
+	for _, block := range n.chain {
+		if block.Hash().IsEqual(hash) {
+			n.sendBlock(id, block)
+			return
+		}
+	}
+}
+
+func (n *Node) sendBlock(id peer.PID, block *Block) {
+	data, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		dpos.Error("[pbftsim] encode block error", err)
+		return
+	}
+	n.send(id, dmsg.NewBlockMsg(data))
+}
+
+func (n *Node) onRequestProposal(id peer.PID) {
+	if currentProposal := n.dispatcher.GetProcessingProposal(); currentProposal != nil {
+		n.send(id, &msg.Proposal{Proposal: *currentProposal})
+	}
+}
+
+func (n *Node) onProposalReceived(id peer.PID, proposal *payload.DPOSProposal) {
+	delete(n.requestedProposals, proposal.Hash())
+	if n.dispatcher.GetProcessingProposal() != nil {
+		return
+	}
+	if !n.dispatcher.GetConsensusView().IsRunning() {
+		return
+	}
+	n.onChangeView()
+
+	if proposal.BlockHash.IsEqual(n.dispatcher.GetFinishedBlockSealHash()) {
+		return
+	}
+	block, ok := n.blocks[proposal.BlockHash]
+	if !ok {
+		n.pendingProposals[proposal.BlockHash] = &pendingProposal{id: id, proposal: proposal}
+		n.send(id, msg.NewGetBlock(proposal.BlockHash))
+		return
+	}
+	head := n.Head()
+	if block.Height > head.Height+1 {
+		// Future proposal, wait syncing the missing blocks.
+		n.requestBlocks(id, head.Height+1, block.Height-1)
+		return
+	}
+	isBadProposal := block.Height != head.Height+1 || !block.ParentHash.IsEqual(head.Hash())
+
+	var voteMsg *msg.Vote
+	err, isSendReject, handled := n.dispatcher.ProcessProposal(id, proposal)
+	if err != nil {
+		if isSendReject {
+			voteMsg = n.dispatcher.RejectProposal(proposal, n.account)
+		} else if !handled {
+			n.notHandledProposal[common.Bytes2Hex(id[:])] = struct{}{}
+			count := len(n.notHandledProposal)
+			view := n.dispatcher.GetConsensusView()
+			if view.GetViewOffset() != 0 && view.HasArbitersMinorityCount(count) {
+				dpos.Info("[OnProposalReceived] has minority not handled proposals, need recover", "node", n.index)
+				n.recoverAbnormalState()
+			}
+		}
+	} else if isBadProposal {
+		voteMsg = n.dispatcher.RejectProposal(proposal, n.account)
+	} else {
+		voteMsg = n.dispatcher.AcceptProposal(proposal, n.account)
+	}
+
+	if handled {
+		n.notHandledProposal = make(map[string]struct{})
+	}
+	if voteMsg != nil && !n.dispatcher.GetProposalProcessFinished() {
+		n.broadcast(voteMsg)
+		n.dispatcher.SetProposalProcessFinished()
+	}
+}
+
+func (n *Node) tryGetCurrentProposal(id peer.PID, v *payload.DPOSProposalVote) (elacom.Uint256, bool) {
+	currentProposal := n.dispatcher.GetProcessingProposal()
+	if currentProposal == nil {
+		if v.ProposalHash.IsEqual(n.dispatcher.GetFinishedProposal()) {
+			return elacom.EmptyHash, true
+		}
+		if _, ok := n.requestedProposals[v.ProposalHash]; !ok {
+			n.send(id, &msg.RequestProposal{ProposalHash: v.ProposalHash})
+			n.requestedProposals[v.ProposalHash] = struct{}{}
+		}
+		return elacom.EmptyHash, false
+	}
+	return currentProposal.Hash(), true
+}
+
+func (n *Node) onVoteAccepted(id peer.PID, vote *payload.DPOSProposalVote) {
+	if !n.dispatcher.GetConsensusView().IsRunning() {
+		return
+	}
+	if n.dispatcher.GetFinishedProposal().IsEqual(vote.ProposalHash) {
+		return
+	}
+	if _, ok := n.confirms[vote.ProposalHash]; ok {
+		return
+	}
+	if n.sealing == nil && n.dispatcher.ProducerIsOnDuty() {
+		return
+	}
+	currentProposal, ok := n.tryGetCurrentProposal(id, vote)
+	if !ok {
+		n.dispatcher.AddPendingVote(vote)
+	} else if currentProposal.IsEqual(vote.ProposalHash) {
+		processingProposal := n.dispatcher.GetProcessingProposal()
+		if processingProposal == nil {
+			return
+		}
+		if _, ok := n.confirms[processingProposal.BlockHash]; ok {
+			return
+		}
+		if _, _, err := n.dispatcher.ProcessVote(vote); err != nil {
+			dpos.Info("ProcessVote error", "node", n.index, "err", err)
+		}
+	}
+}
+
+func (n *Node) onChangeView() {
+	n.dispatcher.OnChangeView()
+
+	if n.ViewOffset() >= n.sim.config.MaxViewOffset {
+		m := &msg.ResetView{Sponsor: n.account.PublicKeyBytes()}
+		buf := new(bytes.Buffer)
+		if err := m.SerializeUnsigned(buf); err != nil {
+			dpos.Error("failed to serialize ResetView message")
+			return
+		}
+		m.Sign = n.account.Sign(buf.Bytes())
+		n.broadcast(m)
+
+		// record self
+		if !n.dispatcher.ResetViewRequestIsContain(m.Sponsor) {
+			n.onResponseResetViewReceived(m)
+		}
+	}
+}
+
+// OnViewChanged implements dpos.ViewListener.
+func (n *Node) OnViewChanged(isOnDuty bool, force bool) {
+	if proposal := n.dispatcher.UpdatePrecociousProposals(); proposal != nil {
+		n.onProposalReceived(peer.PID{}, proposal)
+	}
+	if !force {
+		n.dispatcher.CleanProposals(true)
+		if isOnDuty {
+			n.dispatcher.GetConsensusView().SetReady()
+			n.after(0, n.prepare)
+		}
+	}
+}
+
+func (n *Node) onResponseResetViewReceived(m *msg.ResetView) {
+	if !n.dispatcher.IsProducer(m.Sponsor) {
+		return
+	}
+	if err := n.dispatcher.OnResponseResetViewReceived(m); err != nil {
+		return
+	}
+	if n.dispatcher.GetResetViewReqCount() >= n.dispatcher.GetConsensusView().GetMajorityCount() {
+		n.dispatcher.ResetConsensus(n.Height())
+		n.after(0, n.prepare)
+	}
+}
+
+func (n *Node) recoverAbnormalState() bool {
+	if n.recoverStarted {
+		return false
+	}
+	minCount := n.dispatcher.GetConsensusView().GetMajorityCount()
+	if peers := n.network.GetActivePeers(); len(peers) < minCount {
+		dpos.Error("[recoverAbnormalState] can not find active peer", "node", n.index, "minCount", minCount, "peers.size", len(peers))
+		return false
+	}
+	n.recoverStarted = true
+	n.RequestAbnormalRecovering()
+	startTime := n.sim.clock.Now()
+	var poll func()
+	poll = func() {
+		var count int
+		for _, v := range n.statusMap {
+			count += len(v)
+		}
+		if count > minCount || n.sim.clock.Now().Sub(startTime) > recoverTimeout {
+			n.onRecoverTimeout()
+			return
+		}
+		n.after(recoverInterval, poll)
+	}
+	poll()
+	return true
+}
+
+func (n *Node) onRecoverTimeout() {
+	if n.recoverStarted {
+		if len(n.statusMap) != 0 {
+			n.doRecover()
+		}
+		n.recoverStarted = false
+		n.statusMap = make(map[uint32]map[string]*dmsg.ConsensusStatus)
+	}
+	n.isRecoved = true
+	n.after(0, n.prepare)
+}
+
+func (n *Node) doRecover() {
+	var maxCountMaxViewOffset uint32
+	for k := range n.statusMap {
+		if maxCountMaxViewOffset < k {
+			maxCountMaxViewOffset = k
+		}
+	}
+	// Walk the responses in a fixed order to keep the simulation
+	// reproducible.
+	statuses := n.statusMap[maxCountMaxViewOffset]
+	keys := make([]string, 0, len(statuses))
+	for k := range statuses {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var status *dmsg.ConsensusStatus
+	startTimes := make([]int64, 0, len(keys))
+	for _, k := range keys {
+		v := statuses[k]
+		if status == nil {
+			if v.ConsensusStatus == dpos.ConsensusReady {
+				n.notHandledProposal = make(map[string]struct{})
+				return
+			}
+			status = v
+		}
+		startTimes = append(startTimes, v.ViewStartTime.UnixNano())
+	}
+	sort.Slice(startTimes, func(i, j int) bool {
+		return startTimes[i] < startTimes[j]
+	})
+	n.dispatcher.RecoverAbnormal(status, medianOf(startTimes))
+	n.notHandledProposal = make(map[string]struct{})
+}
+
+func medianOf(nums []int64) int64 {
+	l := len(nums)
+	if l == 0 {
+		return 0
+	}
+	if l%2 == 0 {
+		return (nums[l/2] + nums[l/2-1]) / 2
+	}
+	return nums[l/2]
+}
+
+func (n *Node) onRequestConsensus(id peer.PID, height uint64) {
+	status := n.dispatcher.HelpToRecoverAbnormal(id, height, n.Height())
+	if status != nil {
+		n.send(id, &dmsg.ResponseConsensus{Consensus: *status})
+	}
+}
+
+func (n *Node) onResponseConsensus(id peer.PID, status *dmsg.ConsensusStatus) {
+	if !n.recoverStarted {
+		return
+	}
+	pid := common.Bytes2Hex(id[:])
+	if n.statusMap[status.ViewOffset][pid] != nil {
+		return
+	}
+	if _, ok := n.statusMap[status.ViewOffset]; !ok {
+		n.statusMap[status.ViewOffset] = make(map[string]*dmsg.ConsensusStatus)
+	}
+	n.statusMap[status.ViewOffset][pid] = status
+}
+
+func (n *Node) String() string {
+	return fmt.Sprintf("node%d", n.index)
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+// Package pbftsim implements an in-process simulator for the PBFT consensus
+// of the side chain. A set of producers, each running a real dpos.Dispatcher
+// and the message handling of the pbft engine, are wired through a simulated
+// network on a virtual clock. Latency, message loss, partitions, crashes and
+// clock skew can be injected, and the safety and liveness of the resulting
+// chains checked, so consensus incidents can be replayed deterministically.
+package pbftsim
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
+
+	"github.com/elastos/Elastos.ELA/account"
+	elacom "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/elastos/Elastos.ELA/crypto"
+	daccount "github.com/elastos/Elastos.ELA/dpos/account"
+)
+
+// Config holds the parameters of a simulation.
+type Config struct {
+	Producers     int           // number of producers
+	Seed          int64         // seed of keys and network randomness
+	StartTime     time.Time     // genesis time
+	BlockPeriod   uint64        // seconds between two blocks
+	ViewInterval  time.Duration // duration of a view
+	MaxViewOffset uint32        // view offset triggering a reset view
+
+	Latency  time.Duration // base delay of a message
+	Jitter   time.Duration // random delay added to a message
+	DropRate float64       // probability of losing a message
+
+	LogLevel uint8  // dpos log level, 5 disables logging
+	LogPath  string // dpos log directory
+}
+
+// DefaultConfig is a four producers network with the main net timings and
+// a low latency link.
+var DefaultConfig = Config{
+	Producers:     4,
+	Seed:          1,
+	StartTime:     time.Unix(1600000000, 0),
+	BlockPeriod:   5,
+	ViewInterval:  5 * time.Second,
+	MaxViewOffset: 100,
+	Latency:       20 * time.Millisecond,
+	Jitter:        30 * time.Millisecond,
+	LogLevel:      5,
+}
+
+// Simulator runs a set of simulated producers.
+type Simulator struct {
+	config    Config
+	clock     *Clock
+	network   *Network
+	nodes     []*Node
+	producers [][]byte
+
+	commits    map[uint64]elacom.Uint256
+	violations []error
+}
+
+// New creates a simulator with the given configuration. The nodes are
+// created offline, Start brings them up.
+func New(config Config) (*Simulator, error) {
+	if config.Producers <= 0 {
+		return nil, errors.New("no producers")
+	}
+	if config.ViewInterval <= 0 {
+		return nil, errors.New("invalid view interval")
+	}
+	dpos.InitLog(config.LogLevel, 0, 0, config.LogPath)
+
+	s := &Simulator{
+		config:  config,
+		clock:   NewClock(config.StartTime),
+		commits: make(map[uint64]elacom.Uint256),
+	}
+	s.network = newNetwork(s.clock, config.Seed, config.Latency, config.Jitter, config.DropRate)
+
+	accounts := make([]daccount.Account, config.Producers)
+	for i := range accounts {
+		ac, err := newAccount(config.Seed, i)
+		if err != nil {
+			return nil, err
+		}
+		accounts[i] = ac
+		s.producers = append(s.producers, ac.PublicKeyBytes())
+	}
+	genesis := &Block{Time: uint64(config.StartTime.Unix())}
+	for i, ac := range accounts {
+		s.nodes = append(s.nodes, newNode(s, i, ac, genesis))
+	}
+	s.network.nodes = s.nodes
+	return s, nil
+}
+
+// newAccount derives the producer key of a node from the seed.
+func newAccount(seed int64, index int) (daccount.Account, error) {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(seed))
+	binary.BigEndian.PutUint64(buf[8:], uint64(index))
+	key := sha256.Sum256(buf[:])
+	ac, err := account.NewAccountWithPrivateKey(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return &simAccount{
+		Account: daccount.New(ac),
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{Curve: crypto.DefaultCurve, X: ac.PublicKey.X, Y: ac.PublicKey.Y},
+			D:         new(big.Int).SetBytes(ac.PrivKey()),
+		},
+	}, nil
+}
+
+// simAccount signs with a complete ecdsa key. crypto.Sign only fills in the
+// private scalar, which recent Go releases refuse to sign with. The
+// signatures keep the format expected by crypto.Verify.
+type simAccount struct {
+	daccount.Account
+	key *ecdsa.PrivateKey
+}
+
+func (a *simAccount) SignProposal(proposal *payload.DPOSProposal) ([]byte, error) {
+	return a.sign(proposal.Data())
+}
+
+func (a *simAccount) SignVote(vote *payload.DPOSProposalVote) ([]byte, error) {
+	return a.sign(vote.Data())
+}
+
+func (a *simAccount) Sign(data []byte) []byte {
+	sign, err := a.sign(data)
+	if err != nil {
+		return nil
+	}
+	return sign
+}
+
+func (a *simAccount) sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, crypto.SignatureLength)
+	r.FillBytes(signature[:crypto.SignerLength])
+	s.FillBytes(signature[crypto.SignerLength:])
+	return signature, nil
+}
+
+// Start brings all stopped nodes online.
+func (s *Simulator) Start() {
+	for _, n := range s.nodes {
+		n.Start()
+	}
+}
+
+// Now returns the virtual time.
+func (s *Simulator) Now() time.Time { return s.clock.Now() }
+
+// Clock returns the virtual clock of the simulation.
+func (s *Simulator) Clock() *Clock { return s.clock }
+
+// Network returns the simulated network.
+func (s *Simulator) Network() *Network { return s.network }
+
+// Nodes returns all the nodes of the simulation.
+func (s *Simulator) Nodes() []*Node { return s.nodes }
+
+// Node returns the node at the given index.
+func (s *Simulator) Node(index int) *Node { return s.nodes[index] }
+
+// Run advances the simulation by d of virtual time.
+func (s *Simulator) Run(d time.Duration) {
+	s.clock.Run(d)
+}
+
+// RunUntil advances the simulation until cond holds or the timeout of
+// virtual time expires. It reports whether cond was met.
+func (s *Simulator) RunUntil(cond func() bool, timeout time.Duration) bool {
+	limit := s.clock.Now().Add(timeout)
+	for !cond() {
+		if !s.clock.Step(limit) {
+			s.clock.now = limit
+			return cond()
+		}
+	}
+	return true
+}
+
+// MinHeight returns the lowest chain height among the online nodes.
+func (s *Simulator) MinHeight() uint64 {
+	var min uint64
+	first := true
+	for _, n := range s.nodes {
+		if n.online && (first || n.Height() < min) {
+			min, first = n.Height(), false
+		}
+	}
+	return min
+}
+
+// MaxHeight returns the highest chain height among all nodes.
+func (s *Simulator) MaxHeight() uint64 {
+	var max uint64
+	for _, n := range s.nodes {
+		if n.Height() > max {
+			max = n.Height()
+		}
+	}
+	return max
+}
+
+func (s *Simulator) onCommit(n *Node, block *Block) {
+	hash := block.Hash()
+	if committed, ok := s.commits[block.Height]; ok {
+		if !committed.IsEqual(hash) {
+			s.violations = append(s.violations, fmt.Errorf("%s committed %s at height %d, conflicting with %s",
+				n, hash, block.Height, committed))
+		}
+		return
+	}
+	s.commits[block.Height] = hash
+}
+
+// CheckSafety verifies that no two nodes ever committed different blocks at
+// the same height and that every committed block carries a valid confirm.
+func (s *Simulator) CheckSafety() error {
+	if len(s.violations) > 0 {
+		return s.violations[0]
+	}
+	for _, n := range s.nodes {
+		for height := 1; height < len(n.chain); height++ {
+			if err := n.verifyBlock(n.chain[height-1], n.chain[height]); err != nil {
+				return fmt.Errorf("%s has invalid block at height %d: %v", n, height, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckLiveness verifies that every online node reached at least the given
+// height.
+func (s *Simulator) CheckLiveness(height uint64) error {
+	for _, n := range s.nodes {
+		if n.online && n.Height() < height {
+			return fmt.Errorf("%s is stuck at height %d (view offset %d), want %d",
+				n, n.Height(), n.ViewOffset(), height)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbftsim
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestSimulator(t *testing.T, modify func(*Config)) *Simulator {
+	config := DefaultConfig
+	config.LogPath = t.TempDir()
+	if modify != nil {
+		modify(&config)
+	}
+	sim, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create simulator: %v", err)
+	}
+	sim.Start()
+	return sim
+}
+
+// runToHeight advances the simulation until all online nodes reached the
+// height and checks both invariants.
+func runToHeight(t *testing.T, sim *Simulator, height uint64, timeout time.Duration) {
+	t.Helper()
+	sim.RunUntil(func() bool { return sim.MinHeight() >= height }, timeout)
+	if err := sim.CheckSafety(); err != nil {
+		t.Fatalf("safety violated: %v", err)
+	}
+	if err := sim.CheckLiveness(height); err != nil {
+		t.Fatalf("liveness violated after %v: %v", timeout, err)
+	}
+}
+
+func TestNormalConsensus(t *testing.T) {
+	sim := newTestSimulator(t, nil)
+	runToHeight(t, sim, 20, 5*time.Minute)
+
+	// Every producer takes its turn in order.
+	for height := uint64(1); height <= 20; height++ {
+		block := sim.Node(0).BlockByHeight(height)
+		sponsor := sim.Node(int(height % 4)).PublicKey()
+		if string(block.Sponsor) != string(sponsor) {
+			t.Errorf("block %d sealed by wrong producer", height)
+		}
+	}
+}
+
+func TestDeterministicReplay(t *testing.T) {
+	config := func(c *Config) { c.DropRate = 0.05 }
+	simA := newTestSimulator(t, config)
+	simB := newTestSimulator(t, config)
+	simA.Run(3 * time.Minute)
+	simB.Run(3 * time.Minute)
+
+	if simA.MaxHeight() != simB.MaxHeight() {
+		t.Fatalf("height mismatch: %d != %d", simA.MaxHeight(), simB.MaxHeight())
+	}
+	for height := uint64(1); height <= simA.Node(0).Height(); height++ {
+		a, b := simA.Node(0).BlockByHeight(height), simB.Node(0).BlockByHeight(height)
+		if b == nil || !a.Hash().IsEqual(b.Hash()) {
+			t.Fatalf("chains diverge at height %d", height)
+		}
+	}
+}
+
+func TestCrashedProducer(t *testing.T) {
+	sim := newTestSimulator(t, nil)
+	runToHeight(t, sim, 5, 2*time.Minute)
+
+	// Stopping a producer makes the others change view whenever it is on
+	// duty.
+	sim.Node(1).Stop()
+	runToHeight(t, sim, 15, 5*time.Minute)
+
+	// A restarted producer recovers the consensus status and follows again.
+	sim.Node(1).Start()
+	runToHeight(t, sim, 25, 5*time.Minute)
+}
+
+func TestMinorityPartition(t *testing.T) {
+	sim := newTestSimulator(t, nil)
+	runToHeight(t, sim, 5, 2*time.Minute)
+
+	sim.Network().Partition([]int{0, 1, 2}, []int{3})
+	sim.RunUntil(func() bool { return sim.Node(0).Height() >= 15 }, 5*time.Minute)
+	if height := sim.Node(0).Height(); height < 15 {
+		t.Fatalf("majority stuck at height %d", height)
+	}
+	if height := sim.Node(3).Height(); height > 6 {
+		t.Fatalf("isolated producer advanced to height %d", height)
+	}
+
+	sim.Network().Heal()
+	runToHeight(t, sim, sim.MaxHeight()+5, 5*time.Minute)
+}
+
+func TestSplitPartition(t *testing.T) {
+	sim := newTestSimulator(t, nil)
+	runToHeight(t, sim, 5, 2*time.Minute)
+
+	// Without a majority on either side no block can be confirmed.
+	sim.Network().Partition([]int{0, 1}, []int{2, 3})
+	start := sim.MaxHeight()
+	sim.Run(2 * time.Minute)
+	if err := sim.CheckSafety(); err != nil {
+		t.Fatalf("safety violated: %v", err)
+	}
+	if height := sim.MaxHeight(); height > start+1 {
+		t.Fatalf("chain advanced without majority: %d -> %d", start, height)
+	}
+
+	sim.Network().Heal()
+	runToHeight(t, sim, sim.MaxHeight()+5, 10*time.Minute)
+}
+
+func TestMessageLoss(t *testing.T) {
+	sim := newTestSimulator(t, func(c *Config) {
+		c.DropRate = 0.1
+		c.Jitter = 500 * time.Millisecond
+	})
+	runToHeight(t, sim, 15, 10*time.Minute)
+
+	if stats := sim.Network().Stats(); stats.Dropped == 0 {
+		t.Error("no message dropped")
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	sim := newTestSimulator(t, nil)
+	sim.Node(0).SetClockSkew(time.Second)
+	sim.Node(2).SetClockSkew(-time.Second)
+	runToHeight(t, sim, 15, 5*time.Minute)
+}
+
+func TestRequestAbnormalRecovering(t *testing.T) {
+	sim := newTestSimulator(t, nil)
+	runToHeight(t, sim, 5, 2*time.Minute)
+
+	// Isolate a producer long enough for the others to move to another view,
+	// then let it recover the view from its peers.
+	sim.Network().Partition([]int{0, 1, 2}, []int{3})
+	sim.Run(30 * time.Second)
+	sim.Network().Heal()
+
+	node := sim.Node(3)
+	node.Dispatcher().GetConsensusView().SetRunning()
+	if !node.recoverAbnormalState() {
+		t.Fatal("recover not started")
+	}
+	sim.Run(5 * time.Second)
+	if node.recoverStarted {
+		t.Error("recover not finished")
+	}
+	runToHeight(t, sim, sim.MaxHeight()+5, 5*time.Minute)
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbft
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// ProducerStats counts the activity of a producer during an ELA turn.
+type ProducerStats struct {
+	Producer string `json:"producer"`
+	Proposed uint64 `json:"proposed"` // blocks sealed by the producer
+	Missed   uint64 `json:"missed"`   // views on duty that ended with a view change
+	Voted    uint64 `json:"voted"`    // confirms carrying the producer vote
+	NotVoted uint64 `json:"notVoted"` // confirms without the producer vote
+}
+
+// TurnStats is the producer activity over the blocks sealed by the same
+// producer set, identified by the ELA height stored in the header nonce.
+// Missed views are only counted when the producer order of the turn is
+// known.
+type TurnStats struct {
+	ElaHeight   uint64           `json:"elaHeight"`
+	FirstBlock  uint64           `json:"firstBlock"`
+	LastBlock   uint64           `json:"lastBlock"`
+	Blocks      uint64           `json:"blocks"`
+	ViewChanges uint64           `json:"viewChanges"`
+	Producers   []*ProducerStats `json:"producers"`
+
+	order []string // producers in duty order, nil if unknown
+	stats map[string]*ProducerStats
+}
+
+func newTurnStats(elaHeight, number uint64, producers [][]byte) *TurnStats {
+	turn := &TurnStats{
+		ElaHeight:  elaHeight,
+		FirstBlock: number,
+		stats:      make(map[string]*ProducerStats),
+	}
+	if len(producers) > 0 {
+		turn.order = make([]string, len(producers))
+		for i, producer := range producers {
+			turn.order[i] = common.Bytes2Hex(producer)
+		}
+	}
+	return turn
+}
+
+func (t *TurnStats) producer(pbk string) *ProducerStats {
+	stats, ok := t.stats[pbk]
+	if !ok {
+		stats = &ProducerStats{Producer: pbk}
+		t.stats[pbk] = stats
+	}
+	return stats
+}
+
+func (t *TurnStats) add(number uint64, confirm *payload.Confirm) {
+	t.LastBlock = number
+	t.Blocks++
+	t.ViewChanges += uint64(confirm.Proposal.ViewOffset)
+
+	sponsor := common.Bytes2Hex(confirm.Proposal.Sponsor)
+	t.producer(sponsor).Proposed++
+	voted := make(map[string]struct{}, len(confirm.Votes))
+	for _, vote := range confirm.Votes {
+		if !vote.Accept {
+			continue
+		}
+		signer := common.Bytes2Hex(vote.Signer)
+		if _, ok := voted[signer]; ok {
+			continue
+		}
+		voted[signer] = struct{}{}
+		t.producer(signer).Voted++
+	}
+
+	// The sponsor proposed at view offset k, so the k producers before it in
+	// duty order let their views expire.
+	index := -1
+	for i, pbk := range t.order {
+		if pbk == sponsor {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+	count := len(t.order)
+	for k := 1; k <= int(confirm.Proposal.ViewOffset); k++ {
+		pbk := t.order[((index-k)%count+count)%count]
+		if pbk != "" && pbk != zeroProducer {
+			t.producer(pbk).Missed++
+		}
+	}
+}
+
+// finish fills the producer list, current producers first in duty order.
+func (t *TurnStats) finish() {
+	listed := make(map[string]struct{})
+	for _, pbk := range t.order {
+		if pbk == "" || pbk == zeroProducer {
+			continue
+		}
+		if _, ok := listed[pbk]; ok {
+			continue
+		}
+		listed[pbk] = struct{}{}
+		t.Producers = append(t.Producers, t.producer(pbk))
+	}
+	others := make([]string, 0)
+	for pbk := range t.stats {
+		if _, ok := listed[pbk]; !ok {
+			others = append(others, pbk)
+		}
+	}
+	sort.Strings(others)
+	for _, pbk := range others {
+		t.Producers = append(t.Producers, t.stats[pbk])
+	}
+	for _, stats := range t.Producers {
+		stats.NotVoted = t.Blocks - stats.Voted
+	}
+}
+
+var zeroProducer = common.Bytes2Hex(make([]byte, 33))
+
+// CollectProducerStats walks the confirms sealed into the headers of the
+// blocks [from, to] and accounts the activity of the producers per ELA
+// turn. producersAt returns the producers of a turn in duty order, or nil
+// if they are unknown.
+func CollectProducerStats(chain consensus.ChainReader, from, to uint64,
+	producersAt func(elaHeight uint64) [][]byte) ([]*TurnStats, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid range [%d, %d]", from, to)
+	}
+	turns := make([]*TurnStats, 0)
+	var turn *TurnStats
+	for number := from; number <= to; number++ {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, fmt.Errorf("header #%d not found", number)
+		}
+		if number == 0 || !chain.Config().IsPBFTFork(header.Number) {
+			continue
+		}
+		var confirm payload.Confirm
+		if err := confirm.Deserialize(bytes.NewReader(header.Extra)); err != nil {
+			return nil, fmt.Errorf("invalid confirm in block #%d: %v", number, err)
+		}
+		elaHeight := header.Nonce.Uint64()
+		if turn == nil || turn.ElaHeight != elaHeight {
+			if turn != nil {
+				turn.finish()
+			}
+			turn = newTurnStats(elaHeight, number, producersAt(elaHeight))
+			turns = append(turns, turn)
+		}
+		turn.add(number, &confirm)
+	}
+	if turn != nil {
+		turn.finish()
+	}
+	return turns, nil
+}
+
+// TurnProducers returns the producers in duty order of the turn started at
+// the given ELA height. The genesis producers are used before the first
+// turn, later ones are read from the SPV module.
+func (p *Pbft) TurnProducers(elaHeight uint64) [][]byte {
+	if elaHeight == 0 {
+		producers := make([][]byte, len(p.cfg.Producers))
+		for i, v := range p.cfg.Producers {
+			producers[i] = common.Hex2Bytes(v)
+		}
+		return producers
+	}
+	producers, _, err := spv.GetProducers(elaHeight)
+	if err != nil {
+		return nil
+	}
+	return producers
+}
+
+// turnProducers returns the producers of the ELA turn and their total count,
+// so that the signatures verified against them are recorded with its height.
+func (p *Pbft) turnProducers(elaHeight uint64) ([][]byte, int, error) {
+	if elaHeight == 0 {
+		producers := p.TurnProducers(elaHeight)
+		return producers, len(producers), nil
+	}
+	if p.producersAt != nil {
+		return p.producersAt(elaHeight)
+	}
+	return spv.GetProducers(elaHeight)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbft
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfirm(sponsor byte, viewOffset uint32, signers ...byte) *payload.Confirm {
+	confirm := &payload.Confirm{
+		Proposal: payload.DPOSProposal{Sponsor: []byte{sponsor}, ViewOffset: viewOffset},
+	}
+	for _, signer := range signers {
+		confirm.Votes = append(confirm.Votes, payload.DPOSProposalVote{Signer: []byte{signer}, Accept: true})
+	}
+	return confirm
+}
+
+func TestTurnStats(t *testing.T) {
+	turn := newTurnStats(10, 100, [][]byte{{0x01}, {0x02}, {0x03}, {0x04}})
+	turn.add(100, testConfirm(0x01, 0, 0x01, 0x02, 0x03))
+	// 0x02 and 0x03 let their views expire.
+	turn.add(101, testConfirm(0x04, 2, 0x04, 0x01, 0x04, 0x03))
+	// 0x04 and 0x01 missed, wrapping around the duty order.
+	turn.add(102, testConfirm(0x02, 2, 0x02, 0x03, 0x05))
+	turn.finish()
+
+	assert.Equal(t, uint64(100), turn.FirstBlock)
+	assert.Equal(t, uint64(102), turn.LastBlock)
+	assert.Equal(t, uint64(3), turn.Blocks)
+	assert.Equal(t, uint64(4), turn.ViewChanges)
+	assert.Equal(t, []*ProducerStats{
+		{Producer: "01", Proposed: 1, Missed: 1, Voted: 2, NotVoted: 1},
+		{Producer: "02", Proposed: 1, Missed: 1, Voted: 2, NotVoted: 1},
+		{Producer: "03", Proposed: 0, Missed: 1, Voted: 3, NotVoted: 0},
+		{Producer: "04", Proposed: 1, Missed: 1, Voted: 1, NotVoted: 2},
+		{Producer: "05", Proposed: 0, Missed: 0, Voted: 1, NotVoted: 2},
+	}, turn.Producers)
+}
+
+func TestTurnStatsUnknownProducers(t *testing.T) {
+	turn := newTurnStats(10, 100, nil)
+	turn.add(100, testConfirm(0x02, 3, 0x01, 0x02))
+	turn.finish()
+
+	assert.Equal(t, uint64(3), turn.ViewChanges)
+	assert.Equal(t, []*ProducerStats{
+		{Producer: "01", Voted: 1},
+		{Producer: "02", Proposed: 1, Voted: 1},
+	}, turn.Producers)
+}
+
+func TestTurnProducersSource(t *testing.T) {
+	p := &Pbft{cfg: params.PbftConfig{Producers: []string{"01", "02"}}}
+	p.SetProducersSource(func(elaHeight uint64) ([][]byte, int, error) {
+		return [][]byte{{byte(elaHeight)}}, 3, nil
+	})
+	producers, total, err := p.turnProducers(0)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{{0x01}, {0x02}}, producers)
+	assert.Equal(t, 2, total)
+
+	producers, total, err = p.turnProducers(7)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{{0x07}}, producers)
+	assert.Equal(t, 3, total)
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbft
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
+
+	ecom "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/elastos/Elastos.ELA/crypto"
+)
+
+// ConfirmSigner is the check of one vote of a confirm.
+type ConfirmSigner struct {
+	Signer string `json:"signer"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ConfirmResult reports the check of the confirm sealed into a block header
+// against the producers of its ELA turn.
+type ConfirmResult struct {
+	Number     uint64          `json:"number"`
+	Hash       common.Hash     `json:"hash"`
+	ElaHeight  uint64          `json:"elaHeight"`
+	Sponsor    string          `json:"sponsor"`
+	ViewOffset uint32          `json:"viewOffset"`
+	Signers    []ConfirmSigner `json:"signers"`
+	Valid      int             `json:"valid"`    // valid votes of distinct producers
+	Required   int             `json:"required"` // votes required by the turn
+	Errors     []string        `json:"errors,omitempty"`
+}
+
+// OK reports whether the confirm is valid.
+func (r *ConfirmResult) OK() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *ConfirmResult) fail(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// ProducersFunc returns the producers of the turn working at an ELA height
+// and the count of signers its majority is computed from.
+type ProducersFunc func(elaHeight uint64) ([][]byte, int, error)
+
+// CheckHeaderConfirm verifies the confirm stored in the extra data of a
+// header without a running engine. Unlike verifySeal, every vote is checked
+// on its own, signers outside the producer set of the turn are not counted,
+// and the proposal must be the one of the header.
+func CheckHeaderConfirm(header *types.Header, producersAt ProducersFunc) *ConfirmResult {
+	result := &ConfirmResult{
+		Number:    header.Number.Uint64(),
+		Hash:      header.Hash(),
+		ElaHeight: header.Nonce.Uint64(),
+		Signers:   make([]ConfirmSigner, 0),
+	}
+	var confirm payload.Confirm
+	if err := confirm.Deserialize(bytes.NewReader(header.Extra)); err != nil {
+		result.fail("invalid confirm: %v", err)
+		return result
+	}
+	proposal := &confirm.Proposal
+	result.Sponsor = common.Bytes2Hex(proposal.Sponsor)
+	result.ViewOffset = proposal.ViewOffset
+
+	if sealHash := SealHash(header); !bytes.Equal(proposal.BlockHash.Bytes(), sealHash.Bytes()) {
+		result.fail("proposal of block %s, want %s", proposal.BlockHash, sealHash.Hex())
+	}
+	if err := verifySignature(proposal.Sponsor, proposal.Data(), proposal.Sign); err != nil {
+		result.fail("invalid proposal signature: %v", err)
+	}
+
+	producers, totalCount, err := producersAt(result.ElaHeight)
+	if err != nil {
+		result.fail("producers of ELA height %d unknown: %v", result.ElaHeight, err)
+		return result
+	}
+	result.Required = dpos.MajorityCount(totalCount)
+	members := make(map[string]struct{}, len(producers))
+	for _, producer := range producers {
+		members[common.Bytes2Hex(producer)] = struct{}{}
+	}
+	if _, ok := members[result.Sponsor]; !ok {
+		result.fail("sponsor %s is not a producer", result.Sponsor)
+	}
+
+	proposalHash := proposal.Hash()
+	counted := make(map[string]struct{}, len(confirm.Votes))
+	for _, vote := range confirm.Votes {
+		signer := ConfirmSigner{Signer: common.Bytes2Hex(vote.Signer)}
+		if err := checkConfirmVote(&vote, proposalHash); err != nil {
+			signer.Error = err.Error()
+		} else if _, ok := members[signer.Signer]; !ok {
+			signer.Error = "not a producer"
+		} else if _, ok := counted[signer.Signer]; ok {
+			signer.Error = "duplicate vote"
+		} else {
+			counted[signer.Signer] = struct{}{}
+		}
+		if signer.Error != "" {
+			result.fail("invalid vote of %s: %s", signer.Signer, signer.Error)
+		}
+		result.Signers = append(result.Signers, signer)
+	}
+	result.Valid = len(counted)
+	if result.Valid < result.Required {
+		result.fail("insufficient votes: %d of %d required", result.Valid, result.Required)
+	}
+	return result
+}
+
+// SetProducersSource makes the engine read the producers of the ELA turns
+// from fn instead of the SPV module, and reject the confirms signed by others.
+// Light clients use it to verify headers against the arbiter sets they track.
+func (p *Pbft) SetProducersSource(fn ProducersFunc) {
+	p.producersAt = fn
+}
+
+// checkConfirmSigners verifies that the sponsor and the signers of a confirm
+// are distinct producers of its turn.
+func checkConfirmSigners(confirm *payload.Confirm, producers [][]byte) error {
+	members := make(map[string]struct{}, len(producers))
+	for _, producer := range producers {
+		members[common.Bytes2Hex(producer)] = struct{}{}
+	}
+	if _, ok := members[common.Bytes2Hex(confirm.Proposal.Sponsor)]; !ok {
+		return fmt.Errorf("sponsor %s is not a producer", common.Bytes2Hex(confirm.Proposal.Sponsor))
+	}
+	signed := make(map[string]struct{}, len(confirm.Votes))
+	for _, vote := range confirm.Votes {
+		signer := common.Bytes2Hex(vote.Signer)
+		if _, ok := members[signer]; !ok {
+			return fmt.Errorf("signer %s is not a producer", signer)
+		}
+		if _, ok := signed[signer]; ok {
+			return fmt.Errorf("duplicate vote of %s", signer)
+		}
+		signed[signer] = struct{}{}
+	}
+	return nil
+}
+
+func checkConfirmVote(vote *payload.DPOSProposalVote, proposalHash ecom.Uint256) error {
+	if !vote.Accept {
+		return fmt.Errorf("reject vote")
+	}
+	if !proposalHash.IsEqual(vote.ProposalHash) {
+		return fmt.Errorf("vote of proposal %s", vote.ProposalHash)
+	}
+	if err := verifySignature(vote.Signer, vote.Data(), vote.Sign); err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	return nil
+}
+
+func verifySignature(publicKey, data, sign []byte) error {
+	pk, err := crypto.DecodePoint(publicKey)
+	if err != nil {
+		return err
+	}
+	return crypto.Verify(*pk, data, sign)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package pbft
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+
+	ecom "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSigner struct {
+	key    *ecdsa.PrivateKey
+	public []byte
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	key, err := ecdsa.GenerateKey(crypto.DefaultCurve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := (&crypto.PublicKey{X: key.X, Y: key.Y}).EncodePoint(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{key: key, public: public}
+}
+
+func (s *testSigner) sign(t *testing.T, data []byte) []byte {
+	digest := sha256.Sum256(data)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, crypto.SignatureLength)
+	r.FillBytes(signature[:crypto.SignerLength])
+	ss.FillBytes(signature[crypto.SignerLength:])
+	return signature
+}
+
+// sealTestHeader seals a confirm of the sponsor with the votes of signers
+// into a header.
+func sealTestHeader(t *testing.T, header *types.Header, sponsor *testSigner, signers ...*testSigner) {
+	sealHash := SealHash(header)
+	blockHash, _ := ecom.Uint256FromBytes(sealHash.Bytes())
+	confirm := payload.Confirm{Proposal: payload.DPOSProposal{Sponsor: sponsor.public, BlockHash: *blockHash}}
+	confirm.Proposal.Sign = sponsor.sign(t, confirm.Proposal.Data())
+	for _, signer := range signers {
+		vote := payload.DPOSProposalVote{ProposalHash: confirm.Proposal.Hash(), Signer: signer.public, Accept: true}
+		vote.Sign = signer.sign(t, vote.Data())
+		confirm.Votes = append(confirm.Votes, vote)
+	}
+	buf := new(bytes.Buffer)
+	if err := confirm.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	header.Extra = buf.Bytes()
+}
+
+func TestCheckHeaderConfirm(t *testing.T) {
+	signers := make([]*testSigner, 5)
+	producers := make([][]byte, 4)
+	for i := range signers {
+		signers[i] = newTestSigner(t)
+		if i < len(producers) {
+			producers[i] = signers[i].public
+		}
+	}
+	producersAt := func(elaHeight uint64) ([][]byte, int, error) {
+		if elaHeight != 100 {
+			return nil, 0, errors.New("unknown height")
+		}
+		return producers, len(producers), nil
+	}
+	newHeader := func() *types.Header {
+		return &types.Header{Number: big.NewInt(10), Difficulty: big.NewInt(1), Nonce: types.EncodeNonce(100)}
+	}
+
+	header := newHeader()
+	sealTestHeader(t, header, signers[0], signers[0], signers[1], signers[2])
+	result := CheckHeaderConfirm(header, producersAt)
+	assert.True(t, result.OK(), "%v", result.Errors)
+	assert.Equal(t, 3, result.Valid)
+	assert.Equal(t, 2, result.Required)
+	assert.Len(t, result.Signers, 3)
+
+	// Votes of outsiders or repeated votes are not counted.
+	header = newHeader()
+	sealTestHeader(t, header, signers[0], signers[0], signers[0], signers[4])
+	result = CheckHeaderConfirm(header, producersAt)
+	assert.Equal(t, 1, result.Valid)
+	assert.Equal(t, "duplicate vote", result.Signers[1].Error)
+	assert.Equal(t, "not a producer", result.Signers[2].Error)
+	assert.Contains(t, result.Errors, "insufficient votes: 1 of 2 required")
+
+	// A confirm moved to another header is rejected.
+	header = newHeader()
+	sealTestHeader(t, header, signers[0], signers[0], signers[1], signers[2])
+	header.Time = 1
+	result = CheckHeaderConfirm(header, producersAt)
+	assert.False(t, result.OK())
+	assert.Equal(t, 3, result.Valid)
+
+	// So is a confirm whose producers are unknown.
+	header = newHeader()
+	header.Nonce = types.EncodeNonce(200)
+	sealTestHeader(t, header, signers[0], signers[0], signers[1], signers[2])
+	result = CheckHeaderConfirm(header, producersAt)
+	assert.False(t, result.OK())
+	assert.Equal(t, 0, result.Valid)
+}
@@ -1,6 +1,9 @@
 package events
 
 import (
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
+
 	it "github.com/elastos/Elastos.ELA/core/types/interfaces"
 )
 
@@ -17,3 +20,35 @@ type InitCurrentProducers struct{}
 type CmallCrossTx struct {
 	Tx it.Transaction
 }
+
+// CrossChainEventKind identifies the cross-chain activity a CrossChainEvent reports.
+type CrossChainEventKind string
+
+const (
+	// RechargeDetected is posted when the spv service sees a deposit to this chain.
+	RechargeDetected CrossChainEventKind = "rechargeDetected"
+	// RechargePacked is posted when a recharge transaction is included in a block.
+	RechargePacked CrossChainEventKind = "rechargePacked"
+	// RechargeFailed is posted when a recharge is recorded as failed.
+	RechargeFailed CrossChainEventKind = "rechargeFailed"
+	// SmallCrossTxSignature is posted when an arbiter signature of a small
+	// cross transaction is verified.
+	SmallCrossTxSignature CrossChainEventKind = "smallCrossTxSignature"
+	// WithdrawRefundSignature is posted when an arbiter signature of a failed
+	// withdraw refund is verified.
+	WithdrawRefundSignature CrossChainEventKind = "withdrawRefundSignature"
+	// RefundExecuted is posted when a failed withdraw refund is included in a block.
+	RefundExecuted CrossChainEventKind = "refundExecuted"
+	// PledgeBillProcessed is posted when a pledge bill NFT payload is saved.
+	PledgeBillProcessed CrossChainEventKind = "pledgeBillProcessed"
+)
+
+// CrossChainEvent is posted when cross-chain activity happens on this node
+type CrossChainEvent struct {
+	Kind        CrossChainEventKind `json:"kind"`
+	ElaTxHash   string              `json:"elaTxHash,omitempty"`   // main chain transaction
+	EscTxHash   *common.Hash        `json:"escTxHash,omitempty"`   // side chain transaction
+	Signer      string              `json:"signer,omitempty"`      // arbiter public key of a verified signature
+	Signatures  hexutil.Uint        `json:"signatures,omitempty"`  // signatures verified so far
+	BlockNumber *hexutil.Uint64     `json:"blockNumber,omitempty"` // block including the side chain transaction
+}
@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus"
 	"math/big"
 
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/blocksigner"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+
+	"github.com/elastos/Elastos.ELA/core/types/payload"
 )
 
 //Evidence of evil signers
@@ -99,7 +104,6 @@ func (signers *EvilSignersMap) UpdateEvilSigners(signer common.Address, height *
 		evidences = v
 	} else {
 		(*signers)[signer] = evidences
-		spv.SendEvilProof(signer, nil)
 	}
 	evidence := evidences.getEvidence(height)
 	for index, hash := range hashes {
@@ -173,7 +177,7 @@ func ParseElaHeightFromHead(head *types.Header) (uint64, error) {
 
 // whether the block was created by evil signer.
 func IsNeedStopChain(headerNew, headerOld *types.Header, engine consensus.Engine, signers *EvilSignersMap,
-	journal *EvilJournal) bool {
+	journal *EvilJournal, db ethdb.KeyValueStore) bool {
 
 	hashOld := headerOld.Hash()
 	hashNew := headerNew.Hash()
@@ -196,6 +200,12 @@ func IsNeedStopChain(headerNew, headerOld *types.Header, engine consensus.Engine
 		return false
 	}
 
+	if db != nil && !rawdb.HasEvilEvidence(db, headerNew.Number.Uint64(), singerNew) {
+		evidence := &types.DoubleSignEvidence{Signer: singerNew, Header: headerOld, Compare: headerNew}
+		rawdb.WriteEvilEvidence(db, evidence)
+		spv.SendEvilProof(singerNew, EvilIllegalData(evidence))
+	}
+
 	addHashes, err := signers.UpdateEvilSigners(singerNew, headerNew.Number, []*common.Hash{&hashOld, &hashNew},
 		[]uint64{elaHeightOld, elaHeightNew})
 	if err != nil {
@@ -211,4 +221,35 @@ func IsNeedStopChain(headerNew, headerOld *types.Header, engine consensus.Engine
 	}
 
 	return signers.IsDanger(headerNew.Number, blocksigner.GetBlockSignersCount()*2/3)
-}
\ No newline at end of file
+}
+// VerifyEvilEvidence checks that the evidence holds two different headers of
+// the same height, both sealed by the accused signer.
+func VerifyEvilEvidence(engine consensus.Engine, evidence *types.DoubleSignEvidence) error {
+	if evidence.Header == nil || evidence.Compare == nil {
+		return errors.New("evidence is missing a header")
+	}
+	if evidence.Header.Number.Cmp(evidence.Compare.Number) != 0 {
+		return errors.New("evidence headers have different heights")
+	}
+	if evidence.Header.Hash() == evidence.Compare.Hash() {
+		return errors.New("evidence headers are the same")
+	}
+	for _, header := range []*types.Header{evidence.Header, evidence.Compare} {
+		signer, err := engine.Author(header)
+		if err != nil {
+			return err
+		}
+		if signer != evidence.Signer {
+			return fmt.Errorf("header %s is sealed by %s, not %s", header.Hash().String(), signer.String(),
+				evidence.Signer.String())
+		}
+	}
+	return nil
+}
+
+// EvilIllegalData converts the evidence to the illegal evidence payload
+// accepted by the ela chain.
+func EvilIllegalData(evidence *types.DoubleSignEvidence) *payload.SidechainIllegalData {
+	return spv.NewSidechainIllegalData(evidence.Signer.Bytes(), evidence.Number(), evidence.Header.Hash(),
+		evidence.Compare.Hash())
+}
@@ -218,4 +218,50 @@ func TestEvilSigners(t *testing.T)  {
 
 	dangerouChainSideSub.Unsubscribe()
 	time.Sleep(20 * time.Second)
-}
\ No newline at end of file
+}
+
+func TestEvilEvidence(t *testing.T) {
+	accounts := newTesterAccountPool()
+	blocksigner.Signers = map[common.Address]struct{}{accounts.address("A"): {}, accounts.address("B"): {}}
+
+	db := rawdb.NewMemoryDatabase()
+	engine := clique.New(&params.CliqueConfig{Period: 1, Epoch: 30000}, db)
+	newHeader := func(signer string, gasLimit uint64) *types.Header {
+		header := &types.Header{
+			Number:     big.NewInt(5),
+			GasLimit:   gasLimit,
+			Difficulty: big.NewInt(2),
+			Extra:      make([]byte, spv.ExtraVanity+spv.ExtraSeal+spv.ExtraElaHeight),
+		}
+		accounts.sign(header, signer, engine.SealHash)
+		return header
+	}
+	headerOld, headerNew := newHeader("A", 1000), newHeader("A", 2000)
+
+	IsNeedStopChain(headerNew, headerOld, engine, &EvilSignersMap{}, nil, db)
+	evidence := rawdb.ReadEvilEvidence(db, 5, accounts.address("A"))
+	if evidence == nil {
+		t.Fatal("evil evidence not stored")
+	}
+	if evidence.Header.Hash() != headerOld.Hash() || evidence.Compare.Hash() != headerNew.Hash() {
+		t.Errorf("evidence headers mismatch")
+	}
+	if err := VerifyEvilEvidence(engine, evidence); err != nil {
+		t.Errorf("valid evidence rejected: %v", err)
+	}
+	if list := rawdb.ReadEvilEvidences(db, 0, 4); len(list) != 0 {
+		t.Errorf("evidences out of range returned: %d", len(list))
+	}
+	if list := rawdb.ReadEvilEvidences(db, 5, 5); len(list) != 1 {
+		t.Errorf("evidences in range mismatch: have %d, want 1", len(list))
+	}
+
+	forged := &types.DoubleSignEvidence{Signer: accounts.address("A"), Header: headerOld, Compare: newHeader("B", 2000)}
+	if err := VerifyEvilEvidence(engine, forged); err == nil {
+		t.Error("evidence with a different signer accepted")
+	}
+	same := &types.DoubleSignEvidence{Signer: accounts.address("A"), Header: headerOld, Compare: headerOld}
+	if err := VerifyEvilEvidence(engine, same); err == nil {
+		t.Error("evidence with identical headers accepted")
+	}
+}
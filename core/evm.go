@@ -23,6 +23,7 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
 )
 
 // ChainContext supports retrieving headers and consensus parameters from the
@@ -35,6 +36,13 @@ type ChainContext interface {
 	GetHeader(common.Hash, uint64) *types.Header
 }
 
+// MainChainContext is implemented by chain contexts which carry their own ELA
+// main chain backend, such as a BlockChain with an injected backend.
+type MainChainContext interface {
+	// MainChainBackend retrieves the main chain backend of the chain.
+	MainChainBackend() spv.MainChainBackend
+}
+
 // NewEVMContext creates a new context for use in the EVM.
 func NewEVMContext(msg Message, header *types.Header, chain ChainContext, author *common.Address) vm.Context {
 	// If we don't have an explicit author (i.e. not mining), extract from the header
@@ -42,18 +50,22 @@ func NewEVMContext(msg Message, header *types.Header, chain ChainContext, author
 		beneficiary common.Address
 		baseFee     *big.Int
 		random      *common.Hash
+		mainChain   spv.MainChainBackend
 	)
 	if author == nil {
 		beneficiary, _ = chain.Engine().Author(header) // Ignore error, we're past header validation
 	} else {
 		beneficiary = *author
 	}
-	//if header.BaseFee != nil {
-	//	baseFee = new(big.Int).Set(header.BaseFee)
-	//}
+	if header.BaseFee != nil {
+		baseFee = new(big.Int).Set(header.BaseFee)
+	}
 	if header.Difficulty.Cmp(common.Big0) == 0 {
 		random = &header.MixDigest
 	}
+	if mc, ok := chain.(MainChainContext); ok {
+		mainChain = mc.MainChainBackend()
+	}
 	return vm.Context{
 		CanTransfer: CanTransfer,
 		Transfer:    Transfer,
@@ -67,6 +79,8 @@ func NewEVMContext(msg Message, header *types.Header, chain ChainContext, author
 		GasPrice:    new(big.Int).Set(msg.GasPrice()),
 		BaseFee:     baseFee,
 		Random:      random,
+		ElaHeight:   header.Nonce.Uint64(),
+		MainChain:   mainChain,
 	}
 }
 
@@ -0,0 +1,242 @@
+// Copyright 2016 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/smallcrosstx"
+
+	elaCrypto "github.com/elastos/Elastos.ELA/crypto"
+)
+
+// The frozen account list is stored in the storage of
+// params.FrozenAccountsAddress:
+//
+//	frozenCountSlot           -> number of frozen accounts
+//	frozenNonceSlot           -> nonce of the next list update
+//	frozenIndexSlot(i)        -> i-th frozen account
+//	frozenAccountSlot(addr)   -> index of addr in the list plus one, zero if not frozen
+var (
+	frozenCountSlot = crypto.Keccak256Hash([]byte("frozen-accounts-count"))
+	frozenNonceSlot = crypto.Keccak256Hash([]byte("frozen-accounts-nonce"))
+)
+
+var (
+	// ErrFrozenAccountsUpdate is returned if an update of the frozen account
+	// list is malformed or not signed by a majority of the arbiters.
+	ErrFrozenAccountsUpdate = errors.New("invalid frozen accounts update")
+)
+
+func frozenIndexSlot(index uint64) common.Hash {
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], index)
+	return crypto.Keccak256Hash([]byte("frozen-accounts-index"), enc[:])
+}
+
+func frozenAccountSlot(addr common.Address) common.Hash {
+	return crypto.Keccak256Hash([]byte("frozen-accounts-account"), addr.Bytes())
+}
+
+func getFrozenUint(db vm.StateDB, slot common.Hash) uint64 {
+	return db.GetState(params.FrozenAccountsAddress, slot).Big().Uint64()
+}
+
+func setFrozenUint(db vm.StateDB, slot common.Hash, value uint64) {
+	db.SetState(params.FrozenAccountsAddress, slot, common.BigToHash(new(big.Int).SetUint64(value)))
+}
+
+// IsAccountFrozen reports whether the account is in the on chain frozen
+// account list.
+func IsAccountFrozen(db vm.StateDB, addr common.Address) bool {
+	return db.GetState(params.FrozenAccountsAddress, frozenAccountSlot(addr)) != (common.Hash{})
+}
+
+// FrozenAccounts returns the on chain frozen account list.
+func FrozenAccounts(db vm.StateDB) []common.Address {
+	count := getFrozenUint(db, frozenCountSlot)
+	accounts := make([]common.Address, 0, count)
+	for i := uint64(0); i < count; i++ {
+		accounts = append(accounts, common.BytesToAddress(db.GetState(params.FrozenAccountsAddress, frozenIndexSlot(i)).Bytes()))
+	}
+	return accounts
+}
+
+// FrozenAccountsNonce returns the nonce the next update of the frozen account
+// list must carry.
+func FrozenAccountsNonce(db vm.StateDB) uint64 {
+	return getFrozenUint(db, frozenNonceSlot)
+}
+
+func freezeAccount(db vm.StateDB, addr common.Address) {
+	if IsAccountFrozen(db, addr) {
+		return
+	}
+	count := getFrozenUint(db, frozenCountSlot)
+	db.SetState(params.FrozenAccountsAddress, frozenIndexSlot(count), common.BytesToHash(addr.Bytes()))
+	setFrozenUint(db, frozenAccountSlot(addr), count+1)
+	setFrozenUint(db, frozenCountSlot, count+1)
+}
+
+func unfreezeAccount(db vm.StateDB, addr common.Address) {
+	position := getFrozenUint(db, frozenAccountSlot(addr))
+	if position == 0 {
+		return
+	}
+	// Move the last account of the list into the freed index
+	last := getFrozenUint(db, frozenCountSlot) - 1
+	if index := position - 1; index != last {
+		moved := db.GetState(params.FrozenAccountsAddress, frozenIndexSlot(last))
+		db.SetState(params.FrozenAccountsAddress, frozenIndexSlot(index), moved)
+		setFrozenUint(db, frozenAccountSlot(common.BytesToAddress(moved.Bytes())), position)
+	}
+	db.SetState(params.FrozenAccountsAddress, frozenIndexSlot(last), common.Hash{})
+	db.SetState(params.FrozenAccountsAddress, frozenAccountSlot(addr), common.Hash{})
+	setFrozenUint(db, frozenCountSlot, last)
+}
+
+// ApplyFrozenAccountsFork creates the frozen account list at the fork block,
+// seeded with the accounts of the chain config.
+func ApplyFrozenAccountsFork(db vm.StateDB, accounts []common.Address) {
+	// A nonce keeps the system account from being removed as empty
+	if db.GetNonce(params.FrozenAccountsAddress) == 0 {
+		db.SetNonce(params.FrozenAccountsAddress, 1)
+	}
+	for _, addr := range accounts {
+		freezeAccount(db, addr)
+	}
+}
+
+// FrozenAccountsUpdate changes the on chain frozen account list. It is the
+// data of a transaction to params.FrozenAccountsAddress, signed by a majority
+// of the arbiters of the ELA turn sealing the block including it.
+type FrozenAccountsUpdate struct {
+	Nonce      uint64
+	Freeze     []common.Address
+	Unfreeze   []common.Address
+	Signatures [][]byte
+}
+
+// DecodeFrozenAccountsUpdate decodes an update from transaction data.
+func DecodeFrozenAccountsUpdate(data []byte) (*FrozenAccountsUpdate, error) {
+	update := new(FrozenAccountsUpdate)
+	if err := rlp.DecodeBytes(data, update); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// SigData returns the data the arbiters sign to approve the update on the
+// chain of the given ID.
+func (u *FrozenAccountsUpdate) SigData(chainID *big.Int) []byte {
+	data, _ := rlp.EncodeToBytes([]interface{}{chainID, u.Nonce, u.Freeze, u.Unfreeze})
+	return data
+}
+
+// verify checks that the update is signed by the required majority of the
+// arbiters.
+func (u *FrozenAccountsUpdate) verify(chainID *big.Int, arbiters [][]byte, total int) error {
+	data := u.SigData(chainID)
+	signed := make(map[string]struct{}, len(u.Signatures))
+	for _, sig := range u.Signatures {
+		for _, arbiter := range arbiters {
+			if _, ok := signed[string(arbiter)]; ok {
+				continue
+			}
+			pubKey, err := elaCrypto.DecodePoint(arbiter)
+			if err != nil {
+				continue
+			}
+			if elaCrypto.Verify(*pubKey, data, sig) == nil {
+				signed[string(arbiter)] = struct{}{}
+				break
+			}
+		}
+	}
+	if required := smallcrosstx.GetMaxArbitersSign(total); len(signed) < required {
+		return fmt.Errorf("%d arbiter signatures, want %d", len(signed), required)
+	}
+	return nil
+}
+
+// apply changes the list and advances the update nonce.
+func (u *FrozenAccountsUpdate) apply(db vm.StateDB) {
+	for _, addr := range u.Freeze {
+		freezeAccount(db, addr)
+	}
+	for _, addr := range u.Unfreeze {
+		unfreezeAccount(db, addr)
+	}
+	setFrozenUint(db, frozenNonceSlot, u.Nonce+1)
+}
+
+// frozenAccountsArbiters returns the arbiters signing the updates included in
+// the blocks of the ELA height, and the count the majority is computed from.
+func frozenAccountsArbiters(evm *vm.EVM) ([][]byte, int, error) {
+	if evm.Context.ElaHeight == 0 {
+		config := evm.ChainConfig().Pbft
+		if config == nil {
+			return nil, 0, errors.New("no pbft producers")
+		}
+		arbiters := make([][]byte, 0, len(config.Producers))
+		for _, producer := range config.Producers {
+			arbiters = append(arbiters, common.Hex2Bytes(producer))
+		}
+		return arbiters, len(arbiters), nil
+	}
+	return evm.MainChain().GetProducers(evm.Context.ElaHeight)
+}
+
+// applyFrozenAccountsUpdate verifies the update carried by the message and
+// applies it to the state.
+func (st *StateTransition) applyFrozenAccountsUpdate() error {
+	if err := st.checkFrozenAccountsUpdate(); err != nil {
+		log.Warn("Rejected frozen accounts update", "from", st.msg.From(), "err", err)
+		return ErrFrozenAccountsUpdate
+	}
+	update, _ := DecodeFrozenAccountsUpdate(st.data)
+	update.apply(st.state)
+	log.Info("Frozen accounts updated", "nonce", update.Nonce, "freeze", len(update.Freeze), "unfreeze", len(update.Unfreeze))
+	return nil
+}
+
+func (st *StateTransition) checkFrozenAccountsUpdate() error {
+	if st.value.Sign() != 0 {
+		return errors.New("value transfer")
+	}
+	update, err := DecodeFrozenAccountsUpdate(st.data)
+	if err != nil {
+		return err
+	}
+	if nonce := FrozenAccountsNonce(st.state); update.Nonce != nonce {
+		return fmt.Errorf("nonce %d, want %d", update.Nonce, nonce)
+	}
+	arbiters, total, err := frozenAccountsArbiters(st.evm)
+	if err != nil {
+		return err
+	}
+	return update.verify(st.evm.ChainConfig().ChainID, arbiters, total)
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+
+	elaCrypto "github.com/elastos/Elastos.ELA/crypto"
+)
+
+// Tests that freezing and unfreezing keeps the stored list compact.
+func TestFrozenAccountsList(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	a, b, c := common.Address{0x0a}, common.Address{0x0b}, common.Address{0x0c}
+
+	ApplyFrozenAccountsFork(statedb, []common.Address{a, b})
+	if statedb.GetNonce(params.FrozenAccountsAddress) != 1 {
+		t.Fatalf("system account nonce not set")
+	}
+	(&FrozenAccountsUpdate{Freeze: []common.Address{c, a}, Unfreeze: []common.Address{a}}).apply(statedb)
+
+	if have, want := FrozenAccounts(statedb), []common.Address{c, b}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("frozen accounts mismatch: have %v, want %v", have, want)
+	}
+	if IsAccountFrozen(statedb, a) || !IsAccountFrozen(statedb, b) || !IsAccountFrozen(statedb, c) {
+		t.Fatalf("frozen account lookup mismatch")
+	}
+	if nonce := FrozenAccountsNonce(statedb); nonce != 1 {
+		t.Fatalf("update nonce mismatch: have %d, want 1", nonce)
+	}
+	(&FrozenAccountsUpdate{Nonce: 1, Unfreeze: []common.Address{c, b, c}}).apply(statedb)
+	if have := FrozenAccounts(statedb); len(have) != 0 {
+		t.Fatalf("frozen accounts left: %v", have)
+	}
+}
+
+// Tests that an update needs distinct signatures of a majority of the arbiters
+// over the data of its chain.
+func TestFrozenAccountsUpdateVerify(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	arbiters := make([][]byte, len(keys))
+	for i := range keys {
+		keys[i], _ = ecdsa.GenerateKey(elaCrypto.DefaultCurve, rand.Reader)
+		arbiters[i], _ = (&elaCrypto.PublicKey{X: keys[i].X, Y: keys[i].Y}).EncodePoint(true)
+	}
+	chainID := big.NewInt(20)
+	update := &FrozenAccountsUpdate{Nonce: 3, Freeze: []common.Address{{0x01}}}
+	sign := func(key *ecdsa.PrivateKey, chainID *big.Int) []byte {
+		digest := sha256.Sum256(update.SigData(chainID))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, elaCrypto.SignatureLength)
+		r.FillBytes(sig[:elaCrypto.SignerLength])
+		s.FillBytes(sig[elaCrypto.SignerLength:])
+		return sig
+	}
+	// Three of four arbiters are required, signing twice does not count
+	update.Signatures = [][]byte{sign(keys[0], chainID), sign(keys[1], chainID), sign(keys[1], chainID)}
+	if err := update.verify(chainID, arbiters, len(arbiters)); err == nil {
+		t.Fatalf("update verified without majority")
+	}
+	update.Signatures = append(update.Signatures, sign(keys[2], big.NewInt(21)))
+	if err := update.verify(chainID, arbiters, len(arbiters)); err == nil {
+		t.Fatalf("update verified with signature of another chain")
+	}
+	update.Signatures = append(update.Signatures, sign(keys[3], chainID))
+	if err := update.verify(chainID, arbiters, len(arbiters)); err != nil {
+		t.Fatalf("update not verified: %v", err)
+	}
+}
+
+// Tests that the pool rejects the transactions of accounts frozen on chain
+// after the fork.
+func TestTxPoolFrozenAccounts(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := *params.TestChainConfig
+	config.FrozenAccountsBlock = big.NewInt(0)
+	pool := NewTxPool(testTxPoolConfig, &config, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000))
+	if err := pool.AddRemote(transaction(0, 100000, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	ApplyFrozenAccountsFork(pool.currentState, []common.Address{from})
+	if err := pool.AddRemote(transaction(1, 100000, key)); err != ErrFrozenAccount {
+		t.Fatalf("frozen account error mismatch: have %v, want %v", err, ErrFrozenAccount)
+	}
+}
+
+// Tests that the pending and queued transactions of an account frozen by an
+// update of the on chain list are evicted on the next pool reset.
+func TestTxPoolEvictFrozenAccounts(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := *params.TestChainConfig
+	config.FrozenAccountsBlock = big.NewInt(0)
+	pool := NewTxPool(testTxPoolConfig, &config, blockchain)
+	defer pool.Stop()
+
+	frozenKey, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+	frozen := crypto.PubkeyToAddress(frozenKey.PublicKey)
+	other := crypto.PubkeyToAddress(otherKey.PublicKey)
+	statedb.AddBalance(frozen, big.NewInt(1000000))
+	statedb.AddBalance(other, big.NewInt(1000000))
+
+	txs := []*types.Transaction{
+		transaction(0, 100000, frozenKey),
+		transaction(1, 100000, frozenKey),
+		transaction(3, 100000, frozenKey), // queued
+		transaction(0, 100000, otherKey),
+	}
+	for i, err := range pool.AddRemotesSync(txs) {
+		if err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	if pending, queued := pool.Stats(); pending != 3 || queued != 1 {
+		t.Fatalf("pool mismatch: have %d pending %d queued, want 3 and 1", pending, queued)
+	}
+	(&FrozenAccountsUpdate{Freeze: []common.Address{frozen}}).apply(statedb)
+	<-pool.requestReset(nil, nil)
+
+	if pending, queued := pool.Stats(); pending != 1 || queued != 0 {
+		t.Fatalf("pool mismatch: have %d pending %d queued, want 1 and 0", pending, queued)
+	}
+	if pool.Get(txs[3].Hash()) == nil {
+		t.Fatalf("transaction of %x evicted", other)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
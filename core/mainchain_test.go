@@ -0,0 +1,131 @@
+// Copyright 2024 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/ethash"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+)
+
+var (
+	rechargeKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	rechargeSender  = crypto.PubkeyToAddress(rechargeKey.PublicKey)
+	rechargeTarget  = common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	rechargeElaHash = common.HexToHash("0x8ce6a6cf62f2bb2fbfd1a8bfdd01c6d59e9cf0cee0fbf4ccbfbab0d26c7a3b4d")
+)
+
+// newRechargeChain creates a chain whose main chain data is served by the
+// given simulated main chain.
+func newRechargeChain(t *testing.T, mainChain *spv.SimulatedMainChain) (*BlockChain, *Genesis) {
+	db := rawdb.NewMemoryDatabase()
+	gspec := &Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  GenesisAlloc{rechargeSender: {Balance: big.NewInt(params.Ether)}},
+	}
+	gspec.MustCommit(db)
+
+	engine := ethash.NewFaker()
+	blockchain, err := NewBlockChain(db, nil, gspec.Config, engine, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	blockchain.SetMainChainBackend(mainChain)
+	return blockchain, gspec
+}
+
+func newRechargeTx(nonce uint64, elaHash common.Hash) *types.Transaction {
+	tx := types.NewTransaction(nonce, common.Address{}, new(big.Int), 100000, big.NewInt(1), elaHash.Bytes())
+	signed, _ := types.SignTx(tx, types.MakeSigner(params.TestChainConfig, big.NewInt(1)), rechargeKey)
+	return signed
+}
+
+func TestRechargeWithSimulatedMainChain(t *testing.T) {
+	var (
+		amount    = new(big.Int).Mul(big.NewInt(10), big.NewInt(params.Ether))
+		fee       = big.NewInt(100000000000000)
+		mainChain = spv.NewSimulatedMainChain(nil)
+	)
+	mainChain.AddRecharge(rechargeElaHash.String(), &spv.RechargeData{
+		TargetAddress: rechargeTarget,
+		TargetAmount:  amount,
+		Fee:           fee,
+	})
+	mainChain.Commit()
+
+	blockchain, _ := newRechargeChain(t, mainChain)
+	defer blockchain.Stop()
+
+	tx := newRechargeTx(0, rechargeElaHash)
+	blocks, _ := GenerateChain(blockchain.Config(), blockchain.Genesis(), ethash.NewFaker(), blockchain.db, 1, func(i int, gen *BlockGen) {
+		gen.AddTxWithChain(blockchain, tx)
+	})
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert recharge block: %v", err)
+	}
+
+	statedb, err := blockchain.State()
+	if err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	if have, want := statedb.GetBalance(rechargeTarget), new(big.Int).Sub(amount, fee); have.Cmp(want) != 0 {
+		t.Errorf("target balance mismatch: have %v, want %v", have, want)
+	}
+	if have := statedb.GetState(common.Address{}, rechargeElaHash); have != tx.Hash() {
+		t.Errorf("recharge not marked complete: have %x, want %x", have, tx.Hash())
+	}
+}
+
+func TestRechargeFailedOnSimulatedMainChain(t *testing.T) {
+	mainChain := spv.NewSimulatedMainChain(nil)
+	mainChain.AddRecharge(rechargeElaHash.String(), &spv.RechargeData{
+		TargetAddress: rechargeTarget,
+		TargetAmount:  big.NewInt(params.Ether),
+		Fee:           big.NewInt(100000000000000),
+	})
+	mainChain.OnTx2Failed(rechargeElaHash.String())
+
+	blockchain, _ := newRechargeChain(t, mainChain)
+	defer blockchain.Stop()
+
+	statedb, _ := blockchain.State()
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Difficulty: big.NewInt(1),
+		GasLimit:   blockchain.CurrentBlock().GasLimit(),
+	}
+	var (
+		gp      = new(GasPool).AddGas(header.GasLimit)
+		usedGas uint64
+		author  common.Address
+	)
+	_, err := ApplyTransaction(blockchain.Config(), blockchain, &author, gp, statedb, header, newRechargeTx(0, rechargeElaHash), &usedGas, vm.Config{})
+	if err != ErrElaToEthAddress {
+		t.Fatalf("failed recharge error mismatch: have %v, want %v", err, ErrElaToEthAddress)
+	}
+	if balance := statedb.GetBalance(rechargeTarget); balance.Sign() != 0 {
+		t.Errorf("failed recharge credited target with %v", balance)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+)
+
+// HasEvilEvidence verifies the existence of double sign evidence of the signer
+// at the given height.
+func HasEvilEvidence(db ethdb.KeyValueReader, number uint64, signer common.Address) bool {
+	if has, err := db.Has(evilEvidenceKey(number, signer)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
+// ReadEvilEvidence retrieves the double sign evidence of the signer at the
+// given height.
+func ReadEvilEvidence(db ethdb.KeyValueReader, number uint64, signer common.Address) *types.DoubleSignEvidence {
+	data, _ := db.Get(evilEvidenceKey(number, signer))
+	if len(data) == 0 {
+		return nil
+	}
+	evidence := new(types.DoubleSignEvidence)
+	if err := rlp.Decode(bytes.NewReader(data), evidence); err != nil {
+		log.Error("Invalid evil evidence RLP", "number", number, "signer", signer, "err", err)
+		return nil
+	}
+	return evidence
+}
+
+// ReadEvilEvidences retrieves all double sign evidences with heights in the
+// range [from, to].
+func ReadEvilEvidences(db ethdb.Iteratee, from, to uint64) []*types.DoubleSignEvidence {
+	it := db.NewIteratorWithStart(append(evilEvidencePrefix, encodeBlockNumber(from)...))
+	defer it.Release()
+
+	var evidences []*types.DoubleSignEvidence
+	for it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, evilEvidencePrefix) {
+			break
+		}
+		if len(key) != len(evilEvidencePrefix)+8+common.AddressLength {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(evilEvidencePrefix):]) > to {
+			break
+		}
+		evidence := new(types.DoubleSignEvidence)
+		if err := rlp.DecodeBytes(it.Value(), evidence); err != nil {
+			log.Error("Invalid evil evidence RLP", "key", common.Bytes2Hex(key), "err", err)
+			continue
+		}
+		evidences = append(evidences, evidence)
+	}
+	return evidences
+}
+
+// WriteEvilEvidence stores the double sign evidence of a signer.
+func WriteEvilEvidence(db ethdb.KeyValueWriter, evidence *types.DoubleSignEvidence) {
+	data, err := rlp.EncodeToBytes(evidence)
+	if err != nil {
+		log.Crit("Failed to RLP encode evil evidence", "err", err)
+	}
+	if err := db.Put(evilEvidenceKey(evidence.Number(), evidence.Signer), data); err != nil {
+		log.Crit("Failed to store evil evidence", "err", err)
+	}
+}
@@ -90,8 +90,9 @@ type (
 		account *common.Address
 	}
 	resetObjectChange struct {
-		prev         *stateObject
-		prevdestruct bool
+		prev             *stateObject
+		prevdestruct     bool
+		prevsnapdestruct bool
 	}
 	suicideChange struct {
 		account     *common.Address
@@ -159,6 +160,9 @@ func (ch resetObjectChange) revert(s *StateDB) {
 	if !ch.prevdestruct {
 		delete(s.stateObjectsDestruct, ch.prev.address)
 	}
+	if !ch.prevsnapdestruct && s.snap != nil {
+		delete(s.snapDestructs, ch.prev.addrHash)
+	}
 }
 
 func (ch resetObjectChange) dirtied() *common.Address {
@@ -0,0 +1,443 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements the offline pruning of stale state trie nodes and
+// contract codes from the key-value store.
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
+)
+
+const (
+	// stateBloomFilePrefix is the filename prefix of state bloom filter.
+	stateBloomFilePrefix = "statebloom"
+
+	// stateBloomFileSuffix is the filename suffix of state bloom filter.
+	stateBloomFileSuffix = "bf.gz"
+
+	// stateBloomFileTempSuffix is the filename suffix of state bloom filter
+	// while it is being written out to detect write aborts.
+	stateBloomFileTempSuffix = ".tmp"
+
+	// rangeCompactionThreshold is the minimal deleted entry number for
+	// triggering range compaction. It's a quite arbitrary number but just
+	// to avoid triggering range compaction because of small deletion.
+	rangeCompactionThreshold = 100000
+
+	// pruneTargetDistance is the default number of blocks below the chain head
+	// whose state is retained.
+	pruneTargetDistance = 128
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256(nil)
+)
+
+// Pruner is an offline tool to prune the stale state with the help of a bloom
+// filter. The live states of the target and the genesis block are recorded into
+// the bloom by iterating their tries, after which every trie node and contract
+// code not in the bloom is deleted from the database.
+//
+// The pruning only works offline, any state modification running meanwhile
+// would be corrupted. It's resumable: once the bloom is committed to disk, an
+// interrupted deletion is finished by RecoverPruning.
+type Pruner struct {
+	db         ethdb.Database
+	stateBloom *stateBloom
+	datadir    string
+	headHeader *types.Header
+}
+
+// NewPruner creates the pruner instance.
+func NewPruner(db ethdb.Database, datadir string, bloomSize uint64) (*Pruner, error) {
+	headBlock := rawdb.ReadHeadBlockHash(db)
+	if headBlock == (common.Hash{}) {
+		return nil, errors.New("failed to load head block")
+	}
+	number := rawdb.ReadHeaderNumber(db, headBlock)
+	if number == nil {
+		return nil, errors.New("failed to load head block number")
+	}
+	headHeader := rawdb.ReadHeader(db, headBlock, *number)
+	if headHeader == nil {
+		return nil, errors.New("failed to load head header")
+	}
+	// Sanitize the bloom filter size if it's too small.
+	if bloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", bloomSize, "updated(MB)", 256)
+		bloomSize = 256
+	}
+	stateBloom, err := newStateBloomWithSize(bloomSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Pruner{
+		db:         db,
+		stateBloom: stateBloom,
+		datadir:    datadir,
+		headHeader: headHeader,
+	}, nil
+}
+
+// Prune deletes all the historical state nodes except the nodes belonging to the
+// specified state root and the genesis state. The root must be the state of one
+// of the recent canonical blocks, from HEAD-128 to HEAD. If the root is empty,
+// the state of the block HEAD-128 is retained, falling back to HEAD-127 which
+// is the one persisted by a clean node shutdown.
+//
+// The state of the chain head is deleted too, the node rewinds its head to the
+// target block on the next startup and reprocesses the blocks above it.
+func (p *Pruner) Prune(root common.Hash) error {
+	// If a state bloom filter was committed previously, a part of the state may
+	// already be deleted. That pruning must be finished first by RecoverPruning.
+	if filename, _, err := findBloomFilter(p.datadir); err != nil {
+		return err
+	} else if filename != "" {
+		return fmt.Errorf("interrupted pruning found (%s), recover it first", filename)
+	}
+	if root == (common.Hash{}) {
+		target, err := p.defaultTarget()
+		if err != nil {
+			return err
+		}
+		root = target.Root
+		log.Info("Selected pruning target", "number", target.Number, "hash", target.Hash(), "root", root)
+	} else {
+		target, err := p.recentTarget(root)
+		if err != nil {
+			return err
+		}
+		log.Info("Selected pruning target", "number", target.Number, "hash", target.Hash(), "root", root)
+	}
+	// Record all the live state nodes into the bloom filter
+	start := time.Now()
+	if err := commitState(p.db, root, p.stateBloom); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, p.stateBloom); err != nil {
+		return err
+	}
+	filename := bloomFilterName(p.datadir, root)
+
+	log.Info("Writing state bloom to disk", "name", filename)
+	if err := p.stateBloom.Commit(filename, filename+stateBloomFileTempSuffix); err != nil {
+		return err
+	}
+	log.Info("State bloom filter committed", "name", filename, "elapsed", common.PrettyDuration(time.Since(start)))
+	return prune(p.db, p.stateBloom, filename, start)
+}
+
+// defaultTarget picks the most recent block at least pruneTargetDistance-1
+// blocks below the chain head with its state present in the database.
+func (p *Pruner) defaultTarget() (*types.Header, error) {
+	head := p.headHeader.Number.Uint64()
+	for _, distance := range []uint64{pruneTargetDistance, pruneTargetDistance - 1} {
+		if head < distance {
+			continue
+		}
+		hash := rawdb.ReadCanonicalHash(p.db, head-distance)
+		header := rawdb.ReadHeader(p.db, hash, head-distance)
+		if header == nil {
+			continue
+		}
+		if ok, _ := p.db.Has(header.Root[:]); ok {
+			return header, nil
+		}
+	}
+	return nil, fmt.Errorf("no state available %d blocks below the head %d, specify the state root explicitly", pruneTargetDistance, head)
+}
+
+// recentTarget returns the recent canonical block with the given state root.
+// Older roots are rejected: pruning them would rewind the chain head far back,
+// or to the genesis if the root is not even canonical.
+func (p *Pruner) recentTarget(root common.Hash) (*types.Header, error) {
+	head := p.headHeader.Number.Uint64()
+	for distance := uint64(0); distance <= pruneTargetDistance && distance <= head; distance++ {
+		hash := rawdb.ReadCanonicalHash(p.db, head-distance)
+		header := rawdb.ReadHeader(p.db, hash, head-distance)
+		if header == nil || header.Root != root {
+			continue
+		}
+		if ok, _ := p.db.Has(root[:]); !ok {
+			return nil, fmt.Errorf("associated state[%x] is not present", root)
+		}
+		return header, nil
+	}
+	return nil, fmt.Errorf("state root %x is not one of the %d most recent canonical blocks", root, pruneTargetDistance+1)
+}
+
+// RecoverPruning will resume the pruning procedure during the system restart.
+// This function is used in this case: user tries to prune state data, but the
+// system was interrupted midway because of crash or manual-kill. In this case
+// if the bloom filter for filtering active state is already constructed, the
+// pruning can be resumed. What's more if the bloom filter is constructed, the
+// pruning **has to be resumed**. Otherwise a lot of dangling nodes may be left
+// in the disk.
+func RecoverPruning(datadir string, db ethdb.Database) error {
+	stateBloomPath, stateBloomRoot, err := findBloomFilter(datadir)
+	if err != nil {
+		return err
+	}
+	if stateBloomPath == "" {
+		return nil // nothing to recover
+	}
+	stateBloom, err := NewStateBloomFromDisk(stateBloomPath)
+	if err != nil {
+		return err
+	}
+	log.Info("Loaded state bloom filter", "path", stateBloomPath, "root", stateBloomRoot)
+	return prune(db, stateBloom, stateBloomPath, time.Now())
+}
+
+// prune deletes all the trie nodes and contract codes not recorded in the state
+// bloom, then drops the bloom file and compacts the database.
+func prune(db ethdb.Database, stateBloom *stateBloom, bloomPath string, start time.Time) error {
+	var (
+		count  int
+		size   common.StorageSize
+		pstart = time.Now()
+		logged = time.Now()
+		batch  = db.NewBatch()
+		iter   = db.NewIterator()
+	)
+	for iter.Next() {
+		key := common.CopyBytes(iter.Key())
+
+		// All state entries don't belong to the retained states will be deleted.
+		// Trie nodes and contract codes are both stored under their raw hashes.
+		if len(key) != common.HashLength {
+			continue
+		}
+		if ok, err := stateBloom.Contain(key); err != nil || ok {
+			continue
+		}
+		size += common.StorageSize(len(key) + len(iter.Value()))
+		batch.Delete(key)
+		count++
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				iter.Release()
+				return err
+			}
+			batch.Reset()
+
+			// Release the iterator to not hold on to the deleted data forever
+			iter.Release()
+			iter = db.NewIteratorWithStart(key)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(pstart)))
+			logged = time.Now()
+		}
+	}
+	err := iter.Error()
+	iter.Release()
+	if err != nil {
+		return err
+	}
+	if batch.ValueSize() > 0 {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	log.Info("Pruned state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(pstart)))
+
+	// The flat state snapshot is based on the chain head whose state was just
+	// deleted, wipe its root so it's regenerated on the next startup.
+	rawdb.DeleteSnapshotRoot(db)
+
+	// All the deletions are persisted, the bloom file is no longer needed
+	if err := os.RemoveAll(bloomPath); err != nil {
+		return err
+	}
+
+	// Start compactions, will remove the deleted data from the disk immediately.
+	// Note for small pruning, the compaction is skipped.
+	if count >= rangeCompactionThreshold {
+		cstart := time.Now()
+		for b := 0x00; b <= 0xf0; b += 0x10 {
+			var (
+				start = []byte{byte(b)}
+				end   = []byte{byte(b + 0x10)}
+			)
+			if b == 0xf0 {
+				end = nil
+			}
+			log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", start, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
+			if err := db.Compact(start, end); err != nil {
+				log.Error("Database compaction failed", "error", err)
+				return err
+			}
+		}
+		log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	}
+	log.Info("State pruning successful", "pruned", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// commitState records all the trie nodes and contract codes of the state with
+// the given root into the bloom filter.
+func commitState(db ethdb.Database, root common.Hash, bloom *stateBloom) error {
+	var (
+		triedb   = trie.NewDatabase(db)
+		storages = make(map[common.Hash]struct{})
+		accounts int
+		nodes    int
+		start    = time.Now()
+		logged   = time.Now()
+	)
+	accTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	it := accTrie.NodeIterator(nil)
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			bloom.Put(hash[:], nil)
+			nodes++
+		}
+		if !it.Leaf() {
+			continue
+		}
+		accounts++
+
+		var account state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &account); err != nil {
+			return err
+		}
+		if account.Root != emptyRoot {
+			// Storage tries may be shared by multiple accounts, only walk them
+			// once. The bloom can't be used for the check as a false positive
+			// would lose live data.
+			if _, ok := storages[account.Root]; !ok {
+				storages[account.Root] = struct{}{}
+
+				n, err := commitStorage(triedb, account.Root, bloom)
+				if err != nil {
+					return err
+				}
+				nodes += n
+			}
+		}
+		if !bytes.Equal(account.CodeHash, emptyCode) {
+			bloom.Put(account.CodeHash, nil)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Recording live state", "root", root, "accounts", accounts, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	log.Info("Recorded live state", "root", root, "accounts", accounts, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// commitStorage records all the nodes of a storage trie into the bloom filter,
+// returning the number of nodes recorded.
+func commitStorage(triedb *trie.Database, root common.Hash, bloom *stateBloom) (int, error) {
+	tr, err := trie.New(root, triedb)
+	if err != nil {
+		return 0, err
+	}
+	var nodes int
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			bloom.Put(hash[:], nil)
+			nodes++
+		}
+	}
+	return nodes, it.Error()
+}
+
+// extractGenesis records the genesis state into the bloom filter, it's still
+// needed to verify the genesis block on startup.
+func extractGenesis(db ethdb.Database, bloom *stateBloom) error {
+	genesisHash := rawdb.ReadCanonicalHash(db, 0)
+	if genesisHash == (common.Hash{}) {
+		return errors.New("missing genesis hash")
+	}
+	genesis := rawdb.ReadBlock(db, genesisHash, 0)
+	if genesis == nil {
+		return errors.New("missing genesis block")
+	}
+	if ok, _ := db.Has(genesis.Root().Bytes()); !ok {
+		return nil // Genesis state already pruned away, nothing to retain
+	}
+	return commitState(db, genesis.Root(), bloom)
+}
+
+// bloomFilterName returns the path of the bloom filter file retaining the state
+// with the given root.
+func bloomFilterName(datadir string, hash common.Hash) string {
+	return filepath.Join(datadir, fmt.Sprintf("%s.%s.%s", stateBloomFilePrefix, hash.Hex(), stateBloomFileSuffix))
+}
+
+// isBloomFilter reports whether the file name is a complete state bloom filter
+// and returns the state root it was generated for.
+func isBloomFilter(filename string) (bool, common.Hash) {
+	filename = filepath.Base(filename)
+	if strings.HasPrefix(filename, stateBloomFilePrefix) && strings.HasSuffix(filename, stateBloomFileSuffix) {
+		return true, common.HexToHash(filename[len(stateBloomFilePrefix)+1 : len(filename)-len(stateBloomFileSuffix)-1])
+	}
+	return false, common.Hash{}
+}
+
+// findBloomFilter looks for a committed state bloom filter in the data directory.
+func findBloomFilter(datadir string) (string, common.Hash, error) {
+	files, err := ioutil.ReadDir(datadir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", common.Hash{}, nil
+		}
+		return "", common.Hash{}, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if ok, root := isBloomFilter(file.Name()); ok {
+			return filepath.Join(datadir, file.Name()), root, nil
+		}
+	}
+	return "", common.Hash{}, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/ethash"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
+)
+
+// makeTestChain creates an archive chain with a different coinbase in every
+// block, so that each block has its own state persisted.
+func makeTestChain(t *testing.T, n int) (ethdb.Database, []*types.Block) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{common.Address{0xaa}: {Balance: big.NewInt(1)}}}
+		genesis = gspec.MustCommit(db)
+	)
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, n, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.BigToAddress(big.NewInt(int64(i + 1))))
+	})
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{TrieDirtyDisabled: true}, params.TestChainConfig, ethash.NewFaker(), ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	chain.Stop()
+
+	return db, append([]*types.Block{genesis}, blocks...)
+}
+
+// checkPruned verifies that only the target and genesis states survived.
+func checkPruned(t *testing.T, db ethdb.Database, blocks []*types.Block, target int) {
+	for _, i := range []int{0, target} {
+		tr, err := trie.New(blocks[i].Root(), trie.NewDatabase(db))
+		if err != nil {
+			t.Fatalf("state of block %d missing: %v", i, err)
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if err := it.Error(); err != nil {
+			t.Errorf("state of block %d incomplete: %v", i, err)
+		}
+	}
+	for _, i := range []int{1, target - 1, len(blocks) - 1} {
+		if ok, _ := db.Has(blocks[i].Root().Bytes()); ok {
+			t.Errorf("state of block %d not pruned", i)
+		}
+	}
+}
+
+// Tests that pruning retains the state HEAD-128 and the genesis and deletes
+// all the other states.
+func TestPrune(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, blocks := makeTestChain(t, 140)
+	rawdb.WriteSnapshotRoot(db, blocks[len(blocks)-1].Root())
+
+	pruner, err := NewPruner(db, datadir, 256)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := pruner.Prune(common.Hash{}); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	checkPruned(t, db, blocks, len(blocks)-1-pruneTargetDistance)
+
+	if root := rawdb.ReadSnapshotRoot(db); root != (common.Hash{}) {
+		t.Errorf("snapshot root not wiped: %x", root)
+	}
+	if filename, _, _ := findBloomFilter(datadir); filename != "" {
+		t.Errorf("state bloom not removed: %s", filename)
+	}
+}
+
+// Tests that only the state of a recent canonical block can be retained, the
+// database being left untouched otherwise.
+func TestPruneTargetTooOld(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, blocks := makeTestChain(t, 140)
+	head := len(blocks) - 1
+
+	pruner, err := NewPruner(db, datadir, 256)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	for _, root := range []common.Hash{blocks[head-pruneTargetDistance-1].Root(), blocks[0].Root(), {0x01}} {
+		if err := pruner.Prune(root); err == nil {
+			t.Fatalf("pruning allowed to root %x", root)
+		}
+	}
+	if filename, _, _ := findBloomFilter(datadir); filename != "" {
+		t.Errorf("state bloom written for a rejected target: %s", filename)
+	}
+	for _, i := range []int{1, head - pruneTargetDistance - 1, head} {
+		if ok, _ := db.Has(blocks[i].Root().Bytes()); !ok {
+			t.Errorf("state of block %d pruned", i)
+		}
+	}
+	// The oldest recent block is still a valid target
+	if err := pruner.Prune(blocks[head-pruneTargetDistance].Root()); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	checkPruned(t, db, blocks, head-pruneTargetDistance)
+}
+
+// Tests that a pruning interrupted after committing its state bloom can be
+// finished by the recovery.
+func TestRecoverPruning(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, blocks := makeTestChain(t, 20)
+	target := 10
+
+	// Construct and commit the bloom, but abort before deleting anything
+	bloom, err := newStateBloomWithSize(256)
+	if err != nil {
+		t.Fatalf("failed to create bloom: %v", err)
+	}
+	if err := commitState(db, blocks[target].Root(), bloom); err != nil {
+		t.Fatalf("failed to record state: %v", err)
+	}
+	if err := extractGenesis(db, bloom); err != nil {
+		t.Fatalf("failed to record genesis: %v", err)
+	}
+	filename := bloomFilterName(datadir, blocks[target].Root())
+	if err := bloom.Commit(filename, filename+stateBloomFileTempSuffix); err != nil {
+		t.Fatalf("failed to commit bloom: %v", err)
+	}
+	// A new pruning must be refused until the previous one is recovered
+	pruner, err := NewPruner(db, datadir, 256)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := pruner.Prune(blocks[target].Root()); err == nil {
+		t.Fatalf("pruning allowed with an interrupted one pending")
+	}
+	if err := RecoverPruning(datadir, db); err != nil {
+		t.Fatalf("failed to recover pruning: %v", err)
+	}
+	checkPruned(t, db, blocks, target)
+
+	// Recovering again must be a noop
+	if err := RecoverPruning(datadir, db); err != nil {
+		t.Fatalf("failed to recover pruning twice: %v", err)
+	}
+}
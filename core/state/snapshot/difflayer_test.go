@@ -0,0 +1,174 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+)
+
+// randomHash generates a random blob of data and returns it as a hash.
+func randomHash() common.Hash {
+	var hash common.Hash
+	if n, err := rand.Read(hash[:]); n != common.HashLength || err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// emptyLayer returns a disk layer with no backing data, usable as the base
+// for diff layer tests.
+func emptyLayer() *diskLayer {
+	return &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		cache:  fastcache.New(500 * 1024),
+	}
+}
+
+// Tests that merging something into a disk layer persists it into the database
+// and invalidates any previously written and cached values.
+func TestMergeBasics(t *testing.T) {
+	var (
+		destructs = make(map[common.Hash]struct{})
+		accounts  = make(map[common.Hash][]byte)
+		storage   = make(map[common.Hash]map[common.Hash][]byte)
+	)
+	// Fill up a parent
+	for i := 0; i < 100; i++ {
+		h := randomHash()
+		data := randomHash().Bytes()
+
+		accounts[h] = data
+		if rand.Intn(4) == 0 {
+			destructs[h] = struct{}{}
+		}
+		if rand.Intn(2) == 0 {
+			accStorage := make(map[common.Hash][]byte)
+			value := make([]byte, 32)
+			rand.Read(value)
+			accStorage[randomHash()] = value
+			storage[h] = accStorage
+		}
+	}
+	// Add some (identical) layers on top
+	parent := newDiffLayer(emptyLayer(), common.Hash{}, destructs, accounts, storage)
+	child := newDiffLayer(parent, common.Hash{}, destructs, accounts, storage)
+	child = newDiffLayer(child, common.Hash{}, destructs, accounts, storage)
+	child = newDiffLayer(child, common.Hash{}, destructs, accounts, storage)
+	child = newDiffLayer(child, common.Hash{}, destructs, accounts, storage)
+
+	// And flatten
+	merged := (child.flatten()).(*diffLayer)
+
+	if have, want := len(merged.destructSet), len(destructs); have != want {
+		t.Errorf("destructs wrong: have %d, want %d", have, want)
+	}
+	if have, want := len(merged.accountData), len(accounts); have != want {
+		t.Errorf("accounts wrong: have %d, want %d", have, want)
+	}
+	if have, want := len(merged.storageData), len(storage); have != want {
+		t.Errorf("storage wrong: have %d, want %d", have, want)
+	}
+}
+
+// Tests that deleting an account and recreating it in a later layer shadows
+// any storage held by the layers below.
+func TestMergeDelete(t *testing.T) {
+	var (
+		h1 = common.HexToHash("0x01")
+		h2 = common.HexToHash("0x02")
+		s1 = common.HexToHash("0x11")
+	)
+	flipDrops := func() map[common.Hash]struct{} {
+		return map[common.Hash]struct{}{h2: {}}
+	}
+	flipAccs := func() map[common.Hash][]byte {
+		return map[common.Hash][]byte{h1: randomHash().Bytes()}
+	}
+	flopDrops := func() map[common.Hash]struct{} {
+		return map[common.Hash]struct{}{h1: {}}
+	}
+	flopAccs := func() map[common.Hash][]byte {
+		return map[common.Hash][]byte{h2: randomHash().Bytes()}
+	}
+	storage := map[common.Hash]map[common.Hash][]byte{h1: {s1: []byte{0x01}}}
+
+	// Add some flipAccs-flopping layers on top
+	parent := newDiffLayer(emptyLayer(), common.Hash{}, flipDrops(), flipAccs(), storage)
+	child := parent.Update(common.Hash{}, flopDrops(), flopAccs(), nil)
+	child = child.Update(common.Hash{}, flipDrops(), flipAccs(), nil)
+
+	if data, _ := child.AccountRLP(h1); data == nil {
+		t.Errorf("last diff layer: expected %x account to be non-nil", h1)
+	}
+	if data, _ := child.AccountRLP(h2); data != nil {
+		t.Errorf("last diff layer: expected %x account to be nil", h2)
+	}
+	// The storage of h1 was dropped by the middle layer and must not resurface
+	if blob, err := child.Storage(h1, s1); err != nil || blob != nil {
+		t.Errorf("last diff layer: expected wiped storage, have %x (err %v)", blob, err)
+	}
+	// And flatten
+	merged := (child.flatten()).(*diffLayer)
+
+	if data, _ := merged.AccountRLP(h1); data == nil {
+		t.Errorf("merged layer: expected %x account to be non-nil", h1)
+	}
+	if data, _ := merged.AccountRLP(h2); data != nil {
+		t.Errorf("merged layer: expected %x account to be nil", h2)
+	}
+	if blob, err := merged.Storage(h1, s1); err != nil || blob != nil {
+		t.Errorf("merged layer: expected wiped storage, have %x (err %v)", blob, err)
+	}
+	if have, want := len(merged.destructSet), 2; have != want {
+		t.Errorf("destructs wrong: have %d, want %d", have, want)
+	}
+}
+
+// Tests that values set in a newer layer override those of older ones, both
+// before and after flattening.
+func TestMergeOverride(t *testing.T) {
+	var (
+		acc  = randomHash()
+		slot = randomHash()
+	)
+	parent := newDiffLayer(emptyLayer(), common.Hash{},
+		nil,
+		map[common.Hash][]byte{acc: {0x01}},
+		map[common.Hash]map[common.Hash][]byte{acc: {slot: {0x01}}},
+	)
+	child := parent.Update(common.Hash{},
+		nil,
+		map[common.Hash][]byte{acc: {0x02}},
+		map[common.Hash]map[common.Hash][]byte{acc: {slot: {0x02}}},
+	)
+	check := func(layer Snapshot, name string) {
+		if blob, _ := layer.AccountRLP(acc); !bytes.Equal(blob, []byte{0x02}) {
+			t.Errorf("%s: account mismatch: have %x, want %x", name, blob, []byte{0x02})
+		}
+		if blob, _ := layer.Storage(acc, slot); !bytes.Equal(blob, []byte{0x02}) {
+			t.Errorf("%s: storage mismatch: have %x, want %x", name, blob, []byte{0x02})
+		}
+	}
+	check(child, "child")
+	check(child.flatten(), "flattened")
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
+)
+
+// Tests that a snapshot generated from a state trie contains exactly the
+// accounts and storage slots of the trie.
+func TestGeneration(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		triedb = trie.NewDatabase(diskdb)
+	)
+	// Create a storage trie with a few slots
+	stTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+	slots := map[string][]byte{}
+	for i := byte(1); i <= 3; i++ {
+		key := []byte{'k', 'e', 'y', '-', i}
+		val, _ := rlp.EncodeToBytes([]byte{'v', 'a', 'l', '-', i})
+		stTrie.Update(key, val)
+		slots[string(key)] = val
+	}
+	stRoot, _ := stTrie.Commit(nil)
+
+	// Create an account trie referencing the storage trie
+	type account struct {
+		Nonce    uint64
+		Balance  *big.Int
+		Root     common.Hash
+		CodeHash []byte
+	}
+	accTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+	accs := map[string]account{
+		"acc-1": {Nonce: 0, Balance: big.NewInt(1), Root: stRoot, CodeHash: emptyCode.Bytes()},
+		"acc-2": {Nonce: 0, Balance: big.NewInt(2), Root: emptyRoot, CodeHash: emptyCode.Bytes()},
+		"acc-3": {Nonce: 0, Balance: big.NewInt(3), Root: stRoot, CodeHash: emptyCode.Bytes()},
+	}
+	for key, acc := range accs {
+		val, _ := rlp.EncodeToBytes(acc)
+		accTrie.Update([]byte(key), val)
+	}
+	root, _ := accTrie.Commit(nil)
+
+	snap := generateSnapshot(diskdb, triedb, 16, root, nil)
+	select {
+	case <-snap.genPending:
+		// Snapshot generation succeeded
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Snapshot generation failed")
+	}
+	for key, acc := range accs {
+		hash := crypto.Keccak256Hash([]byte(key))
+
+		have, err := snap.Account(hash)
+		if err != nil {
+			t.Fatalf("account %s: failed to retrieve: %v", key, err)
+		}
+		if have == nil || have.Balance.Cmp(acc.Balance) != 0 {
+			t.Errorf("account %s: balance mismatch: have %v, want %v", key, have, acc.Balance)
+		}
+		if acc.Root == emptyRoot && len(have.Root) != 0 {
+			t.Errorf("account %s: empty root not slimmed: %x", key, have.Root)
+		}
+		for slot, val := range slots {
+			blob, err := snap.Storage(hash, crypto.Keccak256Hash([]byte(slot)))
+			if err != nil {
+				t.Fatalf("account %s slot %s: failed to retrieve: %v", key, slot, err)
+			}
+			want := val
+			if acc.Root == emptyRoot {
+				want = nil
+			}
+			if !bytes.Equal(blob, want) {
+				t.Errorf("account %s slot %s: mismatch: have %x, want %x", key, slot, blob, want)
+			}
+		}
+	}
+	// Stop the generator goroutine waiting for an abort
+	stop := make(chan *generatorStats)
+	snap.genAbort <- stop
+	<-stop
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+)
+
+// verifyIterator checks that the iterator yields the expected hashes in order,
+// without any duplicates.
+func verifyIterator(t *testing.T, it Iterator, want []common.Hash) {
+	t.Helper()
+
+	var have []common.Hash
+	for it.Next() {
+		have = append(have, it.Hash())
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("iterated item count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range have {
+		if have[i] != want[i] {
+			t.Fatalf("item %d mismatch: have %x, want %x", i, have[i], want[i])
+		}
+	}
+}
+
+// Tests that the account iterator merges the disk layer with multiple diff
+// layers on top, dropping deleted accounts and honouring the seek position.
+func TestAccountIteratorTraversal(t *testing.T) {
+	snaps := newTestTree()
+	base := snaps.Snapshot(common.HexToHash("0x01")).(*diskLayer)
+
+	// Seed the disk layer with a few accounts
+	for _, hash := range []string{"0xaa", "0xbb", "0xdd"} {
+		rawdb.WriteAccountSnapshot(base.diskdb, common.HexToHash(hash), randomAccount())
+	}
+	// Stack diff layers modifying, deleting and creating accounts
+	snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, map[common.Hash][]byte{
+		common.HexToHash("0xbb"): randomAccount(),
+		common.HexToHash("0xcc"): randomAccount(),
+	}, nil)
+	snaps.Update(common.HexToHash("0x03"), common.HexToHash("0x02"), map[common.Hash]struct{}{
+		common.HexToHash("0xaa"): {},
+		common.HexToHash("0xcc"): {},
+	}, map[common.Hash][]byte{
+		common.HexToHash("0xcc"): randomAccount(),
+		common.HexToHash("0xee"): randomAccount(),
+	}, nil)
+
+	it, err := snaps.AccountIterator(common.HexToHash("0x03"), common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to create iterator: %v", err)
+	}
+	verifyIterator(t, it, []common.Hash{
+		common.HexToHash("0xbb"), common.HexToHash("0xcc"), common.HexToHash("0xdd"), common.HexToHash("0xee"),
+	})
+	it.Release()
+
+	// Ensure the iterator returns the data of the topmost layer
+	it, _ = snaps.AccountIterator(common.HexToHash("0x03"), common.HexToHash("0xbb"))
+	if !it.Next() || it.Hash() != common.HexToHash("0xbb") {
+		t.Fatalf("failed to seek to account")
+	}
+	want, _ := snaps.Snapshot(common.HexToHash("0x02")).AccountRLP(common.HexToHash("0xbb"))
+	if !bytes.Equal(it.Account(), want) {
+		t.Fatalf("account data mismatch: have %x, want %x", it.Account(), want)
+	}
+	it.Release()
+
+	// Ensure seeking skips the preceding accounts
+	it, _ = snaps.AccountIterator(common.HexToHash("0x03"), common.HexToHash("0xcd"))
+	verifyIterator(t, it, []common.Hash{common.HexToHash("0xdd"), common.HexToHash("0xee")})
+	it.Release()
+
+	// Iterating an intermediate layer must see its own version of the state
+	it, _ = snaps.AccountIterator(common.HexToHash("0x02"), common.Hash{})
+	verifyIterator(t, it, []common.Hash{
+		common.HexToHash("0xaa"), common.HexToHash("0xbb"), common.HexToHash("0xcc"), common.HexToHash("0xdd"),
+	})
+	it.Release()
+}
+
+// Tests that the storage iterator stops descending into deeper layers once the
+// account was destructed, but still returns the slots of the recreated account.
+func TestStorageIteratorTraversal(t *testing.T) {
+	snaps := newTestTree()
+	base := snaps.Snapshot(common.HexToHash("0x01")).(*diskLayer)
+
+	account := common.HexToHash("0xaa")
+	rawdb.WriteAccountSnapshot(base.diskdb, account, randomAccount())
+	for _, hash := range []string{"0x01", "0x02", "0x03"} {
+		rawdb.WriteStorageSnapshot(base.diskdb, account, common.HexToHash(hash), []byte{0x01})
+	}
+	// Slots of a different account sharing the prefix must not leak in
+	rawdb.WriteStorageSnapshot(base.diskdb, common.HexToHash("0xab"), common.HexToHash("0x04"), []byte{0x01})
+
+	snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, map[common.Hash][]byte{
+		account: randomAccount(),
+	}, map[common.Hash]map[common.Hash][]byte{
+		account: {common.HexToHash("0x02"): nil, common.HexToHash("0x05"): {0x02}},
+	})
+	it, err := snaps.StorageIterator(common.HexToHash("0x02"), account, common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to create iterator: %v", err)
+	}
+	verifyIterator(t, it, []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x03"), common.HexToHash("0x05")})
+	it.Release()
+
+	snaps.Update(common.HexToHash("0x03"), common.HexToHash("0x02"), map[common.Hash]struct{}{
+		account: {},
+	}, map[common.Hash][]byte{
+		account: randomAccount(),
+	}, map[common.Hash]map[common.Hash][]byte{
+		account: {common.HexToHash("0x06"): {0x03}},
+	})
+	it, _ = snaps.StorageIterator(common.HexToHash("0x03"), account, common.Hash{})
+	verifyIterator(t, it, []common.Hash{common.HexToHash("0x06")})
+	it.Release()
+}
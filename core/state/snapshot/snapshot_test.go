@@ -0,0 +1,206 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+)
+
+// randomAccount generates a random account and returns it RLP encoded.
+func randomAccount() []byte {
+	root := randomHash()
+	a := Account{
+		Balance:  big.NewInt(rand.Int63()),
+		Nonce:    rand.Uint64(),
+		Root:     root[:],
+		CodeHash: emptyCode[:],
+	}
+	data, _ := rlp.EncodeToBytes(a)
+	return data
+}
+
+// newTestTree creates a snapshot tree with an empty, fully generated disk layer
+// at root 0x01.
+func newTestTree() *Tree {
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	return &Tree{
+		diskdb: base.diskdb,
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+}
+
+// Tests that if a disk layer becomes stale, no active external references will
+// be returned with junk data. This version of the test flattens every diff layer
+// to check internal corner case around the bottom-most memory accumulator.
+func TestDiskLayerExternalInvalidationFullFlatten(t *testing.T) {
+	snaps := newTestTree()
+	base := snaps.Snapshot(common.HexToHash("0x01")).(*diskLayer)
+
+	// Retrieve a reference to the base and commit a diff on top
+	ref := snaps.Snapshot(base.root)
+
+	accounts := map[common.Hash][]byte{
+		common.HexToHash("0xa1"): randomAccount(),
+	}
+	if err := snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, accounts, nil); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	if n := len(snaps.layers); n != 2 {
+		t.Errorf("pre-cap layer count mismatch: have %d, want %d", n, 2)
+	}
+	// Commit the diff layer onto the disk and ensure it's persisted
+	if err := snaps.Cap(common.HexToHash("0x02"), 0); err != nil {
+		t.Fatalf("failed to merge diff layer onto disk: %v", err)
+	}
+	// Since the base layer was modified, ensure that data retrieval on the external reference fail
+	if acc, err := ref.Account(common.HexToHash("0x01")); err != ErrSnapshotStale {
+		t.Errorf("stale reference returned account: %#x (err: %v)", acc, err)
+	}
+	if slot, err := ref.Storage(common.HexToHash("0xa1"), common.HexToHash("0xb1")); err != ErrSnapshotStale {
+		t.Errorf("stale reference returned storage slot: %#x (err: %v)", slot, err)
+	}
+	if n := len(snaps.layers); n != 1 {
+		t.Errorf("post-cap layer count mismatch: have %d, want %d", n, 1)
+		fmt.Println(snaps.layers)
+	}
+	// The merged account must be served by the new disk layer
+	if blob, err := snaps.Snapshot(common.HexToHash("0x02")).AccountRLP(common.HexToHash("0xa1")); err != nil || !bytes.Equal(blob, accounts[common.HexToHash("0xa1")]) {
+		t.Errorf("merged account mismatch: have %x, want %x (err: %v)", blob, accounts[common.HexToHash("0xa1")], err)
+	}
+}
+
+// Tests that if a diff layer becomes stale, no active external references will
+// be returned with junk data.
+func TestDiffLayerExternalInvalidationPartialFlatten(t *testing.T) {
+	snaps := newTestTree()
+
+	// Commit three diffs on top and retrieve a reference to the bottommost
+	accounts := map[common.Hash][]byte{
+		common.HexToHash("0xa1"): randomAccount(),
+	}
+	if err := snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, accounts, nil); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	if err := snaps.Update(common.HexToHash("0x03"), common.HexToHash("0x02"), nil, accounts, nil); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	if err := snaps.Update(common.HexToHash("0x04"), common.HexToHash("0x03"), nil, accounts, nil); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	if n := len(snaps.layers); n != 4 {
+		t.Errorf("pre-cap layer count mismatch: have %d, want %d", n, 4)
+	}
+	ref := snaps.Snapshot(common.HexToHash("0x02"))
+
+	// Doing a Cap operation with many allowed layers should be a no-op
+	exp := len(snaps.layers)
+	if err := snaps.Cap(common.HexToHash("0x04"), 2000); err != nil {
+		t.Fatalf("failed to flatten diff layer into accumulator: %v", err)
+	}
+	if got := len(snaps.layers); got != exp {
+		t.Errorf("layers modified, got %d exp %d", got, exp)
+	}
+	// Flatten the diff layer into the bottom accumulator
+	if err := snaps.Cap(common.HexToHash("0x04"), 2); err != nil {
+		t.Fatalf("failed to flatten diff layer into accumulator: %v", err)
+	}
+	// Since the accumulator diff layer was modified, ensure that data retrieval on the external reference fail
+	if acc, err := ref.Account(common.HexToHash("0x01")); err != ErrSnapshotStale {
+		t.Errorf("stale reference returned account: %#x (err: %v)", acc, err)
+	}
+	if slot, err := ref.Storage(common.HexToHash("0xa1"), common.HexToHash("0xb1")); err != ErrSnapshotStale {
+		t.Errorf("stale reference returned storage slot: %#x (err: %v)", slot, err)
+	}
+	if n := len(snaps.layers); n != 3 {
+		t.Errorf("post-cap layer count mismatch: have %d, want %d", n, 3)
+	}
+}
+
+// Tests that a journalled snapshot tree can be reloaded with all its diff
+// layers intact, and that a journal not matching the persisted disk layer is
+// rejected.
+func TestJournalRoundtrip(t *testing.T) {
+	snaps := newTestTree()
+	rawdb.WriteSnapshotRoot(snaps.diskdb, common.HexToHash("0x01"))
+
+	var (
+		acc  = common.HexToHash("0xa1")
+		slot = common.HexToHash("0xb1")
+		data = randomAccount()
+	)
+	if err := snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, map[common.Hash][]byte{acc: data}, nil); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	storage := map[common.Hash]map[common.Hash][]byte{acc: {slot: {0x2a}}}
+	if err := snaps.Update(common.HexToHash("0x03"), common.HexToHash("0x02"), map[common.Hash]struct{}{common.HexToHash("0xa2"): {}}, nil, storage); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	base, err := snaps.Journal(common.HexToHash("0x03"))
+	if err != nil {
+		t.Fatalf("failed to journal snapshot: %v", err)
+	}
+	if base != common.HexToHash("0x01") {
+		t.Fatalf("journal base mismatch: have %x, want %x", base, common.HexToHash("0x01"))
+	}
+	// Reload the tree and ensure all layers and data are recovered
+	head, err := loadSnapshot(snaps.diskdb, nil, 1, common.HexToHash("0x03"))
+	if err != nil {
+		t.Fatalf("failed to load journalled snapshot: %v", err)
+	}
+	for i, root := range []common.Hash{common.HexToHash("0x03"), common.HexToHash("0x02"), common.HexToHash("0x01")} {
+		if head == nil || head.Root() != root {
+			t.Fatalf("layer %d: root mismatch: have %v, want %x", i, head, root)
+		}
+		if i < 2 {
+			head = head.Parent()
+		}
+	}
+	loaded, err := loadSnapshot(snaps.diskdb, nil, 1, common.HexToHash("0x03"))
+	if err != nil {
+		t.Fatalf("failed to reload journalled snapshot: %v", err)
+	}
+	if blob, err := loaded.AccountRLP(acc); err != nil || !bytes.Equal(blob, data) {
+		t.Errorf("account mismatch: have %x, want %x (err: %v)", blob, data, err)
+	}
+	if blob, err := loaded.Storage(acc, slot); err != nil || !bytes.Equal(blob, []byte{0x2a}) {
+		t.Errorf("storage mismatch: have %x, want %x (err: %v)", blob, []byte{0x2a}, err)
+	}
+	// A journal for a different head must be rejected
+	if _, err := loadSnapshot(snaps.diskdb, nil, 1, common.HexToHash("0x02")); err == nil {
+		t.Errorf("journal loaded for mismatching head")
+	}
+	// A journal left behind on top of a different disk layer must be rejected
+	rawdb.WriteSnapshotRoot(snaps.diskdb, common.HexToHash("0x02"))
+	if _, err := loadSnapshot(snaps.diskdb, nil, 1, common.HexToHash("0x03")); err == nil {
+		t.Errorf("journal loaded for mismatching disk layer")
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state/snapshot"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
@@ -34,6 +35,11 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
 )
 
+// snapshotLayers is the number of diff layers kept on top of the persisted
+// snapshot, matching the number of recent tries the chain keeps in memory
+// (the disk layer is the 128th, the last available trie).
+const snapshotLayers = 127
+
 type revision struct {
 	id           int
 	journalIndex int
@@ -67,6 +73,12 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects         map[common.Address]*stateObject
 	stateObjectsPending  map[common.Address]struct{} // State objects finalized but not yet written to the trie
@@ -102,14 +114,17 @@ type StateDB struct {
 	nextRevisionId int
 
 	// Measurements gathered during execution for debugging purposes
-	AccountReads   time.Duration
-	AccountHashes  time.Duration
-	AccountUpdates time.Duration
-	AccountCommits time.Duration
-	StorageReads   time.Duration
-	StorageHashes  time.Duration
-	StorageUpdates time.Duration
-	StorageCommits time.Duration
+	AccountReads         time.Duration
+	AccountHashes        time.Duration
+	AccountUpdates       time.Duration
+	AccountCommits       time.Duration
+	StorageReads         time.Duration
+	StorageHashes        time.Duration
+	StorageUpdates       time.Duration
+	StorageCommits       time.Duration
+	SnapshotAccountReads time.Duration
+	SnapshotStorageReads time.Duration
+	SnapshotCommits      time.Duration
 
 	AccountUpdated int
 	StorageUpdated int
@@ -117,15 +132,17 @@ type StateDB struct {
 	StorageDeleted int
 }
 
-// Create a new state from a given trie.
-func New(root common.Hash, db Database) (*StateDB, error) {
+// Create a new state from a given trie. If snaps is non-nil and holds a
+// snapshot of root, account and storage reads are served from the snapshot.
+func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error) {
 	tr, err := db.OpenTrie(root)
 	if err != nil {
 		return nil, err
 	}
-	return &StateDB{
+	sdb := &StateDB{
 		db:                   db,
 		trie:                 tr,
+		snaps:                snaps,
 		stateObjects:         make(map[common.Address]*stateObject),
 		stateObjectsPending:  make(map[common.Address]struct{}),
 		stateObjectsDirty:    make(map[common.Address]struct{}),
@@ -134,7 +151,15 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 		preimages:            make(map[common.Hash][]byte),
 		journal:              newJournal(),
 		accessList:           newAccessList(),
-	}, nil
+	}
+	if sdb.snaps != nil {
+		if sdb.snap = sdb.snaps.Snapshot(root); sdb.snap != nil {
+			sdb.snapDestructs = make(map[common.Hash]struct{})
+			sdb.snapAccounts = make(map[common.Hash][]byte)
+			sdb.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+		}
+	}
+	return sdb, nil
 }
 
 // setError remembers the first non-nil error it is called with.
@@ -166,6 +191,15 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
 	self.clearJournalAndRefund()
+
+	if self.snaps != nil {
+		self.snapAccounts, self.snapDestructs, self.snapStorage = nil, nil, nil
+		if self.snap = self.snaps.Snapshot(root); self.snap != nil {
+			self.snapDestructs = make(map[common.Hash]struct{})
+			self.snapAccounts = make(map[common.Hash][]byte)
+			self.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+		}
+	}
 	return nil
 }
 
@@ -406,15 +440,11 @@ func (self *StateDB) SetState(addr common.Address, key, value common.Hash) {
 // SetStorage replaces the entire storage for the specified account with given
 // storage. This function should only be used for debugging.
 func (self *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
-	// SetStorage needs to wipe existing storage. We achieve this by pretending
-	// that the account self-destructed earlier in this block, by flagging
-	// it in stateObjectsDestruct. The effect of doing so is that storage lookups
-	// will not hit disk, since it is assumed that the disk-data is belonging
-	// to a previous incarnation of the object.
-	self.stateObjectsDestruct[addr] = struct{}{}
+	// SetStorage needs to wipe existing storage. The storage lookups of the
+	// object only hit its fake storage from now on, the disk data is ignored.
 	stateObject := self.GetOrNewStateObject(addr)
-	for k, v := range storage {
-		stateObject.SetState(self.db, k, v)
+	if stateObject != nil {
+		stateObject.SetStorage(storage)
 	}
 }
 
@@ -484,6 +514,14 @@ func (self *StateDB) updateStateObject(obj *stateObject) {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
 	self.setError(self.trie.TryUpdate(addr[:], data))
+
+	// If state snapshotting is active, cache the data til commit. Note, this
+	// update mechanism is not symmetric to the deletion, because whereas it is
+	// enough to track account updates at commit time, deletions need tracking
+	// at transaction boundary level to ensure we capture state clearing.
+	if self.snap != nil {
+		self.snapAccounts[obj.addrHash] = snapshot.AccountRLP(obj.data.Nonce, obj.data.Balance, obj.data.Root, obj.data.CodeHash)
+	}
 }
 
 // deleteStateObject removes the given object from the state trie.
@@ -516,20 +554,45 @@ func (self *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 	if obj := self.stateObjects[addr]; obj != nil {
 		return obj
 	}
-	// Track the amount of time wasted on loading the object from the database
-	if metrics.EnabledExpensive {
-		defer func(start time.Time) { self.AccountReads += time.Since(start) }(time.Now())
-	}
-	// Load the object from the database
-	enc, err := self.trie.TryGet(addr[:])
-	if len(enc) == 0 {
-		self.setError(err)
-		return nil
+	// If no live objects are available, attempt to use snapshots
+	var (
+		data Account
+		err  error
+	)
+	if self.snap != nil {
+		if metrics.EnabledExpensive {
+			defer func(start time.Time) { self.SnapshotAccountReads += time.Since(start) }(time.Now())
+		}
+		var acc *snapshot.Account
+		if acc, err = self.snap.Account(crypto.Keccak256Hash(addr[:])); err == nil {
+			if acc == nil {
+				return nil
+			}
+			data.Nonce, data.Balance, data.CodeHash = acc.Nonce, acc.Balance, acc.CodeHash
+			if len(data.CodeHash) == 0 {
+				data.CodeHash = emptyCodeHash
+			}
+			data.Root = common.BytesToHash(acc.Root)
+			if data.Root == (common.Hash{}) {
+				data.Root = emptyRoot
+			}
+		}
 	}
-	var data Account
-	if err := rlp.DecodeBytes(enc, &data); err != nil {
-		log.Error("Failed to decode state object", "addr", addr, "err", err)
-		return nil
+	// If snapshot unavailable or reading from it failed, load from the database
+	if self.snap == nil || err != nil {
+		// Track the amount of time wasted on loading the object from the database
+		if metrics.EnabledExpensive {
+			defer func(start time.Time) { self.AccountReads += time.Since(start) }(time.Now())
+		}
+		enc, err := self.trie.TryGet(addr[:])
+		if len(enc) == 0 {
+			self.setError(err)
+			return nil
+		}
+		if err := rlp.DecodeBytes(enc, &data); err != nil {
+			log.Error("Failed to decode state object", "addr", addr, "err", err)
+			return nil
+		}
 	}
 	// Insert into the live set
 	obj := newObject(self, addr, data)
@@ -555,19 +618,25 @@ func (self *StateDB) GetOrNewStateObject(addr common.Address) *stateObject {
 func (self *StateDB) createObject(addr common.Address) (newobj, prev *stateObject) {
 	prev = self.getDeletedStateObject(addr) // Note, prev might have been deleted, we need that!
 
-	var prevdestruct bool
+	var prevdestruct, prevsnapdestruct bool
 	if prev != nil {
 		_, prevdestruct = self.stateObjectsDestruct[prev.address]
 		if !prevdestruct {
 			self.stateObjectsDestruct[prev.address] = struct{}{}
 		}
+		if self.snap != nil {
+			_, prevsnapdestruct = self.snapDestructs[prev.addrHash]
+			if !prevsnapdestruct {
+				self.snapDestructs[prev.addrHash] = struct{}{}
+			}
+		}
 	}
 	newobj = newObject(self, addr, Account{})
 	newobj.setNonce(0) // sets the object to dirty
 	if prev == nil {
 		self.journal.append(createObjectChange{account: &addr})
 	} else {
-		self.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct})
+		self.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct, prevsnapdestruct: prevsnapdestruct})
 	}
 	self.setStateObject(newobj)
 	if prev != nil && !prev.deleted {
@@ -629,6 +698,8 @@ func (self *StateDB) Copy() *StateDB {
 	state := &StateDB{
 		db:                   self.db,
 		trie:                 self.db.CopyTrie(self.trie),
+		snaps:                self.snaps,
+		snap:                 self.snap,
 		stateObjects:         make(map[common.Address]*stateObject, len(self.journal.dirties)),
 		stateObjectsPending:  make(map[common.Address]struct{}, len(self.stateObjectsPending)),
 		stateObjectsDirty:    make(map[common.Address]struct{}, len(self.journal.dirties)),
@@ -694,6 +765,28 @@ func (self *StateDB) Copy() *StateDB {
 	state.accessList = self.accessList.Copy()
 	state.transientStorage = self.transientStorage.Copy()
 
+	if self.snaps != nil {
+		// In order for the miner to be able to use and make additions
+		// to the snapshot tree, we need to copy that as well.
+		// Otherwise, any block mined by ourselves will cause gaps in the tree,
+		// and force the miner to operate trie-backed only
+		state.snapDestructs = make(map[common.Hash]struct{}, len(self.snapDestructs))
+		for k, v := range self.snapDestructs {
+			state.snapDestructs[k] = v
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(self.snapAccounts))
+		for k, v := range self.snapAccounts {
+			state.snapAccounts[k] = v
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(self.snapStorage))
+		for k, v := range self.snapStorage {
+			temp := make(map[common.Hash][]byte, len(v))
+			for kk, vv := range v {
+				temp[kk] = vv
+			}
+			state.snapStorage[k] = temp
+		}
+	}
 	return state
 }
 
@@ -743,6 +836,16 @@ func (self *StateDB) Finalise(deleteEmptyObjects bool) {
 		}
 		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
 			obj.deleted = true
+
+			// If state snapshotting is active, also mark the destruction there.
+			// Note, we can't do this only at the end of a block because multiple
+			// transactions within the same block might self destruct and then
+			// resurrect an account; but the snapshotter needs both events.
+			if self.snap != nil {
+				self.snapDestructs[obj.addrHash] = struct{}{} // We need to maintain account deletions explicitly (will remain set indefinitely)
+				delete(self.snapAccounts, obj.addrHash)       // Clear out any previously updated account data (may be recreated via a resurrect)
+				delete(self.snapStorage, obj.addrHash)        // Clear out any previously updated storage data (may be recreated via a resurrect)
+			}
 		} else {
 			obj.finalise()
 		}
@@ -824,7 +927,7 @@ func (self *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	if metrics.EnabledExpensive {
 		defer func(start time.Time) { self.AccountCommits += time.Since(start) }(time.Now())
 	}
-	return self.trie.Commit(func(leaf []byte, parent common.Hash) error {
+	root, err := self.trie.Commit(func(leaf []byte, parent common.Hash) error {
 		var account Account
 		if err := rlp.DecodeBytes(leaf, &account); err != nil {
 			return nil
@@ -838,6 +941,26 @@ func (self *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 		}
 		return nil
 	})
+	if err != nil {
+		return root, err
+	}
+	// If snapshotting is enabled, update the snapshot tree with this new version
+	if self.snap != nil {
+		if metrics.EnabledExpensive {
+			defer func(start time.Time) { self.SnapshotCommits += time.Since(start) }(time.Now())
+		}
+		// Only update if there's a state transition (skip empty Clique blocks)
+		if parent := self.snap.Root(); parent != root {
+			if err := self.snaps.Update(root, parent, self.snapDestructs, self.snapAccounts, self.snapStorage); err != nil {
+				log.Warn("Failed to update snapshot tree", "from", parent, "to", root, "err", err)
+			}
+			if err := self.snaps.Cap(root, snapshotLayers); err != nil {
+				log.Warn("Failed to cap snapshot tree", "root", root, "layers", snapshotLayers, "err", err)
+			}
+		}
+		self.snap, self.snapDestructs, self.snapAccounts, self.snapStorage = nil, nil, nil, nil
+	}
+	return root, nil
 }
 
 // PrepareAccessList handles the preparatory steps for executing a state transition with.
@@ -33,6 +33,7 @@ import (
 
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state/snapshot"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 )
 
@@ -41,7 +42,7 @@ import (
 func TestUpdateLeaks(t *testing.T) {
 	// Create an empty state database
 	db := rawdb.NewMemoryDatabase()
-	state, _ := New(common.Hash{}, NewDatabase(db))
+	state, _ := New(common.Hash{}, NewDatabase(db), nil)
 
 	// Update it with some accounts
 	for i := byte(0); i < 255; i++ {
@@ -75,8 +76,8 @@ func TestIntermediateLeaks(t *testing.T) {
 	// Create two state databases, one transitioning to the final state, the other final from the beginning
 	transDb := rawdb.NewMemoryDatabase()
 	finalDb := rawdb.NewMemoryDatabase()
-	transState, _ := New(common.Hash{}, NewDatabase(transDb))
-	finalState, _ := New(common.Hash{}, NewDatabase(finalDb))
+	transState, _ := New(common.Hash{}, NewDatabase(transDb), nil)
+	finalState, _ := New(common.Hash{}, NewDatabase(finalDb), nil)
 
 	modify := func(state *StateDB, addr common.Address, i, tweak byte) {
 		state.SetBalance(addr, big.NewInt(int64(11*i)+int64(tweak)))
@@ -151,7 +152,7 @@ func TestIntermediateLeaks(t *testing.T) {
 // https://github.com/elastos/Elastos.ELA.SideChain.ESC/pull/15549.
 func TestCopy(t *testing.T) {
 	// Create a random state test to copy and modify "independently"
-	orig, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()))
+	orig, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 
 	for i := byte(0); i < 255; i++ {
 		obj := orig.GetOrNewStateObject(common.BytesToAddress([]byte{i}))
@@ -387,7 +388,7 @@ func (test *snapshotTest) String() string {
 func (test *snapshotTest) run() bool {
 	// Run all actions and create snapshots.
 	var (
-		state, _     = New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()))
+		state, _     = New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 		snapshotRevs = make([]int, len(test.snapshots))
 		sindex       = 0
 	)
@@ -401,7 +402,7 @@ func (test *snapshotTest) run() bool {
 	// Revert all snapshots in reverse order. Each revert must yield a state
 	// that is equivalent to fresh state with all actions up the snapshot applied.
 	for sindex--; sindex >= 0; sindex-- {
-		checkstate, _ := New(common.Hash{}, state.Database())
+		checkstate, _ := New(common.Hash{}, state.Database(), nil)
 		for _, action := range test.actions[:test.snapshots[sindex]] {
 			action.fn(action, checkstate)
 		}
@@ -478,7 +479,7 @@ func (s *StateSuite) TestTouchDelete(c *check.C) {
 // TestCopyOfCopy tests that modified objects are carried over to the copy, and the copy of the copy.
 // See https://github.com/elastos/Elastos.ELA.SideChain.ESC/pull/15225#issuecomment-380191512
 func TestCopyOfCopy(t *testing.T) {
-	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()))
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 	addr := common.HexToAddress("aaaa")
 	state.SetBalance(addr, big.NewInt(42))
 
@@ -495,7 +496,7 @@ func TestCopyOfCopy(t *testing.T) {
 //
 // See https://github.com/elastos/Elastos.ELA.SideChain.ESC/issues/20106.
 func TestCopyCommitCopy(t *testing.T) {
-	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()))
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 
 	// Create an account and check if the retrieved balance is correct
 	addr := common.HexToAddress("0xaffeaffeaffeaffeaffeaffeaffeaffeaffeaffe")
@@ -567,7 +568,7 @@ func TestCopyCommitCopy(t *testing.T) {
 //
 // See https://github.com/elastos/Elastos.ELA.SideChain.ESC/issues/20106.
 func TestCopyCopyCommitCopy(t *testing.T) {
-	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()))
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 
 	// Create an account and check if the retrieved balance is correct
 	addr := common.HexToAddress("0xaffeaffeaffeaffeaffeaffeaffeaffeaffeaffe")
@@ -657,7 +658,7 @@ func TestCopyCopyCommitCopy(t *testing.T) {
 // first, but the journal wiped the entire state object on create-revert.
 func TestDeleteCreateRevert(t *testing.T) {
 	// Create an initial state with a single contract
-	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()))
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
 
 	addr := toAddr([]byte("so"))
 	state.SetBalance(addr, big.NewInt(1))
@@ -681,3 +682,67 @@ func TestDeleteCreateRevert(t *testing.T) {
 		t.Fatalf("self-destructed contract came alive")
 	}
 }
+
+// Tests that a state backed by a snapshot tree serves the same accounts and
+// storage as the tries, and that destructed accounts don't leak stale storage
+// from the snapshot after being recreated.
+func TestSnapshotBackedState(t *testing.T) {
+	var (
+		db   = rawdb.NewMemoryDatabase()
+		sdb  = NewDatabase(db)
+		a    = toAddr([]byte("a"))
+		b    = toAddr([]byte("b"))
+		slot = common.HexToHash("0x01")
+	)
+	// Create an initial state and generate a snapshot for it
+	state, _ := New(common.Hash{}, sdb, nil)
+	state.SetBalance(a, big.NewInt(1))
+	state.SetState(a, slot, common.HexToHash("0xaa"))
+	state.SetBalance(b, big.NewInt(2))
+	state.SetState(b, slot, common.HexToHash("0xbb"))
+
+	root, _ := state.Commit(false)
+	if err := sdb.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to commit state trie: %v", err)
+	}
+	snaps := snapshot.New(db, sdb.TrieDB(), 16, root, false)
+
+	state, _ = New(root, sdb, snaps)
+	if state.snap == nil {
+		t.Fatalf("snapshot not picked up for root %x", root)
+	}
+	if have := state.GetBalance(a); have.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", have, 1)
+	}
+	if have := state.GetState(b, slot); have != common.HexToHash("0xbb") {
+		t.Errorf("storage mismatch: have %x, want %x", have, common.HexToHash("0xbb"))
+	}
+	// Modify a slot, destruct and recreate the other account
+	state.SetState(a, slot, common.HexToHash("0xab"))
+	state.Suicide(b)
+	state.Finalise(true)
+	state.CreateAccount(b)
+	state.SetBalance(b, big.NewInt(3))
+	if have := state.GetState(b, slot); have != (common.Hash{}) {
+		t.Errorf("recreated account storage leaked: have %x", have)
+	}
+	root, _ = state.Commit(true)
+
+	// Ensure the snapshot tree tracked the transition and serves the new values
+	if snaps.Snapshot(root) == nil {
+		t.Fatalf("snapshot missing for committed root %x", root)
+	}
+	state, _ = New(root, sdb, snaps)
+	if state.snap == nil {
+		t.Fatalf("snapshot not picked up for root %x", root)
+	}
+	if have := state.GetState(a, slot); have != common.HexToHash("0xab") {
+		t.Errorf("storage mismatch: have %x, want %x", have, common.HexToHash("0xab"))
+	}
+	if have := state.GetBalance(b); have.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", have, 3)
+	}
+	if have := state.GetState(b, slot); have != (common.Hash{}) {
+		t.Errorf("recreated account storage leaked: have %x", have)
+	}
+}
@@ -28,7 +28,6 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
-	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/withdrawfailedtx"
 )
 
@@ -70,6 +69,9 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
 	}
+	if p.config.FrozenAccountsBlock != nil && p.config.FrozenAccountsBlock.Cmp(block.Number()) == 0 {
+		ApplyFrozenAccountsFork(statedb, p.config.FrozenAccounts)
+	}
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 		statedb.Prepare(tx.Hash(), block.Hash(), i)
@@ -99,10 +101,13 @@ func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *commo
 	if _, ok := signer.(types.EIP155Signer); ok {
 		signer.(types.EIP155Signer).SetForkData(config, header.Number)
 	}
-	msg, err := tx.AsMessage(signer)
+	msg, err := tx.AsMessage(signer, header.BaseFee)
 	if err != nil {
 		return nil, err
 	}
+	if config.IsFrozenAccountsFork(header.Number) && IsAccountFrozen(statedb, msg.From()) {
+		return nil, ErrFrozenAccount
+	}
 	// Create a new context to be used in the EVM environment
 	context := NewEVMContext(msg, header, bc, author)
 	// Create a new environment which holds all relevant information
@@ -124,13 +129,13 @@ func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *commo
 				statedb.SetNonce(blackAddr, statedb.GetNonce(blackAddr)+1)
 			} else if len(tx.Data()) == 32 {
 				txHash = hexutil.Encode(tx.Data())
-				fee, addr, output := spv.FindOutputFeeAndaddressByTxHash(txHash)
+				fee, addr, output := vmenv.MainChain().FindOutputFeeAndAddress(txHash)
 				if fee.Cmp(new(big.Int)) > 0 && output.Cmp(new(big.Int)) > 0 && addr != blackAddr {
 					statedb.SetState(blackAddr, common.HexToHash(txHash), tx.Hash())
 					statedb.SetNonce(blackAddr, statedb.GetNonce(blackAddr)+1)
 				}
 			} else {
-				txHash, _, _, _ = spv.IsSmallCrossTxByData(tx.Data())
+				txHash, _, _, _ = vmenv.MainChain().IsSmallCrossTxByData(tx.Data())
 				if txHash != "" {
 					statedb.SetState(blackAddr, common.HexToHash(txHash), tx.Hash())
 					statedb.SetNonce(blackAddr, statedb.GetNonce(blackAddr)+1)
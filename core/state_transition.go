@@ -66,6 +66,8 @@ type StateTransition struct {
 	msg        Message
 	gas        uint64
 	gasPrice   *big.Int
+	gasFeeCap  *big.Int
+	gasTipCap  *big.Int
 	initialGas uint64
 	value      *big.Int
 	data       []byte
@@ -80,6 +82,8 @@ type Message interface {
 	To() *common.Address
 
 	GasPrice() *big.Int
+	GasFeeCap() *big.Int
+	GasTipCap() *big.Int
 	Gas() uint64
 	Value() *big.Int
 
@@ -168,13 +172,15 @@ func IntrinsicGas(data []byte, contractCreation, isEIP155 bool, isEIP2028 bool)
 // NewStateTransition initialises and returns a new state transition object.
 func NewStateTransition(evm *vm.EVM, msg Message, gp *GasPool) *StateTransition {
 	return &StateTransition{
-		gp:       gp,
-		evm:      evm,
-		msg:      msg,
-		gasPrice: msg.GasPrice(),
-		value:    msg.Value(),
-		data:     msg.Data(),
-		state:    evm.StateDB,
+		gp:        gp,
+		evm:       evm,
+		msg:       msg,
+		gasPrice:  msg.GasPrice(),
+		gasFeeCap: msg.GasFeeCap(),
+		gasTipCap: msg.GasTipCap(),
+		value:     msg.Value(),
+		data:      msg.Data(),
+		state:     evm.StateDB,
 	}
 }
 
@@ -208,7 +214,13 @@ func (st *StateTransition) useGas(amount uint64) error {
 
 func (st *StateTransition) buyGas() error {
 	mgval := new(big.Int).Mul(new(big.Int).SetUint64(st.msg.Gas()), st.gasPrice)
-	if st.state.GetBalance(st.msg.From()).Cmp(mgval) < 0 {
+	// Dynamic fee transactions must be able to pay their fee cap, even
+	// though only the effective gas price is charged.
+	balanceCheck := mgval
+	if st.gasFeeCap != nil {
+		balanceCheck = new(big.Int).Mul(new(big.Int).SetUint64(st.msg.Gas()), st.gasFeeCap)
+	}
+	if st.state.GetBalance(st.msg.From()).Cmp(balanceCheck) < 0 {
 		return errInsufficientBalanceForGas
 	}
 	if err := st.gp.SubGas(st.msg.Gas()); err != nil {
@@ -221,7 +233,10 @@ func (st *StateTransition) buyGas() error {
 	return nil
 }
 
-func (st *StateTransition) preCheck() error {
+// preCheck verifies the nonce and the fee caps of the message and buys its
+// gas. System transactions (recharges, withdraw refunds and the black contract
+// deployment) are priced by the main chain and are exempt from the base fee.
+func (st *StateTransition) preCheck(feeExempt bool) error {
 	// Make sure this transaction's nonce is correct.
 	if st.msg.CheckNonce() {
 		nonce := st.state.GetNonce(st.msg.From())
@@ -231,6 +246,30 @@ func (st *StateTransition) preCheck() error {
 			return ErrNonceTooLow
 		}
 	}
+	// Make sure that the fee caps are sane once the fee market is live.
+	if st.evm.ChainConfig().IsEIP1559(st.evm.BlockNumber) && st.gasFeeCap != nil && st.gasTipCap != nil {
+		// Skip the checks if gas fields are zero and the base fee was
+		// explicitly disabled (eth_call)
+		skipCheck := st.evm.Config.NoBaseFee && st.gasFeeCap.BitLen() == 0 && st.gasTipCap.BitLen() == 0
+		if !skipCheck {
+			if l := st.gasFeeCap.BitLen(); l > 256 {
+				return fmt.Errorf("%w: address %v, maxFeePerGas bit length: %d", ErrFeeCapVeryHigh,
+					st.msg.From().Hex(), l)
+			}
+			if l := st.gasTipCap.BitLen(); l > 256 {
+				return fmt.Errorf("%w: address %v, maxPriorityFeePerGas bit length: %d", ErrTipVeryHigh,
+					st.msg.From().Hex(), l)
+			}
+			if st.gasFeeCap.Cmp(st.gasTipCap) < 0 {
+				return fmt.Errorf("%w: address %v, maxPriorityFeePerGas: %s, maxFeePerGas: %s", ErrTipAboveFeeCap,
+					st.msg.From().Hex(), st.gasTipCap, st.gasFeeCap)
+			}
+			if !feeExempt && st.evm.Context.BaseFee != nil && st.gasFeeCap.Cmp(st.evm.Context.BaseFee) < 0 {
+				return fmt.Errorf("%w: address %v, maxFeePerGas: %s baseFee: %s", ErrFeeCapTooLow,
+					st.msg.From().Hex(), st.gasFeeCap, st.evm.Context.BaseFee)
+			}
+		}
+	}
 	return st.buyGas()
 }
 
@@ -318,7 +357,7 @@ func (st *StateTransition) TransitionDb() (result *ExecutionResult, err error) {
 				txhash = hexutil.Encode(msg.Data())
 			}
 			if len(msg.Data()) == 32 || isSmallRechargeTx {
-				recharges, totalFee, err = spv.GetRechargeDataByTxhash(txhash)
+				recharges, totalFee, err = evm.MainChain().GetRechargeData(txhash)
 				if err != nil || len(recharges) <= 0 {
 					log.Error("recharge data error", "error", err)
 					return &ExecutionResult{0, nil, nil}, ErrElaToEthAddress
@@ -391,7 +430,9 @@ func (st *StateTransition) TransitionDb() (result *ExecutionResult, err error) {
 		}
 	}
 
-	if err = st.preCheck(); err != nil {
+	feeExempt := len(recharges) > 0 || isRefundWithdrawTx ||
+		(contractCreation && blackcontract.String() == evm.ChainConfig().BlackContractAddr)
+	if err = st.preCheck(feeExempt); err != nil {
 		return
 	}
 	homestead := st.evm.ChainConfig().IsHomestead(st.evm.BlockNumber)
@@ -405,6 +446,11 @@ func (st *StateTransition) TransitionDb() (result *ExecutionResult, err error) {
 	if err = st.useGas(gas); err != nil {
 		return &ExecutionResult{0, nil, nil}, err
 	}
+	if msg.To() != nil && *msg.To() == params.FrozenAccountsAddress && st.evm.ChainConfig().IsFrozenAccountsFork(st.evm.BlockNumber) {
+		if err = st.applyFrozenAccountsUpdate(); err != nil {
+			return &ExecutionResult{0, nil, nil}, err
+		}
+	}
 	// Set up the initial access list.
 	if rules.IsBerlin {
 		st.state.PrepareAccessList(rules, msg.From(), st.evm.Context.Coinbase, msg.To(), vm.ActivePrecompiles(rules), msg.AccessList())
@@ -471,14 +517,15 @@ func (st *StateTransition) TransitionDb() (result *ExecutionResult, err error) {
 	if contractCreation && blackcontract.String() == evm.ChainConfig().BlackContractAddr || isRefundWithdrawTx {
 		st.state.AddBalance(st.msg.From(), new(big.Int).Mul(new(big.Int).SetUint64(st.gasUsed()), st.gasPrice)) // Refund the cost
 	} else {
-		minerFee := new(big.Int).Mul(new(big.Int).SetUint64(st.gasUsed()), st.gasPrice)
-		num := len(st.evm.ChainConfig().DeveloperContract)
-		if num > 0 && st.evm.ChainConfig().IsdeveloperSplitfeeTime(st.evm.Time.Uint64()) {
-			fee := big.NewInt(0).Mul(minerFee, big.NewInt(50))
+		// Once the fee market is live the base fee part of the price is burnt
+		// and only the tip goes to the miner. System transactions are priced
+		// by the main chain and pay their whole fee to the miner.
+		minerFee := new(big.Int).Mul(new(big.Int).SetUint64(st.gasUsed()), st.effectiveTip(feeExempt))
+		if split := st.evm.ChainConfig().DeveloperFeeSplitAt(st.evm.BlockNumber, st.evm.Time.Uint64()); split != nil {
+			fee := big.NewInt(0).Mul(minerFee, new(big.Int).SetUint64(split.Ratio))
 			fee = big.NewInt(0).Div(fee, big.NewInt(100))
-			subFee := fee.Div(fee, big.NewInt(int64(num)))
-			for _, account := range st.evm.ChainConfig().DeveloperContract {
-				developerAddress := common.HexToAddress(account)
+			subFee := fee.Div(fee, big.NewInt(int64(len(split.Recipients))))
+			for _, developerAddress := range split.Recipients {
 				st.state.AddBalance(developerAddress, subFee)
 				minerFee = minerFee.Sub(minerFee, subFee)
 			}
@@ -488,16 +535,37 @@ func (st *StateTransition) TransitionDb() (result *ExecutionResult, err error) {
 	return &ExecutionResult{st.gasUsed(), vmerr, ret}, err
 }
 
+// effectiveTip returns the part of the gas price paid to the miner, that is
+// min(gasTipCap, gasFeeCap-baseFee) once the base fee is active.
+func (st *StateTransition) effectiveTip(feeExempt bool) *big.Int {
+	baseFee := st.evm.Context.BaseFee
+	if feeExempt || baseFee == nil || !st.evm.ChainConfig().IsEIP1559(st.evm.BlockNumber) {
+		return st.gasPrice
+	}
+	tip := new(big.Int).Sub(st.gasPrice, baseFee)
+	if st.gasFeeCap != nil && st.gasTipCap != nil {
+		tip = new(big.Int).Sub(st.gasFeeCap, baseFee)
+		if tip.Cmp(st.gasTipCap) > 0 {
+			tip = new(big.Int).Set(st.gasTipCap)
+		}
+	}
+	// Only calls without a base fee check (eth_call) may price below it.
+	if tip.Sign() < 0 {
+		tip.SetUint64(0)
+	}
+	return tip
+}
+
 func (st *StateTransition) dealSmallCrossTx() (isSmallCrossTx, verifyed bool, txHash string, err error) {
 	msg := st.msg
 	err = nil
-	rawTxid, rawTx, signatures, height := spv.IsSmallCrossTxByData(msg.Data())
+	rawTxid, rawTx, signatures, height := st.evm.MainChain().IsSmallCrossTxByData(msg.Data())
 	isSmallCrossTx = len(rawTxid) > 0
 	if !isSmallCrossTx {
 		verifyed = false
 		return isSmallCrossTx, verifyed, rawTxid, errors.New("is not small cross transaction")
 	}
-	verifyed, err = spv.VerifySmallCrossTx(rawTxid, rawTx, signatures, height)
+	verifyed, err = st.evm.MainChain().VerifySmallCrossTx(rawTxid, rawTx, signatures, height)
 	if err != nil {
 		return isSmallCrossTx, verifyed, rawTxid, err
 	}
@@ -522,7 +590,7 @@ func (st *StateTransition) dealSmallCrossTx() (isSmallCrossTx, verifyed bool, tx
 		verifyed = false
 		return isSmallCrossTx, verifyed, rawTxid, err
 	}
-	spv.NotifySmallCrossTx(txn)
+	st.evm.MainChain().NotifySmallCrossTx(txn)
 	return isSmallCrossTx, verifyed, rawTxid, err
 }
 
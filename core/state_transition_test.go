@@ -0,0 +1,122 @@
+// Copyright 2016 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+)
+
+// Tests that after the EIP-1559 fork the base fee of a transaction is burnt
+// and only the tip is paid to the coinbase and the developer fee recipients.
+func TestDynamicFeeBurn(t *testing.T) {
+	var (
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		coinbase  = common.Address{0xc0}
+		developer = common.Address{0xde}
+		recipient = common.Address{0xaa}
+		funds     = big.NewInt(params.Ether)
+		baseFee   = big.NewInt(10 * params.GWei)
+	)
+	tests := []struct {
+		tipCap, feeCap *big.Int
+		split          []*params.DeveloperFeeSplit
+		tip            *big.Int // expected tip per gas
+	}{
+		// The tip cap fits below the fee cap
+		{big.NewInt(2 * params.GWei), big.NewInt(20 * params.GWei), nil, big.NewInt(2 * params.GWei)},
+		// The fee cap limits the tip
+		{big.NewInt(5 * params.GWei), big.NewInt(12 * params.GWei), nil, big.NewInt(2 * params.GWei)},
+		// No tip at all
+		{big.NewInt(0), big.NewInt(10 * params.GWei), nil, big.NewInt(0)},
+		// The developer split is taken from the tip only
+		{big.NewInt(2 * params.GWei), big.NewInt(20 * params.GWei), []*params.DeveloperFeeSplit{{Block: big.NewInt(0), Ratio: 50, Recipients: []common.Address{developer}}}, big.NewInt(2 * params.GWei)},
+	}
+	for i, tt := range tests {
+		config := *params.TestChainConfig
+		config.BerlinBlock = big.NewInt(0)
+		config.LondonBlock = big.NewInt(0)
+		config.EIP1559Block = big.NewInt(0)
+		config.DeveloperFeeSplits = tt.split
+
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		statedb.AddBalance(sender, funds)
+
+		signer := types.LatestSigner(&config)
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   config.ChainID,
+			Nonce:     0,
+			GasTipCap: tt.tipCap,
+			GasFeeCap: tt.feeCap,
+			Gas:       params.TxGas,
+			To:        &recipient,
+			Value:     big.NewInt(1),
+		})
+		if err != nil {
+			t.Fatalf("test %d: failed to sign transaction: %v", i, err)
+		}
+		msg, err := tx.AsMessage(signer, baseFee)
+		if err != nil {
+			t.Fatalf("test %d: failed to create message: %v", i, err)
+		}
+		context := vm.Context{
+			CanTransfer: CanTransfer,
+			Transfer:    Transfer,
+			GetHash:     func(uint64) common.Hash { return common.Hash{} },
+			Origin:      sender,
+			GasPrice:    msg.GasPrice(),
+			Coinbase:    coinbase,
+			GasLimit:    params.TxGas,
+			BlockNumber: big.NewInt(1),
+			Time:        big.NewInt(0),
+			Difficulty:  big.NewInt(0),
+			BaseFee:     baseFee,
+		}
+		evm := vm.NewEVM(context, statedb, &config, vm.Config{})
+		result, err := ApplyMessage(evm, msg, new(GasPool).AddGas(params.TxGas))
+		if err != nil || result.Failed() {
+			t.Fatalf("test %d: transaction failed: %v %v", i, err, result.Err)
+		}
+		gasUsed := new(big.Int).SetUint64(result.UsedGas)
+		price := new(big.Int).Add(baseFee, tt.tip)
+
+		spent := new(big.Int).Add(new(big.Int).Mul(gasUsed, price), big.NewInt(1))
+		if have, want := statedb.GetBalance(sender), new(big.Int).Sub(funds, spent); have.Cmp(want) != 0 {
+			t.Errorf("test %d: sender balance mismatch: have %v, want %v", i, have, want)
+		}
+		tips := new(big.Int).Mul(gasUsed, tt.tip)
+		if tt.split != nil {
+			devFee := new(big.Int).Div(tips, big.NewInt(2))
+			if have := statedb.GetBalance(developer); have.Cmp(devFee) != 0 {
+				t.Errorf("test %d: developer balance mismatch: have %v, want %v", i, have, devFee)
+			}
+			tips.Sub(tips, devFee)
+		}
+		if have := statedb.GetBalance(coinbase); have.Cmp(tips) != 0 {
+			t.Errorf("test %d: coinbase balance mismatch: have %v, want %v", i, have, tips)
+		}
+	}
+}
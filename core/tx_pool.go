@@ -28,6 +28,7 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/prque"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/misc"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/crosschain"
@@ -228,6 +229,10 @@ type TxPool struct {
 	mu          sync.RWMutex
 
 	istanbul bool // Fork indicator whether we are in the istanbul stage.
+	frozen   bool // Fork indicator whether the frozen account list is on chain.
+	eip1559  bool // Fork indicator whether we are using EIP-1559 type transactions.
+
+	frozenNonce uint64 // Update nonce of the on chain frozen account list at the last reset
 
 	currentState  *state.StateDB // Current state in the blockchain head
 	pendingNonces *txNoncer      // Pending state tracking virtual nonces
@@ -267,7 +272,6 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		config:          config,
 		chainconfig:     chainconfig,
 		chain:           chain,
-		signer:          types.NewEIP155Signer(chainconfig.GetChainIDByHeight(chain.CurrentBlock().Number())),
 		pending:         make(map[common.Address]*txList),
 		queue:           make(map[common.Address]*txList),
 		beats:           make(map[common.Address]time.Time),
@@ -280,7 +284,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		reorgShutdownCh: make(chan struct{}),
 		gasPrice:        new(big.Int).SetUint64(config.PriceLimit),
 	}
-	pool.signer.(types.EIP155Signer).SetForkData(chainconfig, chain.CurrentBlock().Number())
+	pool.signer = pool.makeSigner(chain.CurrentBlock().Number())
 	pool.locals = newAccountSet(pool.signer)
 	for _, addr := range config.Locals {
 		pool.locals.add(addr)
@@ -339,7 +343,7 @@ func (pool *TxPool) loop() {
 				pool.requestReset(head.Header(), ev.Block.Header())
 				head = ev.Block
 				//To dynamically update signer
-				signer := types.NewEIP155Signer(pool.chainconfig.GetChainIDByHeight(pool.chain.CurrentBlock().Number()))
+				signer := pool.makeSigner(pool.chain.CurrentBlock().Number())
 				if !pool.signer.Equal(signer) {
 					pool.signer = signer
 					pool.locals.signer = signer
@@ -408,6 +412,15 @@ func (pool *TxPool) Stop() {
 	log.Info("Transaction pool stopped")
 }
 
+// mainChain returns the ELA main chain backend of the pool's chain, falling
+// back to the spv default backend for chains which don't carry one.
+func (pool *TxPool) mainChain() spv.MainChainBackend {
+	if mc, ok := pool.chain.(MainChainContext); ok {
+		return mc.MainChainBackend()
+	}
+	return spv.DefaultMainChain()
+}
+
 // SubscribeNewTxsEvent registers a subscription of NewTxsEvent and
 // starts sending event to the given channel.
 func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscription {
@@ -522,9 +535,25 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	return txs
 }
 
+// makeSigner creates the signer for the transactions pending on top of the
+// block with the given number. Typed transactions are only accepted once the
+// EIP-1559 fork is active for the next block.
+func (pool *TxPool) makeSigner(number *big.Int) types.Signer {
+	signer := types.NewEIP155Signer(pool.chainconfig.GetChainIDByHeight(number))
+	signer.SetForkData(pool.chainconfig, number)
+	if pool.chainconfig.IsEIP1559(new(big.Int).Add(number, common.Big1)) {
+		return types.NewLondonSignerWithEIP155(signer)
+	}
+	return signer
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
+	// Accept only legacy transactions until EIP-1559 activates.
+	if !pool.eip1559 && tx.Type() != types.LegacyTxType {
+		return types.ErrTxTypeNotSupported
+	}
 	// Heuristic limit, reject transactions over 32KB to prevent DOS attacks
 	if tx.Size() > 32*1024 {
 		return ErrOversizedData
@@ -538,21 +567,32 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if pool.currentMaxGas < tx.Gas() {
 		return ErrGasLimit
 	}
+	// Sanity check for extremely large numbers
+	if tx.GasFeeCap().BitLen() > 256 {
+		return ErrFeeCapVeryHigh
+	}
+	if tx.GasTipCap().BitLen() > 256 {
+		return ErrTipVeryHigh
+	}
+	// Ensure gasFeeCap is greater than or equal to gasTipCap.
+	if tx.GasFeeCapIntCmp(tx.GasTipCap()) < 0 {
+		return ErrTipAboveFeeCap
+	}
 	// Make sure the transaction is signed properly
 	from, err := types.Sender(pool.signer, tx)
 	if err != nil {
 		return ErrInvalidSender
 	}
-	// Drop non-local transactions under our own minimal accepted gas price
+	// Drop non-local transactions under our own minimal accepted gas price or tip
 	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
-	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+	if !local && tx.GasTipCapIntCmp(pool.gasPrice) < 0 {
 		return ErrUnderpriced
 	}
 
 	height := pool.chain.CurrentBlock().Number().Uint64()
-	minGasPrice, err := spv.GetMinGasPrice(uint32(height))
+	minGasPrice, err := pool.mainChain().GetMinGasPrice(uint32(height))
 	log.Info(">>>>>>>>>>> spv.GetMinGasPrice", "minGasPrice", minGasPrice, "currentHeight", uint32(height), "error", err)
-	if err == nil && minGasPrice.Cmp(tx.GasPrice()) > 0 {
+	if err == nil && tx.GasFeeCapIntCmp(minGasPrice) < 0 {
 		return ErrLowGasPrice
 	}
 
@@ -572,7 +612,7 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 			if to == addr {
 				isWithdrawRefund, _ = withdrawfailedtx.IsWithdawFailedTx(tx.Data(), pool.chainconfig.BlackContractAddr)
 				if !isWithdrawRefund && len(tx.Data()) > 32 {
-					rawTxID, _, _, _ := spv.IsSmallCrossTxByData(tx.Data())
+					rawTxID, _, _, _ := pool.mainChain().IsSmallCrossTxByData(tx.Data())
 					isSmallCrossTx = rawTxID != ""
 				}
 			}
@@ -582,7 +622,7 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 				}
 			}
 		}
-		if to.String() == pool.chainconfig.BlackContractAddr && spv.MainChainIsPowMode() {
+		if to.String() == pool.chainconfig.BlackContractAddr && pool.mainChain().IsPowMode() {
 			log.Error("[validateTx]", "error", ErrMainChainInPowMode.Error())
 			return ErrMainChainInPowMode
 		}
@@ -610,7 +650,12 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	return nil
 }
 
+// IsFrozenAccount reports whether the account is frozen by the local list or,
+// after the frozen accounts fork, by the on chain one.
 func (pool *TxPool) IsFrozenAccount(from common.Address) bool {
+	if pool.frozen && IsAccountFrozen(pool.currentState, from) {
+		return true
+	}
 	list := pool.chainconfig.FrozeAccountList
 	for _, account := range list {
 		if from.String() == account {
@@ -895,10 +940,10 @@ func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local bool) ([]error,
 					if len(tx.Data()) == 32 {
 						txhash = hexutil.Encode(tx.Data())
 					} else {
-						txhash, _, _, _ = spv.IsSmallCrossTxByData(tx.Data())
+						txhash, _, _, _ = pool.mainChain().IsSmallCrossTxByData(tx.Data())
 					}
 					//fee, addr, output := spv.FindOutputFeeAndaddressByTxHash(txhash)
-					recharges, fee, err := spv.GetRechargeDataByTxhash(txhash)
+					recharges, fee, err := pool.mainChain().GetRechargeData(txhash)
 					if err != nil {
 						errs[i] = err
 					}
@@ -1040,11 +1085,11 @@ func UptxhashIndex(pool *TxPool, tx *types.Transaction) bool {
 			if len(tx.Data()) == 32 {
 				txhash = hexutil.Encode(tx.Data())
 			} else {
-				txhash, _, _, _ = spv.IsSmallCrossTxByData(tx.Data())
+				txhash, _, _, _ = pool.mainChain().IsSmallCrossTxByData(tx.Data())
 			}
 			completetxhash := pool.currentState.GetState(blackaddr, common.HexToHash(txhash))
 			if (completetxhash == common.Hash{}) {
-				spv.UpTransactionIndex(string(txhash))
+				pool.mainChain().UpTransactionIndex(string(txhash))
 				return true
 			} else {
 				return false
@@ -1250,6 +1295,9 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	// because of another transaction (e.g. higher gas price).
 	if reset != nil {
 		pool.demoteUnexecutables()
+		if reset.newHead != nil && pool.chainconfig.IsEIP1559(new(big.Int).Add(reset.newHead.Number, big.NewInt(1))) {
+			pool.priced.SetBaseFee(misc.CalcBaseFee(pool.chainconfig, reset.newHead))
+		}
 	}
 	// Ensure pool.queue and pool.pending sizes stay within the configured limits.
 	pool.truncatePending()
@@ -1358,6 +1406,39 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// Update all fork indicator by next pending block number.
 	next := new(big.Int).Add(newHead.Number, big.NewInt(1))
 	pool.istanbul = pool.chainconfig.IsIstanbul(next)
+	wasFrozen := pool.frozen
+	pool.frozen = pool.chainconfig.IsFrozenAccountsFork(next)
+	pool.eip1559 = pool.chainconfig.IsEIP1559(next)
+
+	// Evict the transactions of the accounts frozen since the last reset
+	if pool.frozen {
+		if nonce := FrozenAccountsNonce(statedb); !wasFrozen || nonce != pool.frozenNonce {
+			pool.frozenNonce = nonce
+			pool.dropFrozenAccounts()
+		}
+	}
+}
+
+// dropFrozenAccounts removes all the transactions of the frozen accounts, none
+// of them can be executed until the account is unfrozen.
+func (pool *TxPool) dropFrozenAccounts() {
+	var hashes []common.Hash
+	for _, accounts := range []map[common.Address]*txList{pool.pending, pool.queue} {
+		for addr, list := range accounts {
+			if !pool.IsFrozenAccount(addr) {
+				continue
+			}
+			for _, tx := range list.Flatten() {
+				hashes = append(hashes, tx.Hash())
+			}
+		}
+	}
+	for _, hash := range hashes {
+		pool.removeTx(hash, true)
+	}
+	if len(hashes) > 0 {
+		log.Info("Dropped transactions of frozen accounts", "count", len(hashes))
+	}
 }
 
 // promoteExecutables moves transactions that have become processable from the
@@ -56,7 +56,7 @@ type AccessListTx struct {
 }
 
 // copy creates a deep copy of the transaction data and initializes all fields.
-func (tx *AccessListTx) copy() *AccessListTx {
+func (tx *AccessListTx) copy() TxData {
 	cpy := &AccessListTx{
 		Nonce: tx.Nonce,
 		To:    copyAddressPtr(tx.To),
@@ -94,7 +94,7 @@ func (tx *AccessListTx) copy() *AccessListTx {
 }
 
 // accessors for innerTx.
-func (tx *AccessListTx) txType() byte           { return LegacyTxType }
+func (tx *AccessListTx) txType() byte           { return AccessListTxType }
 func (tx *AccessListTx) chainID() *big.Int      { return tx.ChainID }
 func (tx *AccessListTx) accessList() AccessList { return tx.AccessList }
 func (tx *AccessListTx) data() []byte           { return tx.Data }
@@ -112,7 +112,9 @@ func CreateBloomWithTxList(receipts Receipts, txs []*Transaction) Bloom {
 		for _, tx := range txs {
 			if (*tx).Hash() == txHash {
 				to := tx.To()
-				if tx.Protected() {
+				if tx.Type() != LegacyTxType {
+					signer = NewLondonSigner(tx.ChainId())
+				} else if tx.Protected() {
 					if eip155Signer == (EIP155Signer{}) {
 						eip155Signer = NewEIP155Signer(tx.ChainId())
 					}
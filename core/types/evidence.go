@@ -0,0 +1,43 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+)
+
+// DoubleSignEvidence is the proof that a signer sealed two different headers
+// at the same height. Both headers are kept in full so the signatures can be
+// checked without access to the chain.
+type DoubleSignEvidence struct {
+	Signer  common.Address
+	Header  *Header // header first seen at the height
+	Compare *Header // conflicting header sealed by the same signer
+}
+
+// Number returns the height both headers were sealed at.
+func (e *DoubleSignEvidence) Number() uint64 { return e.Header.Number.Uint64() }
+
+// Hash returns a hash identifying the evidence, independent of the order the
+// two headers were seen in.
+func (e *DoubleSignEvidence) Hash() common.Hash {
+	a, b := e.Header.Hash(), e.Compare.Hash()
+	if b.Big().Cmp(a.Big()) < 0 {
+		a, b = b, a
+	}
+	return rlpHash([]interface{}{e.Signer, a, b})
+}
@@ -139,7 +139,7 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 		}
 	}
 	// Sort the transactions and cross check the nonce ordering
-	txset := NewTransactionsByPriceAndNonce(signer, groups)
+	txset := NewTransactionsByPriceAndNonce(signer, groups, nil)
 
 	txs := Transactions{}
 	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
@@ -219,3 +219,143 @@ func TestTransactionJSON(t *testing.T) {
 		}
 	}
 }
+
+// Tests that dynamic fee transactions survive the RLP and binary encodings and
+// that their signer derives the right sender.
+func TestDynamicFeeTransactionEncode(t *testing.T) {
+	key, addr := defaultTestKey()
+	signer := NewLondonSigner(big.NewInt(20))
+
+	to := common.HexToAddress("b94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+	tx, err := SignNewTx(key, signer, &DynamicFeeTx{
+		ChainID:   big.NewInt(20),
+		Nonce:     3,
+		GasTipCap: big.NewInt(2),
+		GasFeeCap: big.NewInt(10),
+		Gas:       25000,
+		To:        &to,
+		Value:     big.NewInt(10),
+		Data:      common.FromHex("5544"),
+		AccessList: AccessList{{
+			Address:     to,
+			StorageKeys: []common.Hash{{1}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("could not sign transaction: %v", err)
+	}
+	if tx.Type() != DynamicFeeTxType {
+		t.Fatalf("transaction type mismatch: have %d, want %d", tx.Type(), DynamicFeeTxType)
+	}
+	// Typed transactions are wrapped into an RLP string inside blocks
+	blob, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	parsed, err := decodeTx(blob)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Errorf("hash mismatch after RLP round trip: have %x, want %x", parsed.Hash(), tx.Hash())
+	}
+	// The canonical binary encoding is the type byte followed by the payload
+	bin, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("binary encode error: %v", err)
+	}
+	if bin[0] != DynamicFeeTxType {
+		t.Errorf("binary encoding type prefix mismatch: have %d, want %d", bin[0], DynamicFeeTxType)
+	}
+	parsed = new(Transaction)
+	if err := parsed.UnmarshalBinary(bin); err != nil {
+		t.Fatalf("binary decode error: %v", err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Errorf("hash mismatch after binary round trip: have %x, want %x", parsed.Hash(), tx.Hash())
+	}
+	from, err := Sender(signer, parsed)
+	if err != nil {
+		t.Fatalf("could not derive sender: %v", err)
+	}
+	if from != addr {
+		t.Errorf("sender mismatch: have %x, want %x", from, addr)
+	}
+	// Pre-London signers must refuse the typed transaction
+	if _, err := Sender(NewEIP155Signer(big.NewInt(20)), parsed); err != ErrTxTypeNotSupported {
+		t.Errorf("EIP155 signer error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	// JSON must carry the fee caps through too
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	parsed = new(Transaction)
+	if err := json.Unmarshal(data, parsed); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Errorf("hash mismatch after JSON round trip: have %x, want %x", parsed.Hash(), tx.Hash())
+	}
+}
+
+// Tests the effective gas price that dynamic fee transactions pay for a given
+// base fee.
+func TestEffectiveGasPrice(t *testing.T) {
+	tx := NewTx(&DynamicFeeTx{GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(10)})
+	legacy := NewTransaction(0, common.Address{}, common.Big0, 0, big.NewInt(7), nil)
+
+	tests := []struct {
+		tx      *Transaction
+		baseFee *big.Int
+		want    int64
+	}{
+		{tx, nil, 10},              // pre-fork, the fee cap is the price
+		{tx, big.NewInt(3), 5},     // base fee plus full tip
+		{tx, big.NewInt(9), 10},    // tip cut short by the fee cap
+		{legacy, big.NewInt(3), 7}, // legacy transactions pay their gas price
+	}
+	for i, test := range tests {
+		if have := test.tx.EffectiveGasPrice(test.baseFee); have.Int64() != test.want {
+			t.Errorf("test %d: effective gas price mismatch: have %v, want %d", i, have, test.want)
+		}
+	}
+}
+
+// Tests that transactions which cannot pay the base fee are left out and that
+// the rest are ordered by the tip they pay the miner.
+func TestTransactionTipSort(t *testing.T) {
+	signer := NewLondonSigner(common.Big1)
+	baseFee := big.NewInt(10)
+
+	groups := map[common.Address]Transactions{}
+	for i, caps := range [][2]int64{{5, 20}, {1, 9}, {8, 12}, {3, 30}} {
+		key, _ := crypto.GenerateKey()
+		tx, _ := SignNewTx(key, signer, &DynamicFeeTx{
+			ChainID:   common.Big1,
+			Nonce:     uint64(i),
+			GasTipCap: big.NewInt(caps[0]),
+			GasFeeCap: big.NewInt(caps[1]),
+			Gas:       21000,
+		})
+		groups[crypto.PubkeyToAddress(key.PublicKey)] = Transactions{tx}
+	}
+	txset := NewTransactionsByPriceAndNonce(signer, groups, baseFee)
+
+	var tips []int64
+	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
+		tip, _ := tx.EffectiveGasTip(baseFee)
+		tips = append(tips, tip.Int64())
+		txset.Shift()
+	}
+	want := []int64{5, 3, 2}
+	if len(tips) != len(want) {
+		t.Fatalf("transaction count mismatch: have %v, want %v", tips, want)
+	}
+	for i := range want {
+		if tips[i] != want[i] {
+			t.Errorf("tip ordering mismatch: have %v, want %v", tips, want)
+			break
+		}
+	}
+}
@@ -34,7 +34,6 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto/bn256"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
-	"github.com/elastos/Elastos.ELA.SideChain.ESC/pledgeBill"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
 
 	"github.com/elastos/Elastos.ELA/core/contract"
@@ -682,18 +681,38 @@ func (c *blake2F) Run(input []byte) ([]byte, error) {
 	return output, nil
 }
 
+// mainChainPrecompile is implemented by the precompiles reading ELA main chain
+// data, so the EVM can bind them to its own main chain backend.
+type mainChainPrecompile interface {
+	withMainChain(backend spv.MainChainBackend) PrecompiledContract
+}
+
+// mainChainOrDefault returns backend, or the spv default backend if nil.
+func mainChainOrDefault(backend spv.MainChainBackend) spv.MainChainBackend {
+	if backend != nil {
+		return backend
+	}
+	return spv.DefaultMainChain()
+}
+
 var (
 	errGettingArbitersFailed = errors.New("getting arbiters failed")
 )
 
-type arbiters struct{}
+type arbiters struct {
+	mainChain spv.MainChainBackend
+}
+
+func (c *arbiters) withMainChain(backend spv.MainChainBackend) PrecompiledContract {
+	return &arbiters{mainChain: backend}
+}
 
 func (c *arbiters) RequiredGas(input []byte) uint64 {
 	return params.ArbitersBaseGas
 }
 
 func (c *arbiters) Run(input []byte) ([]byte, error) {
-	arbiters, _, err := spv.GetArbiters()
+	arbiters, _, err := mainChainOrDefault(c.mainChain).GetArbiters()
 	if err != nil {
 		return nil, errGettingArbitersFailed
 	}
@@ -770,7 +789,13 @@ func (b *pbkVerifySignature) Run(input []byte) ([]byte, error) {
 	return false32Byte, nil
 }
 
-type pledgeBillVerify struct{}
+type pledgeBillVerify struct {
+	mainChain spv.MainChainBackend
+}
+
+func (b *pledgeBillVerify) withMainChain(backend spv.MainChainBackend) PrecompiledContract {
+	return &pledgeBillVerify{mainChain: backend}
+}
 
 func (b *pledgeBillVerify) RequiredGas(input []byte) uint64 {
 	return params.PledgeBillVerifyGas
@@ -804,7 +829,7 @@ func (b *pledgeBillVerify) Run(input []byte) ([]byte, error) {
 
 	if n.Int64() == 1 {
 		signature := getData(input, point, 64)
-		err := checkStandardSignature(publickeys[0], elaHash, toAddress, signature)
+		err := checkStandardSignature(mainChainOrDefault(b.mainChain), publickeys[0], elaHash, toAddress, signature)
 		if err != nil {
 			log.Error("checkStandardSignature failed", "err", err)
 			return false32Byte, err
@@ -819,7 +844,7 @@ func (b *pledgeBillVerify) Run(input []byte) ([]byte, error) {
 		if n.Cmp(m) < 0 {
 			return false32Byte, errors.New("n is smaller than m")
 		}
-		err := checkMultiSignatures(int(m.Int64()), publickeys, signatures, elaHash, toAddress)
+		err := checkMultiSignatures(mainChainOrDefault(b.mainChain), int(m.Int64()), publickeys, signatures, elaHash, toAddress)
 		if err != nil {
 			log.Error("checkMultiSignatures failed", "err", err)
 			return false32Byte, err
@@ -837,7 +862,7 @@ func getParameterBySignature(signature []byte) []byte {
 	return buf.Bytes()
 }
 
-func checkStandardSignature(pubKey *elaCrypto.PublicKey, elaHash []byte, toAddress []byte, signature []byte) error {
+func checkStandardSignature(mainChain spv.MainChainBackend, pubKey *elaCrypto.PublicKey, elaHash []byte, toAddress []byte, signature []byte) error {
 	data := append(elaHash, toAddress...)
 	err := elaCrypto.Verify(*pubKey, data, signature)
 	if err != nil {
@@ -853,7 +878,7 @@ func checkStandardSignature(pubKey *elaCrypto.PublicKey, elaHash []byte, toAddre
 	}
 	stakeAddress, err := ct.ToProgramHash().ToAddress()
 
-	sAddress, _, err := pledgeBill.GetPledgeBillData(common.BytesToHash(elaHash).String())
+	sAddress, _, err := mainChain.GetPledgeBillData(common.BytesToHash(elaHash).String())
 	if err != nil {
 		log.Info("general stakeAddress", "", stakeAddress)
 		return err
@@ -864,7 +889,7 @@ func checkStandardSignature(pubKey *elaCrypto.PublicKey, elaHash []byte, toAddre
 	return nil
 }
 
-func checkMultiSignatures(m int, publickeys []*elaCrypto.PublicKey, signatures []byte, elaHash []byte, toAddress []byte) error {
+func checkMultiSignatures(mainChain spv.MainChainBackend, m int, publickeys []*elaCrypto.PublicKey, signatures []byte, elaHash []byte, toAddress []byte) error {
 	ct, err := contract.CreateMultiSigContract(m, publickeys)
 	if err != nil {
 		return err
@@ -883,14 +908,20 @@ func checkMultiSignatures(m int, publickeys []*elaCrypto.PublicKey, signatures [
 	if err != nil {
 		return err
 	}
-	sAddress, _, err := pledgeBill.GetPledgeBillData(common.BytesToHash(elaHash).String())
+	sAddress, _, err := mainChain.GetPledgeBillData(common.BytesToHash(elaHash).String())
 	if sAddress != stakeAddress {
 		return errors.New(fmt.Sprintf("stakeAddress is not correct, spv sAddress%s, callSaddress:%s", sAddress, stakeAddress))
 	}
 	return nil
 }
 
-type pledgeBillTokenID struct{}
+type pledgeBillTokenID struct {
+	mainChain spv.MainChainBackend
+}
+
+func (b *pledgeBillTokenID) withMainChain(backend spv.MainChainBackend) PrecompiledContract {
+	return &pledgeBillTokenID{mainChain: backend}
+}
 
 func (b *pledgeBillTokenID) RequiredGas(input []byte) uint64 {
 	return params.GetPledgeBillTokenID
@@ -900,7 +931,7 @@ func (b *pledgeBillTokenID) Run(input []byte) ([]byte, error) {
 	//length := getData(input, 0, 32)
 	elaHash := getData(input, 32, 32)
 
-	_, tokenID, err := pledgeBill.GetPledgeBillData(common.BytesToHash(elaHash).String())
+	_, tokenID, err := mainChainOrDefault(b.mainChain).GetPledgeBillData(common.BytesToHash(elaHash).String())
 	if err != nil {
 		log.Info("pledgeBillTokenID", "elaHash", elaHash, "hash", common.BytesToHash(elaHash).String(), "tokenID", tokenID)
 		return false32Byte, err
@@ -908,7 +939,13 @@ func (b *pledgeBillTokenID) Run(input []byte) ([]byte, error) {
 	return tokenID.Bytes(), nil
 }
 
-type pledgeBillTokenDetail struct{}
+type pledgeBillTokenDetail struct {
+	mainChain spv.MainChainBackend
+}
+
+func (p *pledgeBillTokenDetail) withMainChain(backend spv.MainChainBackend) PrecompiledContract {
+	return &pledgeBillTokenDetail{mainChain: backend}
+}
 
 func (p *pledgeBillTokenDetail) RequiredGas(input []byte) uint64 {
 	return params.GetPledgeBillTokenDetail
@@ -917,7 +954,7 @@ func (p *pledgeBillTokenDetail) RequiredGas(input []byte) uint64 {
 func (p *pledgeBillTokenDetail) Run(input []byte) ([]byte, error) {
 	//length := getData(input, 0, 32)
 	elaHash := getData(input, 32, 32)
-	nftPayload, payloadVersion, err := pledgeBill.GetCreateNFTPayload(common.BytesToHash(elaHash).String())
+	nftPayload, payloadVersion, err := mainChainOrDefault(p.mainChain).GetCreateNFTPayload(common.BytesToHash(elaHash).String())
 	if err != nil {
 		log.Info("pledgeBillTokenDetail", "elaHash", elaHash, "hash", common.BytesToHash(elaHash).String())
 		return false32Byte, err
@@ -970,7 +1007,13 @@ func (p *pledgeBillTokenDetail) Run(input []byte) ([]byte, error) {
 	return ret, nil
 }
 
-type pledgeBillPayloadVersion struct{}
+type pledgeBillPayloadVersion struct {
+	mainChain spv.MainChainBackend
+}
+
+func (p *pledgeBillPayloadVersion) withMainChain(backend spv.MainChainBackend) PrecompiledContract {
+	return &pledgeBillPayloadVersion{mainChain: backend}
+}
 
 func (p *pledgeBillPayloadVersion) RequiredGas(input []byte) uint64 {
 	return params.GetPledgeBillTokenID
@@ -978,7 +1021,7 @@ func (p *pledgeBillPayloadVersion) RequiredGas(input []byte) uint64 {
 
 func (p *pledgeBillPayloadVersion) Run(input []byte) ([]byte, error) {
 	elaHash := getData(input, 32, 32)
-	v, err := pledgeBill.GetBPosNftPayloadVersion(common.BytesToHash(elaHash).String())
+	v, err := mainChainOrDefault(p.mainChain).GetBPosNftPayloadVersion(common.BytesToHash(elaHash).String())
 	version := big.NewInt(int64(v))
 	if err != nil {
 		log.Warn("GetBPosNftPayloadVerson failed", "error", err)
@@ -1411,7 +1454,13 @@ func (c *bls12381MapG2) Run(input []byte) ([]byte, error) {
 	return g.EncodePoint(r), nil
 }
 
-type getMainChainBlockByHeight struct{}
+type getMainChainBlockByHeight struct {
+	mainChain spv.MainChainBackend
+}
+
+func (c *getMainChainBlockByHeight) withMainChain(backend spv.MainChainBackend) PrecompiledContract {
+	return &getMainChainBlockByHeight{mainChain: backend}
+}
 
 func (c *getMainChainBlockByHeight) RequiredGas(input []byte) uint64 {
 	return params.GetMainChainBlock
@@ -1421,7 +1470,7 @@ func (c *getMainChainBlockByHeight) Run(input []byte) ([]byte, error) {
 	data := getData(input, 32, 32)
 	height := big.NewInt(0).SetBytes(data)
 
-	header, err := spv.SpvService.GetELAHeader(uint32(height.Uint64()))
+	header, err := mainChainOrDefault(c.mainChain).GetELAHeader(uint32(height.Uint64()))
 	if err != nil {
 		log.Error("getMainChainBlockByHeight failed", "error", err, " height", height)
 		return []byte{}, err
@@ -1456,14 +1505,20 @@ func (c *getMainChainBlockByHeight) Run(input []byte) ([]byte, error) {
 	return ret, nil
 }
 
-type getMainChainLatestHeight struct{}
+type getMainChainLatestHeight struct {
+	mainChain spv.MainChainBackend
+}
+
+func (h *getMainChainLatestHeight) withMainChain(backend spv.MainChainBackend) PrecompiledContract {
+	return &getMainChainLatestHeight{mainChain: backend}
+}
 
 func (h *getMainChainLatestHeight) RequiredGas(input []byte) uint64 {
 	return params.GetMainChainBlockLatestHeight
 }
 
 func (h *getMainChainLatestHeight) Run(input []byte) ([]byte, error) {
-	head, err := spv.SpvService.HeaderStore().GetBest()
+	head, err := mainChainOrDefault(h.mainChain).BestELAHeader()
 	if err != nil {
 		log.Error("getMainChainLatestHeight failed", "error", err)
 		return []byte{}, err
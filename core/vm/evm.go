@@ -60,9 +60,20 @@ func (evm *EVM) precompile(addr common.Address) (PrecompiledContract, bool) {
 		precompiles = PrecompiledContractsHomestead
 	}
 	p, ok := precompiles[addr]
+	if mp, isMainChain := p.(mainChainPrecompile); isMainChain {
+		p = mp.withMainChain(evm.MainChain())
+	}
 	return p, ok
 }
 
+// MainChain returns the main chain backend the EVM reads ELA data from.
+func (evm *EVM) MainChain() spv.MainChainBackend {
+	if evm.Context.MainChain != nil {
+		return evm.Context.MainChain
+	}
+	return spv.DefaultMainChain()
+}
+
 // Context provides the EVM with auxiliary information. Once provided
 // it shouldn't be modified.
 type Context struct {
@@ -86,6 +97,11 @@ type Context struct {
 	Difficulty  *big.Int       // Provides information for DIFFICULTY
 	BaseFee     *big.Int       // Provides information for BASEFEE
 	Random      *common.Hash   // Provides information for RANDOM
+	ElaHeight   uint64         // ELA height of the PBFT turn sealing the block
+
+	// MainChain provides the ELA main chain data used by recharge transactions
+	// and the main chain precompiles. The spv default backend is used if nil.
+	MainChain spv.MainChainBackend
 }
 
 type TxContext struct {
@@ -240,7 +256,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		} else if recharge != nil {
 			isSmallRechargeTx := false
 			if len(input) > 32 {
-				rawTxid, _, _, _ := spv.IsSmallCrossTxByData(input)
+				rawTxid, _, _, _ := evm.MainChain().IsSmallCrossTxByData(input)
 				isSmallRechargeTx = len(rawTxid) > 0
 				txHash = rawTxid
 			}
@@ -262,7 +278,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 					}
 					value = new(big.Int).Sub(recharge.TargetAmount, recharge.Fee)
 					topics := make([]common.Hash, 5)
-					topics[0] = common.HexToHash("0x09f15c376272c265d7fcb47bf57d8f84a928195e6ea156d12f5a3cd05b8fed5a")
+					topics[0] = spv.RechargeEventTopic
 					topics[1] = common.HexToHash(caller.Address().String())
 					topics[2] = common.HexToHash(txHash)
 					topics[3] = common.HexToHash(recharge.TargetAddress.String())
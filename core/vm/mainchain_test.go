@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+)
+
+func newMainChainEVM(mainChain spv.MainChainBackend) *EVM {
+	config := *params.TestChainConfig
+	config.BerlinBlock = big.NewInt(0)
+	return NewEVM(Context{BlockNumber: big.NewInt(1), MainChain: mainChain}, nil, &config, Config{})
+}
+
+func TestMainChainPrecompilesUseContextBackend(t *testing.T) {
+	producer := common.Hex2Bytes("03bfd8bd2b10e887ec785360f9b329c2ae567975c784daca2f223cb19840b51914")
+	mainChain := spv.NewSimulatedMainChain([][]byte{producer})
+	mainChain.Commit()
+	mainChain.Commit()
+	evm := newMainChainEVM(mainChain)
+
+	p, ok := evm.precompile(common.BytesToAddress(params.GetMainChainLatestHeight.Bytes()))
+	if !ok {
+		t.Fatal("latest height precompile missing")
+	}
+	ret, _, err := RunPrecompiledContract(p, nil, params.GetMainChainBlockLatestHeight)
+	if err != nil {
+		t.Fatalf("latest height failed: %v", err)
+	}
+	if height := new(big.Int).SetBytes(ret); height.Uint64() != 2 {
+		t.Errorf("latest height mismatch: have %v, want 2", height)
+	}
+
+	p, ok = evm.precompile(common.BytesToAddress(params.ArbiterAddress.Bytes()))
+	if !ok {
+		t.Fatal("arbiters precompile missing")
+	}
+	ret, _, err = RunPrecompiledContract(p, nil, params.ArbitersBaseGas)
+	if err != nil {
+		t.Fatalf("arbiters failed: %v", err)
+	}
+	if want := crypto.Keccak256(producer); !bytes.Equal(ret, want) {
+		t.Errorf("arbiters mismatch: have %x, want %x", ret, want)
+	}
+}
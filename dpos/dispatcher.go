@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -252,6 +253,43 @@ func (d *Dispatcher) OnResponseResetViewReceived(msg *msg.ResetView) error {
 	return nil
 }
 
+// GetAcceptVotes returns a copy of the accept votes collected for the
+// processing proposal.
+func (d *Dispatcher) GetAcceptVotes() []payload.DPOSProposalVote {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	votes := make([]payload.DPOSProposalVote, 0, len(d.acceptVotes))
+	for _, v := range d.acceptVotes {
+		votes = append(votes, *v)
+	}
+	return votes
+}
+
+// GetRejectedVotes returns a copy of the reject votes collected for the
+// processing proposal.
+func (d *Dispatcher) GetRejectedVotes() []payload.DPOSProposalVote {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	votes := make([]payload.DPOSProposalVote, 0, len(d.rejectedVotes))
+	for _, v := range d.rejectedVotes {
+		votes = append(votes, *v)
+	}
+	return votes
+}
+
+// GetResetViewRequests returns the sponsors which requested to reset the
+// view, sorted.
+func (d *Dispatcher) GetResetViewRequests() []string {
+	d.resetViewMu.Lock()
+	defer d.resetViewMu.Unlock()
+	sponsors := make([]string, 0, len(d.resetViewRequests))
+	for sponsor := range d.resetViewRequests {
+		sponsors = append(sponsors, sponsor)
+	}
+	sort.Strings(sponsors)
+	return sponsors
+}
+
 func (d *Dispatcher) GetResetViewReqCount() int {
 	d.resetViewMu.Lock()
 	defer d.resetViewMu.Unlock()
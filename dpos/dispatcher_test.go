@@ -210,4 +210,22 @@ func TestProcessVote(t *testing.T) {
 	}()
 
 	wg.Wait()
-}
\ No newline at end of file
+}
+
+func TestDispatcherResetViewRequests(t *testing.T) {
+	dispatcher := NewDispatcher(getProducerList(), nil, nil, 5*time.Second, []byte{}, dtime.NewMedianTime(), nil, 0)
+	assert.Empty(t, dispatcher.GetAcceptVotes())
+	assert.Empty(t, dispatcher.GetRejectedVotes())
+
+	producers := getProducerList()
+	dispatcher.RecordViewRequest(producers[1])
+	dispatcher.RecordViewRequest(producers[0])
+	dispatcher.RecordViewRequest(producers[1])
+	assert.Equal(t, 2, dispatcher.GetResetViewReqCount())
+
+	expected := []string{common.BytesToHexString(producers[0]), common.BytesToHexString(producers[1])}
+	if expected[0] > expected[1] {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+	assert.Equal(t, expected, dispatcher.GetResetViewRequests())
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package dpos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/dpos_msg"
+	dmsg "github.com/elastos/Elastos.ELA.SideChain.ESC/dpos/msg"
+
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/elastos/Elastos.ELA/dpos/account"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	elap2p "github.com/elastos/Elastos.ELA/p2p"
+)
+
+// EnvelopeMode selects how the arbiter messages are enveloped.
+type EnvelopeMode uint8
+
+const (
+	// EnvelopeOff sends the arbiter messages bare. Envelopes received are
+	// still verified.
+	EnvelopeOff EnvelopeMode = iota
+	// EnvelopeSign seals the arbiter messages sent.
+	EnvelopeSign
+	// EnvelopeRequire also rejects the arbiter messages received bare.
+	EnvelopeRequire
+	// EnvelopeEncrypt also encrypts the arbiter messages to their receiver.
+	EnvelopeEncrypt
+)
+
+var envelopeModes = []string{"off", "sign", "require", "encrypt"}
+
+func (m EnvelopeMode) String() string {
+	if int(m) < len(envelopeModes) {
+		return envelopeModes[m]
+	}
+	return fmt.Sprintf("EnvelopeMode%d", m)
+}
+
+// ParseEnvelopeMode parses the name of an envelope mode, empty being off.
+func ParseEnvelopeMode(name string) (EnvelopeMode, error) {
+	if name == "" {
+		return EnvelopeOff, nil
+	}
+	for i, mode := range envelopeModes {
+		if mode == name {
+			return EnvelopeMode(i), nil
+		}
+	}
+	return EnvelopeOff, fmt.Errorf("unknown message envelope mode %q", name)
+}
+
+// envelopeWindow is how far the timestamp of an envelope may be from the
+// local time. Envelopes are remembered twice as long to reject replays.
+const envelopeWindow = 2 * time.Minute
+
+var (
+	errEnvelopeSender    = errors.New("envelope sender is not the peer")
+	errEnvelopeSignature = errors.New("invalid envelope signature")
+	errEnvelopeCommand   = errors.New("command not allowed in envelope")
+	errEnvelopeStale     = errors.New("envelope timestamp out of window")
+	errEnvelopeReplayed  = errors.New("envelope replayed")
+	errEnvelopeMissing   = errors.New("arbiter message not enveloped")
+	errEnvelopeEncrypted = errors.New("envelope encrypted to another arbiter")
+	errEnvelopeMalformed = errors.New("malformed envelope")
+)
+
+// sealedCommands are the arbiter messages carried in envelopes.
+var sealedCommands = map[string]struct{}{
+	dpos_msg.CmdDArbiter:                 {},
+	dpos_msg.CmdRequireArbiters:          {},
+	dpos_msg.CmdRequireArbitersSignature: {},
+	dpos_msg.CmdFeedbackArbiterSignature: {},
+	dmsg.CmdSmallCroTx:                   {},
+	dmsg.CmdFailedWithdrawTx:             {},
+}
+
+// envelopes seals the arbiter messages sent and opens the ones received,
+// rejecting the forged and replayed ones.
+type envelopes struct {
+	mode    EnvelopeMode
+	account account.Account
+	now     func() time.Time
+
+	lock sync.Mutex
+	last int64                            // timestamp of the last envelope sealed
+	seen map[peer.PID]map[int64]time.Time // envelopes received within the window
+}
+
+func newEnvelopes(mode EnvelopeMode, account account.Account, now func() time.Time) *envelopes {
+	return &envelopes{
+		mode:    mode,
+		account: account,
+		now:     now,
+		seen:    make(map[peer.PID]map[int64]time.Time),
+	}
+}
+
+// seal envelopes the arbiter message sent to the peer, or to all the peers
+// if to is nil. Other messages are returned as they are.
+func (e *envelopes) seal(m elap2p.Message, to *peer.PID) (elap2p.Message, error) {
+	if _, ok := sealedCommands[m.CMD()]; !ok || e.mode == EnvelopeOff {
+		return m, nil
+	}
+	buf := new(bytes.Buffer)
+	if err := m.Serialize(buf); err != nil {
+		return nil, err
+	}
+	envelope := &dmsg.Envelope{
+		Sender:    e.account.PublicKeyBytes(),
+		Timestamp: e.nextTimestamp(),
+		Command:   m.CMD(),
+		Payload:   buf.Bytes(),
+	}
+	if e.mode == EnvelopeEncrypt && to != nil {
+		receiver, err := crypto.DecodePoint(to[:])
+		if err != nil {
+			return nil, err
+		}
+		if envelope.Payload, err = crypto.Encrypt(receiver, envelope.Payload); err != nil {
+			return nil, err
+		}
+		envelope.Encrypted = true
+	}
+	envelope.Signature = e.account.Sign(envelope.SignData())
+	if envelope.Signature == nil {
+		return nil, errors.New("failed to sign envelope")
+	}
+	return envelope, nil
+}
+
+// nextTimestamp returns the current time, made unique among the envelopes
+// sealed.
+func (e *envelopes) nextTimestamp() int64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	timestamp := e.now().UnixNano()
+	if timestamp <= e.last {
+		timestamp = e.last + 1
+	}
+	e.last = timestamp
+	return timestamp
+}
+
+// open returns the message to handle from the one received from the peer:
+// the message sealed in an envelope, or the message itself if not an
+// envelope.
+func (e *envelopes) open(from peer.PID, m elap2p.Message) (elap2p.Message, error) {
+	envelope, ok := m.(*dmsg.Envelope)
+	if !ok {
+		if _, ok := sealedCommands[m.CMD()]; !ok {
+			return m, nil
+		}
+		if e.mode >= EnvelopeRequire {
+			return nil, errEnvelopeMissing
+		}
+		return m, nil
+	}
+	if !bytes.Equal(envelope.Sender, from[:]) {
+		return nil, errEnvelopeSender
+	}
+	if _, ok := sealedCommands[envelope.Command]; !ok {
+		return nil, errEnvelopeCommand
+	}
+	sender, err := crypto.DecodePoint(envelope.Sender)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errEnvelopeMalformed, err)
+	}
+	if err := crypto.Verify(*sender, envelope.SignData(), envelope.Signature); err != nil {
+		return nil, errEnvelopeSignature
+	}
+	if err := e.checkReplay(from, envelope.Timestamp); err != nil {
+		return nil, err
+	}
+	payload := envelope.Payload
+	if envelope.Encrypted {
+		plain, err := e.account.DecryptAddr(payload)
+		if err != nil {
+			return nil, errEnvelopeEncrypted
+		}
+		payload = []byte(plain)
+	}
+	sealed, err := newMessage(envelope.Command)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errEnvelopeMalformed, err)
+	}
+	if err := sealed.Deserialize(bytes.NewReader(payload)); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEnvelopeMalformed, err)
+	}
+	return sealed, nil
+}
+
+// checkReplay records the timestamp of the envelope from the peer, rejecting
+// it if out of the window or received before.
+func (e *envelopes) checkReplay(from peer.PID, timestamp int64) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.now()
+	sent := time.Unix(0, timestamp)
+	if sent.Before(now.Add(-envelopeWindow)) || sent.After(now.Add(envelopeWindow)) {
+		return errEnvelopeStale
+	}
+	seen := e.seen[from]
+	if seen == nil {
+		seen = make(map[int64]time.Time)
+		e.seen[from] = seen
+	}
+	for ts, received := range seen {
+		if now.Sub(received) > 2*envelopeWindow {
+			delete(seen, ts)
+		}
+	}
+	if _, ok := seen[timestamp]; ok {
+		return errEnvelopeReplayed
+	}
+	seen[timestamp] = now
+	return nil
+}
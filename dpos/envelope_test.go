@@ -0,0 +1,121 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package dpos
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/dpos_msg"
+	dmsg "github.com/elastos/Elastos.ELA.SideChain.ESC/dpos/msg"
+
+	"github.com/elastos/Elastos.ELA/account"
+	"github.com/elastos/Elastos.ELA/crypto"
+	daccount "github.com/elastos/Elastos.ELA/dpos/account"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/msg"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testAccount signs with the standard library, producing the signatures of
+// the arbiter accounts.
+type testAccount struct {
+	daccount.Account
+	key *ecdsa.PrivateKey
+}
+
+func newTestAccount(t *testing.T) *testAccount {
+	ac, err := account.NewAccount()
+	assert.NoError(t, err)
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: crypto.DefaultCurve, X: ac.PublicKey.X, Y: ac.PublicKey.Y},
+		D:         new(big.Int).SetBytes(ac.PrivateKey),
+	}
+	return &testAccount{Account: daccount.New(ac), key: key}
+}
+
+func (a *testAccount) Sign(data []byte) []byte {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	r.FillBytes(sig[:crypto.SignerLength])
+	s.FillBytes(sig[crypto.SignerLength:])
+	return sig
+}
+
+func (a *testAccount) pid() (pid peer.PID) {
+	copy(pid[:], a.PublicKeyBytes())
+	return pid
+}
+
+func TestEnvelopeSealAndOpen(t *testing.T) {
+	sender, receiver := newTestAccount(t), newTestAccount(t)
+	now := time.Now()
+	clock := func() time.Time { return now }
+	seal := newEnvelopes(EnvelopeSign, sender, clock)
+	open := newEnvelopes(EnvelopeRequire, receiver, clock)
+
+	feedback := &dpos_msg.FeedBackArbitersSignature{Producer: sender.PublicKeyBytes(), Signature: make([]byte, 65)}
+	m, err := seal.seal(feedback, nil)
+	assert.NoError(t, err)
+	envelope := m.(*dmsg.Envelope)
+	assert.Equal(t, dpos_msg.CmdFeedbackArbiterSignature, envelope.Command)
+
+	opened, err := open.open(sender.pid(), envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, feedback, opened)
+
+	// Replayed, relayed by another peer and tampered envelopes are rejected
+	_, err = open.open(sender.pid(), envelope)
+	assert.Equal(t, errEnvelopeReplayed, err)
+	_, err = open.open(receiver.pid(), envelope)
+	assert.Equal(t, errEnvelopeSender, err)
+	m, _ = seal.seal(feedback, nil)
+	m.(*dmsg.Envelope).Payload[0] ^= 0xff
+	_, err = open.open(sender.pid(), m)
+	assert.Equal(t, errEnvelopeSignature, err)
+
+	// Envelopes out of the time window are rejected
+	m, _ = seal.seal(feedback, nil)
+	now = now.Add(envelopeWindow + time.Second)
+	_, err = open.open(sender.pid(), m)
+	assert.Equal(t, errEnvelopeStale, err)
+
+	// Bare arbiter messages are rejected when envelopes are required, other
+	// messages pass
+	_, err = open.open(sender.pid(), feedback)
+	assert.Equal(t, errEnvelopeMissing, err)
+	ping := msg.NewPing(1)
+	opened, err = open.open(sender.pid(), ping)
+	assert.NoError(t, err)
+	assert.Equal(t, ping, opened)
+}
+
+func TestEnvelopeEncryption(t *testing.T) {
+	sender, receiver, other := newTestAccount(t), newTestAccount(t), newTestAccount(t)
+	seal := newEnvelopes(EnvelopeEncrypt, sender, time.Now)
+
+	tx := dmsg.NewSmallCroTx("signature", "rawtx")
+	to := receiver.pid()
+	m, err := seal.seal(tx, &to)
+	assert.NoError(t, err)
+	assert.True(t, m.(*dmsg.Envelope).Encrypted)
+
+	opened, err := newEnvelopes(EnvelopeOff, receiver, time.Now).open(sender.pid(), m)
+	assert.NoError(t, err)
+	assert.Equal(t, tx, opened)
+
+	_, err = newEnvelopes(EnvelopeOff, other, time.Now).open(sender.pid(), m)
+	assert.Equal(t, errEnvelopeEncrypted, err)
+}
@@ -9,4 +9,5 @@ const (
 	CmdConfirm  = "confirm"
 	CmdSmallCroTx  = "smallCroTx"
 	CmdFailedWithdrawTx  = "failedWTx"
+	CmdEnvelope  = "envelope"
 )
\ No newline at end of file
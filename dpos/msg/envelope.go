@@ -0,0 +1,100 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package msg
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/elanet/pact"
+	"github.com/elastos/Elastos.ELA/p2p"
+)
+
+// envelopeOverhead bounds the envelope fields around the payload, including
+// the encryption overhead of the payload.
+const envelopeOverhead = 1024
+
+// Ensure Envelope implement p2p.Message interface.
+var _ p2p.Message = (*Envelope)(nil)
+
+// Envelope carries a message signed by the arbiter sending it, optionally
+// encrypted to the arbiter receiving it.
+type Envelope struct {
+	Sender    []byte // public key of the sending arbiter
+	Timestamp int64  // unix nanoseconds at sealing, unique per sender
+	Command   string // command of the sealed message
+	Encrypted bool   // whether the payload is encrypted to the receiver
+	Payload   []byte // serialized sealed message
+	Signature []byte
+}
+
+func (msg *Envelope) CMD() string {
+	return CmdEnvelope
+}
+
+func (msg *Envelope) MaxLength() uint32 {
+	return pact.MaxBlockContextSize + envelopeOverhead
+}
+
+// SignData returns the envelope data signed by the sender.
+func (msg *Envelope) SignData() []byte {
+	buf := new(bytes.Buffer)
+	msg.serializeUnsigned(buf)
+	return buf.Bytes()
+}
+
+func (msg *Envelope) serializeUnsigned(w io.Writer) error {
+	if err := common.WriteVarBytes(w, msg.Sender); err != nil {
+		return err
+	}
+	if err := common.WriteUint64(w, uint64(msg.Timestamp)); err != nil {
+		return err
+	}
+	if err := common.WriteVarString(w, msg.Command); err != nil {
+		return err
+	}
+	var encrypted uint8
+	if msg.Encrypted {
+		encrypted = 1
+	}
+	if err := common.WriteUint8(w, encrypted); err != nil {
+		return err
+	}
+	return common.WriteVarBytes(w, msg.Payload)
+}
+
+func (msg *Envelope) Serialize(w io.Writer) error {
+	if err := msg.serializeUnsigned(w); err != nil {
+		return err
+	}
+	return common.WriteVarBytes(w, msg.Signature)
+}
+
+func (msg *Envelope) Deserialize(r io.Reader) error {
+	var err error
+	if msg.Sender, err = common.ReadVarBytes(r, 33, "Sender"); err != nil {
+		return err
+	}
+	timestamp, err := common.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	msg.Timestamp = int64(timestamp)
+	if msg.Command, err = common.ReadVarString(r); err != nil {
+		return err
+	}
+	encrypted, err := common.ReadUint8(r)
+	if err != nil {
+		return err
+	}
+	msg.Encrypted = encrypted != 0
+	if msg.Payload, err = common.ReadVarBytes(r, msg.MaxLength(), "Payload"); err != nil {
+		return err
+	}
+	msg.Signature, err = common.ReadVarBytes(r, 64, "Signature")
+	return err
+}
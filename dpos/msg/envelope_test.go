@@ -0,0 +1,28 @@
+package msg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope_Deserialize(t *testing.T) {
+	msg := &Envelope{
+		Sender:    bytes.Repeat([]byte{0x02}, 33),
+		Timestamp: 1700000000000000000,
+		Command:   CmdSmallCroTx,
+		Encrypted: true,
+		Payload:   []byte{0x01, 0x02, 0x03},
+		Signature: bytes.Repeat([]byte{0x04}, 64),
+	}
+	buffer := new(bytes.Buffer)
+	err := msg.Serialize(buffer)
+	assert.NoError(t, err)
+
+	msg2 := &Envelope{}
+	err = msg2.Deserialize(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, msg2)
+	assert.Equal(t, msg.SignData(), msg2.SignData())
+}
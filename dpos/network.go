@@ -13,6 +13,7 @@ import (
 	dmsg "github.com/elastos/Elastos.ELA.SideChain.ESC/dpos/msg"
 	peer2 "github.com/elastos/Elastos.ELA/p2p/peer"
 	"net"
+	"time"
 
 	"github.com/elastos/Elastos.ELA/common"
 	"github.com/elastos/Elastos.ELA/core/types/payload"
@@ -39,9 +40,11 @@ type NetworkConfig struct {
 
 	NodeVersion        string
 	GetCurrentHeight   func(pid peer.PID) uint64
+	ProducerIsOnDuty   func(pid peer.PID) bool
 	ProposalDispatcher *Dispatcher
 	PublicKey          []byte
 	AnnounceAddr       func()
+	Envelope           EnvelopeMode
 }
 
 type DPOSNetwork interface {
@@ -104,6 +107,8 @@ type Network struct {
 	announceAddr func()
 
 	p2pServer    p2p.Server
+	envelopes    *envelopes
+	scores       *PeerScores
 	messageQueue chan *messageItem
 	quit         chan bool
 
@@ -307,9 +312,38 @@ func (n *Network) UpdatePeers(currentPeers []peer.PID, nextPeers []peer.PID) {
 }
 
 func (n *Network) handleMessage(pid peer.PID, msg elap2p.Message) {
+	if n.scores.Banned(pid) && !n.scores.exempt(pid, msg.CMD()) {
+		return
+	}
+	if !n.scores.Allow(pid, msg.CMD()) {
+		n.Penalize(pid, penaltyRateLimited, fmt.Errorf("%s over rate limit", msg.CMD()))
+		return
+	}
+	msg, err := n.envelopes.open(pid, msg)
+	if err != nil {
+		Warn("[handleMessage] rejected message from", pid.String(), "error:", err)
+		if penalty := envelopePenalty(err); penalty > 0 {
+			n.Penalize(pid, penalty, err)
+		}
+		return
+	}
 	n.messageQueue <- &messageItem{pid, msg}
 }
 
+// Penalize adds the penalty of the misbehavior to the score of the peer,
+// dropping its messages for a while once the score is too high. The proposals
+// and votes of the producer on duty are not dropped.
+func (n *Network) Penalize(pid peer.PID, penalty int, reason error) {
+	if n.scores.Penalize(pid, penalty, reason) {
+		Warn("[Penalize] messages of", pid.String(), "dropped for", peerBanDuration, "reason:", reason)
+	}
+}
+
+// PeerScores returns the scores of the peers.
+func (n *Network) PeerScores() *PeerScores {
+	return n.scores
+}
+
 func (n *Network) badNetwork() {
 	Info("badnet workd")
 	n.listener.OnBadNetwork()
@@ -326,12 +360,30 @@ func (n *Network) AddDirectLinkAddr(pid peer.PID, addr string) {
 
 func (n *Network) SendMessageToPeer(id peer.PID, msg elap2p.Message) error {
 	Info("[SendMessageToPeer] msg:", msg.CMD(), id.String())
-	return n.p2pServer.SendMessageToPeer(id, msg)
+	sealed, err := n.envelopes.seal(msg, &id)
+	if err != nil {
+		return err
+	}
+	return n.p2pServer.SendMessageToPeer(id, sealed)
 }
 
 func (n *Network) BroadcastMessage(msg elap2p.Message) {
 	Info("[BroadcastMessage] msg:", msg.CMD())
-	n.p2pServer.BroadcastMessage(msg)
+	if _, ok := sealedCommands[msg.CMD()]; ok && n.envelopes.mode == EnvelopeEncrypt {
+		// Encrypted envelopes differ for every peer
+		for _, p := range n.p2pServer.ConnectedPeers() {
+			if err := n.SendMessageToPeer(p.PID(), msg); err != nil {
+				Warn("[BroadcastMessage] send to", p.PID().String(), "error:", err)
+			}
+		}
+		return
+	}
+	sealed, err := n.envelopes.seal(msg, nil)
+	if err != nil {
+		Error("[BroadcastMessage] seal error:", err)
+		return
+	}
+	n.p2pServer.BroadcastMessage(sealed)
 }
 
 // DumpPeersInfo returns an array consisting of all peers state in connect list.
@@ -355,6 +407,9 @@ func NewNetwork(cfg *NetworkConfig) (*Network, error) {
 		changeViewChan: make(chan bool),
 		recoverChan:    make(chan bool),
 	}
+	network.envelopes = newEnvelopes(cfg.Envelope, cfg.Account, cfg.MedianTime.AdjustedTime)
+	network.scores = NewPeerScores(time.Now)
+	network.scores.onDuty = cfg.ProducerIsOnDuty
 
 	notifier := p2p.NewNotifier(p2p.NFNetStabled|p2p.NFBadNetwork, network.notifyFlag)
 	fmt.Println(">>>>>>> cfg.DPoSV2StartHeight <<<<<<<<", cfg.DPoSV2StartHeight)
@@ -387,7 +442,16 @@ func NewNetwork(cfg *NetworkConfig) (*Network, error) {
 }
 
 func createMessage(hdr elap2p.Header, r net.Conn) (message elap2p.Message, err error) {
-	switch hdr.GetCMD() {
+	message, err = newMessage(hdr.GetCMD())
+	if err != nil {
+		return nil, err
+	}
+	return peer2.CheckAndCreateMessage(hdr, message, r)
+}
+
+// newMessage returns an empty message of the command.
+func newMessage(cmd string) (message elap2p.Message, err error) {
+	switch cmd {
 	case elap2p.CmdBlock:
 		message = dmsg.NewBlockMsg([]byte{})
 	case msg.CmdAcceptVote:
@@ -434,8 +498,10 @@ func createMessage(hdr elap2p.Header, r net.Conn) (message elap2p.Message, err e
 		message = &dpos_msg.FeedBackArbitersSignature{}
 	case msg.CmdResetConsensusView:
 		message = &msg.ResetView{}
+	case dmsg.CmdEnvelope:
+		message = &dmsg.Envelope{}
 	default:
-		return nil, errors.New("Received unsupported message, CMD " + hdr.GetCMD())
+		return nil, errors.New("Received unsupported message, CMD " + cmd)
 	}
-	return peer2.CheckAndCreateMessage(hdr, message, r)
+	return message, nil
 }
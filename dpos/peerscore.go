@@ -0,0 +1,280 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package dpos
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/chainbridge-core/dpos_msg"
+	dmsg "github.com/elastos/Elastos.ELA.SideChain.ESC/dpos/msg"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/msg"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+	elap2p "github.com/elastos/Elastos.ELA/p2p"
+)
+
+const (
+	// maxPeerScore is the misbehavior score making a peer banned.
+	maxPeerScore = 100
+
+	// peerBanDuration is how long the messages of a banned peer are dropped.
+	peerBanDuration = 10 * time.Minute
+
+	// peerScoreDecay is the time without penalty clearing the score.
+	peerScoreDecay = 10 * time.Minute
+)
+
+// Penalties of the peers sending invalid messages. Only the messages proven
+// invalid by themselves are penalized: the ones rejected by the local view of
+// the peer, its clock or its configuration are dropped without penalty.
+const (
+	penaltyMalformed   = 20 // undecodable, forged or misaddressed message
+	penaltyReplayed    = 10 // envelope received before
+	penaltyRateLimited = 5  // message over the rate limit of its command
+)
+
+// Penalties of the producers sending invalid consensus messages, reported by
+// the consensus engine.
+const (
+	PenaltyInvalidProposal = 25 // badly signed proposal
+	PenaltyInvalidVote     = 20 // badly signed vote
+)
+
+// envelopePenalty returns the penalty of the peer having sent the envelope
+// rejected with err, zero if the envelope may have been sent in good faith.
+func envelopePenalty(err error) int {
+	switch {
+	case errors.Is(err, errEnvelopeStale), errors.Is(err, errEnvelopeMissing):
+		return 0
+	case errors.Is(err, errEnvelopeReplayed):
+		return penaltyReplayed
+	default:
+		return penaltyMalformed
+	}
+}
+
+// livenessCommands are the messages of the producer on duty handled even if
+// it is banned, so that a producer scored by mistake can still propose and
+// vote. They stay rate limited.
+var livenessCommands = map[string]struct{}{
+	msg.CmdReceivedProposal: {},
+	msg.CmdAcceptVote:       {},
+	msg.CmdRejectVote:       {},
+}
+
+// messageLimit is the token bucket limiting a command: rate messages a second
+// on average, up to burst at once.
+type messageLimit struct {
+	rate  float64
+	burst float64
+}
+
+// messageLimits limits the commands a peer sends; other commands are not
+// limited. The requests make a peer serve data, the others are received at
+// most a few times per block from each producer.
+var messageLimits = map[string]messageLimit{
+	msg.CmdInv:                           {10, 50},
+	msg.CmdGetBlock:                      {5, 20},
+	msg.CmdGetBlocks:                     {1, 5},
+	msg.CmdRequestConsensus:              {0.5, 5},
+	msg.CmdRequestProposal:               {2, 10},
+	msg.CmdReceivedProposal:              {5, 20},
+	msg.CmdAcceptVote:                    {10, 50},
+	msg.CmdRejectVote:                    {10, 50},
+	msg.CmdResetConsensusView:            {1, 5},
+	elap2p.CmdBlock:                      {10, 50},
+	dmsg.CmdConfirm:                      {10, 50},
+	dmsg.CmdEnvelope:                     {50, 200},
+	dmsg.CmdSmallCroTx:                   {50, 200},
+	dmsg.CmdFailedWithdrawTx:             {50, 200},
+	dpos_msg.CmdDArbiter:                 {10, 50},
+	dpos_msg.CmdRequireArbiters:          {5, 20},
+	dpos_msg.CmdRequireArbitersSignature: {5, 20},
+	dpos_msg.CmdFeedbackArbiterSignature: {10, 50},
+}
+
+// tokenBucket holds the tokens left to a peer for a command.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket since the last message and takes a token from it,
+// returning false if it is empty.
+func (b *tokenBucket) take(limit messageLimit, now time.Time) bool {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * limit.rate
+		if b.tokens > limit.burst {
+			b.tokens = limit.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// PeerScore is the misbehavior record of a peer.
+type PeerScore struct {
+	PID         string `json:"pid"`
+	Score       int    `json:"score"`
+	Banned      bool   `json:"banned"`
+	BannedUntil int64  `json:"banneduntil,omitempty"`
+	Bans        int    `json:"bans"`
+	Dropped     uint64 `json:"dropped"` // messages over the rate limits
+	LastReason  string `json:"lastreason,omitempty"`
+}
+
+type peerScore struct {
+	score       int
+	lastPenalty time.Time
+	bannedUntil time.Time
+	bans        int
+	dropped     uint64
+	lastReason  string
+	buckets     map[string]*tokenBucket
+}
+
+// PeerScores rate limits the messages of the peers and scores their
+// misbehavior, banning the peers whose score reaches maxPeerScore.
+type PeerScores struct {
+	now func() time.Time
+
+	// onDuty reports whether the peer is the producer on duty, may be nil.
+	onDuty func(pid peer.PID) bool
+
+	lock  sync.Mutex
+	peers map[peer.PID]*peerScore
+}
+
+// NewPeerScores creates the scores of the peers, timed by now.
+func NewPeerScores(now func() time.Time) *PeerScores {
+	return &PeerScores{
+		now:   now,
+		peers: make(map[peer.PID]*peerScore),
+	}
+}
+
+func (s *PeerScores) peer(pid peer.PID) *peerScore {
+	p := s.peers[pid]
+	if p == nil {
+		p = &peerScore{buckets: make(map[string]*tokenBucket)}
+		s.peers[pid] = p
+	}
+	return p
+}
+
+// exempt returns whether the command received from the peer is a liveness
+// message of the producer on duty, handled even if the peer is banned.
+func (s *PeerScores) exempt(pid peer.PID, cmd string) bool {
+	if _, ok := livenessCommands[cmd]; !ok || s.onDuty == nil {
+		return false
+	}
+	return s.onDuty(pid)
+}
+
+// Allow takes a token of the command from the bucket of the peer, returning
+// false if the peer sends the command over its rate limit.
+func (s *PeerScores) Allow(pid peer.PID, cmd string) bool {
+	limit, ok := messageLimits[cmd]
+	if !ok {
+		return true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	p := s.peer(pid)
+	bucket := p.buckets[cmd]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: limit.burst, last: now}
+		p.buckets[cmd] = bucket
+	}
+	if bucket.take(limit, now) {
+		return true
+	}
+	p.dropped++
+	return false
+}
+
+// Penalize adds the penalty to the score of the peer, banning the peer once
+// the score reaches maxPeerScore. It returns whether the peer got banned.
+func (s *PeerScores) Penalize(pid peer.PID, penalty int, reason error) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	p := s.peer(pid)
+	if reason != nil {
+		p.lastReason = reason.Error()
+	}
+	if now.Before(p.bannedUntil) {
+		return false
+	}
+	if now.Sub(p.lastPenalty) > peerScoreDecay {
+		p.score = 0
+	}
+	p.score += penalty
+	p.lastPenalty = now
+	if p.score < maxPeerScore {
+		return false
+	}
+	p.score = 0
+	p.bans++
+	p.bannedUntil = now.Add(peerBanDuration)
+	return true
+}
+
+// Banned returns whether the messages of the peer are dropped.
+func (s *PeerScores) Banned(pid peer.PID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p := s.peers[pid]
+	return p != nil && s.now().Before(p.bannedUntil)
+}
+
+// Scores returns the records of the peers having misbehaved, ordered by PID.
+func (s *PeerScores) Scores() []PeerScore {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	pids := make([]peer.PID, 0, len(s.peers))
+	for pid, p := range s.peers {
+		if p.bans > 0 || p.dropped > 0 || !p.lastPenalty.IsZero() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Slice(pids, func(i, j int) bool {
+		return bytes.Compare(pids[i][:], pids[j][:]) < 0
+	})
+	scores := make([]PeerScore, 0, len(pids))
+	for _, pid := range pids {
+		p := s.peers[pid]
+		score := PeerScore{
+			PID:        common.BytesToHexString(pid[:]),
+			Bans:       p.bans,
+			Dropped:    p.dropped,
+			LastReason: p.lastReason,
+		}
+		if now.Sub(p.lastPenalty) <= peerScoreDecay {
+			score.Score = p.score
+		}
+		if now.Before(p.bannedUntil) {
+			score.Banned = true
+			score.BannedUntil = p.bannedUntil.Unix()
+		}
+		scores = append(scores, score)
+	}
+	return scores
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2017-2019 The Elastos Foundation
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+//
+
+package dpos
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dmsg "github.com/elastos/Elastos.ELA.SideChain.ESC/dpos/msg"
+
+	"github.com/elastos/Elastos.ELA/dpos/p2p/msg"
+	"github.com/elastos/Elastos.ELA/dpos/p2p/peer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerScoresRateLimit(t *testing.T) {
+	now := time.Now()
+	scores := NewPeerScores(func() time.Time { return now })
+	var pid, other peer.PID
+	other[0] = 1
+
+	limit := messageLimits[msg.CmdGetBlocks]
+	for i := 0; i < int(limit.burst); i++ {
+		assert.True(t, scores.Allow(pid, msg.CmdGetBlocks))
+	}
+	assert.False(t, scores.Allow(pid, msg.CmdGetBlocks))
+
+	// Buckets are per peer and per command, unlimited commands always pass
+	assert.True(t, scores.Allow(other, msg.CmdGetBlocks))
+	assert.True(t, scores.Allow(pid, msg.CmdRequestProposal))
+	for i := 0; i < 1000; i++ {
+		assert.True(t, scores.Allow(pid, msg.CmdPing))
+	}
+
+	// Tokens refill at the rate of the command
+	now = now.Add(time.Duration(float64(time.Second) / limit.rate))
+	assert.True(t, scores.Allow(pid, msg.CmdGetBlocks))
+	assert.False(t, scores.Allow(pid, msg.CmdGetBlocks))
+
+	records := scores.Scores()
+	assert.Len(t, records, 1)
+	assert.Equal(t, uint64(2), records[0].Dropped)
+}
+
+func TestPeerScoresBan(t *testing.T) {
+	now := time.Now()
+	scores := NewPeerScores(func() time.Time { return now })
+	var pid peer.PID
+	reason := errors.New("invalid vote")
+
+	for i := 0; i < maxPeerScore/PenaltyInvalidVote-1; i++ {
+		assert.False(t, scores.Penalize(pid, PenaltyInvalidVote, reason))
+	}
+	// The score is cleared by a while without penalty
+	now = now.Add(peerScoreDecay + time.Second)
+	assert.False(t, scores.Penalize(pid, PenaltyInvalidVote, reason))
+	assert.Equal(t, PenaltyInvalidVote, scores.Scores()[0].Score)
+	for i := 0; i < maxPeerScore/PenaltyInvalidVote-2; i++ {
+		assert.False(t, scores.Penalize(pid, PenaltyInvalidVote, reason))
+	}
+	assert.True(t, scores.Penalize(pid, PenaltyInvalidVote, reason))
+	assert.True(t, scores.Banned(pid))
+
+	// Penalties during the ban do not extend it
+	assert.False(t, scores.Penalize(pid, PenaltyInvalidProposal, reason))
+	record := scores.Scores()[0]
+	assert.True(t, record.Banned)
+	assert.Equal(t, 1, record.Bans)
+	assert.Equal(t, now.Add(peerBanDuration).Unix(), record.BannedUntil)
+	assert.Equal(t, "invalid vote", record.LastReason)
+
+	now = now.Add(peerBanDuration)
+	assert.False(t, scores.Banned(pid))
+	assert.False(t, scores.Scores()[0].Banned)
+}
+
+func TestEnvelopePenalty(t *testing.T) {
+	sender, receiver := newTestAccount(t), newTestAccount(t)
+	now := time.Now()
+	clock := func() time.Time { return now }
+	open := newEnvelopes(EnvelopeOff, receiver, clock)
+	scores := NewPeerScores(clock)
+	forged, _ := newEnvelopes(EnvelopeSign, receiver, clock).seal(dmsg.NewSmallCroTx("", ""), nil)
+
+	for i := 0; i < maxPeerScore/penaltyMalformed; i++ {
+		_, err := open.open(sender.pid(), forged)
+		assert.Error(t, err)
+		assert.Equal(t, penaltyMalformed, envelopePenalty(err))
+		assert.Equal(t, i == maxPeerScore/penaltyMalformed-1, scores.Penalize(sender.pid(), envelopePenalty(err), err))
+	}
+	assert.True(t, scores.Banned(sender.pid()))
+}
+
+func TestPeerScoresOnDutyExempt(t *testing.T) {
+	now := time.Now()
+	scores := NewPeerScores(func() time.Time { return now })
+	var onDuty, other peer.PID
+	onDuty[0], other[0] = 1, 2
+	scores.onDuty = func(pid peer.PID) bool { return pid == onDuty }
+
+	// Only the proposals and votes of the producer on duty bypass a ban
+	assert.True(t, scores.exempt(onDuty, msg.CmdReceivedProposal))
+	assert.True(t, scores.exempt(onDuty, msg.CmdAcceptVote))
+	assert.True(t, scores.exempt(onDuty, msg.CmdRejectVote))
+	assert.False(t, scores.exempt(onDuty, msg.CmdRequestConsensus))
+	assert.False(t, scores.exempt(onDuty, msg.CmdInv))
+	assert.False(t, scores.exempt(other, msg.CmdReceivedProposal))
+}
+
+func TestNetworkRateLimitPenalty(t *testing.T) {
+	now := time.Now()
+	network := &Network{
+		envelopes:    newEnvelopes(EnvelopeOff, nil, time.Now),
+		scores:       NewPeerScores(func() time.Time { return now }),
+		messageQueue: make(chan *messageItem, 1000),
+	}
+	var onDuty, arbiter peer.PID
+	onDuty[0], arbiter[0] = 1, 2
+	network.scores.onDuty = func(pid peer.PID) bool { return pid == onDuty }
+
+	// An arbiter flooding consensus requests is rate limited, then banned
+	limit := messageLimits[msg.CmdRequestConsensus]
+	for i := 0; i < int(limit.burst); i++ {
+		network.handleMessage(arbiter, &msg.RequestConsensus{})
+	}
+	assert.Len(t, network.messageQueue, int(limit.burst))
+	for i := 0; i < maxPeerScore/penaltyRateLimited; i++ {
+		network.handleMessage(arbiter, &msg.RequestConsensus{})
+	}
+	assert.Len(t, network.messageQueue, int(limit.burst))
+	assert.True(t, network.scores.Banned(arbiter))
+
+	// Once refilled, its messages stay dropped while it is banned
+	now = now.Add(time.Minute)
+	network.handleMessage(arbiter, &msg.RequestConsensus{})
+	network.handleMessage(arbiter, &msg.Proposal{})
+	assert.Len(t, network.messageQueue, int(limit.burst))
+
+	// The proposals of a banned producer on duty are still handled
+	for i := 0; i < maxPeerScore/PenaltyInvalidProposal; i++ {
+		network.Penalize(onDuty, PenaltyInvalidProposal, errors.New("invalid proposal"))
+	}
+	assert.True(t, network.scores.Banned(onDuty))
+	network.handleMessage(onDuty, &msg.Proposal{})
+	network.handleMessage(onDuty, &msg.RequestConsensus{})
+	assert.Len(t, network.messageQueue, int(limit.burst)+1)
+}
+
+func TestEnvelopePenaltyInGoodFaith(t *testing.T) {
+	assert.Equal(t, 0, envelopePenalty(errEnvelopeStale))
+	assert.Equal(t, 0, envelopePenalty(errEnvelopeMissing))
+	assert.Equal(t, penaltyReplayed, envelopePenalty(errEnvelopeReplayed))
+	assert.Equal(t, penaltyMalformed, envelopePenalty(errEnvelopeSignature))
+}
@@ -182,10 +182,13 @@ func (p *Producers) GetCRMajorityCount() int {
 }
 
 func (p *Producers) GetMajorityCountByTotalSigners(totalSigner int) int {
-	p.mtx.Lock()
-	minSignCount := int(float64(totalSigner) * 2 / 3)
-	p.mtx.Unlock()
-	return minSignCount
+	return MajorityCount(totalSigner)
+}
+
+// MajorityCount returns the minimum count of votes a confirm must carry when
+// the turn has totalSigner signers.
+func MajorityCount(totalSigner int) int {
+	return int(float64(totalSigner) * 2 / 3)
 }
 
 func (p *Producers) GetProducersCount() int {
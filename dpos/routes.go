@@ -47,6 +47,9 @@ const (
 	maxKnownAddrs = 108 * 110
 )
 
+// invLimit limits the Inv messages of a peer.
+var invLimit = messageLimit{rate: 10, burst: 50}
+
 // Config defines the parameters to create a Route instance.
 type Config struct {
 	// The PID of this peer if it is an producer.
@@ -67,13 +70,19 @@ type Config struct {
 	// RelayAddr relays the addresses inventory to the P2P network.
 	RelayAddr func(iv *msg.InvVect, data interface{})
 
-	// OnCipherAddr will be invoked when an address cipher received.
-	OnCipherAddr func(pid peer.PID, cipher []byte)
+	// OnCipherAddr will be invoked when an address cipher received. It
+	// returns an error if the cipher can not be decrypted.
+	OnCipherAddr func(pid peer.PID, cipher []byte) error
+
+	// Scores scores the producers announcing invalid addresses and drops the
+	// addresses announced by banned producers, may be nil.
+	Scores *PeerScores
 }
 
 // cache stores the requested DAddrs from a peer.
 type cache struct {
 	requested map[common.Uint256]struct{}
+	inv       tokenBucket
 }
 
 // state stores the DPOS addresses and other additional information tracking
@@ -436,6 +445,11 @@ func (r *Routes) handleDAddr(s *state, p IPeer, m *msg.DAddr) {
 	delete(c.requested, hash)
 	delete(s.requested, hash)
 
+	if r.cfg.Scores != nil && r.cfg.Scores.Banned(m.PID) {
+		Debugf("Drop addr %s of banned %s", hash, m.PID)
+		return
+	}
+
 	if err := r.verifyDAddr(s, m); err != nil {
 		Warnf("Got invalid addr %s %s from %s -- disconnecting",
 			hash, err, p)
@@ -456,9 +470,23 @@ func (r *Routes) handleDAddr(s *state, p IPeer, m *msg.DAddr) {
 	// Append received addr into state.
 	r.appendAddr(m)
 
-	// Notify the received DPOS address if the Encode matches.
+	// Notify the received DPOS address if the Encode matches. The address is
+	// signed by its producer, which is to blame for an undecryptable cipher.
 	if r.selfPID.Equal(m.Encode) && r.cfg.OnCipherAddr != nil {
-		r.cfg.OnCipherAddr(m.PID, m.Cipher)
+		if err := r.cfg.OnCipherAddr(m.PID, m.Cipher); err != nil {
+			Warnf("Got invalid addr %s %s of %s", hash, err, m.PID)
+			r.penalize(m.PID, err)
+		}
+	}
+}
+
+// penalize scores the producer having announced an invalid address.
+func (r *Routes) penalize(pid peer.PID, err error) {
+	if r.cfg.Scores == nil {
+		return
+	}
+	if r.cfg.Scores.Penalize(pid, penaltyMalformed, err) {
+		Warnf("Addresses of %s dropped for %s", pid, peerBanDuration)
 	}
 }
 
@@ -489,7 +517,10 @@ func (r *Routes) appendAddr(m *msg.DAddr) {
 
 func (r *Routes) handleNewPeer(s *state, p IPeer) {
 	// Create state for the new peer.
-	s.peerCache[p] = &cache{requested: make(map[common.Uint256]struct{})}
+	s.peerCache[p] = &cache{
+		requested: make(map[common.Uint256]struct{}),
+		inv:       tokenBucket{tokens: invLimit.burst, last: time.Now()},
+	}
 }
 
 func (r *Routes) handleDonePeer(s *state, p IPeer) {
@@ -515,6 +546,11 @@ func (r *Routes) handleInv(s *state, p IPeer, m *msg.Inv) {
 		return
 	}
 
+	if !c.inv.take(invLimit, time.Now()) {
+		Debugf("Drop inv message from %s over rate limit", p)
+		return
+	}
+
 	// Push GetData message according to the Inv message.
 	getData := msg.NewGetData()
 	for _, iv := range m.InvList {
@@ -16,6 +16,7 @@ import (
 	"github.com/elastos/Elastos.ELA/common"
 	"github.com/elastos/Elastos.ELA/core/types"
 	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/elastos/Elastos.ELA/dpos/dtime"
 	dp "github.com/elastos/Elastos.ELA/dpos/p2p/peer"
 	"github.com/elastos/Elastos.ELA/events"
 	"github.com/elastos/Elastos.ELA/p2p"
@@ -284,7 +285,7 @@ func TestRouteMsg(t *testing.T) {
 		RelayAddr: func(iv *msg.InvVect, data interface{}) {
 			relay <- struct{}{}
 		},
-		OnCipherAddr: func(pid dp.PID, addr []byte) {},
+		OnCipherAddr: func(pid dp.PID, addr []byte) error { return nil },
 	})
 	routes.Start()
 
@@ -375,7 +376,7 @@ func TestRoutes_AppendAddr(t *testing.T) {
 		},
 		IsCurrent:    func() bool { return true },
 		RelayAddr:    func(iv *msg.InvVect, data interface{}) {},
-		OnCipherAddr: func(pid dp.PID, addr []byte) {},
+		OnCipherAddr: func(pid dp.PID, addr []byte) error { return nil },
 	})
 
 	for i := 0; i < maxKnownAddrs*10; i++ {
@@ -400,6 +401,59 @@ func TestRoutes_AppendAddr(t *testing.T) {
 	}
 }
 
+func TestRoutes_InvalidCipherAddr(t *testing.T) {
+	producer, receiver := newTestAccount(t), newTestAccount(t)
+	errCipher := errors.New("undecryptable cipher")
+	scores := NewPeerScores(time.Now)
+	routes := New(&Config{
+		PID:        receiver.PublicKeyBytes(),
+		Addr:       "localhost",
+		TimeSource: dtime.NewMedianTime(),
+		Sign:       receiver.Sign,
+		IsCurrent:  func() bool { return true },
+		RelayAddr:  func(iv *msg.InvVect, data interface{}) {},
+		OnCipherAddr: func(pid dp.PID, cipher []byte) error {
+			if string(cipher) != "cipher" {
+				return errCipher
+			}
+			return nil
+		},
+		Scores: scores,
+	})
+	relayer := newMockPeer()
+	s := &state{
+		peers:     map[dp.PID]struct{}{producer.pid(): {}},
+		requested: make(map[common.Uint256]struct{}),
+		peerCache: map[IPeer]*cache{relayer: {requested: make(map[common.Uint256]struct{})}},
+	}
+	now := time.Now()
+	announce := func(cipher string) *msg.DAddr {
+		now = now.Add(minAnnounceDuration)
+		addr := &msg.DAddr{
+			PID:       producer.pid(),
+			Timestamp: now,
+			Encode:    receiver.pid(),
+			Cipher:    []byte(cipher),
+		}
+		addr.Signature = producer.Sign(addr.Data())
+		s.peerCache[relayer].requested[addr.Hash()] = struct{}{}
+		routes.handleDAddr(s, relayer, addr)
+		return addr
+	}
+	addr := announce("cipher")
+	assert.Contains(t, routes.knownAddr, addr.Hash())
+
+	// A producer announcing undecryptable ciphers gets banned
+	for i := 0; i < maxPeerScore/penaltyMalformed; i++ {
+		announce("garbage")
+	}
+	assert.True(t, scores.Banned(producer.pid()))
+
+	// The addresses of a banned producer are dropped
+	addr = announce("cipher")
+	assert.NotContains(t, routes.knownAddr, addr.Hash())
+}
+
 func TestEventNotify(t *testing.T) {
 	const ET_TEST_EVENT = 10000
 	events.Subscribe(func(e *events.Event) {
@@ -28,6 +28,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/blocksigner"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
@@ -40,6 +41,8 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
+
+	"github.com/elastos/Elastos.ELA/core/types/payload"
 )
 
 // PublicEthereumAPI provides an API to access Ethereum full node-related
@@ -176,6 +179,60 @@ func NewPrivateAdminAPI(eth *Ethereum) *PrivateAdminAPI {
 	return &PrivateAdminAPI{eth: eth}
 }
 
+// errNotProducer is returned by the cross chain admin methods on nodes that
+// do not produce blocks, and therefore never send the recharges.
+var errNotProducer = errors.New("cross chain admin is only available on producer nodes")
+
+// CrossChainQueue returns the recharges waiting to be sent, at most count.
+func (api *PrivateAdminAPI) CrossChainQueue(count *uint64) ([]*spv.QueuedRecharge, error) {
+	if !blocksigner.SelfIsProducer {
+		return nil, errNotProducer
+	}
+	var n uint64
+	if count != nil {
+		n = *count
+	}
+	return spv.ListQueuedRecharges(n)
+}
+
+// CrossChainFailed returns the recharges recorded as failed.
+func (api *PrivateAdminAPI) CrossChainFailed() ([]*spv.FailedRecharge, error) {
+	if !blocksigner.SelfIsProducer {
+		return nil, errNotProducer
+	}
+	return spv.ListFailedRecharges()
+}
+
+// CrossChainCursors returns the seek and index positions of the recharge queue.
+func (api *PrivateAdminAPI) CrossChainCursors() (*spv.RechargeCursors, error) {
+	if !blocksigner.SelfIsProducer {
+		return nil, errNotProducer
+	}
+	return spv.GetRechargeCursors()
+}
+
+// CrossChainRequeue queues the recharge of the main chain transaction again.
+func (api *PrivateAdminAPI) CrossChainRequeue(elaTx string) (bool, error) {
+	if !blocksigner.SelfIsProducer {
+		return false, errNotProducer
+	}
+	if err := spv.RequeueRecharge(elaTx, api.eth.BlockChain().CurrentBlock().NumberU64()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CrossChainSkip makes the node pass over a queued recharge, recording why.
+func (api *PrivateAdminAPI) CrossChainSkip(elaTx string, reason string) (bool, error) {
+	if !blocksigner.SelfIsProducer {
+		return false, errNotProducer
+	}
+	if err := spv.SkipRecharge(elaTx, reason); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // ExportChain exports the current blockchain into a local file.
 func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	if _, err := os.Stat(file); err == nil {
@@ -358,6 +415,50 @@ func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]*BadBlockArgs,
 	return results, nil
 }
 
+// EvilSignerProof is a self-contained proof that a signer sealed two different
+// blocks at the same height.
+type EvilSignerProof struct {
+	Signer      common.Address   `json:"signer"`
+	Number      hexutil.Uint64   `json:"number"`
+	Hash        common.Hash      `json:"hash"`
+	Headers     []*types.Header  `json:"headers"`
+	ElaHeights  []hexutil.Uint64 `json:"elaHeights"`
+	Verified    bool             `json:"verified"`
+	RLP         hexutil.Bytes    `json:"rlp"`         // rlp encoded evidence
+	IllegalData hexutil.Bytes    `json:"illegalData"` // illegal evidence payload of the ela chain
+}
+
+// GetEvilSigners returns the double sign evidences stored with heights in the
+// range [fromHeight, toHeight].
+func (api *PrivateDebugAPI) GetEvilSigners(fromHeight, toHeight uint64) ([]*EvilSignerProof, error) {
+	if fromHeight > toHeight {
+		return nil, fmt.Errorf("from height %d is greater than to height %d", fromHeight, toHeight)
+	}
+	evidences := rawdb.ReadEvilEvidences(api.eth.ChainDb(), fromHeight, toHeight)
+	results := make([]*EvilSignerProof, 0, len(evidences))
+	for _, evidence := range evidences {
+		enc, err := rlp.EncodeToBytes(evidence)
+		if err != nil {
+			return nil, err
+		}
+		proof := &EvilSignerProof{
+			Signer:      evidence.Signer,
+			Number:      hexutil.Uint64(evidence.Number()),
+			Hash:        evidence.Hash(),
+			Headers:     []*types.Header{evidence.Header, evidence.Compare},
+			Verified:    core.VerifyEvilEvidence(api.eth.engine, evidence) == nil,
+			RLP:         enc,
+			IllegalData: core.EvilIllegalData(evidence).Data(payload.SidechainIllegalDataVersion),
+		}
+		for _, header := range proof.Headers {
+			elaHeight, _ := core.ParseElaHeightFromHead(header)
+			proof.ElaHeights = append(proof.ElaHeights, hexutil.Uint64(elaHeight))
+		}
+		results = append(results, proof)
+	}
+	return results, nil
+}
+
 // AccountRangeResult returns a mapping from the hash of an account addresses
 // to its preimage. It will return the JSON null if no preimage is found.
 // Since a query can return a limited amount of results, a "next" field is
@@ -0,0 +1,276 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/ethash"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/internal/ethapi"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
+)
+
+var (
+	traceKey, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	traceAccount   = crypto.PubkeyToAddress(traceKey.PublicKey)
+	traceFunds     = big.NewInt(params.Ether)
+	traceContract  = common.Address{0xcc} // returns its storage slot 0
+	traceRecipient = common.Address{0xaa}
+
+	// Code returning storage slot 0, the block number, time and coinbase
+	codeSlot0     = common.FromHex("0x60005460005260206000f3")
+	codeNumber    = common.FromHex("0x4360005260206000f3")
+	codeTimestamp = common.FromHex("0x4260005260206000f3")
+	codeCoinbase  = common.FromHex("0x4160005260206000f3")
+)
+
+// newTestTraceBackend creates an Ethereum service on a chain of the given
+// length, each block of which transfers funds from traceAccount.
+func newTestTraceBackend(t *testing.T, blocks int) *Ethereum {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				traceAccount: {Balance: traceFunds},
+				traceContract: {
+					Code:    codeSlot0,
+					Balance: new(big.Int),
+					Storage: map[common.Hash]common.Hash{
+						common.BigToHash(big.NewInt(0)): common.BigToHash(big.NewInt(1)),
+						common.BigToHash(big.NewInt(1)): common.BigToHash(big.NewInt(2)),
+					},
+				},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	chain, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, blocks, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(uint64(i), traceRecipient, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, traceKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	blockchain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	eth := &Ethereum{
+		config:     &Config{RPCGasCap: big.NewInt(25000000)},
+		chainDb:    db,
+		blockchain: blockchain,
+	}
+	eth.APIBackend = &EthAPIBackend{eth: eth}
+	return eth
+}
+
+// word returns the hex encoding of a 32 byte call result holding n.
+func word(n *big.Int) string {
+	return fmt.Sprintf("%x", common.BigToHash(n))
+}
+
+func traceCall(t *testing.T, api *PrivateDebugAPI, args ethapi.CallArgs, block rpc.BlockNumberOrHash, config *TraceCallConfig) (*ethapi.ExecutionResult, error) {
+	result, err := api.TraceCall(context.Background(), args, block, config)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*ethapi.ExecutionResult), nil
+}
+
+// Tests that a call is traced on the state of the requested block.
+func TestTraceCallKnownBlock(t *testing.T) {
+	eth := newTestTraceBackend(t, 2)
+	defer eth.blockchain.Stop()
+	api := NewPrivateDebugAPI(eth)
+
+	// Transferring the whole genesis funds only succeeds on the genesis state
+	args := ethapi.CallArgs{
+		From:     &traceAccount,
+		To:       &traceRecipient,
+		GasPrice: (*hexutil.Big)(new(big.Int)),
+		Value:    (*hexutil.Big)(traceFunds),
+	}
+	genesis := eth.blockchain.GetBlockByNumber(0).Hash()
+	result, err := traceCall(t, api, args, rpc.BlockNumberOrHashWithHash(genesis, true), nil)
+	if err != nil {
+		t.Fatalf("failed to trace call on genesis: %v", err)
+	}
+	if result.Failed || result.Gas != params.TxGas {
+		t.Fatalf("trace result mismatch: have failed %v gas %d, want success with %d gas", result.Failed, result.Gas, params.TxGas)
+	}
+	result, err = traceCall(t, api, args, rpc.BlockNumberOrHashWithNumber(2), nil)
+	if err != nil {
+		t.Fatalf("failed to trace call on block 2: %v", err)
+	}
+	if !result.Failed {
+		t.Fatalf("transfer of spent funds succeeded")
+	}
+	if _, err := traceCall(t, api, args, rpc.BlockNumberOrHashWithNumber(3), nil); err == nil {
+		t.Fatalf("traced call on unknown block")
+	}
+}
+
+// Tests that the state overrides of eth_call apply to a traced call.
+func TestTraceCallStateOverrides(t *testing.T) {
+	eth := newTestTraceBackend(t, 1)
+	defer eth.blockchain.Stop()
+	api := NewPrivateDebugAPI(eth)
+
+	var (
+		slot0 = common.BigToHash(big.NewInt(0))
+		slot1 = common.BigToHash(big.NewInt(1))
+		value = func(n int64) common.Hash { return common.BigToHash(big.NewInt(n)) }
+		empty = common.Address{0xee}
+	)
+	tests := []struct {
+		to        common.Address
+		overrides ethapi.StateOverride
+		want      int64
+	}{
+		{traceContract, nil, 1},
+		// The state replaces the whole storage
+		{traceContract, ethapi.StateOverride{traceContract: {State: &map[common.Hash]common.Hash{slot1: value(5)}}}, 0},
+		{traceContract, ethapi.StateOverride{traceContract: {State: &map[common.Hash]common.Hash{slot0: value(7)}}}, 7},
+		// The state diff keeps the other slots
+		{traceContract, ethapi.StateOverride{traceContract: {StateDiff: &map[common.Hash]common.Hash{slot1: value(5)}}}, 1},
+		{traceContract, ethapi.StateOverride{traceContract: {StateDiff: &map[common.Hash]common.Hash{slot0: value(7)}}}, 7},
+		// The code of an empty account
+		{empty, ethapi.StateOverride{empty: {Code: (*hexutil.Bytes)(&codeSlot0), StateDiff: &map[common.Hash]common.Hash{slot0: value(9)}}}, 9},
+	}
+	for i, tt := range tests {
+		to := tt.to
+		args := ethapi.CallArgs{From: &traceAccount, To: &to}
+		result, err := traceCall(t, api, args, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), &TraceCallConfig{StateOverrides: &tt.overrides})
+		if err != nil {
+			t.Fatalf("test %d: failed to trace call: %v", i, err)
+		}
+		if want := word(big.NewInt(tt.want)); result.ReturnValue != want {
+			t.Errorf("test %d: return value mismatch: have %s, want %s", i, result.ReturnValue, want)
+		}
+	}
+	// The balance of the sender is overridden
+	poor := common.Address{0x0f}
+	args := ethapi.CallArgs{From: &poor, To: &traceRecipient, GasPrice: (*hexutil.Big)(new(big.Int)), Value: (*hexutil.Big)(big.NewInt(1000))}
+	if result, err := traceCall(t, api, args, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), nil); err != nil || !result.Failed {
+		t.Fatalf("transfer without funds succeeded")
+	}
+	balance := (*hexutil.Big)(big.NewInt(1000))
+	overrides := ethapi.StateOverride{poor: {Balance: &balance}}
+	result, err := traceCall(t, api, args, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), &TraceCallConfig{StateOverrides: &overrides})
+	if err != nil || result.Failed {
+		t.Fatalf("failed to trace transfer with overridden balance: %v", err)
+	}
+	// Both the state and the state diff are rejected
+	overrides = ethapi.StateOverride{traceContract: {State: &map[common.Hash]common.Hash{}, StateDiff: &map[common.Hash]common.Hash{}}}
+	if _, err := traceCall(t, api, ethapi.CallArgs{To: &traceContract}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), &TraceCallConfig{StateOverrides: &overrides}); err == nil {
+		t.Fatalf("traced call with both state and state diff")
+	}
+}
+
+// Tests that the block overrides of eth_call apply to a traced call.
+func TestTraceCallBlockOverrides(t *testing.T) {
+	eth := newTestTraceBackend(t, 1)
+	defer eth.blockchain.Stop()
+	api := NewPrivateDebugAPI(eth)
+
+	var (
+		head     = eth.blockchain.CurrentBlock()
+		to       = common.Address{0xee}
+		number   = big.NewInt(1000)
+		time     = hexutil.Uint64(head.Time() + 1000)
+		coinbase = common.Address{0xc0}
+	)
+	tests := []struct {
+		code      []byte
+		overrides *ethapi.BlockOverrides
+		want      *big.Int
+	}{
+		{codeNumber, nil, head.Number()},
+		{codeNumber, &ethapi.BlockOverrides{Number: (*hexutil.Big)(number)}, number},
+		{codeTimestamp, nil, new(big.Int).SetUint64(head.Time())},
+		{codeTimestamp, &ethapi.BlockOverrides{Time: &time}, new(big.Int).SetUint64(uint64(time))},
+		{codeCoinbase, &ethapi.BlockOverrides{Coinbase: &coinbase}, new(big.Int).SetBytes(coinbase.Bytes())},
+	}
+	for i, tt := range tests {
+		code := hexutil.Bytes(tt.code)
+		config := &TraceCallConfig{
+			StateOverrides: &ethapi.StateOverride{to: {Code: &code}},
+			BlockOverrides: tt.overrides,
+		}
+		result, err := traceCall(t, api, ethapi.CallArgs{From: &traceAccount, To: &to}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), config)
+		if err != nil {
+			t.Fatalf("test %d: failed to trace call: %v", i, err)
+		}
+		if want := word(tt.want); result.ReturnValue != want {
+			t.Errorf("test %d: return value mismatch: have %s, want %s", i, result.ReturnValue, want)
+		}
+	}
+}
+
+// Tests that the gas is estimated on the overridden state.
+func TestEstimateGasOverrides(t *testing.T) {
+	eth := newTestTraceBackend(t, 1)
+	defer eth.blockchain.Stop()
+
+	var (
+		ctx    = context.Background()
+		latest = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		to     = common.Address{0xee}
+		store  = hexutil.Bytes(common.FromHex("0x600160005500")) // sstore(0, 1)
+	)
+	estimate := func(args ethapi.CallArgs, overrides *ethapi.StateOverride) (uint64, error) {
+		gas, err := ethapi.DoEstimateGas(ctx, eth.APIBackend, args, latest, overrides, nil, eth.APIBackend.RPCGasCap())
+		return uint64(gas), err
+	}
+	args := ethapi.CallArgs{From: &traceAccount, To: &to}
+	if gas, err := estimate(args, nil); err != nil || gas != params.TxGas {
+		t.Fatalf("estimate mismatch: have %d (%v), want %d", gas, err, params.TxGas)
+	}
+	gas, err := estimate(args, &ethapi.StateOverride{to: {Code: &store}})
+	if err != nil {
+		t.Fatalf("failed to estimate gas with overridden code: %v", err)
+	}
+	if gas < params.TxGas+params.SstoreSetGas {
+		t.Fatalf("estimate with overridden code too low: have %d, want at least %d", gas, params.TxGas+params.SstoreSetGas)
+	}
+	// The overridden balance of the sender is kept
+	poor := common.Address{0x0f}
+	args = ethapi.CallArgs{From: &poor, To: &to, Value: (*hexutil.Big)(big.NewInt(1000))}
+	if _, err := estimate(args, nil); err != nil {
+		t.Fatalf("failed to estimate gas of funded sender: %v", err)
+	}
+	balance := (*hexutil.Big)(big.NewInt(999))
+	if _, err := estimate(args, &ethapi.StateOverride{poor: {Balance: &balance}}); err == nil {
+		t.Fatalf("estimated gas of transfer above overridden balance")
+	}
+}
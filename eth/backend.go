@@ -41,12 +41,14 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/bloombits"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state/pruner"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/eth/downloader"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/eth/filters"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/eth/gasprice"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/eth/protocols/snap"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/internal/ethapi"
@@ -58,7 +60,9 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/smallcrosstx"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/withdrawfailedtx"
 
 	_interface "github.com/elastos/Elastos.ELA.SPV/interface"
 
@@ -167,13 +171,18 @@ func New(ctx *node.ServiceContext, config *Config, node *node.Node) (*Ethereum,
 		config.TrieCleanCache += config.TrieDirtyCache
 		config.TrieDirtyCache = 0
 	}
-	log.Info("Allocated trie memory caches", "clean", common.StorageSize(config.TrieCleanCache)*1024*1024, "dirty", common.StorageSize(config.TrieDirtyCache)*1024*1024)
+	log.Info("Allocated trie memory caches", "clean", common.StorageSize(config.TrieCleanCache)*1024*1024, "dirty", common.StorageSize(config.TrieDirtyCache)*1024*1024, "snapshot", common.StorageSize(config.SnapshotCache)*1024*1024)
 
 	// Assemble the Ethereum object
 	chainDb, err := ctx.OpenDatabaseWithFreezer("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezer, "eth/db/chaindata/")
 	if err != nil {
 		return nil, err
 	}
+	// Finish any state pruning interrupted midway, the database is missing an
+	// arbitrary part of the stale state until then
+	if err := pruner.RecoverPruning(ctx.ResolvePath(""), chainDb); err != nil {
+		log.Error("Failed to recover state", "error", err)
+	}
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.OverrideIstanbul)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -219,6 +228,9 @@ func New(ctx *node.ServiceContext, config *Config, node *node.Node) (*Ethereum,
 		} else {
 			chainConfig.Pbft.DPoSPort = config.PbftDPosPort
 		}
+		if len(config.PbftMessageEnvelope) > 0 {
+			chainConfig.Pbft.MessageEnvelope = config.PbftMessageEnvelope
+		}
 	}
 
 	if config.DynamicArbiterHeight > 0 {
@@ -227,7 +239,11 @@ func New(ctx *node.ServiceContext, config *Config, node *node.Node) (*Ethereum,
 	chainConfig.FrozeAccountList = config.FrozenAccountList
 	chainConfig.BridgeContractAddr = config.ArbiterListContract
 	chainConfig.PledgeBillContract = config.PledgedBillContract
-	chainConfig.DeveloperContract = config.DeveloperFeeContract
+	if len(chainConfig.DeveloperFeeSplits) == 0 {
+		chainConfig.DeveloperContract = config.DeveloperFeeContract
+	} else if len(config.DeveloperFeeContract) > 0 {
+		log.Warn("Ignoring developer fee contracts, the split is scheduled by the chain config", "contracts", config.DeveloperFeeContract)
+	}
 	log.Info("Initialised chain configuration", "config", chainConfig, "config.Miner.Etherbase", config.Miner.Etherbase)
 
 	eth := &Ethereum{
@@ -270,6 +286,7 @@ func New(ctx *node.ServiceContext, config *Config, node *node.Node) (*Ethereum,
 			TrieDirtyLimit:      config.TrieDirtyCache,
 			TrieDirtyDisabled:   config.NoPruning,
 			TrieTimeLimit:       config.TrieTimeout,
+			SnapshotLimit:       config.SnapshotCache,
 		}
 	)
 	engine := pbft.New(chainConfig, ctx.ResolvePath(""))
@@ -398,15 +415,17 @@ func New(ctx *node.ServiceContext, config *Config, node *node.Node) (*Ethereum,
 					Msg:  invBuf.Bytes(),
 				})
 			},
-			OnCipherAddr: func(pid elapeer.PID, cipher []byte) {
+			OnCipherAddr: func(pid elapeer.PID, cipher []byte) error {
 				addr, err := dposAccount.DecryptAddr(cipher)
 				if err != nil {
 					log.Error("decrypt address cipher error", "error:", err)
-					return
+					return err
 				}
 				log.Info("AddDirectLinkPeer", "address:", addr)
 				engine.AddDirectLinkPeer(pid, addr)
+				return nil
 			},
+			Scores: engine.PeerScores(),
 		}
 		routes := dpos.New(&routeCfg)
 		go routes.Start()
@@ -857,6 +876,11 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 		protos[i] = s.protocolManager.makeProtocol(vsn)
 		protos[i].Attributes = []enr.Entry{s.currentEthEntry()}
 	}
+	// Serve state ranges to snap syncing peers if the snapshots are maintained,
+	// and speak the protocol ourselves if snap syncing
+	if s.config.SyncMode == downloader.SnapSync || s.blockchain.Snapshots() != nil {
+		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.protocolManager))...)
+	}
 	if s.lesServer != nil {
 		protos = append(protos, s.lesServer.Protocols()...)
 	}
@@ -895,6 +919,8 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 func (s *Ethereum) Stop() error {
 	fmt.Println("ethereum stop 111111111")
 	spv.Close()
+	smallcrosstx.Close()
+	withdrawfailedtx.Close()
 	fmt.Println("ethereum stop 222222222")
 	close(s.stopChan)
 	fmt.Println("ethereum stop 3333333333")
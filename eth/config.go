@@ -50,6 +50,7 @@ var DefaultConfig = Config{
 	TrieCleanCache:     256,
 	TrieDirtyCache:     256,
 	TrieTimeout:        60 * time.Minute,
+	SnapshotCache:      256,
 	Miner: miner.Config{
 		GasFloor: 8000000,
 		GasCeil:  8000000,
@@ -121,6 +122,7 @@ type Config struct {
 	TrieCleanCache int
 	TrieDirtyCache int
 	TrieTimeout    time.Duration
+	SnapshotCache  int
 
 	// Mining options
 	Miner miner.Config
@@ -155,6 +157,10 @@ type Config struct {
 	// CheckpointOracle is the configuration for checkpoint oracle.
 	CheckpointOracle *params.CheckpointOracleConfig `toml:",omitempty"`
 
+	// ArbiterCheckpoints are trusted PBFT producer sets, overriding the
+	// hardcoded ones of the network for light clients.
+	ArbiterCheckpoints []*params.ArbiterCheckpoint `toml:",omitempty"`
+
 	// Istanbul block override (TODO: remove after the fork)
 	OverrideIstanbul *big.Int
 
@@ -171,6 +177,7 @@ type Config struct {
 	PbftMinerAddress     string
 	PbftIPAddress        string
 	PbftDPosPort         uint16
+	PbftMessageEnvelope  string
 	DPoSV2StartHeight    uint32
 
 	DynamicArbiterHeight uint64
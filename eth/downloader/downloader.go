@@ -27,8 +27,10 @@ import (
 
 	"github.com/elastos/Elastos.ELA.SideChain.ESC"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/eth/protocols/snap"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
@@ -103,6 +105,9 @@ type Downloader struct {
 	mode SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
 	mux  *event.TypeMux // Event multiplexer to announce sync operation events
 
+	snapSync   bool         // Whether to run state sync over the snap protocol
+	SnapSyncer *snap.Syncer // Snap protocol state syncer, fed by the snap message handlers
+
 	checkpoint uint64   // Checkpoint block number to enforce head against (e.g. fast sync)
 	genesis    uint64   // Genesis block number to limit sync to (e.g. light client CHT)
 	queue      *queue   // Scheduler for selecting the hashes to download
@@ -221,6 +226,7 @@ func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom,
 		stateDB:        stateDb,
 		stateBloom:     stateBloom,
 		mux:            mux,
+		SnapSyncer:     snap.NewSyncer(stateDb, stateBloom),
 		checkpoint:     checkpoint,
 		queue:          newQueue(),
 		peers:          newPeerSet(),
@@ -405,7 +411,12 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 
 	defer d.Cancel() // No matter what, we can't leave the cancel channel open
 
-	// Set the requested sync mode, unless it's forbidden
+	// Set the requested sync mode, unless it's forbidden. Snap sync is a fast
+	// sync with the state retrieved over the snap protocol.
+	d.snapSync = mode == SnapSync
+	if mode == SnapSync {
+		mode = FastSync
+	}
 	d.mode = mode
 
 	// Retrieve the origin peer and initiate the downloading process
@@ -1600,6 +1611,9 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 	// Start syncing state of the reported head block. This should get us most of
 	// the state of the pivot block.
+	if err := d.verifyPivot(latest); err != nil {
+		return err
+	}
 	sync := d.syncState(latest.Root)
 	defer sync.Cancel()
 	closeOnErr := func(s *stateSync) {
@@ -1660,6 +1674,9 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 			if oldPivot != P {
 				sync.Cancel()
 
+				if err := d.verifyPivot(P.Header); err != nil {
+					return err
+				}
 				sync = d.syncState(P.Header.Root)
 				defer sync.Cancel()
 				go closeOnErr(sync)
@@ -1760,6 +1777,39 @@ func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 	return nil
 }
 
+// pbftChain is implemented by chains able to verify the PBFT confirmations
+// sealed into the block headers.
+type pbftChain interface {
+	consensus.ChainReader
+
+	// GetDposEngine retrieves the PBFT engine sealing the blocks after the fork.
+	GetDposEngine() consensus.Engine
+}
+
+// verifyPivot checks that a header the state is about to be synced against is
+// confirmed by the PBFT producers. Snap sync trusts the range proofs served by
+// remote peers to be rooted in the pivot, so a forged pivot must be rejected
+// before any state is requested. Headers before the PBFT fork, or chains not
+// running the PBFT engine, are accepted as is.
+func (d *Downloader) verifyPivot(header *types.Header) error {
+	if !d.snapSync {
+		return nil
+	}
+	chain, ok := d.blockchain.(pbftChain)
+	if !ok || !chain.Config().IsPBFTFork(header.Number) {
+		return nil
+	}
+	engine := chain.GetDposEngine()
+	if engine == nil {
+		return nil
+	}
+	if err := engine.VerifySeal(chain, header); err != nil {
+		log.Warn("Unconfirmed snap sync pivot", "number", header.Number, "hash", header.Hash(), "err", err)
+		return errInvalidChain
+	}
+	return nil
+}
+
 // DeliverHeaders injects a new batch of block headers received from a remote
 // node into the download schedule.
 func (d *Downloader) DeliverHeaders(id string, headers []*types.Header) (err error) {
@@ -1781,6 +1831,32 @@ func (d *Downloader) DeliverNodeData(id string, data [][]byte) (err error) {
 	return d.deliver(id, d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
 }
 
+// DeliverSnapPacket is invoked from a peer's message handler when it transmits a
+// data packet for the local node to consume.
+func (d *Downloader) DeliverSnapPacket(peer *snap.Peer, packet snap.Packet) error {
+	switch packet := packet.(type) {
+	case *snap.AccountRangePacket:
+		hashes, accounts, err := packet.Unpack()
+		if err != nil {
+			return err
+		}
+		return d.SnapSyncer.OnAccounts(peer, packet.ID, hashes, accounts, packet.Proof)
+
+	case *snap.StorageRangesPacket:
+		hashset, slotset := packet.Unpack()
+		return d.SnapSyncer.OnStorage(peer, packet.ID, hashset, slotset, packet.Proof)
+
+	case *snap.ByteCodesPacket:
+		return d.SnapSyncer.OnByteCodes(peer, packet.ID, packet.Codes)
+
+	case *snap.TrieNodesPacket:
+		return d.SnapSyncer.OnTrieNodes(peer, packet.ID, packet.Nodes)
+
+	default:
+		return fmt.Errorf("unexpected snap packet type: %T", packet)
+	}
+}
+
 // deliver injects a new batch of data received from a remote node.
 func (d *Downloader) deliver(id string, destCh chan dataPack, packet dataPack, inMeter, dropMeter metrics.Meter) (err error) {
 	// Update the delivery metrics for both good and failed deliveries
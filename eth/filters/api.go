@@ -28,6 +28,7 @@ import (
 	ethereum "github.com/elastos/Elastos.ELA.SideChain.ESC"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
@@ -233,6 +234,38 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	return rpcSub, nil
 }
 
+// CrossChain send a notification each time cross-chain activity is observed,
+// such as a recharge detected by spv, a verified arbiter signature or a
+// refund included in a block.
+func (api *PublicFilterAPI) CrossChain(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		crossChain := make(chan events.CrossChainEvent)
+		crossChainSub := api.events.SubscribeCrossChain(crossChain)
+
+		for {
+			select {
+			case ev := <-crossChain:
+				notifier.Notify(rpcSub.ID, ev)
+			case <-rpcSub.Err():
+				crossChainSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				crossChainSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
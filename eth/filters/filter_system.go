@@ -20,6 +20,7 @@ package filters
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"sync"
@@ -27,12 +28,16 @@ import (
 
 	ethereum "github.com/elastos/Elastos.ELA.SideChain.ESC"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/withdrawfailedtx"
 )
 
 // Type determines the kind of filter and is used to put the filter in to
@@ -53,6 +58,9 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// CrossChainSubscription queries cross-chain activity of recharges, small
+	// cross transactions, failed withdraw refunds and pledge bills
+	CrossChainSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -72,18 +80,22 @@ const (
 
 var (
 	ErrInvalidSubscriptionID = errors.New("invalid id")
+
+	// refundEventTopic is the topic of the log added by an executed refund.
+	refundEventTopic = withdrawfailedtx.GetRefundEventHash()
 )
 
 type subscription struct {
-	id        rpc.ID
-	typ       Type
-	created   time.Time
-	logsCrit  ethereum.FilterQuery
-	logs      chan []*types.Log
-	hashes    chan []common.Hash
-	headers   chan *types.Header
-	installed chan struct{} // closed when the filter is installed
-	err       chan error    // closed when the filter is uninstalled
+	id         rpc.ID
+	typ        Type
+	created    time.Time
+	logsCrit   ethereum.FilterQuery
+	logs       chan []*types.Log
+	hashes     chan []common.Hash
+	headers    chan *types.Header
+	crossChain chan events.CrossChainEvent
+	installed  chan struct{} // closed when the filter is installed
+	err        chan error    // closed when the filter is uninstalled
 }
 
 // EventSystem creates subscriptions, processes events and broadcasts them to the
@@ -100,6 +112,7 @@ type EventSystem struct {
 	rmLogsSub     event.Subscription         // Subscription for removed log event
 	chainSub      event.Subscription         // Subscription for new chain event
 	pendingLogSub *event.TypeMuxSubscription // Subscription for pending log event
+	crossChainSub *event.TypeMuxSubscription // Subscription for cross-chain event
 
 	// Channels
 	install   chan *subscription         // install filter for event notification
@@ -136,10 +149,11 @@ func NewEventSystem(mux *event.TypeMux, backend Backend, lightMode bool) *EventS
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
 	// TODO(rjl493456442): use feed to subscribe pending log event
 	m.pendingLogSub = m.mux.Subscribe(core.PendingLogsEvent{})
+	m.crossChainSub = m.mux.Subscribe(events.CrossChainEvent{})
 
 	// Make sure none of the subscriptions are empty
 	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil ||
-		m.pendingLogSub.Closed() {
+		m.pendingLogSub.Closed() || m.crossChainSub.Closed() {
 		log.Crit("Subscribe for event system failed")
 	}
 
@@ -175,6 +189,7 @@ func (sub *Subscription) Unsubscribe() {
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
 			case <-sub.f.headers:
+			case <-sub.f.crossChain:
 			}
 		}
 
@@ -314,6 +329,23 @@ func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscript
 	return es.subscribe(sub)
 }
 
+// SubscribeCrossChain creates a subscription that writes cross-chain events,
+// from recharges detected by spv to refunds included in imported blocks.
+func (es *EventSystem) SubscribeCrossChain(crossChain chan events.CrossChainEvent) *Subscription {
+	sub := &subscription{
+		id:         rpc.NewID(),
+		typ:        CrossChainSubscription,
+		created:    time.Now(),
+		logs:       make(chan []*types.Log),
+		hashes:     make(chan []common.Hash),
+		headers:    make(chan *types.Header),
+		crossChain: crossChain,
+		installed:  make(chan struct{}),
+		err:        make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 type filterIndex map[Type]map[rpc.ID]*subscription
 
 // broadcast event to filters that match criteria.
@@ -330,6 +362,13 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 					f.logs <- matchedLogs
 				}
 			}
+			if len(filters[CrossChainSubscription]) > 0 {
+				for _, ev := range crossChainEventsFromLogs(e) {
+					for _, f := range filters[CrossChainSubscription] {
+						f.crossChain <- ev
+					}
+				}
+			}
 		}
 	case core.RemovedLogsEvent:
 		for _, f := range filters[LogsSubscription] {
@@ -347,6 +386,13 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 				}
 			}
 		}
+		if muxe, ok := e.Data.(events.CrossChainEvent); ok {
+			for _, f := range filters[CrossChainSubscription] {
+				if e.Time.After(f.created) {
+					f.crossChain <- muxe
+				}
+			}
+		}
 	case core.NewTxsEvent:
 		hashes := make([]common.Hash, 0, len(e.Txs))
 		for _, tx := range e.Txs {
@@ -371,6 +417,37 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 	}
 }
 
+// crossChainEventsFromLogs returns the packed recharges and executed refunds
+// found in the logs of newly imported blocks.
+func crossChainEventsFromLogs(logs []*types.Log) []events.CrossChainEvent {
+	var evs []events.CrossChainEvent
+	for _, l := range logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		var (
+			txHash = l.TxHash
+			number = hexutil.Uint64(l.BlockNumber)
+		)
+		switch {
+		case l.Topics[0] == spv.RechargeEventTopic && len(l.Topics) > 2:
+			evs = append(evs, events.CrossChainEvent{
+				Kind:        events.RechargePacked,
+				ElaTxHash:   hex.EncodeToString(l.Topics[2].Bytes()),
+				EscTxHash:   &txHash,
+				BlockNumber: &number,
+			})
+		case l.Topics[0] == refundEventTopic:
+			evs = append(evs, events.CrossChainEvent{
+				Kind:        events.RefundExecuted,
+				EscTxHash:   &txHash,
+				BlockNumber: &number,
+			})
+		}
+	}
+	return evs
+}
+
 func (es *EventSystem) lightFilterNewHead(newHeader *types.Header, callBack func(*types.Header, bool)) {
 	oldh := es.lastHead
 	es.lastHead = newHeader
@@ -449,6 +526,7 @@ func (es *EventSystem) eventLoop() {
 	// Ensure all subscriptions get cleaned up
 	defer func() {
 		es.pendingLogSub.Unsubscribe()
+		es.crossChainSub.Unsubscribe()
 		es.txsSub.Unsubscribe()
 		es.logsSub.Unsubscribe()
 		es.rmLogsSub.Unsubscribe()
@@ -476,6 +554,11 @@ func (es *EventSystem) eventLoop() {
 				return
 			}
 			es.broadcast(index, ev)
+		case ev, active := <-es.crossChainSub.Chan():
+			if !active { // system stopped
+				return
+			}
+			es.broadcast(index, ev)
 
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
@@ -18,6 +18,7 @@ package filters
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -30,12 +31,14 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/ethash"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/bloombits"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
 )
 
 type testBackend struct {
@@ -212,6 +215,63 @@ func TestBlockSubscription(t *testing.T) {
 	<-sub1.Err()
 }
 
+// TestCrossChainSubscription tests that cross-chain events posted to the mux and
+// derived from imported logs are delivered to cross-chain subscriptions.
+func TestCrossChainSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux        = new(event.TypeMux)
+		db         = rawdb.NewMemoryDatabase()
+		txFeed     = new(event.Feed)
+		rmLogsFeed = new(event.Feed)
+		logsFeed   = new(event.Feed)
+		chainFeed  = new(event.Feed)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		api        = NewPublicFilterAPI(backend, false)
+
+		elaTx    = common.HexToHash("0x8ce6a6cf62f2bb2fbfd1a8bfdd01c6d59e9cf0cee0fbf4ccbfbab0d26c7a3b4d")
+		packTx   = common.HexToHash("0x01")
+		refundTx = common.HexToHash("0x02")
+		logs     = []*types.Log{
+			{Topics: []common.Hash{spv.RechargeEventTopic, {}, elaTx, {}, {}}, TxHash: packTx, BlockNumber: 5},
+			{Topics: []common.Hash{common.HexToHash("0xdead")}, TxHash: packTx, BlockNumber: 5},
+			{Topics: []common.Hash{refundEventTopic, {}, {}, {}, {}}, TxHash: refundTx, BlockNumber: 6},
+		}
+	)
+
+	crossChain := make(chan events.CrossChainEvent)
+	sub := api.events.SubscribeCrossChain(crossChain)
+	defer sub.Unsubscribe()
+
+	time.Sleep(1 * time.Second)
+	go func() {
+		mux.Post(events.CrossChainEvent{Kind: events.RechargeDetected, ElaTxHash: "aa"})
+		logsFeed.Send(logs)
+	}()
+
+	var received []events.CrossChainEvent
+	timeout := time.After(2 * time.Second)
+	for len(received) < 3 {
+		select {
+		case ev := <-crossChain:
+			received = append(received, ev)
+		case <-timeout:
+			t.Fatalf("timeout waiting for cross-chain events, got %d", len(received))
+		}
+	}
+	if received[0].Kind != events.RechargeDetected || received[0].ElaTxHash != "aa" {
+		t.Errorf("invalid detected event: %+v", received[0])
+	}
+	if ev := received[1]; ev.Kind != events.RechargePacked || ev.ElaTxHash != hex.EncodeToString(elaTx.Bytes()) ||
+		*ev.EscTxHash != packTx || uint64(*ev.BlockNumber) != 5 {
+		t.Errorf("invalid packed event: %+v", ev)
+	}
+	if ev := received[2]; ev.Kind != events.RefundExecuted || *ev.EscTxHash != refundTx || uint64(*ev.BlockNumber) != 6 {
+		t.Errorf("invalid refund event: %+v", ev)
+	}
+}
+
 // TestPendingTxFilter tests whether pending tx filters retrieve all pending transactions that are posted to the event mux.
 func TestPendingTxFilter(t *testing.T) {
 	t.Parallel()
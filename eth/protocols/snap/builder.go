@@ -0,0 +1,96 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state/snapshot"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
+)
+
+// trieBuilder inserts leaves into a fresh trie, flushing the accumulated nodes
+// into the database every so often to keep the memory use bounded.
+type trieBuilder struct {
+	db    *trie.Database
+	trie  *trie.Trie
+	count int
+}
+
+// newTrieBuilder creates a builder for an initially empty trie.
+func newTrieBuilder(db *trie.Database) *trieBuilder {
+	tr, _ := trie.New(common.Hash{}, db) // Empty tries never fail
+	return &trieBuilder{db: db, trie: tr}
+}
+
+// add inserts a leaf into the trie.
+func (b *trieBuilder) add(key, value []byte) error {
+	if err := b.trie.TryUpdate(key, value); err != nil {
+		return err
+	}
+	if b.count++; b.count%trieFlushInterval == 0 {
+		_, err := b.commit()
+		return err
+	}
+	return nil
+}
+
+// commit writes all the nodes of the trie into the database and reopens it from
+// the committed root, releasing the in-memory nodes.
+func (b *trieBuilder) commit() (common.Hash, error) {
+	root, err := b.trie.Commit(nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := b.db.Commit(root, false); err != nil {
+		return common.Hash{}, err
+	}
+	b.trie, err = trie.New(root, b.db)
+	return root, err
+}
+
+// rlpAccount encodes an account in the consensus format stored in the trie.
+func rlpAccount(account snapshot.Account) ([]byte, error) {
+	return rlp.EncodeToBytes(account)
+}
+
+// bloomedStore is a database wrapper adding all the keys written through batches
+// into the sync bloom, so the healer does not consider them missing.
+type bloomedStore struct {
+	ethdb.KeyValueStore
+	bloom *trie.SyncBloom
+}
+
+// NewBatch creates a write-only database batch tracking the written keys.
+func (s *bloomedStore) NewBatch() ethdb.Batch {
+	return &bloomedBatch{Batch: s.KeyValueStore.NewBatch(), bloom: s.bloom}
+}
+
+// bloomedBatch is a database batch adding all written keys into the sync bloom.
+type bloomedBatch struct {
+	ethdb.Batch
+	bloom *trie.SyncBloom
+}
+
+// Put inserts the given value into the batch and its key into the bloom.
+func (b *bloomedBatch) Put(key, value []byte) error {
+	if b.bloom != nil {
+		b.bloom.Add(key)
+	}
+	return b.Batch.Put(key, value)
+}
@@ -0,0 +1,1368 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state/snapshot"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/light"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+
+	// maxHash is the largest possible account or storage slot hash.
+	maxHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+)
+
+const (
+	// maxRequestSize is the maximum number of bytes to request from a remote peer.
+	maxRequestSize = 512 * 1024
+
+	// maxStorageSetRequestCount is the maximum number of contracts to request the
+	// storage of in a single query. If this number is too low, we're not filling
+	// responses fully and waste round trip times. If it's too high, we're capping
+	// responses and waste bandwidth.
+	maxStorageSetRequestCount = maxRequestSize / 1024
+
+	// maxCodeRequestCount is the maximum number of bytecode blobs to request in a
+	// single query. If this number is too low, we're not filling responses fully
+	// and waste round trip times. If it's too high, we're capping responses and
+	// waste bandwidth.
+	//
+	// Depoyed bytecodes are currently capped at 24KB, so the minimum request
+	// size should be maxRequestSize / 24K. Assuming that most contracts do not
+	// come close to that, requesting 4x should be a good approximation.
+	maxCodeRequestCount = maxRequestSize / (24 * 1024) * 4
+
+	// maxTrieRequestCount is the maximum number of trie node blobs to request in
+	// a single query. If this number is too low, we're not filling responses fully
+	// and waste round trip times. If it's too high, we're capping responses and
+	// waste bandwidth.
+	maxTrieRequestCount = 256
+
+	// accountConcurrency is the number of chunks to split the account trie into
+	// to allow concurrent retrievals.
+	accountConcurrency = 16
+
+	// trieFlushInterval is the number of leaves inserted into a locally rebuilt
+	// trie after which the accumulated nodes are flushed to disk.
+	trieFlushInterval = 100000
+)
+
+// requestTimeout is the maximum time a peer is allowed to spend on serving a
+// single network request.
+var requestTimeout = 10 * time.Second
+
+// ErrCancelled is returned from snap syncing if the operation was prematurely
+// terminated.
+var ErrCancelled = errors.New("sync cancelled")
+
+// accountRequest tracks a pending account range request to ensure responses are
+// to actual requests and to validate any security constraints.
+type accountRequest struct {
+	peer string // Peer to which this request is assigned
+	id   uint64 // Request ID of this request
+
+	root   common.Hash  // State root the range is proven against
+	origin common.Hash  // First account requested to allow continuation checks
+	task   *accountTask // Task which this request is filling
+
+	timeout *time.Timer // Timer to track delivery timeout
+}
+
+// storageRequest tracks a pending storage ranges request to ensure responses are
+// to actual requests and to validate any security constraints.
+type storageRequest struct {
+	peer string // Peer to which this request is assigned
+	id   uint64 // Request ID of this request
+
+	tasks []*storageTask // Storage tasks this request is filling, in request order
+
+	timeout *time.Timer // Timer to track delivery timeout
+}
+
+// bytecodeRequest tracks a pending bytecode request to ensure responses are to
+// actual requests and to validate any security constraints.
+type bytecodeRequest struct {
+	peer string // Peer to which this request is assigned
+	id   uint64 // Request ID of this request
+
+	hashes []common.Hash // Bytecode hashes to validate responses
+
+	timeout *time.Timer // Timer to track delivery timeout
+}
+
+// trienodeHealRequest tracks a pending state trie request to ensure responses
+// are to actual requests and to validate any security constraints.
+type trienodeHealRequest struct {
+	peer string // Peer to which this request is assigned
+	id   uint64 // Request ID of this request
+
+	hashes []common.Hash // Trie node hashes to validate responses
+	sched  *trie.Sync    // Healer the request was issued by
+
+	timeout *time.Timer // Timer to track delivery timeout
+}
+
+// accountTask represents the sync task for a chunk of the account snapshot.
+type accountTask struct {
+	Next common.Hash // Next account to sync in this interval
+	Last common.Hash // Last account to sync in this interval
+
+	req *accountRequest // Pending request to fill this task
+}
+
+// storageTask represents the sync task for the storage of a single contract.
+type storageTask struct {
+	Account common.Hash // Hash of the account owning the storage
+	Root    common.Hash // Storage root the delivered slots are proven against
+	Next    common.Hash // Next storage slot to sync for the account
+}
+
+// syncProgress is a database entry to allow suspending and resuming a snapshot
+// state sync. Opposed to full and fast sync, there is no way to restart a
+// suspended snap sync without prior knowledge of the suspension point.
+type syncProgress struct {
+	Tasks   []*accountTask // The suspended account tasks
+	Storage []*storageTask // The suspended storage tasks
+	Codes   []common.Hash  // The suspended bytecode retrievals
+	Healing []common.Hash  // Storage roots failing their range proofs, left to the healer
+	Built   bool           // Whether the state tries were rebuilt from the flat data
+
+	// Status report during syncing phase
+	AccountSynced  uint64             // Number of accounts downloaded
+	AccountBytes   common.StorageSize // Number of account trie bytes persisted to disk
+	StorageSynced  uint64             // Number of storage slots downloaded
+	StorageBytes   common.StorageSize // Number of storage trie bytes persisted to disk
+	StorageSkipped uint64             // Number of storage tries left to the healer
+	BytecodeSynced uint64             // Number of bytecodes downloaded
+	BytecodeBytes  common.StorageSize // Number of bytecode bytes downloaded
+}
+
+// Syncer is an Ethereum account and storage trie syncer based on snapshots and
+// the  snap protocol. It's purpose is to download all the accounts and storage
+// slots from remote peers and reassemble chunks of the state trie, on top of
+// which a state sync can be run to fix any gaps / overlaps.
+//
+// Every network request has a variety of failure events:
+//   - The peer disconnects after task assignment, failing to send the request
+//   - The peer disconnects after sending the request, before delivering on it
+//   - The peer remains connected, but does not deliver a response in time
+//   - The peer delivers a stale response after a previous timeout
+//   - The peer delivers a refusal to serve the requested state
+//
+// The sync runs in three phases. First the flat account and storage ranges are
+// downloaded together with the contract bytecodes, each range verified with a
+// Merkle range proof against the pivot root. Then the account and storage tries
+// are rebuilt locally from the flat data. Finally the rebuilt tries are healed
+// node by node against the latest pivot root, fixing any inconsistencies caused
+// by the pivot moving while the ranges were being downloaded.
+type Syncer struct {
+	db    ethdb.KeyValueStore // Database to store the trie nodes into (and dedup)
+	bloom *trie.SyncBloom     // Bloom filter to deduplicate nodes for state fixup
+
+	root      common.Hash              // Current state trie root being synced
+	tasks     []*accountTask           // Current account task set being synced
+	storage   []*storageTask           // Storage retrievals waiting for an idle peer
+	codes     map[common.Hash]struct{} // Bytecode retrievals waiting for an idle peer
+	healing   []common.Hash            // Storage roots failing their range proofs
+	built     bool                     // Whether the state tries were rebuilt already
+	loaded    bool                     // Whether the suspended progress was loaded
+	completed bool                     // Whether the last sync cycle finished
+	failure   error                    // Local failure aborting the sync cycle
+
+	healer    *trie.Sync    // State trie scheduler filling in the missing nodes
+	healQueue []common.Hash // Trie nodes to retry after a failed retrieval
+	healBatch ethdb.Batch   // Database batch accumulating the healed nodes
+
+	update chan struct{} // Notification channel for possible sync progression
+
+	peers     map[string]*Peer    // Currently active peers to download from
+	idlers    map[string]struct{} // Peers without an in-flight request
+	stateless map[string]struct{} // Peers that failed to deliver state for the current root
+
+	accountReqs      map[uint64]*accountRequest      // Account requests currently running
+	storageReqs      map[uint64]*storageRequest      // Storage requests currently running
+	bytecodeReqs     map[uint64]*bytecodeRequest     // Bytecode requests currently running
+	trienodeHealReqs map[uint64]*trienodeHealRequest // Trie node requests currently running
+
+	accountSynced  uint64             // Number of accounts downloaded
+	accountBytes   common.StorageSize // Number of account trie bytes persisted to disk
+	storageSynced  uint64             // Number of storage slots downloaded
+	storageBytes   common.StorageSize // Number of storage trie bytes persisted to disk
+	storageSkipped uint64             // Number of storage tries left to the healer
+	bytecodeSynced uint64             // Number of bytecodes downloaded
+	bytecodeBytes  common.StorageSize // Number of bytecode bytes downloaded
+	trienodeSynced uint64             // Number of state trie nodes downloaded
+	trienodeBytes  common.StorageSize // Number of state trie bytes persisted to disk
+
+	logTime time.Time // Time instance when status was last reported
+
+	lock sync.RWMutex // Protects fields that can change outside of sync (peers, reqs, root)
+}
+
+// NewSyncer creates a new snapshot syncer to download the Ethereum state over the
+// snap protocol. The bloom filter must be the one the fast sync scheduler uses,
+// all nodes written by the syncer are added to it.
+func NewSyncer(db ethdb.KeyValueStore, bloom *trie.SyncBloom) *Syncer {
+	return &Syncer{
+		db:               db,
+		bloom:            bloom,
+		codes:            make(map[common.Hash]struct{}),
+		update:           make(chan struct{}, 1),
+		peers:            make(map[string]*Peer),
+		idlers:           make(map[string]struct{}),
+		stateless:        make(map[string]struct{}),
+		accountReqs:      make(map[uint64]*accountRequest),
+		storageReqs:      make(map[uint64]*storageRequest),
+		bytecodeReqs:     make(map[uint64]*bytecodeRequest),
+		trienodeHealReqs: make(map[uint64]*trienodeHealRequest),
+	}
+}
+
+// Register injects a new data source into the syncer's peerset.
+func (s *Syncer) Register(peer *Peer) error {
+	// Make sure the peer is not registered yet
+	id := peer.ID()
+
+	s.lock.Lock()
+	if _, ok := s.peers[id]; ok {
+		log.Error("Snap peer already registered", "id", id)
+
+		s.lock.Unlock()
+		return errors.New("already registered")
+	}
+	s.peers[id] = peer
+	s.idlers[id] = struct{}{}
+	s.lock.Unlock()
+
+	// Notify any active syncs that a new peer can be assigned data
+	s.notify()
+	return nil
+}
+
+// Unregister removes a data source from the syncer's peerset.
+func (s *Syncer) Unregister(id string) error {
+	// Remove all traces of the peer from the registry
+	s.lock.Lock()
+	if _, ok := s.peers[id]; !ok {
+		log.Error("Snap peer not registered", "id", id)
+
+		s.lock.Unlock()
+		return errors.New("not registered")
+	}
+	delete(s.peers, id)
+	delete(s.idlers, id)
+	delete(s.stateless, id)
+
+	// Reschedule any requests the peer was tasked with
+	s.revertRequests(id)
+	s.lock.Unlock()
+
+	// Notify any active syncs that pending requests need to be reverted
+	s.notify()
+	return nil
+}
+
+// Sync starts (or resumes a previous) sync cycle to iterate over an state trie
+// with the given root and reconstruct the nodes based on the snapshot leaves.
+// Previously downloaded segments will not be redownloaded of fixed, rather any
+// errors will be healed after the leaves are fully accumulated.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	// Move the trie root from any previous value, revert stateless markers for
+	// any peers and initialize the syncer if it was not yet run
+	s.lock.Lock()
+	s.root = root
+	s.stateless = make(map[string]struct{})
+	s.failure = nil
+	if !s.loaded {
+		s.loadSyncStatus()
+		s.loaded = true
+	}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		// Revert any in-flight requests, their responses are not needed any more,
+		// and persist the progress to resume after a pivot move or restart
+		s.revertRequests("")
+		for id := range s.peers {
+			s.idlers[id] = struct{}{}
+		}
+		s.healer, s.healQueue, s.healBatch = nil, nil, nil
+		s.saveSyncStatus()
+	}()
+	log.Debug("Starting snapshot sync cycle", "root", root)
+
+	// Download the flat state ranges and rebuild the tries from them, unless
+	// already done in a previous cycle (with the pivot since moved)
+	s.lock.RLock()
+	built := s.built
+	s.lock.RUnlock()
+
+	if !built {
+		if err := s.run(cancel, s.rangesDone, s.assignRangeTasks); err != nil {
+			return err
+		}
+		if err := s.rebuildTries(cancel); err != nil {
+			return err
+		}
+		s.lock.Lock()
+		s.built = true
+		s.lock.Unlock()
+	}
+	// Heal the rebuilt tries against the current root
+	s.lock.Lock()
+	s.healer = state.NewStateSync(root, s.db, s.bloom)
+	s.healBatch = s.db.NewBatch()
+
+	// The rebuilt account trie references the storage tries that failed their
+	// range proofs, but those are not complete locally. The healer would not
+	// descend into an already present account trie, so schedule them explicitly.
+	for _, root := range s.healing {
+		s.healer.AddSubTrie(root, 64, common.Hash{}, nil)
+	}
+	s.lock.Unlock()
+
+	if err := s.run(cancel, s.healDone, s.assignHealTasks); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.completed = true
+	s.reportSyncProgress(true)
+	s.lock.Unlock()
+
+	log.Info("Snapshot sync cycle completed", "root", root)
+	return nil
+}
+
+// run keeps assigning tasks to idle peers and waiting for their deliveries until
+// the done condition is met or the sync is cancelled.
+func (s *Syncer) run(cancel chan struct{}, done func() bool, assign func()) error {
+	for {
+		s.lock.Lock()
+		if s.failure == nil && done() {
+			s.lock.Unlock()
+			return nil
+		}
+		if err := s.failure; err != nil {
+			s.lock.Unlock()
+			return err
+		}
+		assign()
+		s.reportSyncProgress(false)
+		s.lock.Unlock()
+
+		// Wait for something to happen
+		select {
+		case <-s.update:
+			// Something happened (new peer, delivery, timeout), recheck tasks
+		case <-cancel:
+			return ErrCancelled
+		}
+	}
+}
+
+// notify signals the running sync cycle that the task assignments should be
+// rechecked.
+func (s *Syncer) notify() {
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// loadSyncStatus retrieves a previously aborted sync status from the database,
+// or generates a fresh one if none is available.
+func (s *Syncer) loadSyncStatus() {
+	var progress syncProgress
+
+	if status := rawdb.ReadSnapshotSyncStatus(s.db); status != nil {
+		if err := json.Unmarshal(status, &progress); err != nil {
+			log.Error("Failed to decode snap sync status", "err", err)
+		} else {
+			log.Debug("Scheduled snap sync resumption", "tasks", len(progress.Tasks), "storage", len(progress.Storage), "codes", len(progress.Codes), "built", progress.Built)
+
+			s.tasks, s.storage, s.healing, s.built = progress.Tasks, progress.Storage, progress.Healing, progress.Built
+			s.codes = make(map[common.Hash]struct{})
+			for _, hash := range progress.Codes {
+				s.codes[hash] = struct{}{}
+			}
+			s.accountSynced, s.accountBytes = progress.AccountSynced, progress.AccountBytes
+			s.storageSynced, s.storageBytes = progress.StorageSynced, progress.StorageBytes
+			s.storageSkipped = progress.StorageSkipped
+			s.bytecodeSynced, s.bytecodeBytes = progress.BytecodeSynced, progress.BytecodeBytes
+			return
+		}
+	}
+	// Either we've failed to decode the previus state, or there was none.
+	// Start a fresh sync by chunking up the account range and scheduling
+	// them for retrieval.
+	s.tasks, s.storage, s.healing, s.built = nil, nil, nil, false
+	s.codes = make(map[common.Hash]struct{})
+	s.accountSynced, s.accountBytes = 0, 0
+	s.storageSynced, s.storageBytes, s.storageSkipped = 0, 0, 0
+	s.bytecodeSynced, s.bytecodeBytes = 0, 0
+	s.trienodeSynced, s.trienodeBytes = 0, 0
+
+	var next common.Hash
+	step := new(big.Int).Sub(
+		new(big.Int).Div(
+			new(big.Int).Exp(common.Big2, common.Big256, nil),
+			big.NewInt(accountConcurrency),
+		), common.Big1,
+	)
+	for i := 0; i < accountConcurrency; i++ {
+		last := common.BigToHash(new(big.Int).Add(next.Big(), step))
+		if i == accountConcurrency-1 {
+			// Make sure we don't overflow if the step is not a proper divisor
+			last = maxHash
+		}
+		s.tasks = append(s.tasks, &accountTask{
+			Next: next,
+			Last: last,
+		})
+		next = common.BigToHash(new(big.Int).Add(last.Big(), common.Big1))
+	}
+}
+
+// saveSyncStatus marshals the remaining sync tasks into leveldb, or deletes the
+// stored status if the sync cycle finished.
+func (s *Syncer) saveSyncStatus() {
+	if s.completed {
+		rawdb.DeleteSnapshotSyncStatus(s.db)
+
+		// Start from scratch if the syncer is ever reused
+		s.loaded, s.completed = false, false
+		return
+	}
+	progress := &syncProgress{
+		Tasks:          s.tasks,
+		Storage:        s.storage,
+		Healing:        s.healing,
+		Built:          s.built,
+		AccountSynced:  s.accountSynced,
+		AccountBytes:   s.accountBytes,
+		StorageSynced:  s.storageSynced,
+		StorageBytes:   s.storageBytes,
+		StorageSkipped: s.storageSkipped,
+		BytecodeSynced: s.bytecodeSynced,
+		BytecodeBytes:  s.bytecodeBytes,
+	}
+	for hash := range s.codes {
+		progress.Codes = append(progress.Codes, hash)
+	}
+	status, err := json.Marshal(progress)
+	if err != nil {
+		panic(err) // This can only fail during implementation
+	}
+	rawdb.WriteSnapshotSyncStatus(s.db, status)
+}
+
+// rangesDone reports whether all the flat state ranges and bytecodes have been
+// downloaded. The lock is assumed to be held.
+func (s *Syncer) rangesDone() bool {
+	if len(s.tasks) > 0 || len(s.storage) > 0 || len(s.codes) > 0 {
+		return false
+	}
+	return len(s.accountReqs) == 0 && len(s.storageReqs) == 0 && len(s.bytecodeReqs) == 0
+}
+
+// healDone reports whether the state trie healing finished, flushing the last
+// healed nodes into the database. The lock is assumed to be held.
+func (s *Syncer) healDone() bool {
+	if len(s.trienodeHealReqs) > 0 || len(s.healQueue) > 0 || s.healer.Pending() > 0 {
+		return false
+	}
+	if err := s.commitHeal(true); err != nil {
+		s.failure = err
+		return false
+	}
+	return true
+}
+
+// newRequestID generates a request ID not used by any in-flight request. The
+// lock is assumed to be held.
+func (s *Syncer) newRequestID() uint64 {
+	for {
+		id := uint64(rand.Int63())
+		if _, ok := s.accountReqs[id]; ok {
+			continue
+		}
+		if _, ok := s.storageReqs[id]; ok {
+			continue
+		}
+		if _, ok := s.bytecodeReqs[id]; ok {
+			continue
+		}
+		if _, ok := s.trienodeHealReqs[id]; ok {
+			continue
+		}
+		return id
+	}
+}
+
+// assignRangeTasks attempts to match idle peers to pending account range,
+// storage range and bytecode retrievals. Bytecodes and storage are preferred
+// over new account ranges to keep the backlog bounded. The lock is assumed to
+// be held.
+func (s *Syncer) assignRangeTasks() {
+	for id := range s.idlers {
+		if _, ok := s.stateless[id]; ok {
+			continue
+		}
+		peer := s.peers[id]
+
+		switch {
+		case len(s.codes) > 0:
+			s.requestByteCodes(peer)
+		case len(s.storage) > 0:
+			s.requestStorageRanges(peer)
+		default:
+			var task *accountTask
+			for _, t := range s.tasks {
+				if t.req == nil {
+					task = t
+					break
+				}
+			}
+			if task == nil {
+				return // All account ranges are being retrieved
+			}
+			s.requestAccountRange(peer, task)
+		}
+	}
+}
+
+// assignHealTasks attempts to match idle peers to missing trie nodes. The lock
+// is assumed to be held.
+func (s *Syncer) assignHealTasks() {
+	for id := range s.idlers {
+		if _, ok := s.stateless[id]; ok {
+			continue
+		}
+		// Retry the previously failed nodes first, then fill up with new ones
+		hashes := s.healQueue
+		if len(hashes) > maxTrieRequestCount {
+			hashes = hashes[:maxTrieRequestCount]
+		}
+		s.healQueue = s.healQueue[len(hashes):]
+		if len(hashes) < maxTrieRequestCount {
+			hashes = append(hashes, s.healer.Missing(maxTrieRequestCount-len(hashes))...)
+		}
+		if len(hashes) == 0 {
+			return // Everything is being retrieved
+		}
+		s.requestTrieNodes(s.peers[id], hashes)
+	}
+}
+
+// requestAccountRange sends an account range request to an idle peer. The lock
+// is assumed to be held.
+func (s *Syncer) requestAccountRange(peer *Peer, task *accountTask) {
+	req := &accountRequest{
+		peer:   peer.ID(),
+		id:     s.newRequestID(),
+		root:   s.root,
+		origin: task.Next,
+		task:   task,
+	}
+	req.timeout = time.AfterFunc(requestTimeout, func() {
+		peer.Log().Debug("Account range request timed out", "reqid", req.id)
+
+		s.lock.Lock()
+		if s.accountReqs[req.id] == req {
+			s.revertAccountRequest(req)
+			s.stateless[req.peer] = struct{}{}
+		}
+		s.lock.Unlock()
+		s.notify()
+	})
+	s.accountReqs[req.id] = req
+	task.req = req
+	delete(s.idlers, req.peer)
+
+	if err := peer.RequestAccountRange(req.id, req.root, req.origin, task.Last, maxRequestSize); err != nil {
+		peer.Log().Debug("Failed to request account range", "err", err)
+		s.revertAccountRequest(req)
+	}
+}
+
+// requestStorageRanges sends a storage ranges request to an idle peer. Storage
+// of a large contract is continued alone, fresh contracts are batched up. The
+// lock is assumed to be held.
+func (s *Syncer) requestStorageRanges(peer *Peer) {
+	var tasks []*storageTask
+	if s.storage[0].Next != (common.Hash{}) {
+		tasks = append(tasks, s.storage[0])
+	} else {
+		for _, task := range s.storage {
+			if task.Next != (common.Hash{}) || len(tasks) >= maxStorageSetRequestCount {
+				break
+			}
+			tasks = append(tasks, task)
+		}
+	}
+	s.storage = s.storage[len(tasks):]
+
+	req := &storageRequest{
+		peer:  peer.ID(),
+		id:    s.newRequestID(),
+		tasks: tasks,
+	}
+	req.timeout = time.AfterFunc(requestTimeout, func() {
+		peer.Log().Debug("Storage request timed out", "reqid", req.id)
+
+		s.lock.Lock()
+		if s.storageReqs[req.id] == req {
+			s.revertStorageRequest(req)
+			s.stateless[req.peer] = struct{}{}
+		}
+		s.lock.Unlock()
+		s.notify()
+	})
+	s.storageReqs[req.id] = req
+	delete(s.idlers, req.peer)
+
+	accounts := make([]common.Hash, len(tasks))
+	for i, task := range tasks {
+		accounts[i] = task.Account
+	}
+	var origin []byte
+	if next := tasks[0].Next; next != (common.Hash{}) {
+		origin = next[:]
+	}
+	if err := peer.RequestStorageRanges(req.id, s.root, accounts, origin, nil, maxRequestSize); err != nil {
+		peer.Log().Debug("Failed to request storage", "err", err)
+		s.revertStorageRequest(req)
+	}
+}
+
+// requestByteCodes sends a bytecode request to an idle peer. The lock is assumed
+// to be held.
+func (s *Syncer) requestByteCodes(peer *Peer) {
+	hashes := make([]common.Hash, 0, maxCodeRequestCount)
+	for hash := range s.codes {
+		delete(s.codes, hash)
+
+		hashes = append(hashes, hash)
+		if len(hashes) >= maxCodeRequestCount {
+			break
+		}
+	}
+	req := &bytecodeRequest{
+		peer:   peer.ID(),
+		id:     s.newRequestID(),
+		hashes: hashes,
+	}
+	req.timeout = time.AfterFunc(requestTimeout, func() {
+		peer.Log().Debug("Bytecode request timed out", "reqid", req.id)
+
+		s.lock.Lock()
+		if s.bytecodeReqs[req.id] == req {
+			s.revertBytecodeRequest(req)
+			s.stateless[req.peer] = struct{}{}
+		}
+		s.lock.Unlock()
+		s.notify()
+	})
+	s.bytecodeReqs[req.id] = req
+	delete(s.idlers, req.peer)
+
+	if err := peer.RequestByteCodes(req.id, hashes, maxRequestSize); err != nil {
+		peer.Log().Debug("Failed to request bytecodes", "err", err)
+		s.revertBytecodeRequest(req)
+	}
+}
+
+// requestTrieNodes sends a trie node request to an idle peer. The lock is
+// assumed to be held.
+func (s *Syncer) requestTrieNodes(peer *Peer, hashes []common.Hash) {
+	req := &trienodeHealRequest{
+		peer:   peer.ID(),
+		id:     s.newRequestID(),
+		hashes: hashes,
+		sched:  s.healer,
+	}
+	req.timeout = time.AfterFunc(requestTimeout, func() {
+		peer.Log().Debug("Trienode heal request timed out", "reqid", req.id)
+
+		s.lock.Lock()
+		if s.trienodeHealReqs[req.id] == req {
+			s.revertTrienodeHealRequest(req)
+			s.stateless[req.peer] = struct{}{}
+		}
+		s.lock.Unlock()
+		s.notify()
+	})
+	s.trienodeHealReqs[req.id] = req
+	delete(s.idlers, req.peer)
+
+	if err := peer.RequestTrieNodes(req.id, s.root, hashes, maxRequestSize); err != nil {
+		peer.Log().Debug("Failed to request trienode healers", "err", err)
+		s.revertTrienodeHealRequest(req)
+	}
+}
+
+// revertRequests reverts all the requests assigned to the given peer, or all
+// in-flight requests if no peer is specified. The lock is assumed to be held.
+func (s *Syncer) revertRequests(peer string) {
+	for _, req := range s.accountReqs {
+		if peer == "" || req.peer == peer {
+			s.revertAccountRequest(req)
+		}
+	}
+	for _, req := range s.storageReqs {
+		if peer == "" || req.peer == peer {
+			s.revertStorageRequest(req)
+		}
+	}
+	for _, req := range s.bytecodeReqs {
+		if peer == "" || req.peer == peer {
+			s.revertBytecodeRequest(req)
+		}
+	}
+	for _, req := range s.trienodeHealReqs {
+		if peer == "" || req.peer == peer {
+			s.revertTrienodeHealRequest(req)
+		}
+	}
+}
+
+// revertAccountRequest cleans up an account range request and returns the task
+// to the pool of unassigned ones. The lock is assumed to be held.
+func (s *Syncer) revertAccountRequest(req *accountRequest) {
+	delete(s.accountReqs, req.id)
+	req.timeout.Stop()
+
+	if req.task.req == req {
+		req.task.req = nil
+	}
+}
+
+// revertStorageRequest cleans up a storage range request and returns all its
+// tasks to the front of the pending queue. The lock is assumed to be held.
+func (s *Syncer) revertStorageRequest(req *storageRequest) {
+	delete(s.storageReqs, req.id)
+	req.timeout.Stop()
+
+	s.storage = append(append([]*storageTask{}, req.tasks...), s.storage...)
+}
+
+// revertBytecodeRequest cleans up a bytecode request and returns all its hashes
+// to the pending set. The lock is assumed to be held.
+func (s *Syncer) revertBytecodeRequest(req *bytecodeRequest) {
+	delete(s.bytecodeReqs, req.id)
+	req.timeout.Stop()
+
+	for _, hash := range req.hashes {
+		s.codes[hash] = struct{}{}
+	}
+}
+
+// revertTrienodeHealRequest cleans up a trie node request and schedules all its
+// hashes to be retried. The lock is assumed to be held.
+func (s *Syncer) revertTrienodeHealRequest(req *trienodeHealRequest) {
+	delete(s.trienodeHealReqs, req.id)
+	req.timeout.Stop()
+
+	if req.sched == s.healer {
+		s.healQueue = append(s.healQueue, req.hashes...)
+	}
+}
+
+// markIdle returns a peer to the idle pool, unless it disconnected meanwhile.
+// The lock is assumed to be held.
+func (s *Syncer) markIdle(id string) {
+	if _, ok := s.peers[id]; ok {
+		s.idlers[id] = struct{}{}
+	}
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts are
+// received from a remote peer. The accounts are in the consensus format.
+func (s *Syncer) OnAccounts(peer *Peer, id uint64, hashes []common.Hash, accounts [][]byte, proof [][]byte) error {
+	s.lock.Lock()
+	req, ok := s.accountReqs[id]
+	if !ok || req.peer != peer.ID() {
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected account range packet", "reqid", id)
+		return nil
+	}
+	// Clean up the request timeout, the task stays reserved until processed
+	delete(s.accountReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+	s.lock.Unlock()
+
+	defer s.notify()
+
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data. For account range queries that means the state being
+	// retrieved was either already pruned remotely, or the peer is not yet
+	// synced to our head.
+	if len(hashes) == 0 && len(proof) == 0 {
+		peer.Log().Debug("Peer rejected account range request", "root", req.root)
+
+		s.lock.Lock()
+		s.stateless[req.peer] = struct{}{}
+		if req.task.req == req {
+			req.task.req = nil
+		}
+		s.lock.Unlock()
+		return nil
+	}
+	// Reconstruct a partial trie from the response and verify it
+	cont, err := verifyAccountRange(req, hashes, accounts, proof)
+	if err != nil {
+		peer.Log().Warn("Account range failed proof", "err", err)
+
+		s.lock.Lock()
+		if req.task.req == req {
+			req.task.req = nil
+		}
+		s.lock.Unlock()
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.processAccountResponse(req, hashes, accounts, cont)
+	return nil
+}
+
+// verifyAccountRange checks the Merkle range proof of an account range response
+// against the requested root, returning whether more accounts are available.
+func verifyAccountRange(req *accountRequest, hashes []common.Hash, accounts [][]byte, proof [][]byte) (bool, error) {
+	if len(hashes) != len(accounts) {
+		return false, fmt.Errorf("account count mismatch: %d hashes, %d accounts", len(hashes), len(accounts))
+	}
+	keys := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	var end []byte
+	if len(keys) > 0 {
+		end = keys[len(keys)-1]
+	}
+	return trie.VerifyRangeProof(req.root, req.origin[:], end, keys, accounts, proofSet(proof))
+}
+
+// processAccountResponse persists a verified account range into the flat state
+// and schedules the storage and bytecodes referenced by it. The lock is assumed
+// to be held.
+func (s *Syncer) processAccountResponse(req *accountRequest, hashes []common.Hash, accounts [][]byte, cont bool) {
+	// If the task was reverted meanwhile (sync cycle ended), discard the data
+	task := req.task
+	if task.req != req {
+		return
+	}
+	task.req = nil
+
+	// Drop any accounts beyond the task's interval, those are the next task's
+	// concern. Getting any means this interval is fully covered.
+	n := len(hashes)
+	for n > 0 && bytes.Compare(hashes[n-1][:], task.Last[:]) > 0 {
+		n, cont = n-1, false
+	}
+	end := task.Last
+	if cont {
+		end = hashes[n-1]
+	}
+	// Wipe any stale accounts from the covered interval and persist the new ones
+	batch := s.db.NewBatch()
+	deleteRange(s.db, batch, rawdb.SnapshotAccountPrefix, task.Next, end)
+
+	for i := 0; i < n; i++ {
+		account, err := snapshot.FullAccount(accounts[i])
+		if err != nil {
+			// The account is proven by the state root, a decoding failure
+			// can only happen if the root itself holds garbage
+			s.failure = fmt.Errorf("invalid account %x: %v", hashes[i], err)
+			return
+		}
+		blob := snapshot.AccountRLP(account.Nonce, account.Balance, common.BytesToHash(account.Root), account.CodeHash)
+		rawdb.WriteAccountSnapshot(batch, hashes[i], blob)
+
+		if root := common.BytesToHash(account.Root); root != emptyRoot {
+			s.storage = append(s.storage, &storageTask{
+				Account: hashes[i],
+				Root:    root,
+			})
+		}
+		if code := common.BytesToHash(account.CodeHash); code != emptyCode {
+			if ok, _ := s.db.Has(code[:]); !ok {
+				s.codes[code] = struct{}{}
+			}
+		}
+		s.accountSynced++
+		s.accountBytes += common.StorageSize(common.HashLength + len(blob))
+	}
+	if err := batch.Write(); err != nil {
+		s.failure = err
+		return
+	}
+	// Advance the task, or drop it if the interval was completed
+	if cont {
+		task.Next = incHash(hashes[n-1])
+		return
+	}
+	for i, t := range s.tasks {
+		if t == task {
+			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+			break
+		}
+	}
+}
+
+// OnStorage is a callback method to invoke when ranges of storage slots
+// are received from a remote peer.
+func (s *Syncer) OnStorage(peer *Peer, id uint64, hashes [][]common.Hash, slots [][][]byte, proof [][]byte) error {
+	s.lock.Lock()
+	req, ok := s.storageReqs[id]
+	if !ok || req.peer != peer.ID() {
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected storage ranges packet", "reqid", id)
+		return nil
+	}
+	// Clean up the request and reschedule any tasks not delivered upon
+	delete(s.storageReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+
+	if len(hashes) != len(slots) || len(hashes) > len(req.tasks) {
+		s.revertStorageRequest(req)
+		s.lock.Unlock()
+		s.notify()
+		return fmt.Errorf("storage ranges mismatch: %d hashsets, %d slotsets, %d requested", len(hashes), len(slots), len(req.tasks))
+	}
+	if len(hashes) < len(req.tasks) {
+		s.storage = append(append([]*storageTask{}, req.tasks[len(hashes):]...), s.storage...)
+	}
+	s.lock.Unlock()
+
+	defer s.notify()
+
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data.
+	var delivered int
+	for _, hashset := range hashes {
+		delivered += len(hashset)
+	}
+	if delivered == 0 && len(proof) == 0 {
+		peer.Log().Debug("Peer rejected storage request")
+
+		s.lock.Lock()
+		s.stateless[req.peer] = struct{}{}
+		s.storage = append(append([]*storageTask{}, req.tasks[:len(hashes)]...), s.storage...)
+		s.lock.Unlock()
+		return nil
+	}
+	// Verify each delivered storage range against the account's storage root.
+	// A failure is not necessarily malicious: if the pivot moved since the
+	// account was downloaded, the peer serves the slots of the new storage
+	// root. Such tries are left for the healer to fix up.
+	var (
+		conts    = make([]bool, len(hashes))
+		outdated = make([]bool, len(hashes))
+	)
+	for i, hashset := range hashes {
+		task := req.tasks[i]
+
+		keys := make([][]byte, len(hashset))
+		for j, hash := range hashset {
+			keys[j] = common.CopyBytes(hash[:])
+		}
+		var err error
+		if i == len(hashes)-1 && len(proof) > 0 {
+			end := task.Next[:]
+			if len(keys) > 0 {
+				end = keys[len(keys)-1]
+			}
+			conts[i], err = trie.VerifyRangeProof(task.Root, task.Next[:], end, keys, slots[i], proofSet(proof))
+		} else {
+			_, err = trie.VerifyRangeProof(task.Root, nil, nil, keys, slots[i], nil)
+		}
+		if err == nil && conts[i] && len(keys) == 0 {
+			err = errors.New("empty continued storage range")
+		}
+		if err != nil {
+			peer.Log().Debug("Storage range failed proof, leaving to healer", "account", task.Account, "root", task.Root, "err", err)
+			outdated[i] = true
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var requeue []*storageTask
+	batch := s.db.NewBatch()
+	for i, hashset := range hashes {
+		task := req.tasks[i]
+		if outdated[i] {
+			s.healing = append(s.healing, task.Root)
+			s.storageSkipped++
+			continue
+		}
+		end := maxHash
+		if conts[i] {
+			end = hashset[len(hashset)-1]
+		}
+		prefix := append(append([]byte{}, rawdb.SnapshotStoragePrefix...), task.Account[:]...)
+		deleteRange(s.db, batch, prefix, task.Next, end)
+
+		for j, hash := range hashset {
+			rawdb.WriteStorageSnapshot(batch, task.Account, hash, slots[i][j])
+
+			s.storageSynced++
+			s.storageBytes += common.StorageSize(2*common.HashLength + len(slots[i][j]))
+		}
+		if conts[i] {
+			task.Next = incHash(end)
+			requeue = append(requeue, task)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		s.failure = err
+		return nil
+	}
+	if len(requeue) > 0 {
+		s.storage = append(requeue, s.storage...)
+	}
+	return nil
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract
+// bytes codes are received from a remote peer.
+func (s *Syncer) OnByteCodes(peer *Peer, id uint64, codes [][]byte) error {
+	s.lock.Lock()
+	req, ok := s.bytecodeReqs[id]
+	if !ok || req.peer != peer.ID() {
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected bytecode packet", "reqid", id)
+		return nil
+	}
+	delete(s.bytecodeReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+	s.lock.Unlock()
+
+	defer s.notify()
+
+	// Cross reference the requested bytecodes with the response to find gaps
+	// that the serving node is missing
+	requested := make(map[common.Hash]struct{}, len(req.hashes))
+	for _, hash := range req.hashes {
+		requested[hash] = struct{}{}
+	}
+	delivered := make(map[common.Hash][]byte, len(codes))
+	for _, code := range codes {
+		hash := crypto.Keccak256Hash(code)
+		if _, ok := requested[hash]; !ok {
+			s.lock.Lock()
+			s.revertBytecodeRequest(req)
+			s.lock.Unlock()
+			return fmt.Errorf("unrequested bytecode %x", hash)
+		}
+		delivered[hash] = code
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data.
+	if len(delivered) == 0 {
+		peer.Log().Debug("Peer rejected bytecode request")
+		s.stateless[req.peer] = struct{}{}
+		s.revertBytecodeRequest(req)
+		return nil
+	}
+	batch := s.db.NewBatch()
+	for _, hash := range req.hashes {
+		code, ok := delivered[hash]
+		if !ok {
+			s.codes[hash] = struct{}{}
+			continue
+		}
+		batch.Put(hash[:], code)
+		if s.bloom != nil {
+			s.bloom.Add(hash[:])
+		}
+		s.bytecodeSynced++
+		s.bytecodeBytes += common.StorageSize(len(code))
+	}
+	if err := batch.Write(); err != nil {
+		s.failure = err
+	}
+	return nil
+}
+
+// OnTrieNodes is a callback method to invoke when a batch of trie nodes
+// are received from a remote peer.
+func (s *Syncer) OnTrieNodes(peer *Peer, id uint64, nodes [][]byte) error {
+	s.lock.Lock()
+	req, ok := s.trienodeHealReqs[id]
+	if !ok || req.peer != peer.ID() {
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected trienode heal packet", "reqid", id)
+		return nil
+	}
+	delete(s.trienodeHealReqs, id)
+	req.timeout.Stop()
+	s.markIdle(req.peer)
+	s.lock.Unlock()
+
+	defer s.notify()
+
+	// Cross reference the requested trie nodes with the response to find gaps
+	// that the serving node is missing
+	requested := make(map[common.Hash]struct{}, len(req.hashes))
+	for _, hash := range req.hashes {
+		requested[hash] = struct{}{}
+	}
+	results := make([]trie.SyncResult, 0, len(nodes))
+	for _, node := range nodes {
+		hash := crypto.Keccak256Hash(node)
+		if _, ok := requested[hash]; !ok {
+			s.lock.Lock()
+			s.revertTrienodeHealRequest(req)
+			s.lock.Unlock()
+			return fmt.Errorf("unrequested trie node %x", hash)
+		}
+		delete(requested, hash)
+		results = append(results, trie.SyncResult{Hash: hash, Data: node})
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// If the healer was replaced meanwhile (sync cycle ended), discard the data
+	if req.sched != s.healer {
+		return nil
+	}
+	// Response is valid, but check if peer is signalling that it does not have
+	// the requested data.
+	if len(results) == 0 {
+		peer.Log().Debug("Peer rejected trienode heal request")
+		s.stateless[req.peer] = struct{}{}
+		s.healQueue = append(s.healQueue, req.hashes...)
+		return nil
+	}
+	for _, result := range results {
+		if _, _, err := s.healer.Process([]trie.SyncResult{result}); err != nil {
+			if err == trie.ErrNotRequested || err == trie.ErrAlreadyProcessed {
+				continue
+			}
+			s.failure = fmt.Errorf("invalid trie node %x: %v", result.Hash, err)
+			return nil
+		}
+		s.trienodeSynced++
+		s.trienodeBytes += common.StorageSize(len(result.Data))
+	}
+	for hash := range requested {
+		s.healQueue = append(s.healQueue, hash)
+	}
+	if err := s.commitHeal(false); err != nil {
+		s.failure = err
+	}
+	return nil
+}
+
+// commitHeal moves the healed nodes from the scheduler into the database batch,
+// flushing it if it grew large enough or if forced. The lock is assumed to be
+// held.
+func (s *Syncer) commitHeal(force bool) error {
+	if err := s.healer.Commit(s.healBatch); err != nil {
+		return err
+	}
+	if !force && s.healBatch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	if err := s.healBatch.Write(); err != nil {
+		return err
+	}
+	s.healBatch.Reset()
+	return nil
+}
+
+// rebuildTries regenerates the account and storage tries from the downloaded
+// flat state, writing all the nodes into the database. The resulting tries are
+// only as consistent as the downloaded ranges, the healer fixes them up after.
+func (s *Syncer) rebuildTries(cancel chan struct{}) error {
+	var (
+		start    = time.Now()
+		logged   = time.Now()
+		triedb   = trie.NewDatabase(&bloomedStore{KeyValueStore: s.db, bloom: s.bloom})
+		accounts = newTrieBuilder(triedb)
+		count    int
+	)
+	log.Info("Rebuilding state tries from snapshot ranges")
+
+	it := s.db.NewIteratorWithPrefix(rawdb.SnapshotAccountPrefix)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(rawdb.SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(key[len(rawdb.SnapshotAccountPrefix):])
+
+		account, err := snapshot.FullAccount(it.Value())
+		if err != nil {
+			return err
+		}
+		// Rebuild the storage trie first, it needs to be available by the time
+		// the account trie references it
+		if root := common.BytesToHash(account.Root); root != emptyRoot {
+			if err := s.rebuildStorageTrie(triedb, hash); err != nil {
+				return err
+			}
+		}
+		blob, err := rlpAccount(account)
+		if err != nil {
+			return err
+		}
+		if err := accounts.add(hash[:], blob); err != nil {
+			return err
+		}
+		count++
+
+		if count%1000 == 0 {
+			select {
+			case <-cancel:
+				return ErrCancelled
+			default:
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Rebuilding state tries", "accounts", count, "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	root, err := accounts.commit()
+	if err != nil {
+		return err
+	}
+	log.Info("Rebuilt state tries", "accounts", count, "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// rebuildStorageTrie regenerates the storage trie of a single account from the
+// downloaded flat storage slots.
+func (s *Syncer) rebuildStorageTrie(triedb *trie.Database, account common.Hash) error {
+	builder := newTrieBuilder(triedb)
+
+	it := rawdb.IterateStorageSnapshots(s.db, account)
+	defer it.Release()
+
+	prefix := len(rawdb.SnapshotStoragePrefix) + common.HashLength
+	for it.Next() {
+		key := it.Key()
+		if len(key) != prefix+common.HashLength {
+			continue
+		}
+		if err := builder.add(key[prefix:], it.Value()); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	_, err := builder.commit()
+	return err
+}
+
+// reportSyncProgress calculates various status reports and provides it to the
+// user. The lock is assumed to be held.
+func (s *Syncer) reportSyncProgress(force bool) {
+	if !force && time.Since(s.logTime) < 8*time.Second {
+		return
+	}
+	s.logTime = time.Now()
+
+	log.Info("State sync in progress", "accounts", fmt.Sprintf("%d@%v", s.accountSynced, s.accountBytes),
+		"slots", fmt.Sprintf("%d@%v", s.storageSynced, s.storageBytes), "skipped", s.storageSkipped,
+		"codes", fmt.Sprintf("%d@%v", s.bytecodeSynced, s.bytecodeBytes),
+		"nodes", fmt.Sprintf("%d@%v", s.trienodeSynced, s.trienodeBytes),
+		"ranges", len(s.tasks), "pending", len(s.storage)+len(s.codes)+len(s.healQueue))
+}
+
+// deleteRange removes the flat snapshot entries with the given prefix whose keys
+// fall into the [from, to] interval, wiping any stale data left behind by an
+// earlier sync cycle or a previous snapshot generation.
+func deleteRange(db ethdb.Iteratee, batch ethdb.Batch, prefix []byte, from, to common.Hash) {
+	it := db.NewIteratorWithStart(append(common.CopyBytes(prefix), from[:]...))
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		if len(key) != len(prefix)+common.HashLength {
+			continue
+		}
+		if bytes.Compare(key[len(prefix):], to[:]) > 0 {
+			break
+		}
+		batch.Delete(common.CopyBytes(key))
+	}
+}
+
+// proofSet converts a list of trie nodes into a set usable for range proofs.
+func proofSet(proof [][]byte) ethdb.KeyValueReader {
+	nodes := make(light.NodeList, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes.NodeSet()
+}
+
+// incHash returns the next hash, in lexicographical order (a.k.a plus one).
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,337 @@
+// Copyright 2021 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state/snapshot"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/light"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/p2p"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/p2p/enode"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
+)
+
+// testServer serves snap requests straight from a source state, capping the
+// number of leaves per response to exercise the range continuations.
+type testServer struct {
+	db     ethdb.Database
+	triedb *trie.Database
+	root   common.Hash
+
+	maxLeaves int         // Maximum number of accounts or slots per response
+	corrupt   common.Hash // Account whose storage is served without its last slot
+}
+
+// makeTestState creates a state with the given number of accounts, every third
+// of them a contract with a few storage slots and bytecode. The last account is
+// a large contract needing several storage range requests.
+func makeTestState(t *testing.T, accounts int) (ethdb.Database, common.Hash, []common.Address) {
+	db := rawdb.NewMemoryDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db), nil)
+
+	var addrs []common.Address
+	for i := 0; i < accounts; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		addrs = append(addrs, addr)
+
+		statedb.SetBalance(addr, big.NewInt(int64(1000*i+1)))
+		statedb.SetNonce(addr, uint64(i))
+		if i%3 == 0 {
+			statedb.SetCode(addr, []byte{byte(i), byte(i >> 8), 0x60, 0x00})
+
+			slots := 3
+			if i == accounts-1 {
+				slots = 100
+			}
+			for j := 0; j < slots; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i*1000+j+1))))
+			}
+		}
+	}
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	return db, root, addrs
+}
+
+// run serves the requests arriving on the pipe until it's closed, delivering
+// the responses straight into the syncer.
+func (srv *testServer) run(t *testing.T, syncer *Syncer, peer *Peer, rw p2p.MsgReadWriter) {
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return
+		}
+		switch msg.Code {
+		case GetAccountRangeMsg:
+			var req GetAccountRangePacket
+			if err := msg.Decode(&req); err != nil {
+				t.Errorf("failed to decode account request: %v", err)
+				return
+			}
+			hashes, accounts, proof := srv.accountRange(t, &req)
+			if err := syncer.OnAccounts(peer, req.ID, hashes, accounts, proof); err != nil {
+				t.Errorf("failed to deliver accounts: %v", err)
+			}
+
+		case GetStorageRangesMsg:
+			var req GetStorageRangesPacket
+			if err := msg.Decode(&req); err != nil {
+				t.Errorf("failed to decode storage request: %v", err)
+				return
+			}
+			hashes, slots, proof := srv.storageRanges(t, &req)
+			if err := syncer.OnStorage(peer, req.ID, hashes, slots, proof); err != nil {
+				t.Errorf("failed to deliver storage: %v", err)
+			}
+
+		case GetByteCodesMsg:
+			var req GetByteCodesPacket
+			if err := msg.Decode(&req); err != nil {
+				t.Errorf("failed to decode bytecode request: %v", err)
+				return
+			}
+			var codes [][]byte
+			for _, hash := range req.Hashes {
+				if code, err := srv.db.Get(hash[:]); err == nil {
+					codes = append(codes, code)
+				}
+			}
+			if err := syncer.OnByteCodes(peer, req.ID, codes); err != nil {
+				t.Errorf("failed to deliver bytecodes: %v", err)
+			}
+
+		case GetTrieNodesMsg:
+			var req GetTrieNodesPacket
+			if err := msg.Decode(&req); err != nil {
+				t.Errorf("failed to decode trie node request: %v", err)
+				return
+			}
+			var nodes [][]byte
+			for _, hash := range req.Hashes {
+				if node, err := srv.triedb.Node(hash); err == nil {
+					nodes = append(nodes, node)
+				}
+			}
+			if err := syncer.OnTrieNodes(peer, req.ID, nodes); err != nil {
+				t.Errorf("failed to deliver trie nodes: %v", err)
+			}
+
+		default:
+			t.Errorf("unexpected message code %d", msg.Code)
+		}
+		msg.Discard()
+	}
+}
+
+// accountRange collects at most maxLeaves accounts from the requested origin,
+// proving the boundaries of the returned range.
+func (srv *testServer) accountRange(t *testing.T, req *GetAccountRangePacket) ([]common.Hash, [][]byte, [][]byte) {
+	tr, err := trie.New(req.Root, srv.triedb)
+	if err != nil {
+		t.Fatalf("failed to open account trie: %v", err)
+	}
+	var (
+		hashes   []common.Hash
+		accounts [][]byte
+	)
+	it := trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	for it.Next() && len(hashes) < srv.maxLeaves {
+		hash := common.BytesToHash(it.Key)
+		hashes = append(hashes, hash)
+		accounts = append(accounts, common.CopyBytes(it.Value))
+		if bytes.Compare(hash[:], req.Limit[:]) >= 0 {
+			break
+		}
+	}
+	return hashes, accounts, srv.prove(t, tr, req.Origin[:], hashes)
+}
+
+// storageRanges collects the storage slots of the requested accounts, until the
+// maxLeaves limit is hit in the middle of a contract.
+func (srv *testServer) storageRanges(t *testing.T, req *GetStorageRangesPacket) ([][]common.Hash, [][][]byte, [][]byte) {
+	accTrie, err := trie.New(req.Root, srv.triedb)
+	if err != nil {
+		t.Fatalf("failed to open account trie: %v", err)
+	}
+	var (
+		hashset [][]common.Hash
+		slotset [][][]byte
+		served  int
+	)
+	for i, account := range req.Accounts {
+		blob, err := accTrie.TryGet(account[:])
+		if err != nil || blob == nil {
+			t.Fatalf("failed to retrieve account %x: %v", account, err)
+		}
+		acc, err := snapshot.FullAccount(blob)
+		if err != nil {
+			t.Fatalf("failed to decode account %x: %v", account, err)
+		}
+		stTrie, err := trie.New(common.BytesToHash(acc.Root), srv.triedb)
+		if err != nil {
+			t.Fatalf("failed to open storage trie: %v", err)
+		}
+		var origin []byte
+		if i == 0 && len(req.Origin) > 0 {
+			origin = req.Origin
+		}
+		var (
+			hashes    []common.Hash
+			slots     [][]byte
+			truncated bool
+		)
+		it := trie.NewIterator(stTrie.NodeIterator(origin))
+		for it.Next() {
+			if served >= srv.maxLeaves {
+				truncated = true
+				break
+			}
+			hashes = append(hashes, common.BytesToHash(it.Key))
+			slots = append(slots, common.CopyBytes(it.Value))
+			served++
+		}
+		if account == srv.corrupt && len(hashes) > 0 {
+			hashes, slots = hashes[:len(hashes)-1], slots[:len(slots)-1]
+		}
+		hashset = append(hashset, hashes)
+		slotset = append(slotset, slots)
+
+		if truncated || origin != nil {
+			if origin == nil {
+				origin = common.Hash{}.Bytes()
+			}
+			return hashset, slotset, srv.prove(t, stTrie, origin, hashes)
+		}
+	}
+	return hashset, slotset, nil
+}
+
+// prove creates a Merkle proof of the origin and the last returned leaf.
+func (srv *testServer) prove(t *testing.T, tr *trie.Trie, origin []byte, hashes []common.Hash) [][]byte {
+	proof := light.NewNodeSet()
+	if err := tr.Prove(origin, 0, proof); err != nil {
+		t.Fatalf("failed to prove origin: %v", err)
+	}
+	if len(hashes) > 0 {
+		if err := tr.Prove(hashes[len(hashes)-1][:], 0, proof); err != nil {
+			t.Fatalf("failed to prove last leaf: %v", err)
+		}
+	}
+	var nodes [][]byte
+	for _, node := range proof.NodeList() {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// testSync runs a snap sync against the given server and checks that the full
+// state, including storage and bytecodes, is available locally afterwards.
+func testSync(t *testing.T, srv *testServer) *Syncer {
+	db := rawdb.NewMemoryDatabase()
+	bloom := trie.NewSyncBloom(1, db)
+	defer bloom.Close()
+
+	syncer := NewSyncer(db, bloom)
+
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+
+	peer := newPeer(snap1, p2p.NewPeer(enode.ID{1}, "test", nil), local)
+	go srv.run(t, syncer, peer, remote)
+	if err := syncer.Register(peer); err != nil {
+		t.Fatalf("failed to register peer: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- syncer.Sync(srv.root, make(chan struct{})) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("sync timed out")
+	}
+	// Every node and bytecode of the source state must be present locally
+	src, err := state.New(srv.root, state.NewDatabase(srv.db), nil)
+	if err != nil {
+		t.Fatalf("failed to open source state: %v", err)
+	}
+	for it := state.NewNodeIterator(src); it.Next(); {
+		if it.Hash == (common.Hash{}) {
+			continue
+		}
+		if ok, _ := db.Has(it.Hash[:]); !ok {
+			t.Errorf("state entry %x missing after sync", it.Hash)
+		}
+	}
+	if status := rawdb.ReadSnapshotSyncStatus(db); status != nil {
+		t.Errorf("sync status not cleaned up after completion: %s", status)
+	}
+	return syncer
+}
+
+// Tests that a state can be synced over snap, with the account and storage
+// ranges split up into multiple proven chunks.
+func TestSync(t *testing.T) {
+	db, root, addrs := makeTestState(t, 150)
+	syncer := testSync(t, &testServer{
+		db:        db,
+		triedb:    trie.NewDatabase(db),
+		root:      root,
+		maxLeaves: 16,
+	})
+	if syncer.accountSynced != uint64(len(addrs)) {
+		t.Errorf("synced account count mismatch: have %d, want %d", syncer.accountSynced, len(addrs))
+	}
+	if syncer.storageSkipped != 0 {
+		t.Errorf("storage tries skipped: %d", syncer.storageSkipped)
+	}
+}
+
+// Tests that storage ranges failing their proofs are left to the healer, which
+// retrieves the missing storage trie node by node.
+func TestSyncWithHealing(t *testing.T) {
+	db, root, addrs := makeTestState(t, 150)
+	syncer := testSync(t, &testServer{
+		db:        db,
+		triedb:    trie.NewDatabase(db),
+		root:      root,
+		maxLeaves: 1024,
+		corrupt:   crypto.Keccak256Hash(addrs[3][:]),
+	})
+	if syncer.storageSkipped != 1 {
+		t.Errorf("skipped storage count mismatch: have %d, want 1", syncer.storageSkipped)
+	}
+	if syncer.trienodeSynced == 0 {
+		t.Errorf("no trie nodes healed")
+	}
+}
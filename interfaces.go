@@ -117,6 +117,8 @@ type CallMsg struct {
 	To         *common.Address // the destination contract (nil for contract creation)
 	Gas        uint64          // if 0, the call executes with near-infinite gas
 	GasPrice   *big.Int        // wei <-> gas exchange ratio
+	GasFeeCap  *big.Int        // EIP-1559 fee cap per gas.
+	GasTipCap  *big.Int        // EIP-1559 tip per gas.
 	Value      *big.Int        // amount of wei sent along with the call
 	Data       []byte          // input data, usually an ABI-encoded contract method invocation
 	AccessList types.AccessList
@@ -37,8 +37,10 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/math"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/clique"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/ethash"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/consensus/misc"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/state"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/vm"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
@@ -47,6 +49,7 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/p2p"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/pledgeBill"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/smallcrosstx"
@@ -77,6 +80,39 @@ func (s *PublicEthereumAPI) GasPrice(ctx context.Context) (*hexutil.Big, error)
 	return (*hexutil.Big)(price), err
 }
 
+// MaxPriorityFeePerGas returns a suggestion for a gas tip cap for dynamic fee transactions.
+func (s *PublicEthereumAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, error) {
+	tip, err := suggestGasTipCap(ctx, s.b)
+	return (*hexutil.Big)(tip), err
+}
+
+// pendingBaseFee returns the base fee of the block following the current head,
+// or nil if the EIP-1559 fee market is not live by then.
+func pendingBaseFee(b Backend) *big.Int {
+	head := b.CurrentBlock().Header()
+	if !b.ChainConfig().IsEIP1559(new(big.Int).Add(head.Number, common.Big1)) {
+		return nil
+	}
+	return misc.CalcBaseFee(b.ChainConfig(), head)
+}
+
+// suggestGasTipCap derives the tip to offer from the suggested gas price: the
+// part of it exceeding the base fee of the pending block.
+func suggestGasTipCap(ctx context.Context, b Backend) (*big.Int, error) {
+	price, err := b.SuggestPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tip := new(big.Int).Set(price)
+	if baseFee := pendingBaseFee(b); baseFee != nil {
+		tip.Sub(tip, baseFee)
+		if tip.Sign() < 0 {
+			tip.SetUint64(0)
+		}
+	}
+	return tip, nil
+}
+
 // ProtocolVersion returns the current Ethereum protocol version this node supports
 func (s *PublicEthereumAPI) ProtocolVersion() hexutil.Uint {
 	return hexutil.Uint(s.b.ProtocolVersion())
@@ -395,8 +431,8 @@ func (s *PrivateAccountAPI) SignTransaction(ctx context.Context, args SendTxArgs
 	if args.Gas == nil {
 		return nil, fmt.Errorf("gas not specified")
 	}
-	if args.GasPrice == nil {
-		return nil, fmt.Errorf("gasPrice not specified")
+	if args.GasPrice == nil && (args.MaxFeePerGas == nil || args.MaxPriorityFeePerGas == nil) {
+		return nil, fmt.Errorf("missing gasPrice or maxFeePerGas/maxPriorityFeePerGas")
 	}
 	if args.Nonce == nil {
 		return nil, fmt.Errorf("nonce not specified")
@@ -406,7 +442,7 @@ func (s *PrivateAccountAPI) SignTransaction(ctx context.Context, args SendTxArgs
 		log.Warn("Failed transaction sign attempt", "from", args.From, "to", args.To, "value", args.Value.ToInt(), "err", err)
 		return nil, err
 	}
-	data, err := rlp.EncodeToBytes(signed)
+	data, err := signed.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -765,8 +801,8 @@ func (s *PublicBlockChainAPI) ReceivedSmallCrossTx(ctx context.Context, signatur
 	if err != nil {
 		return err
 	}
-	height := uint64(s.BlockNumber())
-	err = smallcrosstx.OnSmallCrossTx(arbiters, total, signature, rawTx, height)
+	block := s.b.CurrentBlock()
+	err = smallcrosstx.OnSmallCrossTx(arbiters, total, block.Nonce(), signature, rawTx, block.NumberU64())
 	if err != nil {
 		log.Error("ReceivedSmallCrossTx OnSmallCrossTx error", "msg", err.Error())
 		return nil
@@ -791,6 +827,117 @@ func (s *PublicBlockChainAPI) GetFailedRechargeTxByHash(ctx context.Context, has
 	return txid, nil
 }
 
+// RPCRechargeTransition is a recharge state change as returned over RPC.
+type RPCRechargeTransition struct {
+	State     string         `json:"state"`
+	Time      hexutil.Uint64 `json:"time"`
+	EscTxHash *common.Hash   `json:"escTxHash,omitempty"`
+}
+
+// RPCRechargeStatus is the lifecycle of an ELA to ESC recharge as returned
+// over RPC.
+type RPCRechargeStatus struct {
+	ElaTxHash string                  `json:"elaTxHash"`
+	State     string                  `json:"state"`
+	EscTxHash *common.Hash            `json:"escTxHash"`
+	Retries   hexutil.Uint            `json:"retries"`
+	Sequence  hexutil.Uint64          `json:"sequence"`
+	History   []RPCRechargeTransition `json:"history"`
+}
+
+// RechargeListArgs selects a page of recharges for ListRecharges.
+type RechargeListArgs struct {
+	States []string        `json:"states"`
+	From   *hexutil.Uint64 `json:"from"`
+	Count  *hexutil.Uint64 `json:"count"`
+}
+
+func newRPCRechargeStatus(status *spv.RechargeStatus) *RPCRechargeStatus {
+	result := &RPCRechargeStatus{
+		ElaTxHash: "0x" + status.ElaTxHash,
+		State:     status.State.String(),
+		Retries:   hexutil.Uint(status.Retries),
+		Sequence:  hexutil.Uint64(status.Sequence),
+		History:   make([]RPCRechargeTransition, 0, len(status.History)),
+	}
+	if status.EscTxHash != (common.Hash{}) {
+		hash := status.EscTxHash
+		result.EscTxHash = &hash
+	}
+	for _, transition := range status.History {
+		t := RPCRechargeTransition{State: transition.State.String(), Time: hexutil.Uint64(transition.Time)}
+		if transition.EscTxHash != (common.Hash{}) {
+			hash := transition.EscTxHash
+			t.EscTxHash = &hash
+		}
+		result.History = append(result.History, t)
+	}
+	return result
+}
+
+// GetRechargeStatus returns the lifecycle of the recharge made by the given
+// main chain transaction. A recharge packed before this node tracked it is
+// reported packed from the black contract state. It returns nil if the
+// recharge is unknown.
+func (s *PublicBlockChainAPI) GetRechargeStatus(ctx context.Context, elaTxHash string) (*RPCRechargeStatus, error) {
+	status, err := spv.GetRechargeStatus(elaTxHash)
+	if err != nil {
+		return nil, err
+	}
+	var result *RPCRechargeStatus
+	if status != nil {
+		result = newRPCRechargeStatus(status)
+	}
+	if status == nil || status.State != spv.RechargePacked {
+		state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if state == nil || err != nil {
+			return nil, err
+		}
+		if escTx := state.GetState(common.Address{}, common.HexToHash(elaTxHash)); escTx != (common.Hash{}) {
+			if result == nil {
+				result = &RPCRechargeStatus{
+					ElaTxHash: "0x" + strings.ToLower(strings.TrimPrefix(elaTxHash, "0x")),
+					History:   []RPCRechargeTransition{},
+				}
+			}
+			result.State = spv.RechargePacked.String()
+			result.EscTxHash = &escTx
+		}
+	}
+	return result, nil
+}
+
+// ListRecharges returns a page of the recharges tracked by this node in
+// detection order, together with the sequence number of the next page.
+func (s *PublicBlockChainAPI) ListRecharges(ctx context.Context, args RechargeListArgs) (map[string]interface{}, error) {
+	var filter spv.RechargeFilter
+	for _, name := range args.States {
+		state, err := spv.ParseRechargeState(name)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %s", err, name)
+		}
+		filter.States = append(filter.States, state)
+	}
+	if args.From != nil {
+		filter.From = uint64(*args.From)
+	}
+	if args.Count != nil {
+		filter.Count = uint64(*args.Count)
+	}
+	list, next, err := spv.ListRecharges(filter)
+	if err != nil {
+		return nil, err
+	}
+	recharges := make([]*RPCRechargeStatus, 0, len(list))
+	for _, status := range list {
+		recharges = append(recharges, newRPCRechargeStatus(status))
+	}
+	return map[string]interface{}{
+		"recharges": recharges,
+		"next":      hexutil.Uint64(next),
+	}, nil
+}
+
 // GetTransactionFeeDetails returns the transaction fee detail info for the given transaction hash.
 func (s *PublicBlockChainAPI) GetTransactionFeeDetails(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, _, index := rawdb.ReadTransaction(s.b.ChainDb(), hash)
@@ -809,7 +956,7 @@ func (s *PublicBlockChainAPI) GetTransactionFeeDetails(ctx context.Context, hash
 	minerFee := big.NewInt(0).Mul(tx.GasPrice(), big.NewInt(0).SetUint64(gasUsed))
 	crossFee := big.NewInt(0)
 	for _, l := range receipt.Logs {
-		if l.Topics[0].String() == "0x09f15c376272c265d7fcb47bf57d8f84a928195e6ea156d12f5a3cd05b8fed5a" {
+		if l.Topics[0] == spv.RechargeEventTopic {
 			elaHash := l.Topics[2].String()
 			crossFee, _, _ = spv.FindOutputFeeAndaddressByTxHash(elaHash)
 			break
@@ -834,6 +981,30 @@ func (s *PublicBlockChainAPI) GetTransactionFeeDetails(ctx context.Context, hash
 	return fields, nil
 }
 
+// GetDeveloperFeeSplit returns the share of the transaction fees paid to the
+// developer fee recipients in the given block.
+func (s *PublicBlockChainAPI) GetDeveloperFeeSplit(ctx context.Context, number rpc.BlockNumber) (map[string]interface{}, error) {
+	header, err := s.b.HeaderByNumber(ctx, number)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{
+		"number":     (*hexutil.Big)(header.Number),
+		"active":     false,
+		"ratio":      hexutil.Uint64(0),
+		"recipients": []common.Address{},
+	}
+	if split := s.b.ChainConfig().DeveloperFeeSplitAt(header.Number, header.Time); split != nil {
+		fields["active"] = true
+		fields["ratio"] = hexutil.Uint64(split.Ratio)
+		fields["recipients"] = split.Recipients
+		if split.Block != nil {
+			fields["activationBlock"] = (*hexutil.Big)(split.Block)
+		}
+	}
+	return fields, nil
+}
+
 func (s *PublicBlockChainAPI) SendInvalidWithdrawTransaction(ctx context.Context, signature string, hash string) error {
 	txid := common.HexToHash(hash)
 	tx, _, _, _, err := s.b.GetTransaction(ctx, txid)
@@ -851,29 +1022,226 @@ func (s *PublicBlockChainAPI) SendInvalidWithdrawTransaction(ctx context.Context
 	return err
 }
 
-func (s *PublicBlockChainAPI) GetFrozenAccounts(ctx context.Context) ([]string, error) {
-	list := s.b.ChainConfig().FrozeAccountList
+// GetWithdrawRefundStatus returns the refund state of a failed withdraw
+// transaction: its value, the arbiters who signed the refund on this node,
+// the signatures required, and the refund transaction.
+func (s *PublicBlockChainAPI) GetWithdrawRefundStatus(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	tx, blockHash, _, index, err := s.b.GetTransaction(ctx, hash)
+	if tx == nil || err != nil {
+		return nil, fmt.Errorf("not found withdraw tx, txid:%s", hash.String())
+	}
+	if tx.To() == nil || tx.To().String() != s.b.ChainConfig().BlackContractAddr {
+		return nil, fmt.Errorf("is not withdraw tx, txid:%s", hash.String())
+	}
+	receipts, err := s.b.GetReceipts(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(receipts) <= int(index) {
+		return nil, fmt.Errorf("receipt of withdraw tx not found, txid:%s", hash.String())
+	}
+	sender, value, err := withdrawfailedtx.GetWithdrawValueFromLogs(receipts[index].Logs)
+	if err != nil {
+		return nil, err
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{
+		"txid":      hash,
+		"sender":    sender,
+		"value":     (*hexutil.Big)(value),
+		"signers":   []string{},
+		"threshold": hexutil.Uint64(0),
+		"refundTx":  nil,
+		"executed":  false,
+		"completed": false,
+	}
+	total := 0
+	if refund := withdrawfailedtx.GetPendingRefund(hash.String()); refund != nil {
+		fields["signers"] = refund.Signers
+		fields["executed"] = refund.Executed
+		if refund.RefundTx != (common.Hash{}) {
+			fields["refundTx"] = refund.RefundTx
+		}
+		total = int(refund.Total)
+	}
+	if _, count, err := spv.GetArbiters(); err == nil {
+		total = count
+	}
+	if total > 0 {
+		fields["threshold"] = hexutil.Uint64(withdrawfailedtx.GetMaxArbitersSign(total))
+	}
+	// The black address stores the refund transaction of completed refunds
+	if refundTx := state.GetState(common.Address{}, hash); refundTx != (common.Hash{}) {
+		fields["completed"] = true
+		fields["refundTx"] = refundTx
+	}
+	return fields, nil
+}
+
+// GetPendingWithdrawRefunds returns a page of the refunds of failed withdraw
+// transactions this node collects signatures for, oldest first, with the
+// number of refunds pending. At most 100 refunds are returned.
+func (s *PublicBlockChainAPI) GetPendingWithdrawRefunds(ctx context.Context, offset uint64, count *uint64) (map[string]interface{}, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	var limit uint64
+	if count != nil {
+		limit = *count
+	}
+	refunds, total := withdrawfailedtx.ListPendingRefunds(offset, limit, func(txid string) bool {
+		return state.GetState(common.Address{}, common.HexToHash(txid)) != (common.Hash{})
+	})
+	return map[string]interface{}{
+		"total":   hexutil.Uint64(total),
+		"refunds": refunds,
+	}, nil
+}
+
+// PledgeBillFilter selects the pledge bills matching all of its set fields,
+// with the page of them to return.
+type PledgeBillFilter struct {
+	StakeAddress string          `json:"stakeAddress"`
+	TokenID      *hexutil.Big    `json:"tokenID"`
+	Owner        *common.Address `json:"owner"`
+	Offset       hexutil.Uint64  `json:"offset"`
+	Count        hexutil.Uint64  `json:"count"`
+}
+
+// GetPledgeBills returns a page of the BPoS NFT pledge bills saved from the
+// ELA chain matching the filter, with their number. At most 100 bills are
+// returned.
+func (s *PublicBlockChainAPI) GetPledgeBills(ctx context.Context, filter PledgeBillFilter) (map[string]interface{}, error) {
+	bills, total, err := pledgeBill.ListPledgeBills(pledgeBill.Filter{
+		StakeAddress: filter.StakeAddress,
+		TokenID:      (*big.Int)(filter.TokenID),
+		Owner:        filter.Owner,
+	}, uint64(filter.Offset), uint64(filter.Count))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"total": hexutil.Uint64(total),
+		"bills": bills,
+	}, nil
+}
+
+// GetPledgeBillByTokenID returns the pledge bill of the BPoS NFT, or nil if
+// not found.
+func (s *PublicBlockChainAPI) GetPledgeBillByTokenID(ctx context.Context, tokenID hexutil.Big) (*pledgeBill.PledgeBill, error) {
+	return pledgeBill.GetPledgeBillByTokenID((*big.Int)(&tokenID))
+}
+
+// GetFrozenAccounts returns the frozen account list at the given block, the
+// latest one by default. Before the frozen accounts fork it is the list
+// configured on this node.
+func (s *PublicBlockChainAPI) GetFrozenAccounts(ctx context.Context, blockNrOrHash *rpc.BlockNumberOrHash) ([]string, error) {
+	if blockNrOrHash == nil {
+		latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		blockNrOrHash = &latest
+	}
+	state, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, *blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	if !s.b.ChainConfig().IsFrozenAccountsFork(header.Number) {
+		return s.b.ChainConfig().FrozeAccountList, nil
+	}
+	list := make([]string, 0)
+	for _, addr := range core.FrozenAccounts(state) {
+		list = append(list, addr.String())
+	}
 	return list, nil
 }
 
 // CallArgs represents the arguments for a call.
 type CallArgs struct {
-	From       *common.Address   `json:"from"`
-	To         *common.Address   `json:"to"`
-	Gas        *hexutil.Uint64   `json:"gas"`
-	GasPrice   *hexutil.Big      `json:"gasPrice"`
-	Value      *hexutil.Big      `json:"value"`
-	Data       *hexutil.Bytes    `json:"data"`
-	AccessList *types.AccessList `json:"accessList,omitempty"`
+	From                 *common.Address   `json:"from"`
+	To                   *common.Address   `json:"to"`
+	Gas                  *hexutil.Uint64   `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big      `json:"value"`
+	Data                 *hexutil.Bytes    `json:"data"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+}
+
+// ToMessage converts the call arguments to the Message type used by the core
+// evm. The sender defaults to the zero address, the gas to half the uint64 range
+// capped by the global gas cap. Before the fee market the legacy default gas
+// price is charged, after it unspecified fee caps are zero.
+func (args *CallArgs) ToMessage(globalGasCap *big.Int, baseFee *big.Int) (types.Message, error) {
+	if args.GasPrice != nil && (args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil) {
+		return types.Message{}, errors.New("both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified")
+	}
+	// Set sender address or use zero address if none specified.
+	var addr common.Address
+	if args.From != nil {
+		addr = *args.From
+	}
+	// Set default gas & gas price if none were set
+	gas := uint64(math.MaxUint64 / 2)
+	if args.Gas != nil {
+		gas = uint64(*args.Gas)
+	}
+	if globalGasCap != nil && globalGasCap.Uint64() < gas {
+		log.Warn("Caller gas above allowance, capping", "requested", gas, "cap", globalGasCap)
+		gas = globalGasCap.Uint64()
+	}
+	var gasPrice, gasFeeCap, gasTipCap *big.Int
+	if baseFee == nil {
+		// Before the fee market, keep charging the legacy default price
+		gasPrice = new(big.Int).SetUint64(defaultGasPrice)
+		if args.GasPrice != nil {
+			gasPrice = args.GasPrice.ToInt()
+		}
+		gasFeeCap, gasTipCap = gasPrice, gasPrice
+	} else if args.GasPrice != nil {
+		// A legacy gas price pays both the fee cap and the tip
+		gasPrice = args.GasPrice.ToInt()
+		gasFeeCap, gasTipCap = gasPrice, gasPrice
+	} else {
+		// Unspecified caps are zero, the base fee is then skipped by the EVM
+		gasFeeCap, gasTipCap = new(big.Int), new(big.Int)
+		if args.MaxFeePerGas != nil {
+			gasFeeCap = args.MaxFeePerGas.ToInt()
+		}
+		if args.MaxPriorityFeePerGas != nil {
+			gasTipCap = args.MaxPriorityFeePerGas.ToInt()
+		}
+		gasPrice = new(big.Int)
+		if gasFeeCap.BitLen() > 0 || gasTipCap.BitLen() > 0 {
+			gasPrice = math.BigMin(new(big.Int).Add(gasTipCap, baseFee), gasFeeCap)
+		}
+	}
+	value := new(big.Int)
+	if args.Value != nil {
+		value = args.Value.ToInt()
+	}
+	var data []byte
+	if args.Data != nil {
+		data = []byte(*args.Data)
+	}
+	var accessList types.AccessList
+	if args.AccessList != nil {
+		accessList = *args.AccessList
+	}
+	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, gasFeeCap, gasTipCap, data, false, accessList)
+	return msg, nil
 }
 
-// account indicates the overriding fields of account during the execution of
-// a message call.
+// OverrideAccount indicates the overriding fields of account during the execution
+// of a message call.
 // Note, state and stateDiff can't be specified at the same time. If state is
 // set, message execution will only use the data in the given state. Otherwise
 // if statDiff is set, all diff will be applied first and then execute the call
 // message.
-type account struct {
+type OverrideAccount struct {
 	Nonce     *hexutil.Uint64              `json:"nonce"`
 	Code      *hexutil.Bytes               `json:"code"`
 	Balance   **hexutil.Big                `json:"balance"`
@@ -881,26 +1249,15 @@ type account struct {
 	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
 }
 
-func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides map[common.Address]account, vmCfg vm.Config, timeout time.Duration, globalGasCap *big.Int) (*core.ExecutionResult, error) {
-	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+// StateOverride is the collection of overridden accounts.
+type StateOverride map[common.Address]OverrideAccount
 
-	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
-	if state == nil || err != nil {
-		return nil, err
-	}
-	// Set sender address or use a default if none specified
-	var addr common.Address
-	if args.From == nil {
-		if wallets := b.AccountManager().Wallets(); len(wallets) > 0 {
-			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
-				addr = accounts[0].Address
-			}
-		}
-	} else {
-		addr = *args.From
+// Apply overrides the fields of specified accounts into the given state.
+func (diff *StateOverride) Apply(state *state.StateDB) error {
+	if diff == nil {
+		return nil
 	}
-	// Override the fields of specified contracts before execution.
-	for addr, account := range overrides {
+	for addr, account := range *diff {
 		// Override account nonce.
 		if account.Nonce != nil {
 			state.SetNonce(addr, uint64(*account.Nonce))
@@ -914,7 +1271,7 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 			state.SetBalance(addr, (*big.Int)(*account.Balance))
 		}
 		if account.State != nil && account.StateDiff != nil {
-			return nil, fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
 		}
 		// Replace entire state if caller requires.
 		if account.State != nil {
@@ -927,36 +1284,74 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 			}
 		}
 	}
-	// Set default gas & gas price if none were set
-	gas := uint64(math.MaxUint64 / 2)
-	if args.Gas != nil {
-		gas = uint64(*args.Gas)
+	return nil
+}
+
+// BlockOverrides is a set of header fields to override during the execution of
+// a message call.
+type BlockOverrides struct {
+	Number   *hexutil.Big    `json:"number"`
+	Time     *hexutil.Uint64 `json:"time"`
+	Coinbase *common.Address `json:"coinbase"`
+}
+
+// Apply overrides the given header fields into a copy of the header. The EVM
+// derives the chain rules from the overridden block number.
+//
+// Note, the block context takes the coinbase from the consensus engine, which
+// recovers it from the seal for clique blocks. The coinbase override has to be
+// set on the block context too, see ApplyContext.
+func (diff *BlockOverrides) Apply(header *types.Header) *types.Header {
+	if diff == nil {
+		return header
 	}
-	if globalGasCap != nil && globalGasCap.Uint64() < gas {
-		log.Warn("Caller gas above allowance, capping", "requested", gas, "cap", globalGasCap)
-		gas = globalGasCap.Uint64()
+	header = types.CopyHeader(header)
+	if diff.Number != nil {
+		header.Number = new(big.Int).Set(diff.Number.ToInt())
 	}
-	gasPrice := new(big.Int).SetUint64(defaultGasPrice)
-	if args.GasPrice != nil {
-		gasPrice = args.GasPrice.ToInt()
+	if diff.Time != nil {
+		header.Time = uint64(*diff.Time)
 	}
-
-	value := new(big.Int)
-	if args.Value != nil {
-		value = args.Value.ToInt()
+	if diff.Coinbase != nil {
+		header.Coinbase = *diff.Coinbase
 	}
+	return header
+}
 
-	var data []byte
-	if args.Data != nil {
-		data = []byte(*args.Data)
+// ApplyContext overrides the coinbase of a block context created from a header
+// already overridden by Apply.
+func (diff *BlockOverrides) ApplyContext(ctx *vm.Context) {
+	if diff == nil {
+		return
 	}
-	var accessList types.AccessList
-	if args.AccessList != nil {
-		accessList = *args.AccessList
+	if diff.Coinbase != nil {
+		ctx.Coinbase = *diff.Coinbase
 	}
+}
+
+func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides, vmCfg vm.Config, timeout time.Duration, globalGasCap *big.Int) (*core.ExecutionResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
 
+	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	header = blockOverrides.Apply(header)
+
+	// Set sender address or use a default if none specified
+	if args.From == nil {
+		if wallets := b.AccountManager().Wallets(); len(wallets) > 0 {
+			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
+				args.From = &accounts[0].Address
+			}
+		}
+	}
 	// Create new call message
-	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, data, false, accessList)
+	msg, err := args.ToMessage(globalGasCap, header.BaseFee)
+	if err != nil {
+		return nil, err
+	}
+	vmCfg.NoBaseFee = true
 
 	// Setup context so it may be cancelled the call has completed
 	// or, in case of unmetered gas, setup a context with a timeout.
@@ -971,10 +1366,18 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 	defer cancel()
 
 	// Get a new instance of the EVM.
-	evm, vmError, err := b.GetEVM(ctx, msg, state, header)
+	evm, vmError, err := b.GetEVM(ctx, msg, state, header, &vmCfg)
 	if err != nil {
 		return nil, err
 	}
+	blockOverrides.ApplyContext(&evm.Context)
+
+	// Apply the state overrides to the StateDB before the message runs. GetEVM
+	// funds the sender in the same StateDB, so an overridden sender balance has
+	// to be applied after it.
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
 	// Wait for the context to be done and cancel the evm. Even if the
 	// EVM has finished, cancelling may be done (repeatedly)
 	go func() {
@@ -1031,16 +1434,13 @@ func (e *revertError) ErrorData() interface{} {
 
 // Call executes the given transaction on the state for the given block number.
 //
-// Additionally, the caller can specify a batch of contract for fields overriding.
+// Additionally, the caller can specify a batch of contract for fields overriding
+// and a set of block header fields to execute the call in.
 //
 // Note, this function doesn't make and changes in the state/blockchain and is
 // useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *map[common.Address]account) (hexutil.Bytes, error) {
-	var accounts map[common.Address]account
-	if overrides != nil {
-		accounts = *overrides
-	}
-	result, err := DoCall(ctx, s.b, args, blockNrOrHash, accounts, vm.Config{}, 5*time.Second, s.b.RPCGasCap())
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) (hexutil.Bytes, error) {
+	result, err := DoCall(ctx, s.b, args, blockNrOrHash, overrides, blockOverrides, vm.Config{}, 5*time.Second, s.b.RPCGasCap())
 	if err != nil {
 		return nil, err
 	}
@@ -1051,7 +1451,7 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOr
 	return result.Return(), result.Err
 }
 
-func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, gasCap *big.Int) (hexutil.Uint64, error) {
+func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides, gasCap *big.Int) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
 		lo  uint64 = params.TxGas - 1
@@ -1081,7 +1481,7 @@ func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash
 	executable := func(gas uint64) (bool, *core.ExecutionResult, error) {
 		args.Gas = (*hexutil.Uint64)(&gas)
 
-		result, err := DoCall(ctx, b, args, blockNrOrHash, nil, vm.Config{}, 0, gasCap)
+		result, err := DoCall(ctx, b, args, blockNrOrHash, overrides, blockOverrides, vm.Config{}, 0, gasCap)
 		if err != nil {
 			if errors.Is(err, core.ErrIntrinsicGas) {
 				return true, nil, nil // Special case, raise gas limit
@@ -1128,10 +1528,14 @@ func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash
 }
 
 // EstimateGas returns an estimate of the amount of gas needed to execute the
-// given transaction against the current pending block.
-func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
-	blockNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
-	return DoEstimateGas(ctx, s.b, args, blockNrOrHash, s.b.RPCGasCap())
+// given transaction against the current pending block, or the given block if
+// specified. The same state and block overrides as for Call can be applied.
+func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) (hexutil.Uint64, error) {
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+	return DoEstimateGas(ctx, s.b, args, bNrOrHash, overrides, blockOverrides, s.b.RPCGasCap())
 }
 
 // ExecutionResult groups all structured logs emitted by the EVM
@@ -1198,7 +1602,7 @@ func FormatLogs(logs []logger.StructLog) []StructLogRes {
 
 // RPCMarshalHeader converts the given header to the RPC output .
 func RPCMarshalHeader(head *types.Header) map[string]interface{} {
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"number":           (*hexutil.Big)(head.Number),
 		"hash":             head.Hash(),
 		"parentHash":       head.ParentHash,
@@ -1217,6 +1621,10 @@ func RPCMarshalHeader(head *types.Header) map[string]interface{} {
 		"transactionsRoot": head.TxHash,
 		"receiptsRoot":     head.ReceiptHash,
 	}
+	if head.BaseFee != nil {
+		result["baseFeePerGas"] = (*hexutil.Big)(head.BaseFee)
+	}
+	return result
 }
 
 // RPCMarshalBlock converts the given block to the RPC output which depends on fullTx. If inclTx is true transactions are
@@ -1296,33 +1704,37 @@ func (s *PublicBlockChainAPI) rpcMarshalBlock(b *types.Block, inclTx bool, fullT
 
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
 type RPCTransaction struct {
-	BlockHash        *common.Hash    `json:"blockHash"`
-	BlockNumber      *hexutil.Big    `json:"blockNumber"`
-	From             common.Address  `json:"from"`
-	Gas              hexutil.Uint64  `json:"gas"`
-	GasPrice         *hexutil.Big    `json:"gasPrice"`
-	Hash             common.Hash     `json:"hash"`
-	Input            hexutil.Bytes   `json:"input"`
-	Nonce            hexutil.Uint64  `json:"nonce"`
-	To               *common.Address `json:"to"`
-	TransactionIndex *hexutil.Uint64 `json:"transactionIndex"`
-	Value            *hexutil.Big    `json:"value"`
-	V                *hexutil.Big    `json:"v"`
-	R                *hexutil.Big    `json:"r"`
-	S                *hexutil.Big    `json:"s"`
+	BlockHash        *common.Hash      `json:"blockHash"`
+	BlockNumber      *hexutil.Big      `json:"blockNumber"`
+	From             common.Address    `json:"from"`
+	Gas              hexutil.Uint64    `json:"gas"`
+	GasPrice         *hexutil.Big      `json:"gasPrice"`
+	GasFeeCap        *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	GasTipCap        *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Hash             common.Hash       `json:"hash"`
+	Input            hexutil.Bytes     `json:"input"`
+	Nonce            hexutil.Uint64    `json:"nonce"`
+	To               *common.Address   `json:"to"`
+	TransactionIndex *hexutil.Uint64   `json:"transactionIndex"`
+	Value            *hexutil.Big      `json:"value"`
+	Type             hexutil.Uint64    `json:"type"`
+	Accesses         *types.AccessList `json:"accessList,omitempty"`
+	ChainID          *hexutil.Big      `json:"chainId,omitempty"`
+	V                *hexutil.Big      `json:"v"`
+	R                *hexutil.Big      `json:"r"`
+	S                *hexutil.Big      `json:"s"`
 }
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
-// representation, with the given location metadata set (if available).
-func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
-	var signer types.Signer = types.FrontierSigner{}
-	if tx.Protected() {
-		signer = types.NewEIP155Signer(tx.ChainId())
-	}
-	from, _ := types.Sender(signer, tx)
+// representation, with the given location metadata set (if available). The
+// gas price of dynamic fee transactions is the effective one if the base fee
+// of their block is known, the fee cap otherwise.
+func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64, baseFee *big.Int) *RPCTransaction {
+	from, _ := types.Sender(rpcTxSigner(tx), tx)
 	v, r, s := tx.RawSignatureValues()
 
 	result := &RPCTransaction{
+		Type:     hexutil.Uint64(tx.Type()),
 		From:     from,
 		Gas:      hexutil.Uint64(tx.Gas()),
 		GasPrice: (*hexutil.Big)(tx.GasPrice()),
@@ -1340,12 +1752,36 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 		result.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
 		result.TransactionIndex = (*hexutil.Uint64)(&index)
 	}
+	switch tx.Type() {
+	case types.AccessListTxType:
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId())
+	case types.DynamicFeeTxType:
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId())
+		result.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
+		result.GasTipCap = (*hexutil.Big)(tx.GasTipCap())
+		if baseFee != nil {
+			result.GasPrice = (*hexutil.Big)(tx.EffectiveGasPrice(baseFee))
+		}
+	}
 	return result
 }
 
+// rpcTxSigner returns the signer to recover the sender of a transaction
+// returned over RPC, based on the replay protection it carries.
+func rpcTxSigner(tx *types.Transaction) types.Signer {
+	if tx.Protected() {
+		return types.LatestSignerForChainID(tx.ChainId())
+	}
+	return types.FrontierSigner{}
+}
+
 // newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
 func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
-	return newRPCTransaction(tx, common.Hash{}, 0, 0)
+	return newRPCTransaction(tx, common.Hash{}, 0, 0, nil)
 }
 
 // newRPCTransactionFromBlockIndex returns a transaction that will serialize to the RPC representation.
@@ -1354,7 +1790,7 @@ func newRPCTransactionFromBlockIndex(b *types.Block, index uint64) *RPCTransacti
 	if index >= uint64(len(txs)) {
 		return nil
 	}
-	return newRPCTransaction(txs[index], b.Hash(), b.NumberU64(), index)
+	return newRPCTransaction(txs[index], b.Hash(), b.NumberU64(), index, b.BaseFee())
 }
 
 // newRPCRawTransactionFromBlockIndex returns the bytes of a transaction given a block and a transaction index.
@@ -1363,7 +1799,7 @@ func newRPCRawTransactionFromBlockIndex(b *types.Block, index uint64) hexutil.By
 	if index >= uint64(len(txs)) {
 		return nil
 	}
-	blob, _ := rlp.EncodeToBytes(txs[index])
+	blob, _ := txs[index].MarshalBinary()
 	return blob
 }
 
@@ -1465,7 +1901,15 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 		return nil, err
 	}
 	if tx != nil {
-		return newRPCTransaction(tx, blockHash, blockNumber, index), nil
+		header, err := s.b.HeaderByHash(ctx, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		var baseFee *big.Int
+		if header != nil {
+			baseFee = header.BaseFee
+		}
+		return newRPCTransaction(tx, blockHash, blockNumber, index, baseFee), nil
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
@@ -1489,8 +1933,8 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 			return nil, nil
 		}
 	}
-	// Serialize to RLP and return
-	return rlp.EncodeToBytes(tx)
+	// Serialize to binary and return
+	return tx.MarshalBinary()
 }
 
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
@@ -1507,12 +1951,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		return nil, nil
 	}
 	receipt := receipts[index]
-
-	var signer types.Signer = types.FrontierSigner{}
-	if tx.Protected() {
-		signer = types.NewEIP155Signer(tx.ChainId())
-	}
-	from, _ := types.Sender(signer, tx)
+	from, _ := types.Sender(rpcTxSigner(tx), tx)
 
 	fields := map[string]interface{}{
 		"blockHash":         blockHash,
@@ -1526,7 +1965,20 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"contractAddress":   nil,
 		"logs":              receipt.Logs,
 		"logsBloom":         receipt.Bloom,
+		"type":              hexutil.Uint(tx.Type()),
 	}
+	// The effective gas price is only known from the block of the transaction
+	gasPrice := tx.GasPrice()
+	if tx.Type() == types.DynamicFeeTxType {
+		header, err := s.b.HeaderByHash(ctx, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil && header.BaseFee != nil {
+			gasPrice = tx.EffectiveGasPrice(header.BaseFee)
+		}
+	}
+	fields["effectiveGasPrice"] = (*hexutil.Big)(gasPrice)
 
 	// Assign receipt status or post state.
 	if len(receipt.PostState) > 0 {
@@ -1559,26 +2011,59 @@ func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transacti
 
 // SendTxArgs represents the arguments to sumbit a new transaction into the transaction pool.
 type SendTxArgs struct {
-	From     common.Address  `json:"from"`
-	To       *common.Address `json:"to"`
-	Gas      *hexutil.Uint64 `json:"gas"`
-	GasPrice *hexutil.Big    `json:"gasPrice"`
-	Value    *hexutil.Big    `json:"value"`
-	Nonce    *hexutil.Uint64 `json:"nonce"`
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  *hexutil.Uint64 `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big    `json:"value"`
+	Nonce                *hexutil.Uint64 `json:"nonce"`
 	// We accept "data" and "input" for backwards-compatibility reasons. "input" is the
 	// newer name and should be preferred by clients.
 	Data  *hexutil.Bytes `json:"data"`
 	Input *hexutil.Bytes `json:"input"`
+
+	// Introduced by the typed transactions of the EIP-1559 fork.
+	AccessList *types.AccessList `json:"accessList,omitempty"`
+	ChainID    *hexutil.Big      `json:"chainId,omitempty"`
 }
 
 // setDefaults is a helper function that fills in default values for unspecified tx fields.
 func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
-	if args.GasPrice == nil {
-		price, err := b.SuggestPrice(ctx)
-		if err != nil {
-			return err
+	if args.GasPrice != nil && (args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil) {
+		return errors.New("both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified")
+	}
+	// Once the fee market is live, default to a dynamic fee transaction unless
+	// the caller asked for a legacy one by giving a gas price.
+	baseFee := pendingBaseFee(b)
+	if baseFee != nil && args.GasPrice == nil {
+		if args.MaxPriorityFeePerGas == nil {
+			tip, err := suggestGasTipCap(ctx, b)
+			if err != nil {
+				return err
+			}
+			args.MaxPriorityFeePerGas = (*hexutil.Big)(tip)
+		}
+		if args.MaxFeePerGas == nil {
+			// Leave room for the base fee to double before the transaction lands
+			gasFeeCap := new(big.Int).Add(args.MaxPriorityFeePerGas.ToInt(), new(big.Int).Mul(baseFee, big.NewInt(2)))
+			args.MaxFeePerGas = (*hexutil.Big)(gasFeeCap)
+		}
+		if args.MaxFeePerGas.ToInt().Cmp(args.MaxPriorityFeePerGas.ToInt()) < 0 {
+			return fmt.Errorf("maxFeePerGas (%v) < maxPriorityFeePerGas (%v)", args.MaxFeePerGas, args.MaxPriorityFeePerGas)
+		}
+	} else {
+		if args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil {
+			return errors.New("maxFeePerGas or maxPriorityFeePerGas specified but the EIP-1559 fork is not active yet")
+		}
+		if args.GasPrice == nil {
+			price, err := b.SuggestPrice(ctx)
+			if err != nil {
+				return err
+			}
+			args.GasPrice = (*hexutil.Big)(price)
 		}
-		args.GasPrice = (*hexutil.Big)(price)
 	}
 	if args.Value == nil {
 		args.Value = new(hexutil.Big)
@@ -1614,20 +2099,26 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 			input = args.Data
 		}
 		callArgs := CallArgs{
-			From:     &args.From, // From shouldn't be nil
-			To:       args.To,
-			GasPrice: args.GasPrice,
-			Value:    args.Value,
-			Data:     input,
+			From:                 &args.From, // From shouldn't be nil
+			To:                   args.To,
+			GasPrice:             args.GasPrice,
+			MaxFeePerGas:         args.MaxFeePerGas,
+			MaxPriorityFeePerGas: args.MaxPriorityFeePerGas,
+			Value:                args.Value,
+			Data:                 input,
+			AccessList:           args.AccessList,
 		}
 		pendingBlockNr := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
-		estimated, err := DoEstimateGas(ctx, b, callArgs, pendingBlockNr, b.RPCGasCap())
+		estimated, err := DoEstimateGas(ctx, b, callArgs, pendingBlockNr, nil, nil, b.RPCGasCap())
 		if err != nil {
 			return err
 		}
 		args.Gas = &estimated
 		log.Trace("Estimate gas usage automatically", "gas", args.Gas)
 	}
+	if args.ChainID == nil {
+		args.ChainID = (*hexutil.Big)(b.ChainConfig().GetChainIDByHeight(b.CurrentBlock().Number()))
+	}
 	return nil
 }
 
@@ -1638,10 +2129,46 @@ func (args *SendTxArgs) toTransaction() *types.Transaction {
 	} else if args.Data != nil {
 		input = *args.Data
 	}
-	if args.To == nil {
-		return types.NewContractCreation(uint64(*args.Nonce), (*big.Int)(args.Value), uint64(*args.Gas), (*big.Int)(args.GasPrice), input)
+	var data types.TxData
+	switch {
+	case args.MaxFeePerGas != nil:
+		al := types.AccessList{}
+		if args.AccessList != nil {
+			al = *args.AccessList
+		}
+		data = &types.DynamicFeeTx{
+			To:         args.To,
+			ChainID:    (*big.Int)(args.ChainID),
+			Nonce:      uint64(*args.Nonce),
+			Gas:        uint64(*args.Gas),
+			GasFeeCap:  (*big.Int)(args.MaxFeePerGas),
+			GasTipCap:  (*big.Int)(args.MaxPriorityFeePerGas),
+			Value:      (*big.Int)(args.Value),
+			Data:       input,
+			AccessList: al,
+		}
+	case args.AccessList != nil:
+		data = &types.AccessListTx{
+			To:         args.To,
+			ChainID:    (*big.Int)(args.ChainID),
+			Nonce:      uint64(*args.Nonce),
+			Gas:        uint64(*args.Gas),
+			GasPrice:   (*big.Int)(args.GasPrice),
+			Value:      (*big.Int)(args.Value),
+			Data:       input,
+			AccessList: *args.AccessList,
+		}
+	default:
+		data = &types.LegacyTx{
+			To:       args.To,
+			Nonce:    uint64(*args.Nonce),
+			Gas:      uint64(*args.Gas),
+			GasPrice: (*big.Int)(args.GasPrice),
+			Value:    (*big.Int)(args.Value),
+			Data:     input,
+		}
 	}
-	return types.NewTransaction(uint64(*args.Nonce), *args.To, (*big.Int)(args.Value), uint64(*args.Gas), (*big.Int)(args.GasPrice), input)
+	return types.NewTx(data)
 }
 
 // SubmitTransaction is a helper function that submits tx to txPool and logs a message.
@@ -1704,7 +2231,7 @@ func (s *PublicTransactionPoolAPI) FillTransaction(ctx context.Context, args Sen
 	}
 	// Assemble the transaction and obtain rlp
 	tx := args.toTransaction()
-	data, err := rlp.EncodeToBytes(tx)
+	data, err := tx.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -1715,7 +2242,7 @@ func (s *PublicTransactionPoolAPI) FillTransaction(ctx context.Context, args Sen
 // The sender is responsible for signing the transaction and using the correct nonce.
 func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
 	tx := new(types.Transaction)
-	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+	if err := tx.UnmarshalBinary(encodedTx); err != nil {
 		return common.Hash{}, err
 	}
 	return SubmitTransaction(ctx, s.b, tx)
@@ -1759,8 +2286,8 @@ func (s *PublicTransactionPoolAPI) SignTransaction(ctx context.Context, args Sen
 	if args.Gas == nil {
 		return nil, fmt.Errorf("gas not specified")
 	}
-	if args.GasPrice == nil {
-		return nil, fmt.Errorf("gasPrice not specified")
+	if args.GasPrice == nil && (args.MaxFeePerGas == nil || args.MaxPriorityFeePerGas == nil) {
+		return nil, fmt.Errorf("missing gasPrice or maxFeePerGas/maxPriorityFeePerGas")
 	}
 	if args.Nonce == nil {
 		return nil, fmt.Errorf("nonce not specified")
@@ -1772,7 +2299,7 @@ func (s *PublicTransactionPoolAPI) SignTransaction(ctx context.Context, args Sen
 	if err != nil {
 		return nil, err
 	}
-	data, err := rlp.EncodeToBytes(tx)
+	data, err := tx.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -1794,11 +2321,7 @@ func (s *PublicTransactionPoolAPI) PendingTransactions() ([]*RPCTransaction, err
 	}
 	transactions := make([]*RPCTransaction, 0, len(pending))
 	for _, tx := range pending {
-		var signer types.Signer = types.HomesteadSigner{}
-		if tx.Protected() {
-			signer = types.NewEIP155Signer(tx.ChainId())
-		}
-		from, _ := types.Sender(signer, tx)
+		from, _ := types.Sender(rpcTxSigner(tx), tx)
 		if _, exists := accounts[from]; exists {
 			transactions = append(transactions, newRPCPendingTransaction(tx))
 		}
@@ -1822,10 +2345,7 @@ func (s *PublicTransactionPoolAPI) Resend(ctx context.Context, sendArgs SendTxAr
 	}
 
 	for _, p := range pending {
-		var signer types.Signer = types.HomesteadSigner{}
-		if p.Protected() {
-			signer = types.NewEIP155Signer(p.ChainId())
-		}
+		signer := rpcTxSigner(p)
 		wantSigHash := signer.Hash(matchTx)
 
 		if pFrom, err := types.Sender(signer, p); err == nil && pFrom == sendArgs.From && signer.Hash(p) == wantSigHash {
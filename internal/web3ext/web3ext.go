@@ -164,6 +164,20 @@ web3._extend({
 			name: 'getAllPeersInfo',
 			call: 'pbft_getAllPeersInfo',
 		}),
+		new web3._extend.Method({
+			name: 'getConsensusStatus',
+			call: 'pbft_getConsensusStatus',
+		}),
+		new web3._extend.Method({
+			name: 'getProducerStats',
+			call: 'pbft_getProducerStats',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'getPeerScores',
+			call: 'pbft_getPeerScores',
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -241,6 +255,30 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'crossChainQueue',
+			call: 'admin_crossChainQueue',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new web3._extend.Method({
+			name: 'crossChainFailed',
+			call: 'admin_crossChainFailed'
+		}),
+		new web3._extend.Method({
+			name: 'crossChainCursors',
+			call: 'admin_crossChainCursors'
+		}),
+		new web3._extend.Method({
+			name: 'crossChainRequeue',
+			call: 'admin_crossChainRequeue',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'crossChainSkip',
+			call: 'admin_crossChainSkip',
+			params: 2
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -483,6 +521,12 @@ web3._extend({
 			params: 2,
 			inputFormatter: [null, null]
 		}),
+		new web3._extend.Method({
+			name: 'traceCall',
+			call: 'debug_traceCall',
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'preimage',
 			call: 'debug_preimage',
@@ -494,6 +538,12 @@ web3._extend({
 			call: 'debug_getBadBlocks',
 			params: 0,
 		}),
+		new web3._extend.Method({
+			name: 'getEvilSigners',
+			call: 'debug_getEvilSigners',
+			params: 2,
+			inputFormatter: [null, null],
+		}),
 		new web3._extend.Method({
 			name: 'storageRangeAt',
 			call: 'debug_storageRangeAt',
@@ -619,20 +669,59 @@ web3._extend({
 			call: 'eth_getFailedRechargeTxByHash',
 			params: 1,
 		}),
+		new web3._extend.Method({
+			name: 'getRechargeStatus',
+			call: 'eth_getRechargeStatus',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'listRecharges',
+			call: 'eth_listRecharges',
+			params: 1,
+		}),
 		new web3._extend.Method({
 			name: 'getTransactionFeeDetails',
 			call: 'eth_getTransactionFeeDetails',
 			params: 1,
 		}),
+		new web3._extend.Method({
+			name: 'getDeveloperFeeSplit',
+			call: 'eth_getDeveloperFeeSplit',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'sendInvalidWithdrawTransaction',
 			call: 'eth_sendInvalidWithdrawTransaction',
 			params: 2,
 		}),
+		new web3._extend.Method({
+			name: 'getWithdrawRefundStatus',
+			call: 'eth_getWithdrawRefundStatus',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'getPendingWithdrawRefunds',
+			call: 'eth_getPendingWithdrawRefunds',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'getPledgeBills',
+			call: 'eth_getPledgeBills',
+			params: 1,
+		}),
+		new web3._extend.Method({
+			name: 'getPledgeBillByTokenID',
+			call: 'eth_getPledgeBillByTokenID',
+			params: 1,
+			inputFormatter: [web3._extend.utils.fromDecimal]
+		}),
 		new web3._extend.Method({
 			name: 'getFrozenAccounts',
 			call: 'eth_getFrozenAccounts',
-			params: 0,
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
 		})
 	],
 	properties: [
@@ -648,6 +737,11 @@ web3._extend({
 				return formatted;
 			}
 		}),
+		new web3._extend.Property({
+			name: 'maxPriorityFeePerGas',
+			getter: 'eth_maxPriorityFeePerGas',
+			outputFormatter: web3._extend.utils.toBigNumber
+		}),
 	]
 });
 `
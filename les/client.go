@@ -43,7 +43,9 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/p2p/enode"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rpc"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/smallcrosstx"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/withdrawfailedtx"
 )
 
 type LightEthereum struct {
@@ -64,6 +66,7 @@ type LightEthereum struct {
 	ApiBackend     *LesApiBackend
 	eventMux       *event.TypeMux
 	engine         consensus.Engine
+	arbiters       *light.ArbiterTracker
 	accountManager *accounts.Manager
 	netRPCService  *ethapi.PublicNetAPI
 }
@@ -155,6 +158,15 @@ func New(ctx *node.ServiceContext, config *eth.Config, node *node.Node) (*LightE
 	leth.chainReader = leth.blockchain
 	leth.txPool = light.NewTxPool(leth.chainConfig, leth.blockchain, leth.relay)
 
+	// Set up the PBFT arbiter sets followed without the SPV module.
+	arbiterCheckpoints := config.ArbiterCheckpoints
+	if arbiterCheckpoints == nil {
+		arbiterCheckpoints = params.TrustedArbiterCheckpoints[genesisHash]
+	}
+	if leth.arbiters, err = light.NewArbiterTracker(leth.odr, arbiterCheckpoints); err != nil {
+		return nil, err
+	}
+
 	// Set up checkpoint oracle.
 	oracle := config.CheckpointOracle
 	if oracle == nil {
@@ -186,6 +198,7 @@ func New(ctx *node.ServiceContext, config *eth.Config, node *node.Node) (*LightE
 	}
 	leth.ApiBackend.gpo = gasprice.NewOracle(leth.ApiBackend, gpoParams)
 	engine := pbft.New(chainConfig, ctx.ResolvePath(""))
+	engine.SetProducersSource(leth.turnProducers)
 	if leth.blockchain.Config().IsPBFTFork(leth.blockchain.CurrentHeader().Number) {
 		leth.SetEngine(engine)
 	}
@@ -199,6 +212,16 @@ func (s *LightEthereum) SetEngine(engine consensus.Engine) {
 	s.blockchain.SetEngine(engine)
 }
 
+// turnProducers returns the producers of the ELA turn working at the given
+// height. They are read from the main chain if the SPV module runs, otherwise
+// from the arbiter sets followed over the light protocol.
+func (s *LightEthereum) turnProducers(elaHeight uint64) ([][]byte, int, error) {
+	if spv.GetSpvService() != nil {
+		return spv.GetProducers(elaHeight)
+	}
+	return s.arbiters.Producers(elaHeight)
+}
+
 type LightDummyAPI struct{}
 
 // Etherbase is the address that mining rewards will be send to
@@ -297,6 +320,8 @@ func (s *LightEthereum) Start(srvr *p2p.Server) error {
 // Ethereum protocol.
 func (s *LightEthereum) Stop() error {
 	spv.Close()
+	smallcrosstx.Close()
+	withdrawfailedtx.Close()
 	close(s.closeCh)
 	s.peers.Close()
 	s.reqDist.close()
@@ -296,6 +296,21 @@ func (h *clientHandler) handleMsg(p *peer) error {
 			ReqID:   resp.ReqID,
 			Obj:     resp.Status,
 		}
+	case ArbitersMsg:
+		p.Log().Trace("Received arbiters response")
+		var resp struct {
+			ReqID, BV uint64
+			Sets      []light.ArbiterSet
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.ReceivedReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgArbiters,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Sets,
+		}
 	case StopMsg:
 		p.freezeServer(true)
 		h.backend.retriever.frozen(p)
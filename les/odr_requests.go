@@ -68,6 +68,8 @@ func LesRequest(req light.OdrRequest) LesOdrRequest {
 		return (*BloomRequest)(r)
 	case *light.TxStatusRequest:
 		return (*TxStatusRequest)(r)
+	case *light.ArbitersRequest:
+		return (*ArbitersRequest)(r)
 	default:
 		return nil
 	}
@@ -522,6 +524,50 @@ func (r *TxStatusRequest) Validate(db ethdb.Database, msg *Msg) error {
 	return nil
 }
 
+// ArbitersRequest is the ODR request type for the producers of an ELA turn
+type ArbitersRequest light.ArbitersRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *ArbitersRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetArbitersMsg, 1)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *ArbitersRequest) CanSend(peer *peer) bool {
+	return peer.version >= lpv4
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *ArbitersRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting arbiter set", "elaHeight", r.ElaHeight)
+	return peer.RequestArbiters(reqID, r.GetCost(peer), []uint64{r.ElaHeight})
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *ArbitersRequest) Validate(db ethdb.Database, msg *Msg) error {
+	log.Debug("Validating arbiter set", "elaHeight", r.ElaHeight)
+
+	// Ensure we have a correct message with a single arbiter set
+	if msg.MsgType != MsgArbiters {
+		return errInvalidMessageType
+	}
+	sets := msg.Obj.([]light.ArbiterSet)
+	if len(sets) != 1 {
+		return errInvalidEntryCount
+	}
+	set := sets[0]
+	if r.Check != nil {
+		if err := r.Check(&set); err != nil {
+			return err
+		}
+	}
+	r.Set = &set
+	return nil
+}
+
 // readTraceDB stores the keys of database reads. We use this to check that received node
 // sets contain only the trie nodes necessary to make proofs pass.
 type readTraceDB struct {
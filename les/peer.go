@@ -443,6 +443,12 @@ func (p *peer) ReplyTxStatus(reqID uint64, stats []light.TxStatus) *reply {
 	return &reply{p.rw, TxStatusMsg, reqID, data}
 }
 
+// ReplyArbiters creates a reply with a batch of arbiter sets, corresponding to the ones requested.
+func (p *peer) ReplyArbiters(reqID uint64, sets []light.ArbiterSet) *reply {
+	data, _ := rlp.EncodeToBytes(sets)
+	return &reply{p.rw, ArbitersMsg, reqID, data}
+}
+
 // RequestHeadersByHash fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the hash of an origin block.
 func (p *peer) RequestHeadersByHash(reqID, cost uint64, origin common.Hash, amount int, skip int, reverse bool) error {
@@ -495,6 +501,12 @@ func (p *peer) RequestTxStatus(reqID, cost uint64, txHashes []common.Hash) error
 	return sendRequest(p.rw, GetTxStatusMsg, reqID, cost, txHashes)
 }
 
+// RequestArbiters fetches the arbiter sets of a batch of ELA heights from a remote node.
+func (p *peer) RequestArbiters(reqID, cost uint64, elaHeights []uint64) error {
+	p.Log().Debug("Requesting arbiter sets", "count", len(elaHeights))
+	return sendRequest(p.rw, GetArbitersMsg, reqID, cost, elaHeights)
+}
+
 // SendTxStatus creates a reply with a batch of transactions to be added to the remote transaction pool.
 func (p *peer) SendTxs(reqID, cost uint64, txs rlp.RawValue) error {
 	p.Log().Debug("Sending batch of transactions", "size", len(txs))
@@ -721,7 +733,7 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 
 		if !p.onlyAnnounce {
 			for msgCode := range reqAvgTimeCost {
-				if p.fcCosts[msgCode] == nil {
+				if msgCode < ProtocolLengths[uint(p.version)] && p.fcCosts[msgCode] == nil {
 					return errResp(ErrUselessPeer, "peer does not support message %d", msgCode)
 				}
 			}
@@ -36,6 +36,7 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/metrics"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/p2p"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/trie"
 )
 
@@ -52,6 +53,7 @@ const (
 	MaxHelperTrieProofsFetch = 64  // Amount of helper tries to be fetched per retrieval request
 	MaxTxSend                = 64  // Amount of transactions to be send per request
 	MaxTxStatus              = 256 // Amount of transactions to queried per request
+	MaxArbitersFetch         = 16  // Amount of arbiter sets to be fetched per retrieval request
 )
 
 var (
@@ -71,6 +73,8 @@ type serverHandler struct {
 	wg      sync.WaitGroup // WaitGroup used to track all background routines of handler.
 	synced  func() bool    // Callback function used to determine whether local node is synced.
 
+	producersAt func(elaHeight uint64) ([][]byte, int, error) // Source of the arbiter sets served to light clients.
+
 	// Testing fields
 	addTxsSync bool
 }
@@ -83,6 +87,8 @@ func newServerHandler(server *LesServer, blockchain *core.BlockChain, chainDb et
 		txpool:     txpool,
 		closeCh:    make(chan struct{}),
 		synced:     synced,
+
+		producersAt: spv.GetProducers,
 	}
 	return handler
 }
@@ -818,6 +824,47 @@ func (h *serverHandler) handleMsg(p *peer, wg *sync.WaitGroup) error {
 			}()
 		}
 
+	case GetArbitersMsg:
+		p.Log().Trace("Received arbiters request")
+		if metrics.EnabledExpensive {
+			miscInArbitersPacketsMeter.Mark(1)
+			miscInArbitersTrafficMeter.Mark(int64(msg.Size))
+			defer func(start time.Time) { miscServingTimeArbitersTimer.UpdateSince(start) }(time.Now())
+		}
+		var req struct {
+			ReqID      uint64
+			ElaHeights []uint64
+		}
+		if err := msg.Decode(&req); err != nil {
+			clientErrorMeter.Mark(1)
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		reqCnt := len(req.ElaHeights)
+		if accept(req.ReqID, uint64(reqCnt), MaxArbitersFetch) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sets := make([]light.ArbiterSet, len(req.ElaHeights))
+				for i, elaHeight := range req.ElaHeights {
+					if i != 0 && !task.waitOrStop() {
+						sendResponse(req.ReqID, 0, nil, task.servingTime)
+						return
+					}
+					// Unknown sets are returned empty, the client rejects them.
+					sets[i].ElaHeight = elaHeight
+					if producers, total, err := h.producersAt(elaHeight); err == nil {
+						sets[i].Producers, sets[i].TotalCount = producers, uint64(total)
+					}
+				}
+				reply := p.ReplyArbiters(req.ReqID, sets)
+				sendResponse(req.ReqID, uint64(reqCnt), reply, task.done())
+				if metrics.EnabledExpensive {
+					miscOutArbitersPacketsMeter.Mark(1)
+					miscOutArbitersTrafficMeter.Mark(int64(reply.size()))
+				}
+			}()
+		}
+
 	default:
 		p.Log().Trace("Received invalid message", "code", msg.Code)
 		clientErrorMeter.Mark(1)
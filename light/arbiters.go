@@ -0,0 +1,197 @@
+// Copyright 2016 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+)
+
+// arbitersRetrievalTimeout is the time allowed to retrieve an arbiter set
+// while verifying a header.
+const arbitersRetrievalTimeout = 10 * time.Second
+
+var arbiterSetPrefix = []byte("pbft-arbiters-") // arbiterSetPrefix + elaHeight (uint64 big endian) -> arbiter set
+
+var (
+	errNoTrustedArbiters = errors.New("no trusted arbiter set before the ELA height")
+	errEmptyArbiterSet   = errors.New("empty arbiter set")
+)
+
+func arbiterSetKey(elaHeight uint64) []byte {
+	key := make([]byte, len(arbiterSetPrefix)+8)
+	copy(key, arbiterSetPrefix)
+	binary.BigEndian.PutUint64(key[len(arbiterSetPrefix):], elaHeight)
+	return key
+}
+
+func readArbiterSet(db ethdb.KeyValueReader, elaHeight uint64) *ArbiterSet {
+	data, _ := db.Get(arbiterSetKey(elaHeight))
+	if len(data) == 0 {
+		return nil
+	}
+	set := new(ArbiterSet)
+	if err := rlp.DecodeBytes(data, set); err != nil {
+		log.Error("Invalid arbiter set RLP", "elaHeight", elaHeight, "err", err)
+		return nil
+	}
+	return set
+}
+
+func writeArbiterSet(db ethdb.KeyValueWriter, set *ArbiterSet) {
+	data, err := rlp.EncodeToBytes(set)
+	if err != nil {
+		log.Crit("Failed to RLP encode arbiter set", "err", err)
+	}
+	if err := db.Put(arbiterSetKey(set.ElaHeight), data); err != nil {
+		log.Crit("Failed to store arbiter set", "err", err)
+	}
+}
+
+// ArbiterTracker follows the PBFT producers of the ELA turns for a light
+// client, which cannot read them from the main chain. The sets are retrieved
+// from the LES servers and only trusted when they keep a majority of the
+// producers of the closest trusted set before them, starting from the
+// checkpointed ones. A turn replacing most of the producers, like a new CR
+// council, can only be followed from a new checkpoint.
+type ArbiterTracker struct {
+	odr OdrBackend
+
+	lock    sync.RWMutex
+	trusted map[uint64]*ArbiterSet
+	heights []uint64 // heights of the trusted sets, sorted
+}
+
+// NewArbiterTracker creates a tracker trusting the given checkpoints and the
+// sets accepted earlier.
+func NewArbiterTracker(odr OdrBackend, checkpoints []*params.ArbiterCheckpoint) (*ArbiterTracker, error) {
+	t := &ArbiterTracker{
+		odr:     odr,
+		trusted: make(map[uint64]*ArbiterSet),
+	}
+	for _, cp := range checkpoints {
+		set := &ArbiterSet{ElaHeight: cp.ElaHeight, TotalCount: cp.TotalCount}
+		for _, producer := range cp.Producers {
+			set.Producers = append(set.Producers, common.Hex2Bytes(producer))
+		}
+		if len(set.Producers) == 0 || set.TotalCount < uint64(len(set.Producers)) {
+			return nil, fmt.Errorf("invalid arbiter checkpoint at ELA height %d", cp.ElaHeight)
+		}
+		t.add(set)
+	}
+	return t, nil
+}
+
+func (t *ArbiterTracker) add(set *ArbiterSet) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.trusted[set.ElaHeight]; ok {
+		return
+	}
+	t.trusted[set.ElaHeight] = set
+	t.heights = append(t.heights, set.ElaHeight)
+	sort.Slice(t.heights, func(i, j int) bool { return t.heights[i] < t.heights[j] })
+}
+
+// anchor returns the trusted set closest before the ELA height.
+func (t *ArbiterTracker) anchor(elaHeight uint64) *ArbiterSet {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	i := sort.Search(len(t.heights), func(i int) bool { return t.heights[i] >= elaHeight })
+	if i == 0 {
+		return nil
+	}
+	return t.trusted[t.heights[i-1]]
+}
+
+// Producers returns the producers of the turn working at the ELA height and
+// the count of arbiters its majority is computed from, retrieving the set
+// from the network if needed.
+func (t *ArbiterTracker) Producers(elaHeight uint64) ([][]byte, int, error) {
+	t.lock.RLock()
+	set := t.trusted[elaHeight]
+	t.lock.RUnlock()
+
+	if set == nil {
+		if set = readArbiterSet(t.odr.Database(), elaHeight); set != nil {
+			t.add(set)
+		}
+	}
+	if set == nil {
+		req := &ArbitersRequest{ElaHeight: elaHeight, Check: t.check(elaHeight)}
+		ctx, cancel := context.WithTimeout(context.Background(), arbitersRetrievalTimeout)
+		defer cancel()
+		if err := t.odr.Retrieve(ctx, req); err != nil {
+			return nil, 0, err
+		}
+		set = req.Set
+		t.add(set)
+		log.Info("Following new PBFT arbiter set", "elaHeight", elaHeight, "producers", len(set.Producers))
+	}
+	return set.Producers, int(set.TotalCount), nil
+}
+
+// check returns the verification of a set retrieved for the ELA height.
+func (t *ArbiterTracker) check(elaHeight uint64) func(*ArbiterSet) error {
+	return func(set *ArbiterSet) error {
+		if set.ElaHeight != elaHeight {
+			return fmt.Errorf("arbiter set of ELA height %d, want %d", set.ElaHeight, elaHeight)
+		}
+		if len(set.Producers) == 0 || set.TotalCount < uint64(len(set.Producers)) {
+			return errEmptyArbiterSet
+		}
+		anchor := t.anchor(elaHeight)
+		if anchor == nil {
+			return errNoTrustedArbiters
+		}
+		return checkArbiterContinuity(anchor, set)
+	}
+}
+
+// checkArbiterContinuity verifies that the set keeps a majority of the
+// producers of the trusted anchor.
+func checkArbiterContinuity(anchor, set *ArbiterSet) error {
+	known := make(map[string]struct{}, len(anchor.Producers))
+	for _, producer := range anchor.Producers {
+		known[string(producer)] = struct{}{}
+	}
+	kept := make(map[string]struct{})
+	for _, producer := range set.Producers {
+		if _, ok := known[string(producer)]; ok {
+			kept[string(producer)] = struct{}{}
+		}
+	}
+	if required := dpos.MajorityCount(len(anchor.Producers)); len(kept) == 0 || len(kept) < required {
+		return fmt.Errorf("arbiter set of ELA height %d keeps %d producers of ELA height %d, want %d",
+			set.ElaHeight, len(kept), anchor.ElaHeight, required)
+	}
+	return nil
+}
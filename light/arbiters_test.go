@@ -0,0 +1,123 @@
+// Copyright 2016 The Elastos.ELA.SideChain.ESC Authors
+// This file is part of the Elastos.ELA.SideChain.ESC library.
+//
+// The Elastos.ELA.SideChain.ESC library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Elastos.ELA.SideChain.ESC library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Elastos.ELA.SideChain.ESC library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/rawdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
+)
+
+// arbitersTestOdr serves arbiter sets the way a LES server would.
+type arbitersTestOdr struct {
+	OdrBackend
+	db       ethdb.Database
+	sets     map[uint64]*ArbiterSet
+	requests int
+}
+
+func (odr *arbitersTestOdr) Database() ethdb.Database {
+	return odr.db
+}
+
+func (odr *arbitersTestOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	r := req.(*ArbitersRequest)
+	odr.requests++
+	set, ok := odr.sets[r.ElaHeight]
+	if !ok {
+		return fmt.Errorf("no arbiter set at %d", r.ElaHeight)
+	}
+	if err := r.Check(set); err != nil {
+		return err
+	}
+	r.Set = set
+	req.StoreResult(odr.db)
+	return nil
+}
+
+func testProducers(ids ...byte) (producers [][]byte, hexes []string) {
+	for _, id := range ids {
+		producer := make([]byte, 33)
+		producer[0], producer[32] = 0x02, id
+		producers = append(producers, producer)
+		hexes = append(hexes, common.Bytes2Hex(producer))
+	}
+	return producers, hexes
+}
+
+func TestArbiterTracker(t *testing.T) {
+	_, trusted := testProducers(1, 2, 3, 4, 5, 6)
+	odr := &arbitersTestOdr{db: rawdb.NewMemoryDatabase(), sets: make(map[uint64]*ArbiterSet)}
+
+	// Four of six producers kept: the set follows the checkpoint.
+	kept, _ := testProducers(1, 2, 3, 4, 7, 8)
+	odr.sets[200] = &ArbiterSet{ElaHeight: 200, Producers: kept, TotalCount: 12}
+	// Three of six producers kept: the set must be checkpointed.
+	replaced, _ := testProducers(1, 2, 7, 9, 10, 11)
+	odr.sets[300] = &ArbiterSet{ElaHeight: 300, Producers: replaced, TotalCount: 12}
+	// A set at another height than requested.
+	odr.sets[400] = &ArbiterSet{ElaHeight: 401, Producers: kept, TotalCount: 12}
+
+	tracker, err := NewArbiterTracker(odr, []*params.ArbiterCheckpoint{{ElaHeight: 100, Producers: trusted, TotalCount: 12}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if producers, total, err := tracker.Producers(100); err != nil || len(producers) != 6 || total != 12 {
+		t.Fatalf("checkpointed set: have %d producers of %d, %v", len(producers), total, err)
+	}
+	if _, _, err := tracker.Producers(50); err == nil {
+		t.Fatal("set before the checkpoints accepted")
+	}
+	if _, _, err := tracker.Producers(200); err != nil {
+		t.Fatalf("continuous set rejected: %v", err)
+	}
+	if _, _, err := tracker.Producers(300); err == nil {
+		t.Fatal("replacing set accepted")
+	}
+	if _, _, err := tracker.Producers(400); err == nil {
+		t.Fatal("set of another height accepted")
+	}
+
+	// Accepted sets are stored and not retrieved again.
+	requests := odr.requests
+	restarted, err := NewArbiterTracker(odr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if producers, _, err := restarted.Producers(200); err != nil || len(producers) != 6 {
+		t.Fatalf("stored set: have %d producers, %v", len(producers), err)
+	}
+	if odr.requests != requests {
+		t.Fatalf("stored set retrieved again")
+	}
+}
+
+func TestInvalidArbiterCheckpoint(t *testing.T) {
+	_, producers := testProducers(1, 2, 3)
+	odr := &arbitersTestOdr{db: rawdb.NewMemoryDatabase()}
+	if _, err := NewArbiterTracker(odr, []*params.ArbiterCheckpoint{{ElaHeight: 100, Producers: producers, TotalCount: 2}}); err == nil {
+		t.Fatal("checkpoint with more producers than arbiters accepted")
+	}
+	if _, err := NewArbiterTracker(odr, []*params.ArbiterCheckpoint{{ElaHeight: 100}}); err == nil {
+		t.Fatal("empty checkpoint accepted")
+	}
+}
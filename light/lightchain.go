@@ -625,7 +625,7 @@ func (lc *LightChain) isToManyEvilSigners(header *types.Header) bool {
 	if headerOld == nil {
 		return false
 	}
-	return core.IsNeedStopChain(header, headerOld, lc.engine, lc.evilSigners, lc.journal)
+	return core.IsNeedStopChain(header, headerOld, lc.engine, lc.evilSigners, lc.journal, lc.chainDb)
 }
 
 // remove old evilSigners who have created  different blocks, and difference between  the blocks height
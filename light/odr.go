@@ -200,3 +200,25 @@ type TxStatusRequest struct {
 
 // StoreResult stores the retrieved data in local database
 func (req *TxStatusRequest) StoreResult(db ethdb.Database) {}
+
+// ArbiterSet is the set of PBFT producers of the ELA turn working from
+// ElaHeight, in duty order.
+type ArbiterSet struct {
+	ElaHeight  uint64
+	Producers  [][]byte
+	TotalCount uint64
+}
+
+// ArbitersRequest is the ODR request type for retrieving the producers of an
+// ELA turn. Check decides whether the retrieved set can be trusted.
+type ArbitersRequest struct {
+	OdrRequest
+	ElaHeight uint64
+	Check     func(*ArbiterSet) error
+	Set       *ArbiterSet
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *ArbitersRequest) StoreResult(db ethdb.Database) {
+	writeArbiterSet(db, req.Set)
+}
@@ -90,7 +90,6 @@ type TxRelayBackend interface {
 func NewTxPool(config *params.ChainConfig, chain *LightChain, relay TxRelayBackend) *TxPool {
 	pool := &TxPool{
 		config:      config,
-		signer:      types.NewEIP155Signer(config.GetChainIDByHeight(chain.CurrentHeader().Number)),
 		nonce:       make(map[common.Address]uint64),
 		pending:     make(map[common.Hash]*types.Transaction),
 		mined:       make(map[common.Hash][]*types.Transaction),
@@ -103,7 +102,14 @@ func NewTxPool(config *params.ChainConfig, chain *LightChain, relay TxRelayBacke
 		head:        chain.CurrentHeader().Hash(),
 		clearIdx:    chain.CurrentHeader().Number.Uint64(),
 	}
-	pool.signer.(types.EIP155Signer).SetForkData(config, chain.CurrentHeader().Number)
+	signer := types.NewEIP155Signer(config.GetChainIDByHeight(chain.CurrentHeader().Number))
+	signer.SetForkData(config, chain.CurrentHeader().Number)
+	pool.signer = signer
+	// The light pool never refreshes its signer, accept typed transactions as
+	// soon as the EIP-1559 fork is scheduled.
+	if config.EIP1559Block != nil {
+		pool.signer = types.NewLondonSignerWithEIP155(signer)
+	}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 	go pool.eventLoop()
@@ -39,7 +39,6 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/params"
-	"github.com/elastos/Elastos.ELA.SideChain.ESC/spv"
 )
 
 const (
@@ -472,7 +471,7 @@ func (w *worker) mainLoop() {
 					acc, _ := types.Sender(w.current.signer, tx)
 					txs[acc] = append(txs[acc], tx)
 				}
-				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs)
+				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs, w.current.header.BaseFee)
 				tcount := w.current.tcount
 				w.commitTransactions(txset, coinbase, nil)
 				// Only update the snapshot if any new transactons were added
@@ -632,7 +631,7 @@ func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
 		return err
 	}
 	env := &environment{
-		signer:    types.NewEIP155Signer(w.chainConfig.GetChainIDByHeight(header.Number)),
+		signer:    types.MakeSigner(w.chainConfig, header.Number),
 		state:     state,
 		ancestors: mapset.NewSet(),
 		family:    mapset.NewSet(),
@@ -799,6 +798,14 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			log.Info("small cross chain verified error", "sender", from)
 			txs.Pop()
 			core.RemoveLocalTx(w.eth.TxPool(), tx.Hash(), true, true)
+		case core.ErrFrozenAccount:
+			log.Info("Skipping frozen account", "sender", from)
+			txs.Pop()
+
+		case core.ErrFrozenAccountsUpdate:
+			log.Info("Invalid frozen accounts update", "sender", from, "hash", tx.Hash())
+			txs.Shift()
+			core.RemoveLocalTx(w.eth.TxPool(), tx.Hash(), true, true)
 		case core.ErrRefunded:
 			log.Info("ErrRefunded  is returned", "sender", from)
 			txs.Pop()
@@ -833,13 +840,13 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 						txhash = hexutil.Encode(tx.Data())
 					} else if len(tx.Data()) > 32 {
 						log.Error("small cross chain run error", "error", err)
-						txhash, _, _, _ = spv.IsSmallCrossTxByData(tx.Data())
+						txhash, _, _, _ = w.chain.MainChainBackend().IsSmallCrossTxByData(tx.Data())
 					}
 					if txhash != "" {
-						_, addr, _ = spv.FindOutputFeeAndaddressByTxHash(txhash)
+						_, addr, _ = w.chain.MainChainBackend().FindOutputFeeAndAddress(txhash)
 						var blackAddr common.Address
 						if addr != blackAddr {
-							spv.OnTx2Failed(txhash)
+							w.chain.MainChainBackend().OnTx2Failed(txhash)
 						}
 					}
 				}
@@ -899,6 +906,10 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		Extra:      w.extra,
 		Time:       uint64(timestamp),
 	}
+	// Set baseFee if we are on an EIP-1559 chain
+	if w.chainConfig.IsEIP1559(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(w.chainConfig, parent.Header())
+	}
 	// Only set the coinbase if our consensus engine is running (avoid spurious block rewards)
 	if w.isRunning() {
 		if w.coinbase == (common.Address{}) {
@@ -943,6 +954,9 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	if w.chainConfig.DAOForkSupport && w.chainConfig.DAOForkBlock != nil && w.chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
 		misc.ApplyDAOHardFork(env.state)
 	}
+	if w.chainConfig.FrozenAccountsBlock != nil && w.chainConfig.FrozenAccountsBlock.Cmp(header.Number) == 0 {
+		core.ApplyFrozenAccountsFork(env.state, w.chainConfig.FrozenAccounts)
+	}
 	// Accumulate the uncles for the current block
 	uncles := make([]*types.Header, 0, 2)
 	commitUncles := func(blocks map[common.Hash]*types.Block) {
@@ -999,13 +1013,13 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		}
 	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs)
+		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs, header.BaseFee)
 		if w.commitTransactions(txs, w.coinbase, interrupt) {
 			return
 		}
 	}
 	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs)
+		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs, header.BaseFee)
 		if w.commitTransactions(txs, w.coinbase, interrupt) {
 			return
 		}
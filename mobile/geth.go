@@ -61,6 +61,11 @@ type NodeConfig struct {
 	// empty genesis state is equivalent to using the mainnet's state.
 	EthereumGenesis string
 
+	// EthereumArbiterCheckpoints is the JSON list of trusted PBFT arbiter sets
+	// the light client verifies the block confirms from. An empty value uses
+	// the sets built in for the genesis.
+	EthereumArbiterCheckpoints string
+
 	// EthereumDatabaseCache is the system memory in MB to allocate for database caching.
 	// A minimum of 16MB is always reserved.
 	EthereumDatabaseCache int
@@ -154,10 +159,17 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 			}
 		}
 	}
+	var arbiterCheckpoints []*params.ArbiterCheckpoint
+	if config.EthereumArbiterCheckpoints != "" {
+		if err := json.Unmarshal([]byte(config.EthereumArbiterCheckpoints), &arbiterCheckpoints); err != nil {
+			return nil, fmt.Errorf("invalid arbiter checkpoints: %v", err)
+		}
+	}
 	// Register the Ethereum protocol if requested
 	if config.EthereumEnabled {
 		ethConf := eth.DefaultConfig
 		ethConf.Genesis = genesis
+		ethConf.ArbiterCheckpoints = arbiterCheckpoints
 		ethConf.SyncMode = downloader.LightSync
 		ethConf.NetworkId = uint64(config.EthereumNetworkID)
 		ethConf.DatabaseCache = config.EthereumDatabaseCache
@@ -54,6 +54,11 @@ var CheckpointOracles = map[common.Hash]*CheckpointOracleConfig{
 	GoerliGenesisHash:  GoerliCheckpointOracle,
 }
 
+// TrustedArbiterCheckpoints associates the known arbiter sets with the genesis
+// hash of the chain they belong to. Light clients follow the producers of the
+// later ELA turns from them.
+var TrustedArbiterCheckpoints = map[common.Hash][]*ArbiterCheckpoint{}
+
 var (
 	// MainnetChainConfig is the chain parameters to run a node on the main network.
 	MainnetChainConfig = &ChainConfig{
@@ -75,6 +80,7 @@ var (
 		LondonBlock:         big.NewInt(19166000),
 		ShanghaiTime:        newUint64(1728360000),
 		DeveloperFeeTime:    newUint64(math.MaxInt64),
+		DeveloperFeeSplits:  []*DeveloperFeeSplit{{Block: big.NewInt(0)}}, // no developer fee
 		Clique: &CliqueConfig{
 			Period: 15,
 			Epoch:  30000,
@@ -147,6 +153,7 @@ var (
 		LondonBlock:         big.NewInt(18022200),
 		ShanghaiTime:        newUint64(1689154397),
 		DeveloperFeeTime:    newUint64(math.MaxInt64),
+		DeveloperFeeSplits:  []*DeveloperFeeSplit{{Block: big.NewInt(0)}}, // no developer fee
 
 		Clique: &CliqueConfig{
 			Period: 15,
@@ -393,6 +400,15 @@ func (c *TrustedCheckpoint) Empty() bool {
 	return c.SectionHead == (common.Hash{}) || c.CHTRoot == (common.Hash{}) || c.BloomRoot == (common.Hash{})
 }
 
+// ArbiterCheckpoint is a trusted set of PBFT producers of the ELA turn working
+// from ElaHeight, used by light clients to verify the confirms of the side
+// chain blocks without the SPV module.
+type ArbiterCheckpoint struct {
+	ElaHeight  uint64   `json:"elaHeight"`
+	Producers  []string `json:"producers"`  // hex encoded public keys in duty order
+	TotalCount uint64   `json:"totalCount"` // count of arbiters the majority is computed from
+}
+
 // CheckpointOracleConfig represents a set of checkpoint contract(which acts as an oracle)
 // config which used for light client checkpoint syncing.
 type CheckpointOracleConfig struct {
@@ -467,6 +483,66 @@ type ChainConfig struct {
 	BridgeContractAddr    string
 	PledgeBillContract    string
 	DeveloperContract     []string
+
+	// DeveloperFeeSplits schedules the share of the transaction fees paid to
+	// the developer fee recipients, superseding DeveloperContract and
+	// DeveloperFeeTime when set.
+	DeveloperFeeSplits []*DeveloperFeeSplit `json:"developerFeeSplits,omitempty"`
+
+	// FrozenAccountsBlock moves the frozen account list on chain. From this
+	// block the list is kept in the storage of FrozenAccountsAddress, seeded
+	// with FrozenAccounts, changed by transactions signed by the arbiters and
+	// enforced by every node. Before it, FrozeAccountList is a local mempool
+	// policy only.
+	FrozenAccountsBlock *big.Int         `json:"frozenAccountsBlock,omitempty"`
+	FrozenAccounts      []common.Address `json:"frozenAccounts,omitempty"`
+
+	// EIP1559Block starts the EIP-1559 fee market: the headers carry a base
+	// fee and the EIP-2718 typed transactions are accepted. It is separate
+	// from LondonBlock, which enabled the London opcodes without base fee.
+	// The base fee paid by user transactions is burnt, only the tip goes to
+	// the block producer and the developer fee split.
+	EIP1559Block *big.Int `json:"eip1559Block,omitempty"`
+
+	// MinBaseFee is the floor of the EIP-1559 base fee, keeping the fee
+	// market alive on chains whose blocks are mostly empty (nil = no floor).
+	MinBaseFee *big.Int `json:"minBaseFee,omitempty"`
+}
+
+// FrozenAccountsAddress is the system account storing the on chain frozen
+// account list. Transactions to it carry the list updates.
+var FrozenAccountsAddress = common.HexToAddress("0x46726f7a656e4163636f756e7473000000000000")
+
+// DeveloperFeeSplit is the developer fee split applied from a block on, until
+// the next entry of the schedule.
+type DeveloperFeeSplit struct {
+	Block      *big.Int         `json:"block"`      // first block the split applies to
+	Ratio      uint64           `json:"ratio"`      // percentage of the transaction fees paid to the recipients
+	Recipients []common.Address `json:"recipients"` // recipients sharing the developer fee equally
+}
+
+// Active reports whether the split pays a developer fee.
+func (s *DeveloperFeeSplit) Active() bool {
+	return s != nil && s.Ratio > 0 && len(s.Recipients) > 0
+}
+
+func (s *DeveloperFeeSplit) equal(o *DeveloperFeeSplit) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	return configNumEqual(s.Block, o.Block) && s.Ratio == o.Ratio && addressesEqual(s.Recipients, o.Recipients)
+}
+
+func addressesEqual(a, b []common.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -498,6 +574,7 @@ type PbftConfig struct {
 	MaxPerLogSize     int64    `json:"maxperlogsize"`
 	MaxNodePerHost    uint32   `json:"maxnodeperhost"` //MaxNodePerHost defines max nodes that one host can establish.
 	DPoSV2StartHeight uint32   `json:"dposv2startheight"`
+	MessageEnvelope   string   `json:"messageenvelope"` // MessageEnvelope defines how the arbiter messages are enveloped: off, sign, require or encrypt.
 	NodeVersion       string
 }
 
@@ -604,6 +681,12 @@ func (c *ChainConfig) IsLondon(num *big.Int) bool {
 	return isForked(c.LondonBlock, num)
 }
 
+// IsEIP1559 returns whether num is either equal to the EIP-1559 fee market
+// fork block or greater.
+func (c *ChainConfig) IsEIP1559(num *big.Int) bool {
+	return isForked(c.EIP1559Block, num)
+}
+
 // IsArrowGlacier returns whether num is either equal to the Arrow Glacier (EIP-4345) fork block or greater.
 func (c *ChainConfig) IsArrowGlacier(num *big.Int) bool {
 	return isForked(c.ArrowGlacierBlock, num)
@@ -641,6 +724,34 @@ func (c *ChainConfig) IsdeveloperSplitfeeTime(time uint64) bool {
 	return isTimestampForked(c.DeveloperFeeTime, time)
 }
 
+// DeveloperFeeSplitAt returns the developer fee split of the block with the
+// given number and time, or nil if no fee is paid to developers. Without a
+// schedule, the legacy split pays half of the fees to DeveloperContract from
+// DeveloperFeeTime on.
+func (c *ChainConfig) DeveloperFeeSplitAt(num *big.Int, time uint64) *DeveloperFeeSplit {
+	if len(c.DeveloperFeeSplits) > 0 {
+		var split *DeveloperFeeSplit
+		for _, s := range c.DeveloperFeeSplits {
+			if !isForked(s.Block, num) {
+				break
+			}
+			split = s
+		}
+		if !split.Active() {
+			return nil
+		}
+		return split
+	}
+	if len(c.DeveloperContract) == 0 || !c.IsdeveloperSplitfeeTime(time) {
+		return nil
+	}
+	split := &DeveloperFeeSplit{Ratio: 50}
+	for _, account := range c.DeveloperContract {
+		split.Recipients = append(split.Recipients, common.HexToAddress(account))
+	}
+	return split
+}
+
 // IsChainIDFork returns whether num represents a block number after the ChainID fork
 func (c *ChainConfig) IsChainIDFork(num *big.Int) bool {
 	return isForked(c.ChainIDBlock, num)
@@ -650,6 +761,12 @@ func (c *ChainConfig) IsPBFTFork(num *big.Int) bool {
 	return isForked(c.PBFTBlock, num)
 }
 
+// IsFrozenAccountsFork returns whether num is either equal to the frozen
+// accounts fork block or greater.
+func (c *ChainConfig) IsFrozenAccountsFork(num *big.Int) bool {
+	return isForked(c.FrozenAccountsBlock, num)
+}
+
 func (c *ChainConfig) GetPbftBlock() uint64 {
 	if c.PBFTBlock == nil {
 		return 0
@@ -721,6 +838,32 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 		}
 		lastFork = cur
 	}
+	if c.EIP1559Block != nil && (c.LondonBlock == nil || c.LondonBlock.Cmp(c.EIP1559Block) > 0) {
+		return fmt.Errorf("unsupported fork ordering: londonBlock enabled at %v, but eip1559Block enabled at %v",
+			c.LondonBlock, c.EIP1559Block)
+	}
+	return c.checkDeveloperFeeSplits()
+}
+
+// checkDeveloperFeeSplits checks that the developer fee schedule is ordered
+// and pays at most the whole fee.
+func (c *ChainConfig) checkDeveloperFeeSplits() error {
+	var last *big.Int
+	for i, split := range c.DeveloperFeeSplits {
+		if split == nil || split.Block == nil {
+			return fmt.Errorf("developer fee split %d has no block", i)
+		}
+		if last != nil && last.Cmp(split.Block) >= 0 {
+			return fmt.Errorf("unsupported developer fee split ordering: block %v after block %v", split.Block, last)
+		}
+		if split.Ratio > 100 {
+			return fmt.Errorf("developer fee split at block %v pays %d%% of the fees", split.Block, split.Ratio)
+		}
+		if split.Ratio > 0 && len(split.Recipients) == 0 {
+			return fmt.Errorf("developer fee split at block %v has no recipients", split.Block)
+		}
+		last = split.Block
+	}
 	return nil
 }
 
@@ -766,9 +909,47 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.EWASMBlock, newcfg.EWASMBlock, head) {
 		return newCompatError("ewasm fork block", c.EWASMBlock, newcfg.EWASMBlock)
 	}
+	if isForkIncompatible(c.FrozenAccountsBlock, newcfg.FrozenAccountsBlock, head) {
+		return newCompatError("Frozen accounts fork block", c.FrozenAccountsBlock, newcfg.FrozenAccountsBlock)
+	}
+	if c.IsFrozenAccountsFork(head) && !addressesEqual(c.FrozenAccounts, newcfg.FrozenAccounts) {
+		return newCompatError("Frozen accounts seed", c.FrozenAccountsBlock, newcfg.FrozenAccountsBlock)
+	}
+	if isForkIncompatible(c.EIP1559Block, newcfg.EIP1559Block, head) {
+		return newCompatError("EIP1559 fork block", c.EIP1559Block, newcfg.EIP1559Block)
+	}
+	if c.IsEIP1559(head) && !configNumEqual(c.MinBaseFee, newcfg.MinBaseFee) {
+		return newCompatError("EIP1559 minimum base fee", c.EIP1559Block, newcfg.EIP1559Block)
+	}
+	if stored, next, ok := developerFeeSplitIncompatible(c.DeveloperFeeSplits, newcfg.DeveloperFeeSplits, head); ok {
+		return newCompatError("Developer fee split", stored, next)
+	}
 	return nil
 }
 
+// developerFeeSplitIncompatible returns the blocks of the first splits of the
+// two schedules which differ while one of them is active at head. A split
+// paying no fee is compatible with no split at all.
+func developerFeeSplitIncompatible(s1, s2 []*DeveloperFeeSplit, head *big.Int) (*big.Int, *big.Int, bool) {
+	for i := 0; i < len(s1) || i < len(s2); i++ {
+		var a, b *DeveloperFeeSplit
+		var blockA, blockB *big.Int
+		if i < len(s1) {
+			a, blockA = s1[i], s1[i].Block
+		}
+		if i < len(s2) {
+			b, blockB = s2[i], s2[i].Block
+		}
+		if !isForked(blockA, head) && !isForked(blockB, head) {
+			break
+		}
+		if !a.equal(b) && (a.Active() || b.Active()) {
+			return blockA, blockB, true
+		}
+	}
+	return nil, nil, false
+}
+
 // isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
 // block s2 because head is already past the fork.
 func isForkIncompatible(s1, s2, head *big.Int) bool {
@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -79,3 +81,104 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestDeveloperFeeSplitCompatible(t *testing.T) {
+	var (
+		dev1 = common.HexToAddress("0x01")
+		dev2 = common.HexToAddress("0x02")
+	)
+	schedule := func(ratio uint64, recipients ...common.Address) []*DeveloperFeeSplit {
+		return []*DeveloperFeeSplit{
+			{Block: big.NewInt(10), Ratio: 50, Recipients: []common.Address{dev1}},
+			{Block: big.NewInt(20), Ratio: ratio, Recipients: recipients},
+		}
+	}
+	tests := []struct {
+		stored, new []*DeveloperFeeSplit
+		head        uint64
+		wantErr     *ConfigCompatError
+	}{
+		{stored: schedule(30, dev1, dev2), new: schedule(30, dev1, dev2), head: 100},
+		{stored: schedule(30, dev1, dev2), new: schedule(40, dev1, dev2), head: 19},
+		{stored: schedule(30, dev1, dev2), new: schedule(30, dev1), head: 19},
+		{stored: nil, new: []*DeveloperFeeSplit{{Block: big.NewInt(0)}}, head: 100},
+		{
+			stored: schedule(30, dev1, dev2),
+			new:    schedule(40, dev1, dev2),
+			head:   20,
+			wantErr: &ConfigCompatError{
+				What:         "Developer fee split",
+				StoredConfig: big.NewInt(20),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     19,
+			},
+		},
+		{
+			stored: schedule(30, dev1, dev2),
+			new:    schedule(30, dev1, dev2)[:1],
+			head:   25,
+			wantErr: &ConfigCompatError{
+				What:         "Developer fee split",
+				StoredConfig: big.NewInt(20),
+				NewConfig:    nil,
+				RewindTo:     19,
+			},
+		},
+	}
+	for i, test := range tests {
+		stored := &ChainConfig{DeveloperFeeSplits: test.stored}
+		err := stored.CheckCompatible(&ChainConfig{DeveloperFeeSplits: test.new}, test.head)
+		if !reflect.DeepEqual(err, test.wantErr) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.wantErr)
+		}
+	}
+}
+
+func TestDeveloperFeeSplitAt(t *testing.T) {
+	var (
+		dev1 = common.HexToAddress("0x01")
+		dev2 = common.HexToAddress("0x02")
+	)
+	config := &ChainConfig{
+		DeveloperFeeSplits: []*DeveloperFeeSplit{
+			{Block: big.NewInt(10), Ratio: 50, Recipients: []common.Address{dev1}},
+			{Block: big.NewInt(20), Ratio: 0},
+			{Block: big.NewInt(30), Ratio: 20, Recipients: []common.Address{dev1, dev2}},
+		},
+	}
+	if err := config.checkDeveloperFeeSplits(); err != nil {
+		t.Fatalf("valid schedule rejected: %v", err)
+	}
+	for _, test := range []struct {
+		number uint64
+		ratio  uint64
+	}{{9, 0}, {10, 50}, {19, 50}, {20, 0}, {30, 20}, {1000, 20}} {
+		split := config.DeveloperFeeSplitAt(new(big.Int).SetUint64(test.number), 0)
+		if test.ratio == 0 && split != nil {
+			t.Errorf("block %d: have split %+v, want none", test.number, split)
+		}
+		if test.ratio != 0 && (split == nil || split.Ratio != test.ratio) {
+			t.Errorf("block %d: have split %+v, want ratio %d", test.number, split, test.ratio)
+		}
+	}
+
+	// Without a schedule, the legacy contracts get half of the fees.
+	legacy := &ChainConfig{DeveloperContract: []string{dev1.Hex()}, DeveloperFeeTime: newUint64(100)}
+	if split := legacy.DeveloperFeeSplitAt(big.NewInt(1), 99); split != nil {
+		t.Errorf("legacy split active before its time: %+v", split)
+	}
+	if split := legacy.DeveloperFeeSplitAt(big.NewInt(1), 100); split == nil || split.Ratio != 50 || split.Recipients[0] != dev1 {
+		t.Errorf("legacy split mismatch: %+v", split)
+	}
+
+	for i, invalid := range [][]*DeveloperFeeSplit{
+		{{Block: big.NewInt(20), Ratio: 10, Recipients: []common.Address{dev1}}, {Block: big.NewInt(10)}},
+		{{Block: big.NewInt(10), Ratio: 101, Recipients: []common.Address{dev1}}},
+		{{Block: big.NewInt(10), Ratio: 10}},
+		{{Ratio: 10, Recipients: []common.Address{dev1}}},
+	} {
+		if err := (&ChainConfig{DeveloperFeeSplits: invalid}).checkDeveloperFeeSplits(); err == nil {
+			t.Errorf("invalid schedule %d accepted", i)
+		}
+	}
+}
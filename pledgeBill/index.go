@@ -0,0 +1,422 @@
+package pledgeBill
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/crypto"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+
+	elaCom "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// The secondary indexes of the pledge bills, kept in the spv transaction db
+// next to the bills.
+const (
+	pledgeStakePreKey      = "elaPledgeStake_"      // stake address, ela hash -> nil
+	pledgeTokenPreKey      = "elaPledgeToken_"      // token id -> ela hash
+	pledgeTokenOwnerPreKey = "elaPledgeTokenOwner_" // token id -> esc owner
+	pledgeOwnerPreKey      = "elaPledgeOwner_"      // esc owner, token id -> nil
+	pledgeOwnerHeightKey   = "elaPledgeOwnerHeight" // last esc block with an indexed transfer
+	pledgeIndexVersionKey  = "elaPledgeIndexVersion"
+
+	pledgeIndexVersion = 1
+
+	// maxPledgeBillListCount caps the pledge bills returned by one listing.
+	maxPledgeBillListCount = 100
+
+	// ownerScanRange is the number of blocks scanned at once for the
+	// transfers made before the node indexed owners.
+	ownerScanRange = 100000
+)
+
+// transferTopic is the topic of the ERC-721 Transfer event.
+var transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+var ownerIndexQuit chan struct{}
+
+var errNoPledgeBills = errors.New("pledge bills not available")
+
+// PledgeBill is a pledge bill saved from the ELA chain with the decoded
+// fields of its CreateNFT payload.
+type PledgeBill struct {
+	ElaTxHash        string          `json:"elaTxHash"`
+	TokenID          string          `json:"tokenID"` // decimal id of the NFT
+	Owner            *common.Address `json:"owner"`   // owner of the NFT on ESC, nil until minted
+	StakeAddress     string          `json:"stakeAddress"`
+	ReferKey         string          `json:"referKey"`
+	GenesisBlockHash string          `json:"genesisBlockHash"`
+	StartHeight      uint32          `json:"startHeight"`
+	EndHeight        uint32          `json:"endHeight"`
+	Votes            string          `json:"votes"`
+	VoteRights       string          `json:"voteRights"`
+	TargetOwnerKey   string          `json:"targetOwnerKey"`
+	PayloadVersion   byte            `json:"payloadVersion"`
+}
+
+// Filter selects the pledge bills matching all of its set fields.
+type Filter struct {
+	StakeAddress string
+	TokenID      *big.Int
+	Owner        *common.Address
+}
+
+func getStakeKey(stakeAddress, elaHash string) string {
+	return pledgeStakePreKey + stakeAddress + "_" + elaHash
+}
+
+func getTokenKey(tokenID *big.Int) string {
+	return pledgeTokenPreKey + tokenHex(tokenID)
+}
+
+func getTokenOwnerKey(tokenID *big.Int) string {
+	return pledgeTokenOwnerPreKey + tokenHex(tokenID)
+}
+
+func getOwnerKey(owner common.Address, tokenID *big.Int) string {
+	return getOwnerPreKey(owner) + tokenHex(tokenID)
+}
+
+func getOwnerPreKey(owner common.Address) string {
+	return pledgeOwnerPreKey + strings.ToLower(owner.Hex()[2:]) + "_"
+}
+
+func tokenHex(tokenID *big.Int) string {
+	return common.BigToHash(tokenID).Hex()[2:]
+}
+
+func normalizeHash(txHash string) string {
+	return strings.ToLower(strings.TrimPrefix(txHash, "0x"))
+}
+
+// indexPledgeBill indexes the pledge bill by stake address and token id.
+func indexPledgeBill(elaHash elaCom.Uint256, stakeAddress string, referKey elaCom.Uint256) error {
+	hash := normalizeHash(elaHash.String())
+	tokenID := new(big.Int).SetBytes(elaCom.GetNFTID(referKey, elaHash).Bytes())
+
+	transactionDBMutex.Lock()
+	defer transactionDBMutex.Unlock()
+	batch := spvTransactiondb.NewBatch()
+	batch.Put([]byte(getStakeKey(stakeAddress, hash)), nil)
+	batch.Put([]byte(getTokenKey(tokenID)), []byte(hash))
+	return batch.Write()
+}
+
+// migrateIndex indexes the pledge bills saved before the indexes existed.
+func migrateIndex() error {
+	if v, err := getData(pledgeIndexVersionKey); err == nil && len(v) > 0 && v[0] >= pledgeIndexVersion {
+		return nil
+	}
+	hashes := listKeySuffixes(pledgeTxPreKey)
+	for _, hash := range hashes {
+		p, _, err := GetCreateNFTPayload(hash)
+		if err != nil {
+			log.Warn("Skip indexing pledge bill", "hash", hash, "error", err)
+			continue
+		}
+		elaHash, err := elaCom.Uint256FromHexString(hash)
+		if err != nil {
+			continue
+		}
+		if err := indexPledgeBill(*elaHash, p.StakeAddress, p.ReferKey); err != nil {
+			return err
+		}
+	}
+	log.Info("Indexed pledge bills", "count", len(hashes))
+	return putData(pledgeIndexVersionKey, []byte{pledgeIndexVersion})
+}
+
+// listKeySuffixes returns the keys with the prefix, stripped of it.
+func listKeySuffixes(prefix string) []string {
+	transactionDBMutex.Lock()
+	defer transactionDBMutex.Unlock()
+
+	suffixes := make([]string, 0)
+	it := spvTransactiondb.NewIteratorWithPrefix([]byte(prefix))
+	defer it.Release()
+	for it.Next() {
+		suffixes = append(suffixes, string(it.Key()[len(prefix):]))
+	}
+	return suffixes
+}
+
+// GetPledgeBill returns the pledge bill saved for the ELA transaction.
+func GetPledgeBill(elaTxHash string) (*PledgeBill, error) {
+	if spvTransactiondb == nil {
+		return nil, errNoPledgeBills
+	}
+	hash := normalizeHash(elaTxHash)
+	p, payloadVersion, err := GetCreateNFTPayload(hash)
+	if err != nil {
+		return nil, err
+	}
+	elaHash, err := elaCom.Uint256FromHexString(hash)
+	if err != nil {
+		return nil, err
+	}
+	nftID := elaCom.GetNFTID(p.ReferKey, *elaHash)
+	tokenID := new(big.Int).SetBytes(nftID.Bytes())
+	bill := &PledgeBill{
+		ElaTxHash:        hash,
+		TokenID:          tokenID.String(),
+		Owner:            getTokenOwner(tokenID),
+		StakeAddress:     p.StakeAddress,
+		ReferKey:         p.ReferKey.String(),
+		GenesisBlockHash: p.GenesisBlockHash.String(),
+		PayloadVersion:   payloadVersion,
+	}
+	// Version 0 payloads carry no vote details
+	if payloadVersion >= payload.CreateNFTVersion2 {
+		bill.StartHeight = p.StartHeight
+		bill.EndHeight = p.EndHeight
+		bill.Votes = p.Votes.String()
+		bill.VoteRights = p.VoteRights.String()
+		bill.TargetOwnerKey = elaCom.BytesToHexString(p.TargetOwnerKey)
+	}
+	return bill, nil
+}
+
+// GetPledgeBillByTokenID returns the pledge bill of the NFT, or nil if no
+// pledge bill of this node has the token id.
+func GetPledgeBillByTokenID(tokenID *big.Int) (*PledgeBill, error) {
+	if spvTransactiondb == nil {
+		return nil, errNoPledgeBills
+	}
+	hash, err := getData(getTokenKey(tokenID))
+	if err != nil || hash == "" {
+		return nil, nil
+	}
+	return GetPledgeBill(hash)
+}
+
+// ListPledgeBills returns at most count pledge bills matching the filter
+// from offset, and the number of bills matching. The bills are ordered by
+// token id when filtered by owner, by ELA transaction hash otherwise.
+func ListPledgeBills(filter Filter, offset, count uint64) ([]*PledgeBill, uint64, error) {
+	if spvTransactiondb == nil {
+		return nil, 0, errNoPledgeBills
+	}
+	// Walk the most selective index, checking the other fields of the
+	// filter on the bills found
+	var hashes []string
+	checks := 0
+	switch {
+	case filter.TokenID != nil:
+		if hash, err := getData(getTokenKey(filter.TokenID)); err == nil && hash != "" {
+			hashes = append(hashes, hash)
+		}
+		checks = countSet(filter.StakeAddress != "", filter.Owner != nil)
+	case filter.Owner != nil:
+		for _, token := range listKeySuffixes(getOwnerPreKey(*filter.Owner)) {
+			tokenID := new(big.Int).SetBytes(common.HexToHash(token).Bytes())
+			// Tokens minted before their bill got saved are skipped
+			if hash, err := getData(getTokenKey(tokenID)); err == nil && hash != "" {
+				hashes = append(hashes, hash)
+			}
+		}
+		checks = countSet(filter.StakeAddress != "")
+	case filter.StakeAddress != "":
+		hashes = listKeySuffixes(pledgeStakePreKey + filter.StakeAddress + "_")
+	default:
+		hashes = listKeySuffixes(pledgeTxPreKey)
+	}
+	if count == 0 || count > maxPledgeBillListCount {
+		count = maxPledgeBillListCount
+	}
+
+	if checks == 0 {
+		total := uint64(len(hashes))
+		if offset >= total {
+			return []*PledgeBill{}, total, nil
+		}
+		end := offset + count
+		if end > total {
+			end = total
+		}
+		bills := make([]*PledgeBill, 0, end-offset)
+		for _, hash := range hashes[offset:end] {
+			bill, err := GetPledgeBill(hash)
+			if err != nil {
+				return nil, 0, err
+			}
+			bills = append(bills, bill)
+		}
+		return bills, total, nil
+	}
+
+	matched := make([]*PledgeBill, 0)
+	for _, hash := range hashes {
+		bill, err := GetPledgeBill(hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		if filter.StakeAddress != "" && bill.StakeAddress != filter.StakeAddress {
+			continue
+		}
+		if filter.Owner != nil && (bill.Owner == nil || *bill.Owner != *filter.Owner) {
+			continue
+		}
+		matched = append(matched, bill)
+	}
+	total := uint64(len(matched))
+	if offset >= total {
+		return []*PledgeBill{}, total, nil
+	}
+	end := offset + count
+	if end > total {
+		end = total
+	}
+	return matched[offset:end], total, nil
+}
+
+func countSet(set ...bool) int {
+	n := 0
+	for _, s := range set {
+		if s {
+			n++
+		}
+	}
+	return n
+}
+
+func getTokenOwner(tokenID *big.Int) *common.Address {
+	v, err := getData(getTokenOwnerKey(tokenID))
+	if err != nil || len(v) != common.AddressLength {
+		return nil
+	}
+	owner := common.BytesToAddress([]byte(v))
+	return &owner
+}
+
+// applyTransfer moves the NFT of the Transfer event to its receiver, or back
+// to its sender if the event was reverted by a reorganisation.
+func applyTransfer(l *types.Log) error {
+	if len(l.Topics) != 4 || l.Topics[0] != transferTopic {
+		return nil
+	}
+	from := common.BytesToAddress(l.Topics[1].Bytes())
+	to := common.BytesToAddress(l.Topics[2].Bytes())
+	tokenID := l.Topics[3].Big()
+	owner := to
+	if l.Removed {
+		owner = from
+	}
+
+	transactionDBMutex.Lock()
+	defer transactionDBMutex.Unlock()
+	batch := spvTransactiondb.NewBatch()
+	if v, err := spvTransactiondb.Get([]byte(getTokenOwnerKey(tokenID))); err == nil && len(v) == common.AddressLength {
+		batch.Delete([]byte(getOwnerKey(common.BytesToAddress(v), tokenID)))
+	}
+	if owner == (common.Address{}) {
+		// Burnt, or the mint reverted
+		batch.Delete([]byte(getTokenOwnerKey(tokenID)))
+	} else {
+		batch.Put([]byte(getTokenOwnerKey(tokenID)), owner.Bytes())
+		batch.Put([]byte(getOwnerKey(owner, tokenID)), nil)
+	}
+	if !l.Removed {
+		height := make([]byte, 8)
+		binary.BigEndian.PutUint64(height, l.BlockNumber)
+		batch.Put([]byte(pledgeOwnerHeightKey), height)
+	}
+	return batch.Write()
+}
+
+func getOwnerHeight() uint64 {
+	v, err := getData(pledgeOwnerHeightKey)
+	if err != nil || len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64([]byte(v))
+}
+
+// startOwnerIndex follows the NFT transfers of the pledge bill contract to
+// index the pledge bills by owner.
+func startOwnerIndex(contract common.Address) {
+	ownerIndexQuit = make(chan struct{})
+	go indexOwners(contract, ownerIndexQuit)
+}
+
+func indexOwners(contract common.Address, quit chan struct{}) {
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{contract},
+		Topics:    [][]common.Hash{{transferTopic}},
+	}
+	// Subscribe before scanning the past blocks to miss no transfer
+	logs := make(chan types.Log, 128)
+	sub, err := escClient.SubscribeFilterLogs(context.Background(), query, logs)
+	if err != nil {
+		log.Error("Failed to subscribe pledge bill transfers", "error", err)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	head, err := escClient.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		log.Error("Failed to index pledge bill owners", "error", err)
+		return
+	}
+	scanned := head.Number.Uint64()
+	for from := getOwnerHeight(); from <= scanned; from += ownerScanRange {
+		to := from + ownerScanRange - 1
+		if to > scanned {
+			to = scanned
+		}
+		query.FromBlock, query.ToBlock = new(big.Int).SetUint64(from), new(big.Int).SetUint64(to)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		past, err := escClient.FilterLogs(ctx, query)
+		cancel()
+		if err != nil {
+			log.Error("Failed to index pledge bill owners", "from", from, "to", to, "error", err)
+			return
+		}
+		for i := range past {
+			if err := applyTransfer(&past[i]); err != nil {
+				log.Error("Failed to index pledge bill owner", "error", err)
+				return
+			}
+		}
+		select {
+		case <-quit:
+			return
+		default:
+		}
+	}
+	log.Info("Indexed pledge bill owners", "head", scanned)
+
+	for {
+		select {
+		case l := <-logs:
+			if !l.Removed && l.BlockNumber <= scanned {
+				continue
+			}
+			if err := applyTransfer(&l); err != nil {
+				log.Error("Failed to index pledge bill owner", "error", err)
+			}
+		case err := <-sub.Err():
+			if err != nil {
+				log.Error("Pledge bill transfer subscription failed", "error", err)
+			}
+			return
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Close stops indexing the pledge bill owners.
+func Close() {
+	if ownerIndexQuit != nil {
+		close(ownerIndexQuit)
+		ownerIndexQuit = nil
+	}
+}
@@ -0,0 +1,140 @@
+package pledgeBill
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/leveldb"
+
+	elaCom "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+func newTestDb(t *testing.T) {
+	db, err := leveldb.New(t.TempDir(), 16, 16, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	spvTransactiondb = db
+	transactionDBMutex = new(sync.RWMutex)
+}
+
+// saveBill saves a pledge bill as ProcessPledgedBill does, indexing it if
+// index is set, and returns its token id.
+func saveBill(t *testing.T, n byte, stakeAddress string, index bool) (elaCom.Uint256, *big.Int) {
+	elaHash := elaCom.Uint256{n}
+	nft := &payload.CreateNFT{
+		ReferKey:       elaCom.Uint256{n, n},
+		StakeAddress:   stakeAddress,
+		StartHeight:    100,
+		EndHeight:      200,
+		Votes:          elaCom.Fixed64(n) * 100000000,
+		VoteRights:     elaCom.Fixed64(n) * 200000000,
+		TargetOwnerKey: []byte{n},
+	}
+	if err := putData(getTxKey(elaHash.String()), nft.Data(payload.CreateNFTVersion2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := putTxPayLoadVersion(getTxVersionKey(elaHash.String()), payload.CreateNFTVersion2); err != nil {
+		t.Fatal(err)
+	}
+	if index {
+		if err := indexPledgeBill(elaHash, stakeAddress, nft.ReferKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return elaHash, new(big.Int).SetBytes(elaCom.GetNFTID(nft.ReferKey, elaHash).Bytes())
+}
+
+func transferLog(from, to common.Address, tokenID *big.Int, number uint64) *types.Log {
+	return &types.Log{
+		Topics:      []common.Hash{transferTopic, from.Hash(), to.Hash(), common.BigToHash(tokenID)},
+		BlockNumber: number,
+	}
+}
+
+func TestPledgeBillIndexes(t *testing.T) {
+	newTestDb(t)
+	hash1, token1 := saveBill(t, 1, "Sstake1", true)
+	_, token2 := saveBill(t, 2, "Sstake1", true)
+	_, token3 := saveBill(t, 3, "Sstake2", true)
+
+	bill, err := GetPledgeBillByTokenID(token1)
+	if err != nil || bill == nil {
+		t.Fatalf("bill of token 1 not found: %v", err)
+	}
+	if bill.ElaTxHash != hash1.String() || bill.StakeAddress != "Sstake1" || bill.Votes != "1" || bill.VoteRights != "2" || bill.EndHeight != 200 {
+		t.Fatalf("unexpected bill %+v", bill)
+	}
+	if bill.Owner != nil {
+		t.Fatalf("unminted bill has owner %s", bill.Owner.Hex())
+	}
+	if bill, _ := GetPledgeBillByTokenID(big.NewInt(1)); bill != nil {
+		t.Fatalf("found bill of unknown token")
+	}
+
+	bills, total, err := ListPledgeBills(Filter{StakeAddress: "Sstake1"}, 0, 0)
+	if err != nil || total != 2 || len(bills) != 2 {
+		t.Fatalf("stake filter: have %d of %d bills, err %v", len(bills), total, err)
+	}
+	bills, total, _ = ListPledgeBills(Filter{}, 1, 1)
+	if total != 3 || len(bills) != 1 {
+		t.Fatalf("page: have %d of %d bills", len(bills), total)
+	}
+
+	// Owners follow the transfers, reverted ones included
+	alice, bob := common.Address{0xa}, common.Address{0xb}
+	for _, l := range []*types.Log{
+		transferLog(common.Address{}, alice, token1, 10),
+		transferLog(common.Address{}, alice, token2, 11),
+		transferLog(common.Address{}, alice, token3, 12),
+		transferLog(alice, bob, token2, 13),
+	} {
+		if err := applyTransfer(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bills, total, _ = ListPledgeBills(Filter{Owner: &alice}, 0, 0)
+	if total != 2 {
+		t.Fatalf("alice owns %d bills, want 2", total)
+	}
+	bills, total, _ = ListPledgeBills(Filter{Owner: &alice, StakeAddress: "Sstake1"}, 0, 0)
+	if total != 1 || bills[0].TokenID != token1.String() {
+		t.Fatalf("alice owns %d bills of Sstake1, want token 1", total)
+	}
+	removed := transferLog(alice, bob, token2, 13)
+	removed.Removed = true
+	if err := applyTransfer(removed); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ = ListPledgeBills(Filter{Owner: &bob}, 0, 0); total != 0 {
+		t.Fatalf("bob owns %d bills after the reorg, want 0", total)
+	}
+	if bill, _ := GetPledgeBillByTokenID(token2); bill.Owner == nil || *bill.Owner != alice {
+		t.Fatalf("token 2 not back to alice")
+	}
+	if height := getOwnerHeight(); height != 13 {
+		t.Fatalf("owner height %d, want 13", height)
+	}
+}
+
+func TestPledgeBillIndexMigration(t *testing.T) {
+	newTestDb(t)
+	_, token := saveBill(t, 1, "Sstake1", false)
+	if bill, _ := GetPledgeBillByTokenID(token); bill != nil {
+		t.Fatalf("found bill not indexed")
+	}
+	if err := migrateIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if bill, _ := GetPledgeBillByTokenID(token); bill == nil {
+		t.Fatalf("bill not indexed by migration")
+	}
+	if _, total, _ := ListPledgeBills(Filter{StakeAddress: "Sstake1"}, 0, 0); total != 1 {
+		t.Fatalf("have %d bills of Sstake1 after migration, want 1", total)
+	}
+}
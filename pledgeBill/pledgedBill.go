@@ -8,8 +8,10 @@ import (
 	"sync"
 
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethclient"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/leveldb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/smallcrosstx"
 
@@ -32,6 +34,7 @@ var (
 	signerAddress      common.Address
 
 	escClient *ethclient.Client
+	eventMux  *event.TypeMux
 )
 
 func Init(spvDb *leveldb.Database, dbMutex *sync.RWMutex, contractAddress string, signer common.Address, ipcClient *ethclient.Client) {
@@ -40,6 +43,18 @@ func Init(spvDb *leveldb.Database, dbMutex *sync.RWMutex, contractAddress string
 	pledgeBillContract = contractAddress
 	signerAddress = signer
 	escClient = ipcClient
+
+	if err := migrateIndex(); err != nil {
+		log.Error("Failed to index pledge bills", "error", err)
+	}
+	if escClient != nil && common.IsHexAddress(contractAddress) {
+		startOwnerIndex(common.HexToAddress(contractAddress))
+	}
+}
+
+// SetEventMux sets the mux processed pledge bills are announced on.
+func SetEventMux(evtMux *event.TypeMux) {
+	eventMux = evtMux
 }
 
 func getTxKey(key string) string {
@@ -94,6 +109,12 @@ func ProcessPledgedBill(elaTx it.Transaction) {
 	if err != nil {
 		log.Error("putTxPayLoadVersion failed", "save data error", err.Error())
 	}
+	if err := indexPledgeBill(elaTx.Hash(), createNft.StakeAddress, createNft.ReferKey); err != nil {
+		log.Error("indexPledgeBill failed", "save data error", err.Error())
+	}
+	if eventMux != nil {
+		go eventMux.Post(events.CrossChainEvent{Kind: events.PledgeBillProcessed, ElaTxHash: elaTx.Hash().String()})
+	}
 }
 
 func GetPledgeBillData(txHash string) (sAddress string, tokenID *big.Int, err error) {
@@ -0,0 +1,282 @@
+package smallcrosstx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+
+	elatx "github.com/elastos/Elastos.ELA/core/transaction"
+	"github.com/elastos/Elastos.ELA/core/types/interfaces"
+	elaCrypto "github.com/elastos/Elastos.ELA/crypto"
+)
+
+const (
+	// aggregationPrefix + elaTxHash -> rlp(Aggregation)
+	aggregationPrefix = "small_cross_agg"
+
+	// maxPendingAggregations caps the small cross chain transactions
+	// collecting signatures at the same time.
+	maxPendingAggregations = 4096
+
+	// pendingExpiry is the number of ESC blocks a small cross chain
+	// transaction may wait for its next signature before it is dropped.
+	pendingExpiry = 7200
+
+	// confirmedExpiry is the number of ESC blocks a confirmed small cross
+	// chain transaction is kept for the recharge to be sent.
+	confirmedExpiry = 120960
+)
+
+var (
+	ErrSignatureVerified = errors.New("verified this signature")
+	ErrNoArbiterSigned   = errors.New("signature of no pending arbiter")
+	ErrTooManyPending    = errors.New("too many pending small cross txs")
+)
+
+// Aggregation is the signature collection state of one small cross chain
+// transaction.
+type Aggregation struct {
+	ElaTxHash   string
+	RawTx       string
+	ElaHeight   uint64   // ELA height of the arbiter set the signatures were verified with
+	Arbiters    []string // arbiter set the signatures were verified with
+	Total       uint64   // count of arbiters the majority is computed from
+	Signers     []string // arbiters whose signature was verified, in arrival order
+	Signatures  []string // signatures of the signers
+	BlockHeight uint64   // ESC height the last signature was accepted at
+	Confirmed   bool     // whether the majority of signatures was reached
+}
+
+func (agg *Aggregation) copy() *Aggregation {
+	cpy := *agg
+	cpy.Arbiters = append([]string(nil), agg.Arbiters...)
+	cpy.Signers = append([]string(nil), agg.Signers...)
+	cpy.Signatures = append([]string(nil), agg.Signatures...)
+	return &cpy
+}
+
+func (agg *Aggregation) hasSigner(arbiter string) bool {
+	for _, signer := range agg.Signers {
+		if signer == arbiter {
+			return true
+		}
+	}
+	return false
+}
+
+func (agg *Aggregation) hasSignature(signature string) bool {
+	for _, sig := range agg.Signatures {
+		if sig == signature {
+			return true
+		}
+	}
+	return false
+}
+
+// setArbiters switches to the arbiter set of another ELA height, dropping
+// the signatures of the arbiters who left.
+func (agg *Aggregation) setArbiters(arbiters []string, total int, elaHeight uint64) {
+	members := make(map[string]struct{}, len(arbiters))
+	for _, arbiter := range arbiters {
+		members[arbiter] = struct{}{}
+	}
+	var signers, signatures []string
+	for i, signer := range agg.Signers {
+		if _, ok := members[signer]; ok {
+			signers = append(signers, signer)
+			signatures = append(signatures, agg.Signatures[i])
+		}
+	}
+	agg.Signers, agg.Signatures = signers, signatures
+	agg.Arbiters = append([]string(nil), arbiters...)
+	agg.Total = uint64(total)
+	agg.ElaHeight = elaHeight
+}
+
+// Aggregator collects the arbiter signatures of the small cross chain
+// transactions. Its state is stored in the database as it changes, so a node
+// restarting mid-collection neither loses the signatures it verified nor
+// counts an arbiter twice.
+type Aggregator struct {
+	db ethdb.KeyValueStore
+
+	lock    sync.Mutex
+	entries map[string]*Aggregation
+}
+
+// NewAggregator creates an aggregator resuming the collections stored in the
+// database.
+func NewAggregator(db ethdb.KeyValueStore) (*Aggregator, error) {
+	a := &Aggregator{
+		db:      db,
+		entries: make(map[string]*Aggregation),
+	}
+	it := db.NewIteratorWithPrefix([]byte(aggregationPrefix))
+	defer it.Release()
+	for it.Next() {
+		agg := new(Aggregation)
+		if err := rlp.DecodeBytes(it.Value(), agg); err != nil {
+			log.Error("Invalid small cross tx aggregation RLP", "key", string(it.Key()), "err", err)
+			continue
+		}
+		a.entries[agg.ElaTxHash] = agg
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	log.Info("Loaded small cross tx aggregations", "count", len(a.entries))
+	return a, nil
+}
+
+// Add verifies the signature of rawTx against the arbiters of the ELA height
+// and records it. It returns the aggregation after the signature, and the
+// arbiter who signed.
+func (a *Aggregator) Add(arbiters []string, total int, elaHeight uint64, signature, rawTx string,
+	blockNumber uint64) (*Aggregation, string, error) {
+	buff, txn, err := decodeRawTx(rawTx)
+	if err != nil {
+		return nil, "", err
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, "", err
+	}
+	elaHash := normalizeHash(txn.Hash().String())
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.expire(blockNumber)
+	agg := a.entries[elaHash]
+	if agg == nil {
+		if len(a.entries) >= maxPendingAggregations {
+			return nil, "", ErrTooManyPending
+		}
+		agg = &Aggregation{ElaTxHash: elaHash, RawTx: rawTx}
+	} else {
+		agg = agg.copy()
+	}
+	if agg.Confirmed {
+		return nil, "", ErrAllReadyConfirm
+	}
+	if agg.hasSignature(signature) {
+		return nil, "", ErrSignatureVerified
+	}
+	if len(agg.Arbiters) == 0 || agg.ElaHeight != elaHeight {
+		agg.setArbiters(arbiters, total, elaHeight)
+	}
+	signer := ""
+	for _, pubkey := range agg.Arbiters {
+		if agg.hasSigner(pubkey) {
+			continue
+		}
+		pubKey, err := elaCrypto.DecodePoint(common.Hex2Bytes(pubkey))
+		if err != nil {
+			log.Error("arbiter is error", "error", err)
+			return nil, "", err
+		}
+		if elaCrypto.Verify(*pubKey, buff, sig) == nil {
+			signer = pubkey
+			break
+		}
+	}
+	if signer == "" {
+		return nil, "", ErrNoArbiterSigned
+	}
+	agg.Signers = append(agg.Signers, signer)
+	agg.Signatures = append(agg.Signatures, signature)
+	agg.BlockHeight = blockNumber
+	agg.Confirmed = len(agg.Signers) >= GetMaxArbitersSign(int(agg.Total))
+
+	if err := a.write(agg); err != nil {
+		return nil, "", err
+	}
+	a.entries[elaHash] = agg
+	return agg.copy(), signer, nil
+}
+
+// Get returns the aggregation of the ELA transaction, or nil.
+func (a *Aggregator) Get(elaHash string) *Aggregation {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if agg := a.entries[normalizeHash(elaHash)]; agg != nil {
+		return agg.copy()
+	}
+	return nil
+}
+
+// Remove forgets the aggregation of the ELA transaction.
+func (a *Aggregator) Remove(elaHash string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.remove(normalizeHash(elaHash))
+}
+
+// expire drops the aggregations which did not progress in time.
+func (a *Aggregator) expire(blockNumber uint64) {
+	for elaHash, agg := range a.entries {
+		expiry := uint64(pendingExpiry)
+		if agg.Confirmed {
+			expiry = confirmedExpiry
+		}
+		if agg.BlockHeight+expiry < blockNumber {
+			log.Info("Small cross tx aggregation expired", "elaTx", elaHash, "signatures", len(agg.Signers), "confirmed", agg.Confirmed)
+			a.remove(elaHash)
+		}
+	}
+}
+
+func (a *Aggregator) remove(elaHash string) {
+	delete(a.entries, elaHash)
+	if err := a.db.Delete(aggregationKey(elaHash)); err != nil {
+		log.Error("Failed to delete small cross tx aggregation", "elaTx", elaHash, "err", err)
+	}
+}
+
+func (a *Aggregator) write(agg *Aggregation) error {
+	data, err := rlp.EncodeToBytes(agg)
+	if err != nil {
+		return err
+	}
+	return a.db.Put(aggregationKey(agg.ElaTxHash), data)
+}
+
+// transaction decodes the ELA transaction of the aggregation.
+func (agg *Aggregation) transaction() (interfaces.Transaction, error) {
+	_, txn, err := decodeRawTx(agg.RawTx)
+	return txn, err
+}
+
+func decodeRawTx(rawTx string) ([]byte, interfaces.Transaction, error) {
+	buff, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bytes.NewReader(buff)
+	txn, err := elatx.GetTransactionByBytes(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := txn.Deserialize(r); err != nil {
+		log.Error("[Small-Transfer] Decode transaction error", "err", err)
+		return nil, nil, err
+	}
+	return buff, txn, nil
+}
+
+func aggregationKey(elaHash string) []byte {
+	return []byte(aggregationPrefix + elaHash)
+}
+
+func normalizeHash(elaHash string) string {
+	return strings.ToLower(strings.TrimPrefix(elaHash, "0x"))
+}
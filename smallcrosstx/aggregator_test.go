@@ -0,0 +1,155 @@
+package smallcrosstx
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/memorydb"
+
+	elatx "github.com/elastos/Elastos.ELA/core/transaction"
+	common2 "github.com/elastos/Elastos.ELA/core/types/common"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	elaCrypto "github.com/elastos/Elastos.ELA/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+type testArbiter struct {
+	key    *ecdsa.PrivateKey
+	public string
+}
+
+func newTestArbiters(t *testing.T, n int) []*testArbiter {
+	arbiters := make([]*testArbiter, n)
+	for i := range arbiters {
+		key, err := ecdsa.GenerateKey(elaCrypto.DefaultCurve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		public, err := (&elaCrypto.PublicKey{X: key.X, Y: key.Y}).EncodePoint(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arbiters[i] = &testArbiter{key: key, public: common.Bytes2Hex(public)}
+	}
+	return arbiters
+}
+
+func publicKeys(arbiters ...*testArbiter) []string {
+	list := make([]string, len(arbiters))
+	for i, arbiter := range arbiters {
+		list[i] = arbiter.public
+	}
+	return list
+}
+
+// sign signs the raw transaction, every call giving another signature.
+func (a *testArbiter) sign(t *testing.T, rawTx string) string {
+	data, _ := hex.DecodeString(rawTx)
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, elaCrypto.SignatureLength)
+	r.FillBytes(signature[:elaCrypto.SignerLength])
+	s.FillBytes(signature[elaCrypto.SignerLength:])
+	return hex.EncodeToString(signature)
+}
+
+func newTestRawTx(t *testing.T, lockTime uint32) string {
+	tx := elatx.CreateTransaction(common2.TxVersion09, common2.TransferCrossChainAsset, 0,
+		&payload.TransferCrossChainAsset{}, nil, nil, nil, lockTime, nil)
+	buf := new(bytes.Buffer)
+	if err := tx.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func TestAggregatorRestart(t *testing.T) {
+	var (
+		db       = memorydb.New()
+		arbiters = newTestArbiters(t, 4)
+		members  = publicKeys(arbiters...)
+		rawTx    = newTestRawTx(t, 1)
+	)
+	a, err := NewAggregator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := arbiters[0].sign(t, rawTx)
+	agg, signer, err := a.Add(members, 4, 100, first, rawTx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, arbiters[0].public, signer)
+	assert.Len(t, agg.Signers, 1)
+
+	_, _, err = a.Add(members, 4, 100, first, rawTx, 11)
+	assert.Equal(t, ErrSignatureVerified, err)
+
+	// After a restart, another signature of the same arbiter is not counted.
+	a, err = NewAggregator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = a.Add(members, 4, 100, arbiters[0].sign(t, rawTx), rawTx, 11)
+	assert.Equal(t, ErrNoArbiterSigned, err)
+
+	_, _, err = a.Add(members, 4, 100, arbiters[1].sign(t, rawTx), rawTx, 12)
+	assert.NoError(t, err)
+	agg, _, err = a.Add(members, 4, 100, arbiters[2].sign(t, rawTx), rawTx, 13)
+	assert.NoError(t, err)
+	assert.True(t, agg.Confirmed)
+	assert.Equal(t, uint64(13), agg.BlockHeight)
+
+	_, _, err = a.Add(members, 4, 100, arbiters[3].sign(t, rawTx), rawTx, 14)
+	assert.Equal(t, ErrAllReadyConfirm, err)
+
+	a.Remove(agg.ElaTxHash)
+	a, _ = NewAggregator(db)
+	assert.Nil(t, a.Get(agg.ElaTxHash))
+}
+
+func TestAggregatorArbiterChange(t *testing.T) {
+	var (
+		arbiters = newTestArbiters(t, 5)
+		rawTx    = newTestRawTx(t, 2)
+	)
+	a, _ := NewAggregator(memorydb.New())
+	_, _, err := a.Add(publicKeys(arbiters[:4]...), 4, 100, arbiters[0].sign(t, rawTx), rawTx, 10)
+	assert.NoError(t, err)
+	_, _, err = a.Add(publicKeys(arbiters[:4]...), 4, 100, arbiters[1].sign(t, rawTx), rawTx, 11)
+	assert.NoError(t, err)
+
+	// The signature of the arbiter who left the set is dropped.
+	agg, _, err := a.Add(publicKeys(arbiters[1:]...), 4, 200, arbiters[4].sign(t, rawTx), rawTx, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), agg.ElaHeight)
+	assert.Equal(t, publicKeys(arbiters[1], arbiters[4]), agg.Signers)
+	assert.Len(t, agg.Signatures, 2)
+	assert.False(t, agg.Confirmed)
+}
+
+func TestAggregatorExpiry(t *testing.T) {
+	var (
+		arbiters = newTestArbiters(t, 4)
+		members  = publicKeys(arbiters...)
+		stale    = newTestRawTx(t, 3)
+		rawTx    = newTestRawTx(t, 4)
+	)
+	a, _ := NewAggregator(memorydb.New())
+	agg, _, err := a.Add(members, 4, 100, arbiters[0].sign(t, stale), stale, 10)
+	assert.NoError(t, err)
+
+	_, _, err = a.Add(members, 4, 100, arbiters[0].sign(t, rawTx), rawTx, 10+pendingExpiry)
+	assert.NoError(t, err)
+	assert.NotNil(t, a.Get(agg.ElaTxHash))
+
+	_, _, err = a.Add(members, 4, 100, arbiters[1].sign(t, rawTx), rawTx, 11+pendingExpiry)
+	assert.NoError(t, err)
+	assert.Nil(t, a.Get(agg.ElaTxHash))
+}
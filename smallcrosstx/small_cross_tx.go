@@ -2,123 +2,89 @@ package smallcrosstx
 
 import (
 	"bytes"
-	"encoding/binary"
-	"encoding/hex"
 	"errors"
-	"strconv"
-	"sync"
+	"path/filepath"
 
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/leveldb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/memorydb"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
-	elatx "github.com/elastos/Elastos.ELA/core/transaction"
-	elaCrypto "github.com/elastos/Elastos.ELA/crypto"
 )
 
-var (
-	mulCountPti sync.RWMutex
+const (
+	databaseCache = 16
+	handles       = 16
+)
 
+var (
 	eventMux *event.TypeMux
 
-	smallCrossTxCountMap = make(map[string]int)
-
-	verifiedArbiter = make(map[string][]string)
-
-	smallCrossTxMsgMap = make(map[string]bool)
-
-	smallCrossTxDb = make(map[string][]byte)
+	smallCrossTxDb ethdb.KeyValueStore
 
-	SmallTxDB_SIG_PRE = "small_cross_sig"
-
-	SmallTxDB_TX_PRE = "small_cross_tx"
-
-	SmallTxDB_SIGCOUNT_PRE = "small_cross_sigcount"
-
-	SmallTxDB_BLOCKHEIGHT_PRE = "small_cross_blockNumber"
+	aggregator *Aggregator
 
 	ErrNotFound = "leveldb: not found"
 
 	ErrAllReadyConfirm = errors.New("smallCroTxConfirmed")
 )
 
-//Spv database initialization
-func SmallCrossTxInit(datadir string, evtMux *event.TypeMux) {
-	eventMux = evtMux
-}
-
-func OnSmallCrossTx(arbiters []string, total int, signature, rawTx string,
-	blockNumber uint64) error {
-	if smallCrossTxDb == nil || eventMux == nil {
-		return errors.New("smallCrossTxDb is nil")
-	}
-	if smallCrossTxMsgMap[rawTx] == true {
-		return ErrAllReadyConfirm
-	}
-	buff, err := hex.DecodeString(rawTx)
-	if err != nil {
-		return err
+// SmallCrossTxInit opens the database of the signatures collected for the
+// small cross chain transactions, in memory if datadir is empty.
+func SmallCrossTxInit(datadir string, evtMux *event.TypeMux) error {
+	var db ethdb.KeyValueStore
+	if datadir == "" {
+		db = memorydb.New()
+	} else {
+		ldb, err := leveldb.New(filepath.Join(datadir, "small_cross_tx.db"), databaseCache, handles, "eth/db/smallcrosstx/")
+		if err != nil {
+			return err
+		}
+		db = ldb
 	}
-	r := bytes.NewReader(buff)
-	txn, err := elatx.GetTransactionByBytes(r)
-	err = txn.Deserialize(r)
+	agg, err := NewAggregator(db)
 	if err != nil {
-		log.Error("[Small-Transfer] Decode transaction error", err.Error())
+		db.Close()
 		return err
 	}
-	count := 0
-	ctx := GetSmallCrossTxMsg(txn.Hash().String())
-	if ctx != nil {
-		if ctx.VerifiedSignature(signature) {
-			return errors.New("verified this signature")
-		}
-		count = len(ctx.Signatures)
+	smallCrossTxDb, aggregator, eventMux = db, agg, evtMux
+	return nil
+}
+
+// Close closes the database of the collected signatures.
+func Close() {
+	if smallCrossTxDb != nil {
+		smallCrossTxDb.Close()
 	}
-	maxSignCount := GetMaxArbitersSign(total)
-	if count >= maxSignCount {
-		return ErrAllReadyConfirm
+}
+
+// OnSmallCrossTx records the signature of rawTx by one of the arbiters of
+// the ELA height, received at the ESC block number.
+func OnSmallCrossTx(arbiters []string, total int, elaHeight uint64, signature, rawTx string,
+	blockNumber uint64) error {
+	if aggregator == nil || eventMux == nil {
+		return errors.New("smallCrossTxDb is nil")
 	}
-	sig, err := hex.DecodeString(signature)
+	agg, signer, err := aggregator.Add(arbiters, total, elaHeight, signature, rawTx, blockNumber)
 	if err != nil {
 		return err
 	}
-	mulCountPti.Lock()
-	defer mulCountPti.Unlock()
-	for _, pubkey := range arbiters {
-		if isArbiterVerified(pubkey, txn.Hash().String()) {
-			continue
-		}
-		pub := common.Hex2Bytes(pubkey)
-		pubKey, err := elaCrypto.DecodePoint(pub)
+	count := len(agg.Signers)
+	log.Info("OnSmallCrossTx verified ", "count", count, "maxSignCount", GetMaxArbitersSign(int(agg.Total)))
+	go eventMux.Post(events.CrossChainEvent{
+		Kind:       events.SmallCrossTxSignature,
+		ElaTxHash:  agg.ElaTxHash,
+		Signer:     signer,
+		Signatures: hexutil.Uint(count),
+	})
+	if agg.Confirmed {
+		txn, err := agg.transaction()
 		if err != nil {
-			log.Error("arbiter is error", "error", err)
 			return err
 		}
-		err = elaCrypto.Verify(*pubKey, buff, sig)
-		if err == nil {
-			if count == 0 {
-				err = PutSmallTxData(rawTx, txn.Hash().String())
-				if err != nil {
-					return err
-				}
-			}
-			count++
-			log.Info("OnSmallCrossTx verified ", "count", count, "maxSignCount", maxSignCount)
-			if count <= maxSignCount {
-				err = PutSmallTxSignature(signature, txn.Hash().String(), count-1, blockNumber)
-				if err != nil {
-					return err
-				}
-				list := verifiedArbiter[txn.Hash().String()]
-				verifiedArbiter[txn.Hash().String()] = append(list, pubkey)
-				smallCrossTxCountMap[txn.Hash().String()] = count
-			}
-			break
-		}
-	}
-	if count >= maxSignCount {
-		smallCrossTxMsgMap[rawTx] = true
-		delete(verifiedArbiter, txn.Hash().String())
 		eventMux.Post(events.CmallCrossTx{Tx: txn})
 	}
 	return nil
@@ -128,138 +94,35 @@ func GetMaxArbitersSign(total int) int {
 	return total*2/3 + 1
 }
 
-func OnReceivedSmallCroTxFromDirectNet(arbiters [][]byte, total int, signature,
+func OnReceivedSmallCroTxFromDirectNet(arbiters [][]byte, total int, elaHeight uint64, signature,
 	rawTx string, blockHeight uint64) {
 	list := make([]string, len(arbiters))
 	for i, arbiter := range arbiters {
 		list[i] = common.Bytes2Hex(arbiter)
 	}
-	err := OnSmallCrossTx(list, total, signature, rawTx, blockHeight)
+	err := OnSmallCrossTx(list, total, elaHeight, signature, rawTx, blockHeight)
 	if err != nil {
 		log.Error("OnReceivedSmallCroTxFromDirectNet", "OnSmallCrossTx error", err)
 	}
 }
 
-func isArbiterVerified(arbiter string, txid string) bool {
-	list := verifiedArbiter[txid]
-	for _, pbk := range list {
-		if pbk == arbiter {
-			return true
-		}
-	}
-	return false
-}
-
-func PutSmallTxData(rawTx string, elaHash string) error {
-	if smallCrossTxDb == nil {
-		return errors.New("smallCrossTxDb is nil")
-	}
-	if elaHash[:2] == "0x" {
-		elaHash = elaHash[2:]
-	}
-	key := SmallTxDB_TX_PRE + elaHash
-	smallCrossTxDb[key] = []byte(rawTx)
-	return nil
-}
-
-func PutSmallTxSignature(signature string, elaHash string, count int,
-	blockNumber uint64) error {
-	if smallCrossTxDb == nil {
-		return errors.New("smallCrossTxDb is nil")
-	}
-	if elaHash[:2] == "0x" {
-		elaHash = elaHash[2:]
-	}
-	keyCount := SmallTxDB_SIGCOUNT_PRE + elaHash
-	smallCrossTxDb[keyCount] = IntToBytes(uint64(count))
-
-	num := strconv.Itoa(count)
-	key := SmallTxDB_SIG_PRE + elaHash + num
-	smallCrossTxDb[key] = []byte(signature)
-
-	key = SmallTxDB_BLOCKHEIGHT_PRE + elaHash
-	smallCrossTxDb[key] = IntToBytes(blockNumber)
-	return nil
-}
-
-func GetArbiterSignCount(elaHash string) (int, error) {
-	if smallCrossTxDb == nil {
-		return 0, errors.New("smallCrossTxDb is nil")
-	}
-	if elaHash[:2] == "0x" {
-		elaHash = elaHash[2:]
-	}
-	keyCount := SmallTxDB_SIGCOUNT_PRE + elaHash
-	if data, ok := smallCrossTxDb[keyCount]; ok {
-		count := BytesToInt(data)
-		return int(count), nil
-	}
-	err := errors.New("can not find this small transaction:" + elaHash)
-	return 0, err
-}
-
-func GetReiceivedBlockHeight(elaHash string) (uint64, error) {
-	if smallCrossTxDb == nil {
-		return 0, errors.New("smallCrossTxDb is nil")
-	}
-	if elaHash[:2] == "0x" {
-		elaHash = elaHash[2:]
-	}
-	key := SmallTxDB_BLOCKHEIGHT_PRE + elaHash
-	if data, ok := smallCrossTxDb[key]; ok {
-		height := BytesToInt(data)
-		return height, nil
-	}
-	err := errors.New("can not find this small transaction:" + elaHash)
-	return 0, err
-}
-
+// GetSmallCrossTxMsg returns the signatures collected for the ELA
+// transaction, or nil.
 func GetSmallCrossTxMsg(elaHash string) *SmallCrossTx {
-	if smallCrossTxDb == nil {
+	if aggregator == nil {
 		return nil
 	}
-	mulCountPti.Lock()
-	defer mulCountPti.Unlock()
-	if elaHash[:2] == "0x" {
-		elaHash = elaHash[2:]
-	}
-	key := SmallTxDB_TX_PRE + elaHash
-	rawTxData := smallCrossTxDb[key]
-	if len(rawTxData) == 0 {
+	agg := aggregator.Get(elaHash)
+	if agg == nil || len(agg.Signatures) == 0 {
 		log.Error("GetSmallCrossTxMsg rawTx failed", "elaHash", elaHash)
 		return nil
 	}
-
-	count, err := GetArbiterSignCount(elaHash)
-	if err != nil {
-		log.Error("GetArbiterSignCount failed", "elaHash", elaHash, "error", err)
-		return nil
-	}
-	sigList := make([]string, 0)
-	for i := 0; i <= count; i++ {
-		num := strconv.Itoa(i)
-		key = SmallTxDB_SIG_PRE + elaHash + num
-		data := smallCrossTxDb[key]
-		if len(data) == 0 {
-			log.Error("GetSmallCrossTxMsg signature failed", "elaHash", elaHash, "index", i, "count", count)
-			return nil
-		}
-		sigList = append(sigList, string(data))
-	}
-
-	height, err := GetReiceivedBlockHeight(elaHash)
-	if err != nil {
-		log.Error("GetReiceivedBlockHeight failed", "elaHash", elaHash, "error", err)
-		return nil
+	return &SmallCrossTx{
+		RawTxID:     agg.ElaTxHash,
+		RawTx:       agg.RawTx,
+		Signatures:  agg.Signatures,
+		BlockHeight: agg.BlockHeight,
 	}
-
-	msg := SmallCrossTx{
-		RawTxID:     elaHash,
-		RawTx:       string(rawTxData),
-		Signatures:  sigList,
-		BlockHeight: height,
-	}
-	return &msg
 }
 
 func GetSmallCrossTxBytes(elaHash string) ([]byte, *SmallCrossTx, error) {
@@ -275,51 +138,11 @@ func GetSmallCrossTxBytes(elaHash string) ([]byte, *SmallCrossTx, error) {
 	return data.Bytes(), tx, nil
 }
 
-func IntToBytes(n uint64) []byte {
-	buffer := bytes.NewBuffer([]byte{})
-	binary.Write(buffer, binary.BigEndian, n)
-	return buffer.Bytes()
-}
-
-func BytesToInt(b []byte) uint64 {
-	buffer := bytes.NewBuffer(b)
-	var n uint64
-	binary.Read(buffer, binary.BigEndian, &n)
-	return n
-}
-
+// OnSmallTxSuccess forgets the signatures of a small cross chain transaction
+// once its recharge is packed.
 func OnSmallTxSuccess(elaHash string) {
-	if smallCrossTxDb == nil {
-		return
-	}
-	if elaHash[:2] == "0x" {
-		elaHash = elaHash[2:]
-	}
-	count, err := GetArbiterSignCount(elaHash)
-	if err != nil {
-		log.Info("GetArbiterSignCount error", "error", err)
+	if aggregator == nil {
 		return
 	}
-	key := ""
-	for i := 0; i <= count; i++ {
-		num := strconv.Itoa(i)
-		key = SmallTxDB_SIG_PRE + elaHash + num
-		delete(smallCrossTxDb, key)
-	}
-	keyCount := SmallTxDB_SIGCOUNT_PRE + elaHash
-	delete(smallCrossTxDb, keyCount)
-
-	key = SmallTxDB_TX_PRE + elaHash
-	rawTxData := smallCrossTxDb[key]
-	delete(smallCrossTxMsgMap, string(rawTxData))
-	delete(smallCrossTxDb, key)
-
-	key = SmallTxDB_BLOCKHEIGHT_PRE + elaHash
-	delete(smallCrossTxDb, key)
-	if smallCrossTxCountMap[elaHash] > 0 {
-		delete(smallCrossTxCountMap, elaHash)
-	}
-	if _, ok := verifiedArbiter[elaHash]; ok {
-		delete(verifiedArbiter, elaHash)
-	}
+	aggregator.Remove(elaHash)
 }
@@ -0,0 +1,49 @@
+package spv
+
+import (
+	"encoding/hex"
+
+	spv "github.com/elastos/Elastos.ELA.SPV/interface"
+	"github.com/elastos/Elastos.ELA.SPV/interface/store"
+)
+
+// ArbitersStore reads the arbiters recorded by the SPV module from its local
+// data directory, for tools running without the SPV service. The node owning
+// the directory must not be running.
+type ArbitersStore struct {
+	db store.DataStore
+}
+
+// OpenArbitersStore opens the SPV data store of the given configuration.
+func OpenArbitersStore(cfg *Config) (*ArbitersStore, error) {
+	chainParams := newChainParams(cfg.ActiveNet, &spv.Config{DataDir: cfg.DataDir})
+	var originArbiters [][]byte
+	for _, a := range chainParams.DPoSConfiguration.CRCArbiters {
+		v, err := hex.DecodeString(a)
+		if err != nil {
+			return nil, err
+		}
+		originArbiters = append(originArbiters, v)
+	}
+	db, err := store.NewDataStore(cfg.DataDir, originArbiters,
+		len(chainParams.DPoSConfiguration.CRCArbiters)*3, cfg.GenesisAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &ArbitersStore{db: db}, nil
+}
+
+// GetProducers returns the producers of the turn working at the ELA height,
+// as GetProducers does with the running SPV service.
+func (s *ArbitersStore) GetProducers(elaHeight uint64) ([][]byte, int, error) {
+	crcArbiters, normalArbitrs, err := s.db.Arbiters().GetByHeight(uint32(elaHeight))
+	if err != nil {
+		return nil, 0, err
+	}
+	return arbitersToProducers(crcArbiters, normalArbitrs)
+}
+
+// Close releases the data store.
+func (s *ArbitersStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,166 @@
+package spv
+
+import (
+	"errors"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/elastos/Elastos.ELA.SPV/util"
+	ethCommon "github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/pledgeBill"
+
+	it "github.com/elastos/Elastos.ELA/core/types/interfaces"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// MainChainBackend is the view of the ELA main chain consumed by the side
+// chain while validating and producing blocks. The live implementation is
+// backed by the spv service and its transaction database; tests can inject
+// a SimulatedMainChain instead.
+type MainChainBackend interface {
+	// GetELAHeader returns the main chain header at the given height.
+	GetELAHeader(height uint32) (*util.Header, error)
+	// BestELAHeader returns the best main chain header known to the backend.
+	BestELAHeader() (*util.Header, error)
+
+	// GetRechargeData returns the recharge outputs and the total cross chain
+	// fee of a main chain deposit transaction.
+	GetRechargeData(elaTx string) (RechargeDatas, *big.Int, error)
+	// FindOutputFeeAndAddress returns the fee, target address and amount of
+	// the first recharge output of a main chain deposit transaction.
+	FindOutputFeeAndAddress(elaTx string) (*big.Int, ethCommon.Address, *big.Int)
+	// UpTransactionIndex queues a main chain deposit transaction for sending.
+	UpTransactionIndex(elaTx string)
+
+	// IsFailedElaTx reports whether the deposit transaction was recorded as failed.
+	IsFailedElaTx(elaTx string) (bool, error)
+	// OnTx2Failed records the deposit transaction as failed.
+	OnTx2Failed(elaTx string)
+
+	// IsSmallCrossTxByData decodes a small cross chain transaction from call data.
+	IsSmallCrossTxByData(data []byte) (string, string, []string, uint64)
+	// VerifySmallCrossTx checks the arbiter signatures of a small cross chain transaction.
+	VerifySmallCrossTx(rawTxID, rawTx string, signatures []string, blockHeight uint64) (bool, error)
+	// NotifySmallCrossTx records a verified small cross chain transaction.
+	NotifySmallCrossTx(tx it.Transaction)
+
+	// GetProducers returns the CR arbiters and the total arbiter count at the
+	// given main chain height.
+	GetProducers(elaHeight uint64) ([][]byte, int, error)
+	// GetArbiters returns the arbiters of the current side chain block.
+	GetArbiters() ([]string, int, error)
+	// IsPowMode reports whether the main chain is running in POW mode.
+	IsPowMode() bool
+	// GetMinGasPrice returns the minimum gas price voted on the main chain.
+	GetMinGasPrice(spvHeight uint32) (*big.Int, error)
+
+	// GetPledgeBillData returns the stake address and NFT token id of a pledge bill.
+	GetPledgeBillData(elaTx string) (string, *big.Int, error)
+	// GetCreateNFTPayload returns the CreateNFT payload of a pledge bill.
+	GetCreateNFTPayload(elaTx string) (*payload.CreateNFT, byte, error)
+	// GetBPosNftPayloadVersion returns the CreateNFT payload version of a pledge bill.
+	GetBPosNftPayloadVersion(elaTx string) (byte, error)
+}
+
+var (
+	errNoSpvService = errors.New("spv service is nil")
+
+	defaultBackend atomic.Value
+)
+
+func init() {
+	defaultBackend.Store(MainChainBackend(&spvBackend{}))
+}
+
+// DefaultMainChain returns the process wide main chain backend. Unless it is
+// replaced with SetDefaultMainChain it is backed by the running spv service.
+func DefaultMainChain() MainChainBackend {
+	return defaultBackend.Load().(MainChainBackend)
+}
+
+// SetDefaultMainChain replaces the process wide main chain backend. Passing
+// nil restores the spv service backed implementation.
+func SetDefaultMainChain(backend MainChainBackend) {
+	if backend == nil {
+		backend = &spvBackend{}
+	}
+	defaultBackend.Store(backend)
+}
+
+// spvBackend implements MainChainBackend on top of the package level spv
+// service and transaction database.
+type spvBackend struct{}
+
+func (b *spvBackend) GetELAHeader(height uint32) (*util.Header, error) {
+	if SpvService == nil {
+		return nil, errNoSpvService
+	}
+	return SpvService.GetELAHeader(height)
+}
+
+func (b *spvBackend) BestELAHeader() (*util.Header, error) {
+	if SpvService == nil {
+		return nil, errNoSpvService
+	}
+	return SpvService.HeaderStore().GetBest()
+}
+
+func (b *spvBackend) GetRechargeData(elaTx string) (RechargeDatas, *big.Int, error) {
+	return GetRechargeDataByTxhash(elaTx)
+}
+
+func (b *spvBackend) FindOutputFeeAndAddress(elaTx string) (*big.Int, ethCommon.Address, *big.Int) {
+	return FindOutputFeeAndaddressByTxHash(elaTx)
+}
+
+func (b *spvBackend) UpTransactionIndex(elaTx string) {
+	UpTransactionIndex(elaTx)
+}
+
+func (b *spvBackend) IsFailedElaTx(elaTx string) (bool, error) {
+	return IsFailedElaTx(elaTx)
+}
+
+func (b *spvBackend) OnTx2Failed(elaTx string) {
+	OnTx2Failed(elaTx)
+}
+
+func (b *spvBackend) IsSmallCrossTxByData(data []byte) (string, string, []string, uint64) {
+	return IsSmallCrossTxByData(data)
+}
+
+func (b *spvBackend) VerifySmallCrossTx(rawTxID, rawTx string, signatures []string, blockHeight uint64) (bool, error) {
+	return VerifySmallCrossTx(rawTxID, rawTx, signatures, blockHeight)
+}
+
+func (b *spvBackend) NotifySmallCrossTx(tx it.Transaction) {
+	NotifySmallCrossTx(tx)
+}
+
+func (b *spvBackend) GetProducers(elaHeight uint64) ([][]byte, int, error) {
+	return GetProducers(elaHeight)
+}
+
+func (b *spvBackend) GetArbiters() ([]string, int, error) {
+	return GetArbiters()
+}
+
+func (b *spvBackend) IsPowMode() bool {
+	return MainChainIsPowMode()
+}
+
+func (b *spvBackend) GetMinGasPrice(spvHeight uint32) (*big.Int, error) {
+	return GetMinGasPrice(spvHeight)
+}
+
+func (b *spvBackend) GetPledgeBillData(elaTx string) (string, *big.Int, error) {
+	return pledgeBill.GetPledgeBillData(elaTx)
+}
+
+func (b *spvBackend) GetCreateNFTPayload(elaTx string) (*payload.CreateNFT, byte, error) {
+	return pledgeBill.GetCreateNFTPayload(elaTx)
+}
+
+func (b *spvBackend) GetBPosNftPayloadVersion(elaTx string) (byte, error) {
+	return pledgeBill.GetBPosNftPayloadVersion(elaTx)
+}
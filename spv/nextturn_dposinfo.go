@@ -56,6 +56,14 @@ func GetProducers(elaHeight uint64) ([][]byte, int, error) {
 	if err != nil {
 		return producers, totalCount, err
 	}
+	return arbitersToProducers(crcArbiters, normalArbitrs)
+}
+
+// arbitersToProducers returns the producers taking part in the side chain
+// consensus among the arbiters of a turn, and the count of the signers the
+// majority is computed from.
+func arbitersToProducers(crcArbiters, normalArbitrs [][]byte) ([][]byte, int, error) {
+	producers := make([][]byte, 0)
 	if IsOnlyCRConsensus {
 		normalArbitrs = make([][]byte, 0)
 	}
@@ -65,7 +73,7 @@ func GetProducers(elaHeight uint64) ([][]byte, int, error) {
 			producers = append(producers, arbiter)
 		}
 	}
-	totalCount, err = SafeAdd(len(crcArbiters), len(normalArbitrs))
+	totalCount, err := SafeAdd(len(crcArbiters), len(normalArbitrs))
 	if err != nil {
 		return nil, totalCount, err
 	}
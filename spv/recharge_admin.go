@@ -0,0 +1,329 @@
+package spv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	ethCommon "github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// rechargeSkipPrefix + elaTx -> rlp(RechargeSkip)
+const rechargeSkipPrefix = "RcK-"
+
+var (
+	errRechargeUnknown  = errors.New("recharge unknown to this node")
+	errRechargePacked   = errors.New("recharge already packed")
+	errRechargeQueued   = errors.New("recharge already queued")
+	errRechargeReported = errors.New("recharge failure already reported to the main chain")
+	errRechargeNotQueue = errors.New("recharge not queued")
+	errNoSkipReason     = errors.New("skip reason required")
+)
+
+// RechargeCursors are the positions of the unprocessed recharge queue. The
+// recharges from Seek up to, but excluding, Index wait to be sent.
+type RechargeCursors struct {
+	Seek  uint64 `json:"seek"`
+	Index uint64 `json:"index"`
+}
+
+// RechargeSkip is the audit record of a recharge removed from the queue by
+// an operator.
+type RechargeSkip struct {
+	Reason string `json:"reason"`
+	Time   uint64 `json:"time"`
+}
+
+// QueuedRecharge is an entry of the unprocessed recharge queue.
+type QueuedRecharge struct {
+	Index     uint64        `json:"index"`
+	ElaTxHash string        `json:"elaTxHash"`
+	Skip      *RechargeSkip `json:"skip,omitempty"`
+}
+
+// FailedRecharge is a recharge recorded as failed at an ESC height.
+type FailedRecharge struct {
+	Height    uint64 `json:"height"`
+	ElaTxHash string `json:"elaTxHash"`
+}
+
+// GetRechargeCursors returns the positions of the unprocessed recharge queue.
+func GetRechargeCursors() (*RechargeCursors, error) {
+	if spvTransactiondb == nil {
+		return nil, errors.New("spvTransactiondb is not inited")
+	}
+	return readRechargeCursors(spvTransactiondb), nil
+}
+
+// ListQueuedRecharges returns at most count recharges waiting in the queue,
+// in sending order.
+func ListQueuedRecharges(count uint64) ([]*QueuedRecharge, error) {
+	if spvTransactiondb == nil {
+		return nil, errors.New("spvTransactiondb is not inited")
+	}
+	return listQueuedRecharges(spvTransactiondb, count), nil
+}
+
+// ListFailedRecharges returns the recharges recorded as failed, by height.
+func ListFailedRecharges() ([]*FailedRecharge, error) {
+	if spvTransactiondb == nil {
+		return nil, errors.New("spvTransactiondb is not inited")
+	}
+	failedMutex.Lock()
+	defer failedMutex.Unlock()
+	return listFailedRecharges(spvTransactiondb), nil
+}
+
+// RequeueRecharge appends a recharge that was dropped from the queue, or
+// recorded as failed, to the queue again, or restores a skipped one in place.
+// Failures reported to the main chain for refund, blockDiff blocks after they
+// were recorded, cannot be requeued.
+func RequeueRecharge(elaTx string, currentHeight uint64) error {
+	if spvTransactiondb == nil {
+		return errors.New("spvTransactiondb is not inited")
+	}
+	elaTx = normalizeElaTx(elaTx)
+	status, err := readRechargeStatus(spvTransactiondb, elaTx)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		return errRechargeUnknown
+	}
+	if packed, _ := IsPackagedElaTx(elaTx); packed || status.State == RechargePacked {
+		return errRechargePacked
+	}
+	if hash, err := common.Uint256FromHexString(elaTx); err != nil {
+		return err
+	} else if SpvService != nil && SpvService.HaveRetSideChainDepositCoinTx(*hash) {
+		return errRechargeReported
+	}
+	muupti.Lock()
+	queued := findQueuedRecharge(spvTransactiondb, elaTx)
+	muupti.Unlock()
+	if queued != nil && queued.Skip == nil {
+		return errRechargeQueued
+	}
+	if err := dropFailedRecharge(spvTransactiondb, elaTx, currentHeight); err != nil {
+		return err
+	}
+	if err := spvTransactiondb.Delete(rechargeSkipKey(elaTx)); err != nil {
+		return err
+	}
+	if queued != nil {
+		markRecharge(elaTx, RechargeQueued, ethCommon.Hash{})
+	} else {
+		UpTransactionIndex(elaTx)
+	}
+	log.Info("Recharge requeued by operator", "elaTx", elaTx, "state", status.State)
+	return nil
+}
+
+// SkipRecharge marks a queued recharge to be passed over by the sender,
+// recording the reason for audit.
+func SkipRecharge(elaTx string, reason string) error {
+	if spvTransactiondb == nil {
+		return errors.New("spvTransactiondb is not inited")
+	}
+	if reason == "" {
+		return errNoSkipReason
+	}
+	elaTx = normalizeElaTx(elaTx)
+
+	muupti.Lock()
+	var err error
+	queued := findQueuedRecharge(spvTransactiondb, elaTx)
+	if queued == nil {
+		err = errRechargeNotQueue
+	} else {
+		err = writeRechargeSkip(spvTransactiondb, elaTx, &RechargeSkip{Reason: reason, Time: uint64(time.Now().Unix())})
+	}
+	muupti.Unlock()
+	if err != nil {
+		return err
+	}
+	markRecharge(elaTx, RechargeSkipped, ethCommon.Hash{})
+	log.Info("Recharge skipped by operator", "elaTx", elaTx, "index", queued.Index, "reason", reason)
+	return nil
+}
+
+// GetRechargeSkip returns the audit record of a skipped recharge, or nil.
+func GetRechargeSkip(elaTx string) *RechargeSkip {
+	if spvTransactiondb == nil {
+		return nil
+	}
+	return readRechargeSkip(spvTransactiondb, normalizeElaTx(elaTx))
+}
+
+func readRechargeCursors(db ethdb.KeyValueReader) *RechargeCursors {
+	cursors := &RechargeCursors{
+		Seek:  GetUnTransactionNum(db, UnTransactionSeek),
+		Index: GetUnTransactionNum(db, UnTransactionIndex),
+	}
+	if cursors.Seek == missingNumber {
+		cursors.Seek = 1
+	}
+	if cursors.Index == missingNumber {
+		cursors.Index = 1
+	}
+	return cursors
+}
+
+func listQueuedRecharges(db ethdb.KeyValueReader, count uint64) []*QueuedRecharge {
+	if count == 0 || count > maxRechargeListCount {
+		count = maxRechargeListCount
+	}
+	cursors := readRechargeCursors(db)
+	list := make([]*QueuedRecharge, 0)
+	for index := cursors.Seek; index < cursors.Index && uint64(len(list)) < count; index++ {
+		data, err := db.Get(unTransactionKey(index))
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		elaTx := normalizeElaTx(string(data))
+		list = append(list, &QueuedRecharge{Index: index, ElaTxHash: elaTx, Skip: readRechargeSkip(db, elaTx)})
+	}
+	return list
+}
+
+// findQueuedRecharge returns the pending queue entry of the recharge, or nil.
+func findQueuedRecharge(db ethdb.KeyValueReader, elaTx string) *QueuedRecharge {
+	cursors := readRechargeCursors(db)
+	for index := cursors.Seek; index < cursors.Index; index++ {
+		data, err := db.Get(unTransactionKey(index))
+		if err != nil || normalizeElaTx(string(data)) != elaTx {
+			continue
+		}
+		return &QueuedRecharge{Index: index, ElaTxHash: elaTx, Skip: readRechargeSkip(db, elaTx)}
+	}
+	return nil
+}
+
+// listFailedRecharges merges the failures kept in memory with the stored
+// ones. The caller must hold failedMutex.
+func listFailedRecharges(db ethdb.Iteratee) []*FailedRecharge {
+	seen := make(map[FailedRecharge]struct{})
+	list := make([]*FailedRecharge, 0)
+	add := func(height uint64, txs []string) {
+		for _, txid := range txs {
+			failed := FailedRecharge{Height: height, ElaTxHash: normalizeElaTx(txid)}
+			if _, ok := seen[failed]; ok {
+				continue
+			}
+			seen[failed] = struct{}{}
+			list = append(list, &failed)
+		}
+	}
+	for height, txs := range failedTxList {
+		add(height, txs)
+	}
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		if len(it.Key()) != 8 {
+			continue
+		}
+		txs, err := decodeTxList(it.Value())
+		if err != nil {
+			continue
+		}
+		add(binary.BigEndian.Uint64(it.Key()), txs)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Height < list[j].Height })
+	return list
+}
+
+// dropFailedRecharge removes the recharge from the failed list unless its
+// failure may already have been refunded.
+func dropFailedRecharge(db ethdb.KeyValueStore, elaTx string, currentHeight uint64) error {
+	failedMutex.Lock()
+	defer failedMutex.Unlock()
+
+	for _, failed := range listFailedRecharges(db) {
+		if failed.ElaTxHash != elaTx {
+			continue
+		}
+		if diff, err := SafeUInt64Minus(currentHeight, failed.Height); err != nil || diff >= blockDiff {
+			return errRechargeReported
+		}
+	}
+	removeFailedTx(db, elaTx)
+	return nil
+}
+
+// removeFailedTx removes the recharge from the failed list, in memory and in
+// the database. The caller must hold failedMutex.
+func removeFailedTx(db ethdb.KeyValueStore, elaTx string) {
+	for height, txs := range failedTxList {
+		for i, txid := range txs {
+			if normalizeElaTx(txid) == elaTx {
+				if len(txs) == 1 {
+					delete(failedTxList, height)
+				} else {
+					failedTxList[height] = append(txs[:i], txs[i+1:]...)
+				}
+				break
+			}
+		}
+	}
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		if len(it.Key()) != 8 {
+			continue
+		}
+		txs, err := decodeTxList(it.Value())
+		if err != nil || len(txs) == 0 {
+			continue
+		}
+		for i, txid := range txs {
+			if normalizeElaTx(txid) == elaTx {
+				if len(txs) == 1 {
+					db.Delete(it.Key())
+				} else {
+					db.Put(it.Key(), encodeTxList(append(txs[:i], txs[i+1:]...)))
+				}
+				break
+			}
+		}
+	}
+}
+
+func readRechargeSkip(db ethdb.KeyValueReader, elaTx string) *RechargeSkip {
+	data, err := db.Get(rechargeSkipKey(elaTx))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	skip := new(RechargeSkip)
+	if err := rlp.DecodeBytes(data, skip); err != nil {
+		log.Error("Invalid recharge skip RLP", "elaTx", elaTx, "err", err)
+		return nil
+	}
+	return skip
+}
+
+func writeRechargeSkip(db ethdb.KeyValueWriter, elaTx string, skip *RechargeSkip) error {
+	data, err := rlp.EncodeToBytes(skip)
+	if err != nil {
+		return err
+	}
+	if err := db.Put(rechargeSkipKey(elaTx), data); err != nil {
+		return fmt.Errorf("store recharge skip: %v", err)
+	}
+	return nil
+}
+
+func rechargeSkipKey(elaTx string) []byte {
+	return []byte(rechargeSkipPrefix + elaTx)
+}
+
+func unTransactionKey(index uint64) []byte {
+	return append([]byte(UnTransaction), encodeUnTransactionNumber(index)...)
+}
@@ -0,0 +1,63 @@
+package spv
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/memorydb"
+)
+
+func TestQueuedRecharges(t *testing.T) {
+	db := memorydb.New()
+	txs := []string{"0xAA01", "aa02", "aa03"}
+	for i, tx := range txs {
+		db.Put(unTransactionKey(uint64(i+1)), []byte(tx))
+	}
+	db.Put([]byte(UnTransactionIndex), encodeUnTransactionNumber(4))
+	db.Put([]byte(UnTransactionSeek), encodeUnTransactionNumber(2))
+
+	if cursors := readRechargeCursors(db); cursors.Seek != 2 || cursors.Index != 4 {
+		t.Fatalf("cursors mismatch: have %+v", cursors)
+	}
+	list := listQueuedRecharges(db, 0)
+	if len(list) != 2 || list[0].ElaTxHash != "aa02" || list[1].Index != 3 {
+		t.Fatalf("queue mismatch: have %v", list)
+	}
+	if queued := findQueuedRecharge(db, "aa01"); queued != nil {
+		t.Fatalf("sent recharge found queued at %d", queued.Index)
+	}
+	if err := writeRechargeSkip(db, "aa03", &RechargeSkip{Reason: "invalid memo", Time: 1}); err != nil {
+		t.Fatal(err)
+	}
+	queued := findQueuedRecharge(db, "aa03")
+	if queued == nil || queued.Skip == nil || queued.Skip.Reason != "invalid memo" {
+		t.Fatalf("skipped recharge mismatch: have %+v", queued)
+	}
+}
+
+func TestDropFailedRecharge(t *testing.T) {
+	db := memorydb.New()
+	failedTxList = map[uint64][]string{
+		100: {"aa01", "aa02"},
+	}
+	defer func() { failedTxList = make(map[uint64][]string) }()
+	db.Put(encodeUnTransactionNumber(100), encodeTxList([]string{"aa01", "aa02"}))
+	db.Put(encodeUnTransactionNumber(90), encodeTxList([]string{"aa03"}))
+
+	if list := listFailedRecharges(db); len(list) != 3 || list[0].ElaTxHash != "aa03" {
+		t.Fatalf("failed list mismatch: have %v", list)
+	}
+	// The failure at 90 may have been refunded at height 100.
+	if err := dropFailedRecharge(db, "aa03", 100); err != errRechargeReported {
+		t.Fatalf("reported failure dropped: %v", err)
+	}
+	if err := dropFailedRecharge(db, "aa02", 100+blockDiff-1); err != nil {
+		t.Fatalf("recent failure not dropped: %v", err)
+	}
+	data, _ := db.Get(encodeUnTransactionNumber(100))
+	if txs, _ := decodeTxList(data); len(txs) != 1 || txs[0] != "aa01" {
+		t.Fatalf("stored failures mismatch: have %v", txs)
+	}
+	if list := listFailedRecharges(db); len(list) != 2 {
+		t.Fatalf("failed list mismatch after drop: have %v", list)
+	}
+}
@@ -0,0 +1,323 @@
+package spv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	ethCommon "github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+)
+
+// RechargeState is a step in the lifecycle of an ELA to ESC recharge.
+type RechargeState uint8
+
+const (
+	// RechargeDetected means the spv service saw the deposit on the main chain.
+	RechargeDetected RechargeState = iota + 1
+	// RechargeQueued means the deposit waits in the unprocessed recharge queue.
+	RechargeQueued
+	// RechargeSubmitted means the recharge transaction was sent to the tx pool.
+	RechargeSubmitted
+	// RechargePacked means the recharge transaction was packed into a block.
+	RechargePacked
+	// RechargeFailed means the recharge was recorded as failed.
+	RechargeFailed
+	// RechargeRetried means the recharge was submitted again after a submit
+	// or a failure.
+	RechargeRetried
+	// RechargeSkipped means an operator removed the recharge from the queue.
+	RechargeSkipped
+)
+
+const (
+	// rechargeStatusPrefix + elaTx -> rlp(RechargeStatus)
+	rechargeStatusPrefix = "RcS-"
+	// rechargeIndexPrefix + sequence (uint64 big endian) -> elaTx
+	rechargeIndexPrefix = "RcI-"
+	// rechargeIndexCount tracks the next recharge sequence number
+	rechargeIndexCount = "RcN"
+
+	// maxRechargeListCount caps the page size of ListRecharges.
+	maxRechargeListCount = 1000
+)
+
+// RechargeEventTopic is the topic of the log added to the black contract when
+// a recharge transaction is packed. Its topics hold the caller, the main chain
+// transaction, the target address and the recharged value.
+var RechargeEventTopic = ethCommon.HexToHash("0x09f15c376272c265d7fcb47bf57d8f84a928195e6ea156d12f5a3cd05b8fed5a")
+
+var (
+	rechargeStateNames = map[RechargeState]string{
+		RechargeDetected:  "detected",
+		RechargeQueued:    "queued",
+		RechargeSubmitted: "submitted",
+		RechargePacked:    "packed",
+		RechargeFailed:    "failed",
+		RechargeRetried:   "retried",
+		RechargeSkipped:   "skipped",
+	}
+
+	errUnknownRechargeState = errors.New("unknown recharge state")
+
+	rechargeStatusMu sync.Mutex
+)
+
+// String implements fmt.Stringer.
+func (s RechargeState) String() string {
+	if name, ok := rechargeStateNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseRechargeState returns the state with the given name.
+func ParseRechargeState(name string) (RechargeState, error) {
+	for state, n := range rechargeStateNames {
+		if n == strings.ToLower(name) {
+			return state, nil
+		}
+	}
+	return 0, errUnknownRechargeState
+}
+
+// RechargeTransition records one state change of a recharge.
+type RechargeTransition struct {
+	State     RechargeState
+	Time      uint64 // unix seconds
+	EscTxHash ethCommon.Hash
+}
+
+// RechargeStatus is the tracked lifecycle of one ELA to ESC recharge.
+type RechargeStatus struct {
+	ElaTxHash string
+	State     RechargeState
+	EscTxHash ethCommon.Hash
+	Retries   uint32
+	Sequence  uint64
+	History   []RechargeTransition
+}
+
+// Time returns when the recharge last entered the given state, or zero.
+func (s *RechargeStatus) Time(state RechargeState) uint64 {
+	for i := len(s.History) - 1; i >= 0; i-- {
+		if s.History[i].State == state {
+			return s.History[i].Time
+		}
+	}
+	return 0
+}
+
+// RechargeFilter selects a page of tracked recharges in detection order.
+type RechargeFilter struct {
+	States []RechargeState // only return recharges in one of these states, all if empty
+	From   uint64          // first sequence number to consider
+	Count  uint64          // maximum number of recharges to return
+}
+
+// GetRechargeStatus returns the tracked lifecycle of a recharge, or nil if
+// the recharge is unknown to this node.
+func GetRechargeStatus(elaTx string) (*RechargeStatus, error) {
+	if spvTransactiondb == nil {
+		return nil, errors.New("spvTransactiondb is not inited")
+	}
+	return readRechargeStatus(spvTransactiondb, normalizeElaTx(elaTx))
+}
+
+// ListRecharges returns the tracked recharges matching the filter, and the
+// sequence number to continue from.
+func ListRecharges(filter RechargeFilter) ([]*RechargeStatus, uint64, error) {
+	if spvTransactiondb == nil {
+		return nil, 0, errors.New("spvTransactiondb is not inited")
+	}
+	return listRecharges(spvTransactiondb, filter)
+}
+
+// MarkRechargePacked records that the recharge was packed by the given ESC
+// transaction, for nodes that learn it from the black contract state.
+func MarkRechargePacked(elaTx string, escTx ethCommon.Hash) {
+	markRecharge(elaTx, RechargePacked, escTx)
+}
+
+// MarkRechargeLogs tracks the recharges whose event log is found in the
+// blocks imported into the canonical chain, so that every node tracks them and
+// not only the producer which packed them. The recharges of the logs removed
+// by a reorganisation go back to submitted.
+func MarkRechargeLogs(logs []*types.Log) {
+	if spvTransactiondb == nil {
+		return
+	}
+	for _, l := range logs {
+		if len(l.Topics) < 3 || l.Topics[0] != RechargeEventTopic {
+			continue
+		}
+		elaTx := hex.EncodeToString(l.Topics[2].Bytes())
+		if l.Removed {
+			if status, _ := GetRechargeStatus(elaTx); status != nil && status.State == RechargePacked {
+				markRecharge(elaTx, RechargeSubmitted, l.TxHash)
+			}
+			continue
+		}
+		onElaTxPacked(elaTx, l.TxHash)
+	}
+}
+
+// markRecharge moves the recharge to the given state. It is a no-op if the
+// spv database is not opened.
+func markRecharge(elaTx string, state RechargeState, escTx ethCommon.Hash) {
+	if spvTransactiondb == nil {
+		return
+	}
+	changed, err := updateRechargeStatus(spvTransactiondb, normalizeElaTx(elaTx), state, escTx, uint64(time.Now().Unix()))
+	if err != nil {
+		log.Warn("update recharge status failed", "elaTx", elaTx, "state", state, "err", err)
+		return
+	}
+	if !changed || SpvService == nil || SpvService.mux == nil {
+		return
+	}
+	switch state {
+	case RechargeDetected:
+		go SpvService.mux.Post(events.CrossChainEvent{Kind: events.RechargeDetected, ElaTxHash: normalizeElaTx(elaTx)})
+	case RechargeFailed:
+		go SpvService.mux.Post(events.CrossChainEvent{Kind: events.RechargeFailed, ElaTxHash: normalizeElaTx(elaTx)})
+	}
+}
+
+// updateRechargeStatus applies a state transition to the stored status,
+// reporting whether the status changed.
+func updateRechargeStatus(db ethdb.KeyValueStore, elaTx string, state RechargeState, escTx ethCommon.Hash, now uint64) (bool, error) {
+	rechargeStatusMu.Lock()
+	defer rechargeStatusMu.Unlock()
+
+	status, err := readRechargeStatus(db, elaTx)
+	if err != nil {
+		return false, err
+	}
+	batch := db.NewBatch()
+	if status == nil {
+		seq := GetUnTransactionNum(db, rechargeIndexCount)
+		if seq == missingNumber {
+			seq = 0
+		}
+		status = &RechargeStatus{ElaTxHash: elaTx, Sequence: seq}
+		if err := batch.Put(rechargeIndexKey(seq), []byte(elaTx)); err != nil {
+			return false, err
+		}
+		if err := batch.Put([]byte(rechargeIndexCount), encodeUnTransactionNumber(seq+1)); err != nil {
+			return false, err
+		}
+	}
+	if !status.apply(state, escTx, now) {
+		return false, nil
+	}
+	data, err := rlp.EncodeToBytes(status)
+	if err != nil {
+		return false, err
+	}
+	if err := batch.Put(rechargeStatusKey(elaTx), data); err != nil {
+		return false, err
+	}
+	return true, batch.Write()
+}
+
+// apply performs a state transition, reporting whether the status changed.
+// A packed recharge only goes back to submitted when the transaction packing
+// it is reorganised out, and detection is only recorded for new recharges.
+func (s *RechargeStatus) apply(state RechargeState, escTx ethCommon.Hash, now uint64) bool {
+	if s.State == RechargePacked && (state != RechargeSubmitted || escTx != s.EscTxHash) {
+		return false
+	}
+	switch state {
+	case RechargeDetected:
+		if s.State != 0 {
+			return false
+		}
+	case RechargeSubmitted:
+		if s.State == RechargeSubmitted || s.State == RechargeFailed || s.State == RechargeRetried {
+			state = RechargeRetried
+			s.Retries++
+		}
+	case RechargeQueued, RechargeFailed:
+		if s.State == state {
+			return false
+		}
+	}
+	s.State = state
+	if escTx != (ethCommon.Hash{}) {
+		s.EscTxHash = escTx
+	}
+	s.History = append(s.History, RechargeTransition{State: state, Time: now, EscTxHash: escTx})
+	return true
+}
+
+func readRechargeStatus(db ethdb.KeyValueReader, elaTx string) (*RechargeStatus, error) {
+	data, err := db.Get(rechargeStatusKey(elaTx))
+	if err != nil || len(data) == 0 {
+		// Both leveldb and memorydb report missing keys as errors.
+		return nil, nil
+	}
+	status := new(RechargeStatus)
+	if err := rlp.DecodeBytes(data, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func listRecharges(db ethdb.KeyValueStore, filter RechargeFilter) ([]*RechargeStatus, uint64, error) {
+	count := filter.Count
+	if count == 0 || count > maxRechargeListCount {
+		count = maxRechargeListCount
+	}
+	it := db.NewIteratorWithStart(rechargeIndexKey(filter.From))
+	defer it.Release()
+
+	list := make([]*RechargeStatus, 0)
+	next := filter.From
+	for it.Next() && uint64(len(list)) < count {
+		if !bytes.HasPrefix(it.Key(), []byte(rechargeIndexPrefix)) {
+			break
+		}
+		next = binary.BigEndian.Uint64(it.Key()[len(rechargeIndexPrefix):]) + 1
+		status, err := readRechargeStatus(db, string(it.Value()))
+		if err != nil {
+			return nil, 0, err
+		}
+		if status != nil && status.matches(filter.States) {
+			list = append(list, status)
+		}
+	}
+	return list, next, it.Error()
+}
+
+func (s *RechargeStatus) matches(states []RechargeState) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, state := range states {
+		if s.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+func rechargeStatusKey(elaTx string) []byte {
+	return []byte(rechargeStatusPrefix + elaTx)
+}
+
+func rechargeIndexKey(seq uint64) []byte {
+	return append([]byte(rechargeIndexPrefix), encodeUnTransactionNumber(seq)...)
+}
+
+func normalizeElaTx(elaTx string) string {
+	return strings.ToLower(strings.TrimPrefix(elaTx, "0x"))
+}
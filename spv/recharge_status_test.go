@@ -0,0 +1,150 @@
+package spv
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	ethCommon "github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/leveldb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/memorydb"
+)
+
+func TestRechargeStatusLifecycle(t *testing.T) {
+	var (
+		db    = memorydb.New()
+		elaTx = "8ce6a6cf62f2bb2fbfd1a8bfdd01c6d59e9cf0cee0fbf4ccbfbab0d26c7a3b4d"
+		first = ethCommon.HexToHash("0x01")
+		retry = ethCommon.HexToHash("0x02")
+	)
+	steps := []struct {
+		state RechargeState
+		escTx ethCommon.Hash
+		want  RechargeState
+	}{
+		{RechargeDetected, ethCommon.Hash{}, RechargeDetected},
+		{RechargeQueued, ethCommon.Hash{}, RechargeQueued},
+		{RechargeSubmitted, first, RechargeSubmitted},
+		{RechargeFailed, ethCommon.Hash{}, RechargeFailed},
+		{RechargeSubmitted, retry, RechargeRetried},
+		{RechargePacked, retry, RechargePacked},
+		{RechargeFailed, ethCommon.Hash{}, RechargePacked},
+		{RechargeDetected, ethCommon.Hash{}, RechargePacked},
+	}
+	for i, step := range steps {
+		if _, err := updateRechargeStatus(db, elaTx, step.state, step.escTx, uint64(i+1)); err != nil {
+			t.Fatalf("step %d: update failed: %v", i, err)
+		}
+		status, err := readRechargeStatus(db, elaTx)
+		if err != nil {
+			t.Fatalf("step %d: read failed: %v", i, err)
+		}
+		if status.State != step.want {
+			t.Errorf("step %d: state mismatch: have %v, want %v", i, status.State, step.want)
+		}
+	}
+	status, _ := readRechargeStatus(db, elaTx)
+	if status.EscTxHash != retry {
+		t.Errorf("esc tx mismatch: have %x, want %x", status.EscTxHash, retry)
+	}
+	if status.Retries != 1 {
+		t.Errorf("retries mismatch: have %d, want 1", status.Retries)
+	}
+	if len(status.History) != 6 {
+		t.Errorf("history length mismatch: have %d, want 6", len(status.History))
+	}
+	if have := status.Time(RechargeSubmitted); have != 3 {
+		t.Errorf("submit time mismatch: have %d, want 3", have)
+	}
+}
+
+func TestListRecharges(t *testing.T) {
+	db := memorydb.New()
+	hashes := []string{"aa", "bb", "cc", "dd", "ee"}
+	for i, hash := range hashes {
+		updateRechargeStatus(db, hash, RechargeDetected, ethCommon.Hash{}, 1)
+		if i%2 == 0 {
+			updateRechargeStatus(db, hash, RechargeFailed, ethCommon.Hash{}, 2)
+		}
+	}
+	list, next, err := listRecharges(db, RechargeFilter{Count: 2})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(list) != 2 || list[0].ElaTxHash != "aa" || list[1].ElaTxHash != "bb" || next != 2 {
+		t.Fatalf("first page mismatch: %d entries, next %d", len(list), next)
+	}
+	list, next, _ = listRecharges(db, RechargeFilter{From: next, Count: 10})
+	if len(list) != 3 || list[0].ElaTxHash != "cc" || next != 5 {
+		t.Fatalf("second page mismatch: %d entries, next %d", len(list), next)
+	}
+	list, _, _ = listRecharges(db, RechargeFilter{States: []RechargeState{RechargeFailed}})
+	if len(list) != 3 {
+		t.Fatalf("failed filter mismatch: have %d, want 3", len(list))
+	}
+	for _, status := range list {
+		if status.State != RechargeFailed {
+			t.Errorf("unexpected state %v for %s", status.State, status.ElaTxHash)
+		}
+	}
+}
+
+func TestMarkPackedRecharges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spv-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := leveldb.New(dir, 16, 16, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	spvTransactiondb = db
+	defer func() { spvTransactiondb = nil }()
+
+	var (
+		packed      = "8ce6a6cf62f2bb2fbfd1a8bfdd01c6d59e9cf0cee0fbf4ccbfbab0d26c7a3b4d"
+		reorged     = "9ce6a6cf62f2bb2fbfd1a8bfdd01c6d59e9cf0cee0fbf4ccbfbab0d26c7a3b4d"
+		escTx       = ethCommon.HexToHash("0x01")
+		rebirth     = ethCommon.HexToHash("0x02")
+		rechargeLog = func(elaTx string, escTx ethCommon.Hash, removed bool) *types.Log {
+			return &types.Log{Topics: []ethCommon.Hash{RechargeEventTopic, {}, ethCommon.HexToHash(elaTx), {}, {}}, TxHash: escTx, Removed: removed}
+		}
+	)
+	markRecharge(packed, RechargeSubmitted, ethCommon.Hash{})
+	markRecharge(reorged, RechargeSubmitted, ethCommon.Hash{})
+
+	MarkRechargeLogs([]*types.Log{
+		rechargeLog(packed, escTx, false),
+		rechargeLog(reorged, escTx, false),
+		{Topics: []ethCommon.Hash{{0x01}, {}, ethCommon.HexToHash(reorged), {}, {}}, TxHash: rebirth},
+	})
+	for _, elaTx := range []string{packed, reorged} {
+		if status, _ := GetRechargeStatus(elaTx); status.State != RechargePacked || status.EscTxHash != escTx {
+			t.Errorf("recharge %s not packed: have %v %x", elaTx, status.State, status.EscTxHash)
+		}
+	}
+	// A recharge whose packing transaction is reorganised out goes back to
+	// submitted, until it is packed again
+	MarkRechargeLogs([]*types.Log{rechargeLog(reorged, escTx, true)})
+	if status, _ := GetRechargeStatus(reorged); status.State != RechargeSubmitted {
+		t.Errorf("recharge state mismatch: have %v, want %v", status.State, RechargeSubmitted)
+	}
+	MarkRechargeLogs([]*types.Log{rechargeLog(reorged, escTx, true)})
+	if status, _ := GetRechargeStatus(reorged); status.State != RechargeSubmitted || status.Retries != 0 {
+		t.Errorf("unpacked recharge changed: have %v, %d retries", status.State, status.Retries)
+	}
+	MarkRechargeLogs([]*types.Log{rechargeLog(reorged, rebirth, false)})
+	if status, _ := GetRechargeStatus(reorged); status.State != RechargePacked || status.EscTxHash != rebirth {
+		t.Errorf("recharge not packed again: have %v %x", status.State, status.EscTxHash)
+	}
+	// Removed logs of another transaction keep the recharge packed
+	MarkRechargeLogs([]*types.Log{rechargeLog(reorged, escTx, true), rechargeLog(packed, rebirth, true)})
+	for elaTx, want := range map[string]ethCommon.Hash{packed: escTx, reorged: rebirth} {
+		if status, _ := GetRechargeStatus(elaTx); status.State != RechargePacked || status.EscTxHash != want {
+			t.Errorf("recharge %s state mismatch: have %v %x", elaTx, status.State, status.EscTxHash)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package spv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/interface/iutil"
+	"github.com/elastos/Elastos.ELA.SPV/util"
+	ethCommon "github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/smallcrosstx"
+
+	"github.com/elastos/Elastos.ELA/common"
+	elacom "github.com/elastos/Elastos.ELA/core/types/common"
+	it "github.com/elastos/Elastos.ELA/core/types/interfaces"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	elaCrypto "github.com/elastos/Elastos.ELA/crypto"
+)
+
+// simulatedBlockTime is the timestamp distance between two simulated main
+// chain blocks, matching the ELA target block time.
+const simulatedBlockTime = 120
+
+var errSimulatedNotFound = errors.New("not found")
+
+type simulatedProducers struct {
+	height    uint32
+	producers [][]byte
+	total     int
+}
+
+type simulatedPledgeBill struct {
+	payload *payload.CreateNFT
+	version byte
+}
+
+// SimulatedMainChain is a deterministic, in-memory ELA main chain which
+// implements MainChainBackend. Headers are only produced by Commit, so the
+// test controlling it decides exactly when main chain data becomes visible.
+type SimulatedMainChain struct {
+	mu sync.RWMutex
+
+	headers     []*util.Header
+	producers   []simulatedProducers // sorted by activation height
+	recharges   map[string]RechargeDatas
+	failed      map[string]struct{}
+	queue       []string
+	smallCross  map[string]struct{}
+	pledgeBills map[string]*simulatedPledgeBill
+	minGasPrice *big.Int
+	powMode     bool
+}
+
+var _ MainChainBackend = (*SimulatedMainChain)(nil)
+
+// NewSimulatedMainChain creates a simulated main chain containing only a
+// genesis header, with the given CR arbiters active from genesis.
+func NewSimulatedMainChain(producers [][]byte) *SimulatedMainChain {
+	m := &SimulatedMainChain{
+		recharges:   make(map[string]RechargeDatas),
+		failed:      make(map[string]struct{}),
+		smallCross:  make(map[string]struct{}),
+		pledgeBills: make(map[string]*simulatedPledgeBill),
+		minGasPrice: new(big.Int),
+	}
+	m.headers = append(m.headers, newSimulatedHeader(nil, 0))
+	m.producers = append(m.producers, simulatedProducers{0, producers, len(producers)})
+	return m
+}
+
+func newSimulatedHeader(parent *util.Header, height uint32) *util.Header {
+	h := &elacom.Header{
+		Version:   0,
+		Height:    height,
+		Timestamp: height * simulatedBlockTime,
+		Bits:      0x1d03ffff,
+		Nonce:     height,
+	}
+	if parent != nil {
+		h.Previous = parent.Hash()
+	}
+	h.MerkleRoot = common.Sha256D(h.Previous[:])
+	return &util.Header{
+		BlockHeader: iutil.NewHeader(h),
+		Height:      height,
+		TotalWork:   new(big.Int).SetUint64(uint64(height) + 1),
+	}
+}
+
+// Commit appends a new main chain block and returns its height.
+func (m *SimulatedMainChain) Commit() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent := m.headers[len(m.headers)-1]
+	header := newSimulatedHeader(parent, parent.Height+1)
+	m.headers = append(m.headers, header)
+	return header.Height
+}
+
+// SetProducers changes the arbiter set from the given main chain height on.
+// total is the arbiter count including normal arbiters, which only take part
+// in the signature threshold.
+func (m *SimulatedMainChain) SetProducers(height uint32, producers [][]byte, total int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.producers = append(m.producers, simulatedProducers{height, producers, total})
+	sort.SliceStable(m.producers, func(i, j int) bool {
+		return m.producers[i].height < m.producers[j].height
+	})
+}
+
+// AddRecharge registers a main chain deposit transaction with its recharge
+// outputs, as the spv listener would after seeing it in a main chain block.
+func (m *SimulatedMainChain) AddRecharge(elaTx string, recharges ...*RechargeData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recharges[trimHexPrefix(elaTx)] = recharges
+}
+
+// AddPledgeBill registers a CreateNFT main chain transaction.
+func (m *SimulatedMainChain) AddPledgeBill(elaTx string, nft *payload.CreateNFT, version byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pledgeBills[trimHexPrefix(elaTx)] = &simulatedPledgeBill{nft, version}
+}
+
+// SetMinGasPrice sets the minimum gas price returned for every height.
+func (m *SimulatedMainChain) SetMinGasPrice(price *big.Int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.minGasPrice = new(big.Int).Set(price)
+}
+
+// SetPowMode switches the simulated main chain between POW and DPOS mode.
+func (m *SimulatedMainChain) SetPowMode(pow bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.powMode = pow
+}
+
+// Queued returns the deposit transactions queued through UpTransactionIndex.
+func (m *SimulatedMainChain) Queued() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string(nil), m.queue...)
+}
+
+// IsSmallCrossTxNotified reports whether NotifySmallCrossTx saw the transaction.
+func (m *SimulatedMainChain) IsSmallCrossTxNotified(elaTx string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.smallCross[trimHexPrefix(elaTx)]
+	return ok
+}
+
+func (m *SimulatedMainChain) GetELAHeader(height uint32) (*util.Header, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if int(height) >= len(m.headers) {
+		return nil, fmt.Errorf("main chain header %d %v", height, errSimulatedNotFound)
+	}
+	return m.headers[height], nil
+}
+
+func (m *SimulatedMainChain) BestELAHeader() (*util.Header, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.headers[len(m.headers)-1], nil
+}
+
+func (m *SimulatedMainChain) GetRechargeData(elaTx string) (RechargeDatas, *big.Int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	elaTx = trimHexPrefix(elaTx)
+	totalFee := new(big.Int)
+	if _, ok := m.failed[elaTx]; ok {
+		return RechargeDatas{}, totalFee, errors.New("is failed elaTx: " + elaTx)
+	}
+	recharges, ok := m.recharges[elaTx]
+	if !ok {
+		return RechargeDatas{}, totalFee, errSimulatedNotFound
+	}
+	datas := make(RechargeDatas, 0, len(recharges))
+	for _, r := range recharges {
+		datas = append(datas, &RechargeData{
+			TargetAddress: r.TargetAddress,
+			TargetAmount:  new(big.Int).Set(r.TargetAmount),
+			Fee:           new(big.Int).Set(r.Fee),
+			TargetData:    ethCommon.CopyBytes(r.TargetData),
+		})
+		totalFee.Add(totalFee, r.Fee)
+	}
+	return datas, totalFee, nil
+}
+
+func (m *SimulatedMainChain) FindOutputFeeAndAddress(elaTx string) (*big.Int, ethCommon.Address, *big.Int) {
+	recharges, _, err := m.GetRechargeData(elaTx)
+	if err != nil || len(recharges) == 0 {
+		return new(big.Int), ethCommon.Address{}, new(big.Int)
+	}
+	return recharges[0].Fee, recharges[0].TargetAddress, recharges[0].TargetAmount
+}
+
+func (m *SimulatedMainChain) UpTransactionIndex(elaTx string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queue = append(m.queue, trimHexPrefix(elaTx))
+}
+
+func (m *SimulatedMainChain) IsFailedElaTx(elaTx string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.failed[trimHexPrefix(elaTx)]
+	return ok, nil
+}
+
+func (m *SimulatedMainChain) OnTx2Failed(elaTx string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failed[trimHexPrefix(elaTx)] = struct{}{}
+}
+
+// IsSmallCrossTxByData decodes small cross chain transactions the same way
+// as the live backend, without requiring a running pbft engine.
+func (m *SimulatedMainChain) IsSmallCrossTxByData(data []byte) (string, string, []string, uint64) {
+	if len(data) < 1024 {
+		return "", "", nil, 0
+	}
+	tx := smallcrosstx.NewSmallCrossTx()
+	if err := tx.Deserialize(bytes.NewBuffer(data)); err != nil {
+		return "", "", nil, 0
+	}
+	if tx.RawTxID == "" || tx.RawTx == "" || tx.BlockHeight == 0 || len(tx.Signatures) == 0 {
+		return "", "", nil, 0
+	}
+	for _, signature := range tx.Signatures {
+		sig, err := hex.DecodeString(signature)
+		if err != nil || len(sig) != elaCrypto.SignatureLength {
+			return "", "", nil, 0
+		}
+	}
+	return tx.RawTxID, tx.RawTx, tx.Signatures, tx.BlockHeight
+}
+
+// VerifySmallCrossTx checks the signatures against the arbiters active at
+// blockHeight, which the simulated chain interprets as a main chain height.
+func (m *SimulatedMainChain) VerifySmallCrossTx(rawTxID, rawTx string, signatures []string, blockHeight uint64) (bool, error) {
+	fee, target, _ := m.FindOutputFeeAndAddress(rawTxID)
+	if fee.Sign() > 0 || target != (ethCommon.Address{}) {
+		return true, nil
+	}
+	arbiters, total, err := m.GetProducers(blockHeight)
+	if err != nil {
+		return false, err
+	}
+	buff, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return false, err
+	}
+	count := 0
+	for _, signature := range signatures {
+		sig, err := hex.DecodeString(signature)
+		if err != nil {
+			continue
+		}
+		for _, pbk := range arbiters {
+			pubKey, err := elaCrypto.DecodePoint(pbk)
+			if err != nil {
+				continue
+			}
+			if elaCrypto.Verify(*pubKey, buff, sig) == nil {
+				count++
+				break
+			}
+		}
+		if count >= smallcrosstx.GetMaxArbitersSign(total) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *SimulatedMainChain) NotifySmallCrossTx(tx it.Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.smallCross[tx.Hash().String()] = struct{}{}
+}
+
+func (m *SimulatedMainChain) GetProducers(elaHeight uint64) ([][]byte, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.powMode {
+		return [][]byte{}, 0, nil
+	}
+	var active *simulatedProducers
+	for i := range m.producers {
+		if uint64(m.producers[i].height) > elaHeight {
+			break
+		}
+		active = &m.producers[i]
+	}
+	if active == nil {
+		return [][]byte{}, 0, errSimulatedNotFound
+	}
+	producers := make([][]byte, 0, len(active.producers))
+	for _, p := range active.producers {
+		producers = append(producers, ethCommon.CopyBytes(p))
+	}
+	return producers, active.total, nil
+}
+
+func (m *SimulatedMainChain) GetArbiters() ([]string, int, error) {
+	best, _ := m.BestELAHeader()
+	list, total, err := m.GetProducers(uint64(best.Height))
+	if err != nil {
+		return []string{}, 0, err
+	}
+	arbiters := make([]string, 0, len(list))
+	for _, p := range list {
+		arbiters = append(arbiters, common.BytesToHexString(p))
+	}
+	return arbiters, total, nil
+}
+
+func (m *SimulatedMainChain) IsPowMode() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.powMode
+}
+
+func (m *SimulatedMainChain) GetMinGasPrice(spvHeight uint32) (*big.Int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return new(big.Int).Set(m.minGasPrice), nil
+}
+
+func (m *SimulatedMainChain) GetPledgeBillData(elaTx string) (string, *big.Int, error) {
+	nft, _, err := m.GetCreateNFTPayload(elaTx)
+	if err != nil {
+		return "", nil, err
+	}
+	elaHash, err := common.Uint256FromHexString(trimHexPrefix(elaTx))
+	if err != nil {
+		return nft.StakeAddress, nil, err
+	}
+	nftID := common.GetNFTID(nft.ReferKey, *elaHash)
+	return nft.StakeAddress, new(big.Int).SetBytes(nftID.Bytes()), nil
+}
+
+func (m *SimulatedMainChain) GetCreateNFTPayload(elaTx string) (*payload.CreateNFT, byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	bill, ok := m.pledgeBills[trimHexPrefix(elaTx)]
+	if !ok {
+		return nil, 0, errSimulatedNotFound
+	}
+	nft := *bill.payload
+	nft.TargetOwnerKey = ethCommon.CopyBytes(bill.payload.TargetOwnerKey)
+	return &nft, bill.version, nil
+}
+
+func (m *SimulatedMainChain) GetBPosNftPayloadVersion(elaTx string) (byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	bill, ok := m.pledgeBills[trimHexPrefix(elaTx)]
+	if !ok {
+		return 0, errSimulatedNotFound
+	}
+	return bill.version, nil
+}
+
+func trimHexPrefix(s string) string {
+	return strings.TrimPrefix(s, "0x")
+}
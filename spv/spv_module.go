@@ -127,8 +127,9 @@ type Config struct {
 
 type Service struct {
 	spv.SPVService
-	GenesisHash common.Uint256
-	mux         *event.TypeMux
+	GenesisHash    common.Uint256
+	GenesisAddress string
+	mux            *event.TypeMux
 }
 
 // Spv database initialization
@@ -143,10 +144,11 @@ func SpvDbInit(spvdataDir string, pledgeBillContract string, signer ethCommon.Ad
 	pledgeBill.Init(db, &transactionDBMutex, pledgeBillContract, signer, ipcClient)
 }
 
-// Spv service initialization
-func NewService(cfg *Config, tmux *event.TypeMux, dynamicArbiterHeight uint64) (*Service, error) {
+// newChainParams returns the parameters of the ELA network to connect with,
+// overridden by the prefer config.
+func newChainParams(activeNet string, spvCfg *spv.Config) *config.Configuration {
 	var chainParams *config.Configuration
-	switch strings.ToLower(cfg.ActiveNet) {
+	switch strings.ToLower(activeNet) {
 	case "testnet", "test", "t":
 		chainParams = config.DefaultParams.TestNet()
 	case "regnet", "reg", "r":
@@ -157,14 +159,20 @@ func NewService(cfg *Config, tmux *event.TypeMux, dynamicArbiterHeight uint64) (
 		chainParams = &config.DefaultParams
 
 	}
+	ResetConfigWithReflect(chainParams, spvCfg)
+	chainParams.Sterilize()
+	return chainParams
+}
+
+// Spv service initialization
+func NewService(cfg *Config, tmux *event.TypeMux, dynamicArbiterHeight uint64) (*Service, error) {
 	spvCfg := &spv.Config{
 		DataDir:             cfg.DataDir,
 		FilterType:          filter.FTReturnSidechainDepositCoinFilter,
 		OnRollback:          nil, // Not implemented yet
 		GenesisBlockAddress: cfg.GenesisAddress,
 	}
-	ResetConfigWithReflect(chainParams, spvCfg)
-	chainParams.Sterilize()
+	chainParams := newChainParams(cfg.ActiveNet, spvCfg)
 	spvCfg.ChainParams = chainParams
 
 	spvCfg.PermanentPeers = chainParams.PermanentPeers
@@ -178,7 +186,8 @@ func NewService(cfg *Config, tmux *event.TypeMux, dynamicArbiterHeight uint64) (
 		return nil, err
 	}
 
-	SpvService = &Service{service, cfg.GenesisHash, tmux}
+	SpvService = &Service{service, cfg.GenesisHash, cfg.GenesisAddress, tmux}
+	pledgeBill.SetEventMux(tmux)
 	err = service.RegisterTransactionListener(&listener{
 		address: cfg.GenesisAddress,
 		service: service,
@@ -427,6 +436,7 @@ func saveOutputPayload(outputs []*elacom.Output, txHash string) error {
 		log.Error("saveOutputPayload Put Input: ", "err", err, "elaHash", txHash)
 	}
 	transactionDBMutex.Unlock()
+	markRecharge(txHash, RechargeDetected, ethCommon.Hash{})
 	if atomic.LoadInt32(&candSend) == 1 {
 		from := GetDefaultSingerAddr()
 		IteratorUnTransaction(from)
@@ -506,6 +516,7 @@ func savePayloadInfo(elaTx it.Transaction, l *listener) {
 	if err != nil {
 		log.Error("SpvServicedb Put Input: ", "err", err, "elaHash", elaTx.Hash().String())
 	}
+	markRecharge(elaTx.Hash().String(), RechargeDetected, ethCommon.Hash{})
 	if atomic.LoadInt32(&candSend) == 1 {
 		from := GetDefaultSingerAddr()
 		IteratorUnTransaction(from)
@@ -551,7 +562,7 @@ func UpTransactionIndex(elaTx string) {
 		return
 	}
 	log.Trace(UnTransactionIndex+"put", "index", index+1)
-
+	markRecharge(elaTx, RechargeQueued, ethCommon.Hash{})
 }
 
 // IteratorUnTransaction iterates before mining and processes existing spv refill transactions
@@ -594,6 +605,11 @@ func IteratorUnTransaction(from ethCommon.Address) {
 				setNextSeek(seek)
 				break
 			}
+			if skip := readRechargeSkip(spvTransactiondb, normalizeElaTx(string(txHash))); skip != nil {
+				log.Info("pass over skipped recharge", "seek", seek, "elaTx", string(txHash), "reason", skip.Reason)
+				setNextSeek(seek)
+				continue
+			}
 			//fee, _, _ := FindOutputFeeAndaddressByTxHash(string(txHash))
 			recharges, fee, err := GetRechargeDataByTxhash(string(txHash))
 			if err != nil || len(recharges) == 0 {
@@ -647,7 +663,7 @@ func SendTransaction(from ethCommon.Address, elaTx string, fee *big.Int) (err er
 	}
 	h := ethCommon.Hash{}
 	if ethCommon.BytesToHash(ethTx) != h {
-		onElaTxPacked(elaTx)
+		onElaTxPacked(elaTx, ethCommon.BytesToHash(ethTx))
 		err = errors.New("Cross-chain transactions have been processed " + elaTx)
 		return err, true
 	}
@@ -733,6 +749,7 @@ func SendTransaction(from ethCommon.Address, elaTx string, fee *big.Int) (err er
 		return err, true
 	}
 	log.Info("Cross chain Transaction", "elaTx", elaTx, "ethTh", hash.String(), "gasLimit", gasLimit, "price.String()", price.String())
+	markRecharge(elaTx, RechargeSubmitted, hash)
 	return nil, true
 }
 
@@ -904,6 +921,7 @@ func OnTx2Failed(elaTx string) {
 	data := encodeTxList(txList)
 	err = spvTransactiondb.Put(encodeUnTransactionNumber(height), data)
 	log.Info("recharge tx failed", "height", height, "tx", elaTx)
+	markRecharge(elaTx, RechargeFailed, ethCommon.Hash{})
 }
 
 func IsPackagedElaTx(elaTx string) (bool, error) {
@@ -917,7 +935,7 @@ func IsPackagedElaTx(elaTx string) (bool, error) {
 	if err == nil {
 		h := ethCommon.Hash{}
 		if ethCommon.BytesToHash(ethTx) != h {
-			onElaTxPacked(elaTx)
+			onElaTxPacked(elaTx, ethCommon.BytesToHash(ethTx))
 			return true, nil
 		}
 	}
@@ -979,51 +997,11 @@ func IsFailedElaTx(elaTx string) (bool, error) {
 	return res, nil
 }
 
-func onElaTxPacked(elaTx string) {
+func onElaTxPacked(elaTx string, escTx ethCommon.Hash) {
+	markRecharge(elaTx, RechargePacked, escTx)
 	failedMutex.Lock()
 	defer failedMutex.Unlock()
-	for height, txs := range failedTxList {
-		for i, txid := range txs {
-			if txid == elaTx {
-				if len(txs) == 1 {
-					delete(failedTxList, height)
-					spvTransactiondb.Delete(encodeUnTransactionNumber(height))
-				} else {
-					txs = append(txs[:i], txs[i+1:]...)
-					data := encodeTxList(txs)
-					spvTransactiondb.Put(encodeUnTransactionNumber(height), data)
-				}
-				break
-			}
-		}
-	}
-
-	it := spvTransactiondb.NewIterator()
-	defer it.Release()
-	for it.Next() {
-		value := it.Value()
-		txs, err := decodeTxList(value)
-		if err != nil {
-			continue
-		}
-		if len(it.Key()) != 8 || len(txs) == 0 {
-			continue
-		}
-		height := binary.BigEndian.Uint64(it.Key())
-		for i, txid := range txs {
-			if txid == elaTx {
-				if len(txs) == 1 {
-					delete(failedTxList, height)
-					spvTransactiondb.Delete(encodeUnTransactionNumber(height))
-				} else {
-					txs = append(txs[:i], txs[i+1:]...)
-					data := encodeTxList(txs)
-					spvTransactiondb.Put(encodeUnTransactionNumber(height), data)
-				}
-				break
-			}
-		}
-	}
+	removeFailedTx(spvTransactiondb, normalizeElaTx(elaTx))
 }
 
 func GetFailedRechargeTxs(height uint64) []string {
@@ -1106,12 +1084,32 @@ func getTxsOnDb(height uint64) []string {
 	return list
 }
 
-func SendEvilProof(addr ethCommon.Address, info interface{}) {
-	log.Info("Send evil Proof", "signer", addr.String())
+func SendEvilProof(addr ethCommon.Address, proof *payload.SidechainIllegalData) {
+	log.Info("Send evil Proof", "signer", addr.String(), "height", proof.Height, "proof", proof.Hash().String())
 	//ToDO connect ela chain
 
 }
 
+// NewSidechainIllegalData builds the main chain illegal evidence payload of a
+// signer that sealed two different side chain blocks at the same height.
+// The arbiter signatures are left to the submitter.
+func NewSidechainIllegalData(signer []byte, height uint64, hash, compare ethCommon.Hash) *payload.SidechainIllegalData {
+	if bytes.Compare(compare[:], hash[:]) < 0 {
+		hash, compare = compare, hash
+	}
+	data := &payload.SidechainIllegalData{
+		IllegalType:     payload.SidechainIllegalProposal,
+		Height:          uint32(height),
+		IllegalSigner:   signer,
+		Evidence:        payload.SidechainIllegalEvidence{DataHash: common.Uint256(hash)},
+		CompareEvidence: payload.SidechainIllegalEvidence{DataHash: common.Uint256(compare)},
+	}
+	if SpvService != nil {
+		data.GenesisBlockAddress = SpvService.GenesisAddress
+	}
+	return data
+}
+
 func GetArbiters() ([]string, int, error) {
 	producers := make([]string, 0)
 	if PbftEngine != nil {
@@ -1243,6 +1241,7 @@ func GetMinGasPrice(spvHeight uint32) (*big.Int, error) {
 
 func Close() {
 	fmt.Println("spv close 111111")
+	pledgeBill.Close()
 	spvdb := SpvService.GetDatabase()
 	if spvdb != nil {
 		fmt.Println("spv close 2222222")
@@ -0,0 +1,243 @@
+package withdrawfailedtx
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/leveldb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/ethdb/memorydb"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/rlp"
+)
+
+const (
+	databaseCache = 16
+	handles       = 16
+
+	// maxRefundListCount caps the refunds returned by one listing.
+	maxRefundListCount = 100
+)
+
+var (
+	refundDb ethdb.KeyValueStore
+	refundMu sync.Mutex
+)
+
+// PendingRefund is the signature collection state of the refund of a failed
+// withdraw transaction, kept until the refund is found complete on chain.
+type PendingRefund struct {
+	Txid       string      `json:"txid"`
+	Signers    []string    `json:"signers"`    // arbiters whose signature was verified, in arrival order
+	Signatures []string    `json:"signatures"` // signatures of the signers
+	Total      uint64      `json:"total"`      // arbiter count when the last signature was verified
+	RefundTx   common.Hash `json:"refundTx"`   // refund transaction sent by this node, if any
+	Executed   bool        `json:"executed"`   // whether the EVM executed the refund, maybe in a block not sealed yet
+	FirstSeen  uint64      `json:"firstSeen"`  // unix time of the first signature
+	LastSeen   uint64      `json:"lastSeen"`   // unix time of the last signature
+}
+
+// openRefundDb opens the database of the refunds collecting signatures, in
+// memory if datadir is empty, and loads the collections not executed yet.
+func openRefundDb(datadir string) error {
+	var db ethdb.KeyValueStore
+	if datadir == "" {
+		db = memorydb.New()
+	} else {
+		ldb, err := leveldb.New(filepath.Join(datadir, "withdraw_refund.db"), databaseCache, handles, "eth/db/withdrawrefund/")
+		if err != nil {
+			return err
+		}
+		db = ldb
+	}
+	it := db.NewIteratorWithPrefix([]byte(FailedTxPre))
+	defer it.Release()
+
+	mulFailedMux.Lock()
+	defer mulFailedMux.Unlock()
+	for it.Next() {
+		refund := new(PendingRefund)
+		if err := rlp.DecodeBytes(it.Value(), refund); err != nil {
+			log.Error("Invalid withdraw refund RLP", "key", string(it.Key()), "err", err)
+			continue
+		}
+		if !refund.Executed {
+			failedTxList[refund.Txid] = refund.Signatures
+			verifiedArbiter[refund.Txid] = refund.Signers
+		}
+	}
+	if err := it.Error(); err != nil {
+		db.Close()
+		return err
+	}
+	refundDb = db
+	log.Info("Loaded withdraw refunds", "count", len(failedTxList))
+	return nil
+}
+
+// Close closes the database of the refunds.
+func Close() {
+	if refundDb != nil {
+		refundDb.Close()
+	}
+}
+
+// GetPendingRefund returns the collection state of the refund of the withdraw
+// transaction, or nil if this node did not receive signatures for it.
+func GetPendingRefund(txid string) *PendingRefund {
+	if refundDb == nil {
+		return nil
+	}
+	return readRefund(refundDb, normalizeTxid(txid))
+}
+
+// ListPendingRefunds returns at most count refunds from offset, oldest first,
+// and the number of refunds listed from. The refunds reported complete are
+// forgotten.
+func ListPendingRefunds(offset, count uint64, complete func(txid string) bool) ([]*PendingRefund, uint64) {
+	if refundDb == nil {
+		return []*PendingRefund{}, 0
+	}
+	refundMu.Lock()
+	defer refundMu.Unlock()
+
+	refunds := listRefunds(refundDb)
+	pending := refunds[:0]
+	for _, refund := range refunds {
+		if complete(refund.Txid) {
+			deleteRefund(refundDb, refund.Txid)
+			continue
+		}
+		pending = append(pending, refund)
+	}
+	total := uint64(len(pending))
+	if count == 0 || count > maxRefundListCount {
+		count = maxRefundListCount
+	}
+	if offset >= total {
+		return []*PendingRefund{}, total
+	}
+	end := offset + count
+	if end > total {
+		end = total
+	}
+	return pending[offset:end], total
+}
+
+// storeRefundSignatures records the signatures verified for the refund.
+func storeRefundSignatures(txid string, signers, signatures []string, total int) {
+	updateRefund(txid, func(refund *PendingRefund) {
+		now := uint64(time.Now().Unix())
+		if refund.FirstSeen == 0 {
+			refund.FirstSeen = now
+		}
+		refund.LastSeen = now
+		refund.Signers = append([]string(nil), signers...)
+		refund.Signatures = append([]string(nil), signatures...)
+		refund.Total = uint64(total)
+		refund.Executed = false
+	})
+}
+
+// storeRefundTx records the refund transaction sent for the withdraw.
+func storeRefundTx(txid string, refundTx common.Hash) {
+	updateRefund(txid, func(refund *PendingRefund) {
+		refund.RefundTx = refundTx
+	})
+}
+
+// markRefundExecuted records that the EVM executed the refund.
+func markRefundExecuted(txid string) {
+	updateRefund(txid, func(refund *PendingRefund) {
+		refund.Executed = true
+	})
+}
+
+// forgetRefund drops the refund found complete on chain.
+func forgetRefund(txid string) {
+	if refundDb == nil {
+		return
+	}
+	refundMu.Lock()
+	defer refundMu.Unlock()
+	deleteRefund(refundDb, normalizeTxid(txid))
+}
+
+func updateRefund(txid string, update func(*PendingRefund)) {
+	if refundDb == nil {
+		return
+	}
+	refundMu.Lock()
+	defer refundMu.Unlock()
+
+	txid = normalizeTxid(txid)
+	refund := readRefund(refundDb, txid)
+	if refund == nil {
+		refund = &PendingRefund{Txid: txid}
+	}
+	update(refund)
+	writeRefund(refundDb, refund)
+}
+
+func readRefund(db ethdb.KeyValueReader, txid string) *PendingRefund {
+	data, err := db.Get(refundKey(txid))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	refund := new(PendingRefund)
+	if err := rlp.DecodeBytes(data, refund); err != nil {
+		log.Error("Invalid withdraw refund RLP", "txid", txid, "err", err)
+		return nil
+	}
+	return refund
+}
+
+func writeRefund(db ethdb.KeyValueWriter, refund *PendingRefund) {
+	data, err := rlp.EncodeToBytes(refund)
+	if err != nil {
+		log.Error("Failed to RLP encode withdraw refund", "txid", refund.Txid, "err", err)
+		return
+	}
+	if err := db.Put(refundKey(refund.Txid), data); err != nil {
+		log.Error("Failed to store withdraw refund", "txid", refund.Txid, "err", err)
+	}
+}
+
+func deleteRefund(db ethdb.KeyValueWriter, txid string) {
+	if err := db.Delete(refundKey(txid)); err != nil {
+		log.Error("Failed to delete withdraw refund", "txid", txid, "err", err)
+	}
+}
+
+// listRefunds returns the stored refunds, oldest first.
+func listRefunds(db ethdb.Iteratee) []*PendingRefund {
+	refunds := make([]*PendingRefund, 0)
+	it := db.NewIteratorWithPrefix([]byte(FailedTxPre))
+	defer it.Release()
+	for it.Next() {
+		refund := new(PendingRefund)
+		if err := rlp.DecodeBytes(it.Value(), refund); err != nil {
+			continue
+		}
+		refunds = append(refunds, refund)
+	}
+	sort.SliceStable(refunds, func(i, j int) bool {
+		if refunds[i].FirstSeen != refunds[j].FirstSeen {
+			return refunds[i].FirstSeen < refunds[j].FirstSeen
+		}
+		return refunds[i].Txid < refunds[j].Txid
+	})
+	return refunds
+}
+
+func refundKey(txid string) []byte {
+	return []byte(FailedTxPre + txid)
+}
+
+func normalizeTxid(txid string) string {
+	return strings.ToLower(strings.TrimPrefix(txid, "0x"))
+}
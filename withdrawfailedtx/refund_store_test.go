@@ -0,0 +1,63 @@
+package withdrawfailedtx
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
+)
+
+func TestRefundStoreRestart(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "withdraw-refund-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+
+	if err := openRefundDb(datadir); err != nil {
+		t.Fatalf("failed to open refund database: %v", err)
+	}
+	storeRefundSignatures("0xAA", []string{"arbiter1"}, []string{"sig1"}, 3)
+	storeRefundSignatures("bb", []string{"arbiter1", "arbiter2"}, []string{"sig1", "sig2"}, 3)
+	storeRefundTx("bb", common.Hash{0x01})
+	storeRefundSignatures("cc", []string{"arbiter3"}, []string{"sig3"}, 3)
+	markRefundExecuted("cc")
+	Close()
+
+	failedTxList = make(map[string][]string)
+	verifiedArbiter = make(map[string][]string)
+	if err := openRefundDb(datadir); err != nil {
+		t.Fatalf("failed to reopen refund database: %v", err)
+	}
+	defer Close()
+
+	// Executed refunds are not collected anymore
+	if have, want := verifiedArbiter, map[string][]string{"aa": {"arbiter1"}, "bb": {"arbiter1", "arbiter2"}}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("signers mismatch: have %v, want %v", have, want)
+	}
+	if have, want := failedTxList["bb"], []string{"sig1", "sig2"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("signatures mismatch: have %v, want %v", have, want)
+	}
+	refund := GetPendingRefund("0xBB")
+	if refund == nil || refund.RefundTx != (common.Hash{0x01}) || refund.Total != 3 || refund.Executed {
+		t.Fatalf("refund mismatch: %+v", refund)
+	}
+	if refund := GetPendingRefund("cc"); refund == nil || !refund.Executed {
+		t.Fatalf("executed refund mismatch: %+v", refund)
+	}
+
+	// Complete refunds are dropped from the listing
+	complete := func(txid string) bool { return txid == "aa" }
+	refunds, total := ListPendingRefunds(1, 1, complete)
+	if total != 2 || len(refunds) != 1 || refunds[0].Txid != "cc" {
+		t.Fatalf("listing mismatch: total %d, refunds %+v", total, refunds)
+	}
+	if GetPendingRefund("aa") != nil {
+		t.Fatalf("complete refund not dropped")
+	}
+	if refunds, total := ListPendingRefunds(5, 0, complete); total != 2 || len(refunds) != 0 {
+		t.Fatalf("listing past the end mismatch: total %d, refunds %+v", total, refunds)
+	}
+}
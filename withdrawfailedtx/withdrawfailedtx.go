@@ -14,6 +14,8 @@ import (
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/accounts/abi"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/common/hexutil"
+	eevents "github.com/elastos/Elastos.ELA.SideChain.ESC/core/events"
+	"github.com/elastos/Elastos.ELA.SideChain.ESC/core/types"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/dpos"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/event"
 	"github.com/elastos/Elastos.ELA.SideChain.ESC/log"
@@ -40,9 +42,14 @@ type FailedWithdrawEvent struct {
 	Txid      string
 }
 
-//Spv database initialization
-func FailedWithrawInit(datadir string, evtMux *event.TypeMux) {
+// FailedWithrawInit opens the database of the refund signatures collected for
+// the failed withdraw transactions, in memory if datadir is empty.
+func FailedWithrawInit(datadir string, evtMux *event.TypeMux) error {
+	if err := openRefundDb(datadir); err != nil {
+		return err
+	}
 	eventMux = evtMux
+	return nil
 }
 
 func OnProcessFaildWithdrawTx(hash string) {
@@ -52,6 +59,7 @@ func OnProcessFaildWithdrawTx(hash string) {
 	if len(failedTxList[hash]) > 0 {
 		delete(failedTxList, hash)
 		delete(verifiedArbiter, hash)
+		markRefundExecuted(hash)
 	}
 }
 
@@ -89,6 +97,7 @@ func ReceivedFailedWithdrawTx(hash string, signature string) error {
 	h := common.Hash{}
 	if common.BytesToHash(txhash) != h {
 		OnProcessFaildWithdrawTx(hash)
+		forgetRefund(hash)
 		return errors.New("all ready refund this amount" + common.BytesToHash(txhash).String())
 	}
 	arbiters, total, err := spv.GetArbiters()
@@ -98,7 +107,7 @@ func ReceivedFailedWithdrawTx(hash string, signature string) error {
 
 	verifiedSigList := failedTxList[hash]
 	verifiedArbiterList := verifiedArbiter[hash]
-	if len(verifiedArbiterList) >= getMaxArbitersSign(total) {
+	if len(verifiedArbiterList) >= GetMaxArbitersSign(total) {
 		return errors.New("all ready received 2/3 signatures")
 	}
 
@@ -107,7 +116,9 @@ func ReceivedFailedWithdrawTx(hash string, signature string) error {
 		verifiedArbiterList = append(verifiedArbiterList, arb)
 		failedTxList[hash] = verifiedSigList
 		verifiedArbiter[hash] = verifiedArbiterList
-		if len(verifiedArbiterList) >= getMaxArbitersSign(total) {
+		storeRefundSignatures(hash, verifiedArbiterList, verifiedSigList, total)
+		broadRefundSignatureEvt(hash, arb, len(verifiedArbiterList))
+		if len(verifiedArbiterList) >= GetMaxArbitersSign(total) {
 			err := SendRefundTx(spv.GetDefaultSingerAddr(), hash)
 			if err != nil {
 				log.Error("SendRefundTx error", "error", err)
@@ -171,6 +182,9 @@ func SendRefundTx(from common.Address, txid string) error {
 	callmsg := ethereum.TXMsg{From: from, To: &common.Address{}, Data: data, Gas: gasLimit, GasPrice: gasPrice}
 	hash, err := client.SendPublicTransaction(context.Background(), callmsg)
 	log.Info("send refund tx", "txHash", hash, "withdrawTx", txid, "gasPrice", gasPrice.Uint64(), "gasLimit", gasLimit)
+	if err == nil {
+		storeRefundTx(txid, hash)
+	}
 	return err
 }
 
@@ -238,7 +252,7 @@ func VerifySignatures(input []byte) bool {
 	txid = txid[2:]
 
 	verifiedArbiterList := verifiedArbiter[txid]
-	if len(verifiedArbiterList) >= getMaxArbitersSign(total) {
+	if len(verifiedArbiterList) >= GetMaxArbitersSign(total) {
 		log.Info("all ready verified refund withdraw tx", "txid", txid)
 		return true
 	}
@@ -260,7 +274,7 @@ func VerifySignatures(input []byte) bool {
 			}
 		}
 		log.Info(">>>> verified true ", "count", count, "arbiter", "txid", txid)
-		if count >= getMaxArbitersSign(total) {
+		if count >= GetMaxArbitersSign(total) {
 			return true
 		}
 	}
@@ -280,8 +294,23 @@ func GetWithdrawTxValue(txid string) (string, *big.Int, error) {
 	if err != nil {
 		return "", value, err
 	}
+	fromAccount, value, err := GetWithdrawValueFromLogs(receipt.Logs)
+	if err != nil {
+		return "", value, err
+	}
+	log.Info("GetWithdrawTxValue", "txid", txid, "value", value.String(), "sender", fromAccount)
+	return fromAccount, value, nil
+}
+
+// GetWithdrawValueFromLogs returns the sender and the amount of the withdraw
+// from the logs of its receipt.
+func GetWithdrawValueFromLogs(logs []*types.Log) (string, *big.Int, error) {
+	value := big.NewInt(0)
 	abiJson := `[{"constant":false,"inputs":[{"name":"_addr","type":"string"},{"name":"_amount","type":"uint256"},{"name":"_fee","type":"uint256"}],"name":"receivePayload","outputs":[],"payable":true,"stateMutability":"payable","type":"function"},{"payable":true,"stateMutability":"payable","type":"fallback"},{"anonymous":false,"inputs":[{"indexed":false,"name":"_addr","type":"string"},{"indexed":false,"name":"_amount","type":"uint256"},{"indexed":false,"name":"_crosschainamount","type":"uint256"},{"indexed":true,"name":"_sender","type":"address"}],"name":"PayloadReceived","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"_sender","type":"address"},{"indexed":false,"name":"_amount","type":"uint256"},{"indexed":true,"name":"_black","type":"address"}],"name":"EtherDeposited","type":"event"}]`
 	contract, err := abi.JSON(strings.NewReader(abiJson))
+	if err != nil {
+		return "", value, err
+	}
 	evtId := contract.Events["PayloadReceived"].ID.String()
 
 	type PayloadReceived struct {
@@ -291,7 +320,7 @@ func GetWithdrawTxValue(txid string) (string, *big.Int, error) {
 	}
 	var ev PayloadReceived
 	var fromAccount string
-	for _, log := range receipt.Logs {
+	for _, log := range logs {
 		if log.Topics[0].String() == evtId {
 			fromAccount = log.Topics[1].String()
 			err := contract.UnpackIntoInterface(&ev, "PayloadReceived", log.Data)
@@ -302,7 +331,6 @@ func GetWithdrawTxValue(txid string) (string, *big.Int, error) {
 			break
 		}
 	}
-	log.Info("GetWithdrawTxValue", "txid", txid, "value", value.String(), "sender", fromAccount)
 	return fromAccount, value, nil
 }
 
@@ -347,7 +375,8 @@ func IsArbiterVerified(txid, arbiter string) bool {
 	return false
 }
 
-func getMaxArbitersSign(total int) int {
+// GetMaxArbitersSign returns the count of arbiter signatures a refund needs.
+func GetMaxArbitersSign(total int) int {
 	return total*2/3 + 1
 }
 
@@ -364,6 +393,19 @@ func broadFailedWithdrawEvt(hash, signature string) {
 	go events.Notify(dpos.ETFailedWithdrawTx, &evt)
 }
 
+func broadRefundSignatureEvt(hash, arbiter string, count int) {
+	if eventMux == nil {
+		return
+	}
+	txHash := common.HexToHash(hash)
+	go eventMux.Post(eevents.CrossChainEvent{
+		Kind:       eevents.WithdrawRefundSignature,
+		EscTxHash:  &txHash,
+		Signer:     arbiter,
+		Signatures: hexutil.Uint(count),
+	})
+}
+
 func IsWithdawFailedTx(input []byte, withdrawAddress string) (bool, string) {
 	if len(input) <= 32 {
 		return false, ""